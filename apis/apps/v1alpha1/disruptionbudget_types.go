@@ -0,0 +1,105 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// DisruptionBudgetSpec defines the pods sharing the budget and the max unavailable or min available of them.
+// Exactly one of MaxUnavailable and MinAvailable is required.
+type DisruptionBudgetSpec struct {
+	// Selector selects pods sharing the budget.
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// NamespaceSelector selects namespaces of pods sharing the budget.
+	// Only pods in the namespace of DisruptionBudget are selected if it is nil,
+	// and pods in all namespaces are selected if it is empty.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// MaxUnavailable is the max number or percentage of selected pods which are unavailable or reserved to disrupt.
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+
+	// MinAvailable is the min number or percentage of selected pods which are available and not reserved to disrupt.
+	MinAvailable *intstr.IntOrString `json:"minAvailable,omitempty"`
+}
+
+// DisruptionBudgetStatus records the disruption slots reserved by PodTransitionRules and PodOpsLifecycle.
+// It is updated with optimistic concurrency, so that the budget is never exceeded by concurrent reservations.
+type DisruptionBudgetStatus struct {
+	// ObservedGeneration is the most recent generation observed by the controller.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// TotalPods is the number of selected pods.
+	TotalPods int32 `json:"totalPods,omitempty"`
+
+	// UnavailablePods is the number of selected pods which are unavailable without reservation.
+	UnavailablePods int32 `json:"unavailablePods,omitempty"`
+
+	// DisruptionsAllowed is the number of pods which can be reserved to disrupt currently.
+	DisruptionsAllowed int32 `json:"disruptionsAllowed,omitempty"`
+
+	// Reservations are the disruption slots reserved by pods.
+	Reservations []DisruptionReservation `json:"reservations,omitempty"`
+}
+
+// DisruptionReservation is a disruption slot reserved by a pod
+type DisruptionReservation struct {
+	// Pod is the namespace/name of the pod.
+	Pod string `json:"pod"`
+
+	// Holder is the component reserving the slot, e.g. PodTransitionRule/namespace/name or PodOpsLifecycle.
+	Holder string `json:"holder,omitempty"`
+
+	// ReserveTime is the time when the slot is reserved.
+	ReserveTime metav1.Time `json:"reserveTime,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=kdb
+// +kubebuilder:printcolumn:name="MAX_UNAVAILABLE",type="string",JSONPath=".spec.maxUnavailable"
+// +kubebuilder:printcolumn:name="MIN_AVAILABLE",type="string",JSONPath=".spec.minAvailable"
+// +kubebuilder:printcolumn:name="TOTAL",type="integer",JSONPath=".status.totalPods"
+// +kubebuilder:printcolumn:name="ALLOWED",type="integer",JSONPath=".status.disruptionsAllowed"
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+
+// DisruptionBudget is a budget of disruption shared by PodTransitionRules and PodOpsLifecycle,
+// which limits the unavailable pods selected across namespaces and rules.
+type DisruptionBudget struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DisruptionBudgetSpec   `json:"spec,omitempty"`
+	Status DisruptionBudgetStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DisruptionBudgetList contains a list of DisruptionBudget
+type DisruptionBudgetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DisruptionBudget `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&DisruptionBudget{}, &DisruptionBudgetList{})
+}
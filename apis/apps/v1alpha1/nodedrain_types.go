@@ -0,0 +1,150 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// NodeDrainSpec defines the node to drain
+type NodeDrainSpec struct {
+	// NodeName is the name of node to drain. The node is cordoned before its pods are drained,
+	// and is left cordoned after the drain succeeds.
+	NodeName string `json:"nodeName"`
+
+	// Force drains pods not managed by any controller by eviction. Such pods are not recreated once evicted,
+	// so they are marked Failed and left on the node unless forced, like kubectl drain does.
+	Force bool `json:"force,omitempty"`
+
+	// TimeoutSeconds is the timeout of draining each pod. A pod not drained in time is marked Failed,
+	// and the NodeDrain is Failed after other pods are drained. No timeout if not set.
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+}
+
+type NodeDrainPhase string
+
+const (
+	NodeDrainPhaseDraining  NodeDrainPhase = "Draining"
+	NodeDrainPhaseSucceeded NodeDrainPhase = "Succeeded"
+	NodeDrainPhaseFailed    NodeDrainPhase = "Failed"
+)
+
+// NodeDrainAction is how a pod is drained from the node
+type NodeDrainAction string
+
+const (
+	// NodeDrainActionReplace replaces the pod of CollaSet with a new pod on other nodes, so that capacity is kept.
+	NodeDrainActionReplace NodeDrainAction = "Replace"
+	// NodeDrainActionDelete deletes the pod through the delete lifecycle of PodOpsLifecycle.
+	NodeDrainActionDelete NodeDrainAction = "Delete"
+	// NodeDrainActionEvict evicts the pod not managed by PodOpsLifecycle through Eviction API, respecting PodDisruptionBudgets.
+	NodeDrainActionEvict NodeDrainAction = "Evict"
+)
+
+type NodeDrainProgress string
+
+const (
+	NodeDrainProgressProcessing NodeDrainProgress = "Processing"
+	NodeDrainProgressSucceeded  NodeDrainProgress = "Succeeded"
+	NodeDrainProgressFailed     NodeDrainProgress = "Failed"
+)
+
+// NodeDrainStatus records the progress of draining pods on the node
+type NodeDrainStatus struct {
+	// ObservedGeneration is the most recent generation observed by the controller.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Phase is Draining until all pods are drained, or Failed if the node is not found or any pod fails to drain.
+	Phase NodeDrainPhase `json:"phase,omitempty"`
+
+	// Message tells why the drain is failed.
+	Message string `json:"message,omitempty"`
+
+	// StartTime is the time when the node is cordoned.
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// EndTime is the time when all pods are drained or failed.
+	EndTime *metav1.Time `json:"endTime,omitempty"`
+
+	// TotalPods is the number of pods to drain.
+	TotalPods int32 `json:"totalPods,omitempty"`
+
+	// SucceededPods is the number of pods drained.
+	SucceededPods int32 `json:"succeededPods,omitempty"`
+
+	// FailedPods is the number of pods failed to drain, e.g. unmanaged pods or pods timed out.
+	FailedPods int32 `json:"failedPods,omitempty"`
+
+	// TargetDetails are the progress of draining each pod.
+	TargetDetails []NodeDrainTargetDetail `json:"targetDetails,omitempty"`
+}
+
+// NodeDrainTargetDetail is the progress of draining a pod
+type NodeDrainTargetDetail struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	// UID tells the pod apart from a new pod with the same name.
+	UID types.UID `json:"uid,omitempty"`
+
+	Action   NodeDrainAction   `json:"action,omitempty"`
+	Progress NodeDrainProgress `json:"progress,omitempty"`
+
+	// ReplaceNewPod is the name of the new pod replacing it, if the action is Replace.
+	ReplaceNewPod string `json:"replaceNewPod,omitempty"`
+
+	// Reason and Message tell why the pod is not drained yet or failed, e.g. the eviction is rejected.
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+	EndTime   *metav1.Time `json:"endTime,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster,shortName=nd
+// +kubebuilder:printcolumn:name="NODE",type="string",JSONPath=".spec.nodeName"
+// +kubebuilder:printcolumn:name="PHASE",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="TOTAL",type="integer",JSONPath=".status.totalPods"
+// +kubebuilder:printcolumn:name="SUCCEEDED",type="integer",JSONPath=".status.succeededPods"
+// +kubebuilder:printcolumn:name="FAILED",type="integer",JSONPath=".status.failedPods"
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+
+// NodeDrain cordons a node and drains its pods through PodOpsLifecycle, so that PodTransitionRules and
+// traffic draining are respected. Pods of CollaSet are replaced, and other pods are deleted.
+type NodeDrain struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   NodeDrainSpec   `json:"spec,omitempty"`
+	Status NodeDrainStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// NodeDrainList contains a list of NodeDrain
+type NodeDrainList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NodeDrain `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NodeDrain{}, &NodeDrainList{})
+}
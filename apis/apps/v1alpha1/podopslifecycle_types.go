@@ -0,0 +1,134 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+)
+
+// Stages of PodOpsLifecycle which may be stuck and timed out
+const (
+	// PodOpsLifecycleStagePreparing lasts from the beginning of lifecycle until the pod is permitted to operate,
+	// including waiting for PodTransitionRules of PreCheck stage and protection finalizers.
+	PodOpsLifecycleStagePreparing = "Preparing"
+	// PodOpsLifecycleStageCompleting lasts from the end of operation until the lifecycle is finished,
+	// including waiting for PodTransitionRules of PostCheck stage and expected finalizers.
+	PodOpsLifecycleStageCompleting = "Completing"
+)
+
+// PodOpsLifecycleStageTimeoutCondition is set to true on pod status if any stage of its lifecycles is timed out,
+// and reset to false after all lifecycles are finished.
+const PodOpsLifecycleStageTimeoutCondition corev1.PodConditionType = "PodOpsLifecycleStageTimeout"
+
+// PodTransitionRuleStageTimeoutAnnoKey is annotated on PodTransitionRule to time out stuck stages of PodOpsLifecycle
+// on its target pods, in the format of json PodOpsLifecycleStageTimeout.
+const PodTransitionRuleStageTimeoutAnnoKey = "podtransitionrule.kusionstack.io/stage-timeout"
+
+type StageTimeoutAction string
+
+const (
+	// StageTimeoutActionFail marks the lifecycle failed by events and pod condition, and leaves it as it is.
+	// It is the default action.
+	StageTimeoutActionFail StageTimeoutAction = "Fail"
+	// StageTimeoutActionForcePass passes the stage regardless of PodTransitionRules and finalizers
+	StageTimeoutActionForcePass StageTimeoutAction = "ForcePass"
+	// StageTimeoutActionCancel cancels the lifecycle by the undo label, as CancelOpsLifecycle does. It only works in Preparing stage,
+	// since the operation has been done in Completing stage, where it falls back to Fail.
+	StageTimeoutActionCancel StageTimeoutAction = "Cancel"
+)
+
+// PodOpsLifecycleStageTimeout defines how long a lifecycle can stay in each stage, and what to do on expiry.
+// Stages without timeout never expire.
+type PodOpsLifecycleStageTimeout struct {
+	// Preparing is the timeout of Preparing stage, like 30m. It counts from the beginning of lifecycle, i.e. the
+	// operating label, rather than the preparing label, so that lifecycles stuck in PreCheck are timed out as well.
+	Preparing *metav1.Duration `json:"preparing,omitempty"`
+	// Completing is the timeout of Completing stage, like 30m. It counts from the operated label.
+	Completing *metav1.Duration `json:"completing,omitempty"`
+	// Action is taken when any stage is timed out. Default is Fail.
+	Action StageTimeoutAction `json:"action,omitempty"`
+}
+
+// GetStageTimeout returns the timeout of stage, or nil if not set.
+func (t *PodOpsLifecycleStageTimeout) GetStageTimeout(stage string) *metav1.Duration {
+	if t == nil {
+		return nil
+	}
+	switch stage {
+	case PodOpsLifecycleStagePreparing:
+		return t.Preparing
+	case PodOpsLifecycleStageCompleting:
+		return t.Completing
+	}
+	return nil
+}
+
+// GetAction returns the action on expiry, with default value.
+func (t *PodOpsLifecycleStageTimeout) GetAction() StageTimeoutAction {
+	if t == nil || t.Action == "" {
+		return StageTimeoutActionFail
+	}
+	return t.Action
+}
+
+// GetTransitionRuleStageTimeout parses stage timeout annotated on PodTransitionRule, or returns nil if not set.
+func GetTransitionRuleStageTimeout(rs *appsv1alpha1.PodTransitionRule) (*PodOpsLifecycleStageTimeout, error) {
+	if rs.Annotations == nil || rs.Annotations[PodTransitionRuleStageTimeoutAnnoKey] == "" {
+		return nil, nil
+	}
+	timeout := &PodOpsLifecycleStageTimeout{}
+	if err := json.Unmarshal([]byte(rs.Annotations[PodTransitionRuleStageTimeoutAnnoKey]), timeout); err != nil {
+		return nil, fmt.Errorf("fail to parse annotation %s: %s", PodTransitionRuleStageTimeoutAnnoKey, err)
+	}
+	return timeout, nil
+}
+
+// ValidateStageTimeout returns error if the action is unknown or any timeout is not positive.
+func ValidateStageTimeout(t *PodOpsLifecycleStageTimeout) error {
+	if t == nil {
+		return nil
+	}
+	switch t.GetAction() {
+	case StageTimeoutActionFail, StageTimeoutActionForcePass, StageTimeoutActionCancel:
+	default:
+		return fmt.Errorf("unknown action %s, should be one of %s, %s and %s",
+			t.Action, StageTimeoutActionFail, StageTimeoutActionForcePass, StageTimeoutActionCancel)
+	}
+	for _, stage := range []string{PodOpsLifecycleStagePreparing, PodOpsLifecycleStageCompleting} {
+		if d := t.GetStageTimeout(stage); d != nil && d.Duration <= 0 {
+			return fmt.Errorf("timeout of stage %s should be positive", stage)
+		}
+	}
+	return nil
+}
+
+// PodEndpointSliceDrainAnnoKey is annotated on pod to drain its traffic before it passes PreCheck stage. The pod
+// is set not ready by the service-ready readiness gate, and waits until it is marked not ready or removed in
+// EndpointSlices of all Services selecting it, except Services publishing not ready addresses. The value is the
+// extra drain delay since the pod is set not ready, like 10s, and 0s for no delay.
+const PodEndpointSliceDrainAnnoKey = "podopslifecycle.kusionstack.io/endpointslice-drain"
+
+// PodOpsLifecycleEnabledLabelKey is labeled with "true" on pods of native workloads, like Deployment and StatefulSet,
+// to manage them by PodOpsLifecycle without a KusionStack controller. Their deletions are intercepted to begin a
+// delete lifecycle, and the pods are deleted by kuperator after traffic is turned off and PodTransitionRules pass.
+const PodOpsLifecycleEnabledLabelKey = "podopslifecycle.kusionstack.io/enabled"
@@ -0,0 +1,168 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	// PodOpsLifecycleHooksAnnoKey is annotated on CollaSet or OperationJob to declare hooks of lifecycles it begins
+	// on pods, in the format of json PodOpsLifecycleHooks. Hooks are loaded from the CollaSet owning the pod or the
+	// OperationJob targeting it when they run, and never from the pod, so that pod writers can not inject commands.
+	PodOpsLifecycleHooksAnnoKey = "podopslifecycle.kusionstack.io/hooks"
+
+	// PodOpsLifecycleHookStatusAnnoPrefix is annotated on pod with the lifecycle ID, like hook-status.podopslifecycle.kusionstack.io/<id>,
+	// to record the progress of hooks in the format of json []LifecycleHookStatus.
+	PodOpsLifecycleHookStatusAnnoPrefix = "hook-status.podopslifecycle.kusionstack.io"
+)
+
+// PodOpsLifecycleHooks are hooks run on pod in stages of PodOpsLifecycle. Hooks of a stage run one by one in order,
+// and the stage waits until all of them succeed, like the checks of PodTransitionRules.
+type PodOpsLifecycleHooks struct {
+	// Preparing hooks run when the pod enters Preparing stage, before its traffic is turned off.
+	Preparing []LifecycleHook `json:"preparing,omitempty"`
+	// Completing hooks run when the pod enters Completing stage, before its traffic is turned on.
+	Completing []LifecycleHook `json:"completing,omitempty"`
+}
+
+// LifecycleHook is an action run on pod. Exactly one of Exec and HTTPGet should be set.
+type LifecycleHook struct {
+	// Name is unique among hooks of the same stage.
+	Name string `json:"name"`
+	// Exec runs a command in a container of pod. The hook succeeds if the command exits with 0.
+	Exec *ExecHookAction `json:"exec,omitempty"`
+	// HTTPGet calls an HTTP endpoint on pod IP. The hook succeeds if the response code is in [200, 400).
+	HTTPGet *HTTPGetHookAction `json:"httpGet,omitempty"`
+	// TimeoutSeconds is the timeout of each attempt. Default is 10.
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+}
+
+type ExecHookAction struct {
+	// Container is the name of container to run command in.
+	Container string `json:"container"`
+	// Command is run without a shell, like lifecycle handlers of container.
+	// It is waited at most TimeoutSeconds of hook, then the stream is closed and the attempt fails.
+	Command []string `json:"command"`
+}
+
+type HTTPGetHookAction struct {
+	// Port is the port number on pod IP.
+	Port int32 `json:"port"`
+	// Path is the path of request, like /deregister
+	Path string `json:"path,omitempty"`
+	// Scheme is HTTP or HTTPS. Default is HTTP.
+	Scheme corev1.URIScheme `json:"scheme,omitempty"`
+}
+
+type LifecycleHookPhase string
+
+const (
+	LifecycleHookPhaseRunning   LifecycleHookPhase = "Running"
+	LifecycleHookPhaseSucceeded LifecycleHookPhase = "Succeeded"
+	LifecycleHookPhaseFailed    LifecycleHookPhase = "Failed"
+)
+
+// LifecycleHookStatus is the progress of a hook. A hook is recorded as Running before each attempt,
+// and failed hooks are retried until succeeded.
+type LifecycleHookStatus struct {
+	Name          string             `json:"name"`
+	Stage         string             `json:"stage"`
+	Phase         LifecycleHookPhase `json:"phase"`
+	Attempts      int32              `json:"attempts,omitempty"`
+	Message       string             `json:"message,omitempty"`
+	LastProbeTime metav1.Time        `json:"lastProbeTime,omitempty"`
+}
+
+// GetStageHooks returns the hooks of stage.
+func (h *PodOpsLifecycleHooks) GetStageHooks(stage string) []LifecycleHook {
+	if h == nil {
+		return nil
+	}
+	switch stage {
+	case PodOpsLifecycleStagePreparing:
+		return h.Preparing
+	case PodOpsLifecycleStageCompleting:
+		return h.Completing
+	}
+	return nil
+}
+
+// GetTimeoutSeconds returns the timeout of each attempt, with default value.
+func (h *LifecycleHook) GetTimeoutSeconds() int32 {
+	if h.TimeoutSeconds <= 0 {
+		return 10
+	}
+	return h.TimeoutSeconds
+}
+
+// ParseLifecycleHooks parses hooks in the format of json PodOpsLifecycleHooks, or returns nil if value is empty.
+func ParseLifecycleHooks(value string) (*PodOpsLifecycleHooks, error) {
+	if value == "" {
+		return nil, nil
+	}
+	hooks := &PodOpsLifecycleHooks{}
+	if err := json.Unmarshal([]byte(value), hooks); err != nil {
+		return nil, fmt.Errorf("fail to parse lifecycle hooks: %s", err)
+	}
+	return hooks, nil
+}
+
+// ValidateLifecycleHooks returns error if any hook is unnamed, duplicated in a stage, or has no exactly one action.
+func ValidateLifecycleHooks(h *PodOpsLifecycleHooks) error {
+	if h == nil {
+		return nil
+	}
+	for _, stage := range []string{PodOpsLifecycleStagePreparing, PodOpsLifecycleStageCompleting} {
+		names := sets.NewString()
+		for _, hook := range h.GetStageHooks(stage) {
+			if hook.Name == "" {
+				return fmt.Errorf("name of hook in stage %s should not be empty", stage)
+			}
+			if names.Has(hook.Name) {
+				return fmt.Errorf("hook %s exists multiple times in stage %s", hook.Name, stage)
+			}
+			names.Insert(hook.Name)
+
+			if (hook.Exec == nil) == (hook.HTTPGet == nil) {
+				return fmt.Errorf("hook %s should have exactly one of exec and httpGet", hook.Name)
+			}
+			if hook.Exec != nil && (hook.Exec.Container == "" || len(hook.Exec.Command) == 0) {
+				return fmt.Errorf("exec of hook %s should have container and command", hook.Name)
+			}
+			if hook.HTTPGet != nil {
+				if hook.HTTPGet.Port <= 0 || hook.HTTPGet.Port > 65535 {
+					return fmt.Errorf("port of hook %s should be in range (0, 65535]", hook.Name)
+				}
+				switch hook.HTTPGet.Scheme {
+				case "", corev1.URISchemeHTTP, corev1.URISchemeHTTPS:
+				default:
+					return fmt.Errorf("scheme of hook %s should be %s or %s", hook.Name, corev1.URISchemeHTTP, corev1.URISchemeHTTPS)
+				}
+			}
+			if hook.TimeoutSeconds < 0 {
+				return fmt.Errorf("timeout of hook %s should not be negative", hook.Name)
+			}
+		}
+	}
+	return nil
+}
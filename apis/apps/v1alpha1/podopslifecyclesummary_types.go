@@ -0,0 +1,104 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PodOpsLifecycleSummaryStatus summarizes the lifecycles in flight on a pod, and what is blocking them.
+type PodOpsLifecycleSummaryStatus struct {
+	// ObservedPodResourceVersion is the resource version of pod the summary is built from.
+	ObservedPodResourceVersion string `json:"observedPodResourceVersion,omitempty"`
+
+	// Lifecycles are the lifecycles on the pod, sorted by ID.
+	Lifecycles []LifecycleSummary `json:"lifecycles,omitempty"`
+
+	// BlockingRules are the rules of PodTransitionRules rejecting the pod. Rejections in audit mode are excluded.
+	BlockingRules []BlockingRule `json:"blockingRules,omitempty"`
+
+	// PendingProtectionFinalizers are the protection finalizers blocking the pod from operating.
+	PendingProtectionFinalizers []string `json:"pendingProtectionFinalizers,omitempty"`
+
+	// PendingExpectedFinalizers are the expected finalizers not satisfied yet, blocking lifecycles from finishing,
+	// in the map from the key of employer to the finalizer.
+	PendingExpectedFinalizers map[string]string `json:"pendingExpectedFinalizers,omitempty"`
+
+	// LastUpdateTime is the last time the summary is changed.
+	LastUpdateTime *metav1.Time `json:"lastUpdateTime,omitempty"`
+}
+
+// LifecycleSummary is the state of a lifecycle on pod
+type LifecycleSummary struct {
+	// ID is the operating ID of the lifecycle.
+	ID string `json:"id"`
+
+	// OperationType is the operation type of the lifecycle, e.g. update, scale-in and delete.
+	OperationType string `json:"operationType,omitempty"`
+
+	// Stage is the latest step the lifecycle reached, named after the lifecycle label, e.g. PreCheck, Preparing,
+	// Operate, PostCheck and Completing. It is Canceling if the lifecycle is being canceled.
+	Stage string `json:"stage,omitempty"`
+
+	// StageEntries are the steps the lifecycle has entered, with the time recorded in lifecycle labels.
+	StageEntries []StageEntry `json:"stageEntries,omitempty"`
+}
+
+// StageEntry is a step of lifecycle and when it is entered
+type StageEntry struct {
+	Stage string `json:"stage"`
+	// EnterTime is nil if the label of the step does not record time.
+	EnterTime *metav1.Time `json:"enterTime,omitempty"`
+}
+
+// BlockingRule is a rule of PodTransitionRule rejecting the pod
+type BlockingRule struct {
+	PodTransitionRule string `json:"podTransitionRule"`
+	Stage             string `json:"stage,omitempty"`
+	RuleName          string `json:"ruleName,omitempty"`
+	Reason            string `json:"reason,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=opssummary
+// +kubebuilder:printcolumn:name="TYPES",type="string",JSONPath=".status.lifecycles[*].operationType"
+// +kubebuilder:printcolumn:name="STAGES",type="string",JSONPath=".status.lifecycles[*].stage"
+// +kubebuilder:printcolumn:name="BLOCKING_RULES",type="string",JSONPath=".status.blockingRules[*].ruleName"
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+
+// PodOpsLifecycleSummary summarizes PodOpsLifecycle of the pod with the same name, to tell what is blocking it.
+// It is owned by the pod, and deleted after all lifecycles on the pod are finished.
+type PodOpsLifecycleSummary struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status PodOpsLifecycleSummaryStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// PodOpsLifecycleSummaryList contains a list of PodOpsLifecycleSummary
+type PodOpsLifecycleSummaryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PodOpsLifecycleSummary `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PodOpsLifecycleSummary{}, &PodOpsLifecycleSummaryList{})
+}
@@ -0,0 +1,347 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+)
+
+// PodTransitionRuleExtensionsAnnoKey is annotated on PodTransitionRule to define rules not supported by
+// TransitionRuleDefinition, in the format of json map from rule name to TransitionRuleExtension.
+// The rule in spec.rules with the same name is expected to leave its definition empty.
+const PodTransitionRuleExtensionsAnnoKey = "podtransitionrule.kusionstack.io/rule-extensions"
+
+// TransitionRuleExtension defines the built-in rules besides TransitionRuleDefinition.
+// Only one of them is expected to be set.
+type TransitionRuleExtension struct {
+	// MetricsCheck passes pods if the result of metrics query meets the threshold
+	MetricsCheck *TransitionRuleMetricsCheck `json:"metricsCheck,omitempty"`
+	// TimeWindow passes pods only inside maintenance time windows
+	TimeWindow *TransitionRuleTimeWindow `json:"timeWindow,omitempty"`
+	// RateLimit passes at most limit pods in a sliding period
+	RateLimit *TransitionRuleRateLimit `json:"rateLimit,omitempty"`
+	// TopologyAvailable evaluates available policy in each topology domain of nodes
+	TopologyAvailable *TransitionRuleTopologyAvailable `json:"topologyAvailable,omitempty"`
+	// Dependency passes pods only if the workloads they depend on are ready and not updating
+	Dependency *TransitionRuleDependency `json:"dependency,omitempty"`
+	// Expression passes pods on which the CEL expression evaluates to true
+	Expression *TransitionRuleExpression `json:"expression,omitempty"`
+	// DisruptionBudget passes pods which reserve slots of the shared DisruptionBudget
+	DisruptionBudget *TransitionRuleDisruptionBudget `json:"disruptionBudget,omitempty"`
+}
+
+type MetricsCheckOperator string
+
+const (
+	MetricsCheckOperatorLessThan         MetricsCheckOperator = "<"
+	MetricsCheckOperatorLessThanEqual    MetricsCheckOperator = "<="
+	MetricsCheckOperatorGreaterThan      MetricsCheckOperator = ">"
+	MetricsCheckOperatorGreaterThanEqual MetricsCheckOperator = ">="
+	MetricsCheckOperatorEqual            MetricsCheckOperator = "=="
+	MetricsCheckOperatorNotEqual         MetricsCheckOperator = "!="
+)
+
+type MetricsCheckNoDataPolicy string
+
+const (
+	// MetricsCheckNoDataReject rejects pods if the query returns no data. It is the default policy.
+	MetricsCheckNoDataReject MetricsCheckNoDataPolicy = "Reject"
+	MetricsCheckNoDataPass   MetricsCheckNoDataPolicy = "Pass"
+)
+
+// TransitionRuleMetricsCheck evaluates a PromQL query against a Prometheus-compatible HTTP API.
+type TransitionRuleMetricsCheck struct {
+	// Address is the base url of Prometheus-compatible HTTP API, like http://prometheus:9090
+	Address string `json:"address"`
+	// CABundle is a PEM encoded CA bundle in base64 to verify the server certificate
+	CABundle string `json:"caBundle,omitempty"`
+
+	// Query is a PromQL template rendered by text/template with parameters of each pod,
+	// like error_rate{shard="{{ .shard }}"}
+	Query string `json:"query"`
+	// Parameters are extracted from pod and used to render query
+	Parameters []appsv1alpha1.Parameter `json:"parameters,omitempty"`
+
+	// Operator compares each sample of query result with Threshold, like "<"
+	Operator MetricsCheckOperator `json:"operator"`
+	// Threshold is the float value compared with query result
+	Threshold string `json:"threshold"`
+	// NoDataPolicy decides whether to pass pods if query returns no data
+	NoDataPolicy MetricsCheckNoDataPolicy `json:"noDataPolicy,omitempty"`
+}
+
+// TransitionRuleTimeWindow passes pods inside any of the windows, except on blackout dates.
+type TransitionRuleTimeWindow struct {
+	// TimeZone is the IANA time zone name of windows and blackout dates, like Asia/Shanghai. Default is UTC.
+	TimeZone string `json:"timeZone,omitempty"`
+	// Windows are the time windows in which pods are allowed to transit
+	Windows []TimeWindow `json:"windows"`
+	// BlackoutDates are dates in the format of 2006-01-02, on which all windows are closed
+	BlackoutDates []string `json:"blackoutDates,omitempty"`
+}
+
+// TimeWindow is either a cron-style window or a weekday window.
+type TimeWindow struct {
+	// Cron is a standard 5-field cron expression, like "0 2 * * 1-5", at which the window opens
+	Cron string `json:"cron,omitempty"`
+	// Duration is how long the cron-style window lasts, like 2h
+	Duration *metav1.Duration `json:"duration,omitempty"`
+
+	// Weekdays are the days the window opens, like Mon or Sat. Empty means every day.
+	Weekdays []string `json:"weekdays,omitempty"`
+	// Start is the time the window opens in the format of 15:04
+	Start string `json:"start,omitempty"`
+	// End is the time the window closes in the format of 15:04. The window crosses midnight if End is not after Start.
+	End string `json:"end,omitempty"`
+}
+
+// TransitionRuleRateLimit limits the number of pods approved across all targets in any sliding period.
+type TransitionRuleRateLimit struct {
+	// Limit is the max number of pods approved in period
+	Limit int32 `json:"limit"`
+	// Period is the length of sliding window, like 5m
+	Period metav1.Duration `json:"period"`
+}
+
+// TransitionRuleTopologyAvailable evaluates maxUnavailable and minAvailable among pods in the same topology domain,
+// which is decided by the label value of nodes the pods are scheduled to.
+type TransitionRuleTopologyAvailable struct {
+	// TopologyKey is the node label key of topology domain, like topology.kubernetes.io/zone
+	TopologyKey string `json:"topologyKey"`
+
+	// MaxUnavailableValue is the max number or percentage of unavailable pods in each domain
+	MaxUnavailableValue *intstr.IntOrString `json:"maxUnavailableValue,omitempty"`
+	// MinAvailableValue is the min number or percentage of available pods in each domain
+	MinAvailableValue *intstr.IntOrString `json:"minAvailableValue,omitempty"`
+}
+
+// Kinds of workloads supported by TransitionRuleDependency
+const (
+	DependentKindCollaSet          = "CollaSet"
+	DependentKindDeployment        = "Deployment"
+	DependentKindPodTransitionRule = "PodTransitionRule"
+)
+
+// TransitionRuleDependency blocks pods until all the dependent workloads are ready.
+// PodTransitionRules depending on themselves or on each other are rejected, since they block their pods forever.
+type TransitionRuleDependency struct {
+	Workloads []DependentWorkload `json:"workloads"`
+}
+
+// DependentWorkload refers to workloads in the same namespace as PodTransitionRule, by name or selector.
+type DependentWorkload struct {
+	// Kind is one of CollaSet, Deployment and PodTransitionRule. The pods of PodTransitionRule are its targets.
+	Kind string `json:"kind"`
+	// Name of the workload
+	Name string `json:"name,omitempty"`
+	// Selector selects workloads by labels, if name is empty
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// MinReadyValue is the min number or percentage of ready pods of the workload. Default is 100%.
+	MinReadyValue *intstr.IntOrString `json:"minReadyValue,omitempty"`
+	// AllowUpdating indicates not to block pods while the workload is updating
+	AllowUpdating bool `json:"allowUpdating,omitempty"`
+}
+
+// TransitionRuleExpression is a CEL expression returning bool. The variables are pod, collaset and node,
+// in the form of their json objects. collaset is the owner CollaSet of pod, and node is the node pod scheduled to.
+// They are empty if not exist, so use has() to check optional fields,
+// e.g. "pod.status.containerStatuses.all(c, c.restartCount < 3) && !has(node.spec.unschedulable)"
+type TransitionRuleExpression struct {
+	Expression string `json:"expression"`
+}
+
+// TransitionRuleDisruptionBudget refers to a DisruptionBudget shared by PodTransitionRules and PodOpsLifecycle.
+// Each pod reserves a slot of the budget only once, no matter how many rules consult it.
+type TransitionRuleDisruptionBudget struct {
+	// Name is the name of DisruptionBudget.
+	Name string `json:"name"`
+	// Namespace is the namespace of DisruptionBudget. Default is the namespace of PodTransitionRule.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// GetTransitionRuleExtensions parses extended rules annotated on PodTransitionRule.
+func GetTransitionRuleExtensions(rs *appsv1alpha1.PodTransitionRule) (map[string]*TransitionRuleExtension, error) {
+	extensions := map[string]*TransitionRuleExtension{}
+	if rs.Annotations == nil || rs.Annotations[PodTransitionRuleExtensionsAnnoKey] == "" {
+		return extensions, nil
+	}
+	if err := json.Unmarshal([]byte(rs.Annotations[PodTransitionRuleExtensionsAnnoKey]), &extensions); err != nil {
+		return nil, fmt.Errorf("fail to parse annotation %s: %s", PodTransitionRuleExtensionsAnnoKey, err)
+	}
+	return extensions, nil
+}
+
+// PodTransitionRuleWebhookAuthAnnoKey is annotated on PodTransitionRule to authenticate requests of webhook rules,
+// in the format of json map from webhook rule name to TransitionRuleWebhookAuth.
+const PodTransitionRuleWebhookAuthAnnoKey = "podtransitionrule.kusionstack.io/webhook-auth"
+
+type WebhookAuthType string
+
+const (
+	// WebhookAuthBearerToken sets "Authorization: Bearer {token}" header, with token in key WebhookAuthTokenKey of Secret
+	WebhookAuthBearerToken WebhookAuthType = "BearerToken"
+	// WebhookAuthClientCertificate uses mTLS, with client certificate and key in keys tls.crt and tls.key of Secret
+	WebhookAuthClientCertificate WebhookAuthType = "ClientCertificate"
+	// WebhookAuthHMAC signs requests by HMAC-SHA256 of "{timestamp}.{body}", with signing key in key WebhookAuthSigningKey of Secret.
+	// The timestamp and signature are set in headers X-Kuperator-Timestamp and X-Kuperator-Signature.
+	WebhookAuthHMAC WebhookAuthType = "HMAC"
+)
+
+const (
+	WebhookAuthTokenKey   = "token"
+	WebhookAuthSigningKey = "signing-key"
+)
+
+// TransitionRuleWebhookAuth refers to a Secret in the namespace of PodTransitionRule, for both webhook and polling requests.
+// The Secret is read on every request, so rotated credentials take effect without restart.
+type TransitionRuleWebhookAuth struct {
+	Type       WebhookAuthType `json:"type"`
+	SecretName string          `json:"secretName"`
+}
+
+// GetTransitionRuleWebhookAuths parses webhook authentications annotated on PodTransitionRule.
+func GetTransitionRuleWebhookAuths(rs *appsv1alpha1.PodTransitionRule) (map[string]*TransitionRuleWebhookAuth, error) {
+	auths := map[string]*TransitionRuleWebhookAuth{}
+	if rs.Annotations == nil || rs.Annotations[PodTransitionRuleWebhookAuthAnnoKey] == "" {
+		return auths, nil
+	}
+	if err := json.Unmarshal([]byte(rs.Annotations[PodTransitionRuleWebhookAuthAnnoKey]), &auths); err != nil {
+		return nil, fmt.Errorf("fail to parse annotation %s: %s", PodTransitionRuleWebhookAuthAnnoKey, err)
+	}
+	return auths, nil
+}
+
+// PodTransitionRuleWebhookRetryAnnoKey is annotated on PodTransitionRule to configure failure handling of webhook rules,
+// in the format of json map from webhook rule name to TransitionRuleWebhookRetry.
+const PodTransitionRuleWebhookRetryAnnoKey = "podtransitionrule.kusionstack.io/webhook-retry"
+
+// TransitionRuleWebhookRetry configures how webhook request failures, e.g. timeout and 5xx, are handled.
+// Consecutive failures are backed off exponentially with jitter, from InitialBackoffSeconds to MaxBackoffSeconds,
+// and no request is sent during backoff.
+type TransitionRuleWebhookRetry struct {
+	// FailureThreshold is the number of consecutive failures, after which pods are passed if failurePolicy is Ignore.
+	// Since failurePolicy is defaulted to Ignore, 0 means failures are never ignored.
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+	// TimeoutSeconds is the timeout of each webhook request. Default is 30.
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+	// InitialBackoffSeconds is the backoff after the first failure. Default is 5.
+	InitialBackoffSeconds int32 `json:"initialBackoffSeconds,omitempty"`
+	// MaxBackoffSeconds is the max backoff. Default is 300.
+	MaxBackoffSeconds int32 `json:"maxBackoffSeconds,omitempty"`
+}
+
+// GetTransitionRuleWebhookRetries parses webhook failure handling annotated on PodTransitionRule.
+func GetTransitionRuleWebhookRetries(rs *appsv1alpha1.PodTransitionRule) (map[string]*TransitionRuleWebhookRetry, error) {
+	retries := map[string]*TransitionRuleWebhookRetry{}
+	if rs.Annotations == nil || rs.Annotations[PodTransitionRuleWebhookRetryAnnoKey] == "" {
+		return retries, nil
+	}
+	if err := json.Unmarshal([]byte(rs.Annotations[PodTransitionRuleWebhookRetryAnnoKey]), &retries); err != nil {
+		return nil, fmt.Errorf("fail to parse annotation %s: %s", PodTransitionRuleWebhookRetryAnnoKey, err)
+	}
+	return retries, nil
+}
+
+// PodTransitionRuleWebhookProgressAnnoKey is annotated on PodTransitionRule by controller to keep progress of webhook
+// rules which WebhookStatus has no field for, in the format of json map from webhook rule name to
+// TransitionRuleWebhookProgress.
+const PodTransitionRuleWebhookProgressAnnoKey = "podtransitionrule.kusionstack.io/webhook-progress"
+
+// TransitionRuleWebhookProgress is the progress of webhook rule, which survives controller restarts.
+type TransitionRuleWebhookProgress struct {
+	// Failure is the consecutive failures of webhook requests, and is cleared once a request succeeds.
+	Failure *TransitionRuleWebhookFailure `json:"failure,omitempty"`
+	// Polls is the progress of running polling tasks, taskId:poll.
+	Polls map[string]*TransitionRuleWebhookPoll `json:"polls,omitempty"`
+}
+
+// IsEmpty returns true if there is nothing to persist.
+func (p *TransitionRuleWebhookProgress) IsEmpty() bool {
+	return p == nil || (p.Failure == nil && len(p.Polls) == 0)
+}
+
+// TransitionRuleWebhookPoll records progress of polling task, so that polling is resumed after controller restarts.
+type TransitionRuleWebhookPoll struct {
+	// Count is the number of polling requests sent.
+	Count int32 `json:"count"`
+	// Deadline is the time polling task times out.
+	Deadline metav1.Time `json:"deadline"`
+}
+
+// TransitionRuleWebhookFailure records consecutive failures of webhook requests.
+type TransitionRuleWebhookFailure struct {
+	// Count is the number of consecutive failures.
+	Count int32 `json:"count"`
+	// LastFailureTime is the time of the latest failure.
+	LastFailureTime metav1.Time `json:"lastFailureTime"`
+	// RetryTime is the time to request again after backoff.
+	RetryTime metav1.Time `json:"retryTime"`
+	// LastError is the error of the latest failure.
+	LastError string `json:"lastError,omitempty"`
+}
+
+// GetTransitionRuleWebhookProgresses parses progress of webhook rules annotated on PodTransitionRule.
+func GetTransitionRuleWebhookProgresses(rs *appsv1alpha1.PodTransitionRule) (map[string]*TransitionRuleWebhookProgress, error) {
+	progresses := map[string]*TransitionRuleWebhookProgress{}
+	if rs.Annotations == nil || rs.Annotations[PodTransitionRuleWebhookProgressAnnoKey] == "" {
+		return progresses, nil
+	}
+	if err := json.Unmarshal([]byte(rs.Annotations[PodTransitionRuleWebhookProgressAnnoKey]), &progresses); err != nil {
+		return nil, fmt.Errorf("fail to parse annotation %s: %s", PodTransitionRuleWebhookProgressAnnoKey, err)
+	}
+	return progresses, nil
+}
+
+// PodTransitionRuleAuditAnnoKey is annotated on PodTransitionRule to run rules in audit mode. Rejections of audited rules
+// are recorded in status, events and metrics, but never block pods. The value is "*" for all rules of the
+// PodTransitionRule, or rule names separated by comma.
+const PodTransitionRuleAuditAnnoKey = "podtransitionrule.kusionstack.io/audit"
+
+// AuditAllTransitionRules is the value of PodTransitionRuleAuditAnnoKey to audit all rules.
+const AuditAllTransitionRules = "*"
+
+// GetAuditedTransitionRules parses names of audited rules annotated on PodTransitionRule.
+func GetAuditedTransitionRules(rs *appsv1alpha1.PodTransitionRule) []string {
+	if rs.Annotations == nil || rs.Annotations[PodTransitionRuleAuditAnnoKey] == "" {
+		return nil
+	}
+	var names []string
+	for _, name := range strings.Split(rs.Annotations[PodTransitionRuleAuditAnnoKey], ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// IsTransitionRuleAudited returns true if the rule of PodTransitionRule runs in audit mode.
+func IsTransitionRuleAudited(rs *appsv1alpha1.PodTransitionRule, ruleName string) bool {
+	for _, name := range GetAuditedTransitionRules(rs) {
+		if name == AuditAllTransitionRules || name == ruleName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// +kubebuilder:object:generate=true
+// +groupName=apps.kusionstack.io
+
+package v1alpha1
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+)
+
+var (
+	// SchemeBuilder registers kinds defined in kuperator into the same group version of kube-api
+	SchemeBuilder = &scheme.Builder{GroupVersion: appsv1alpha1.SchemeGroupVersion}
+
+	// AddToScheme adds the kinds defined in kuperator to the scheme
+	AddToScheme = SchemeBuilder.AddToScheme
+)
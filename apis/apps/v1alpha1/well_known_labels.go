@@ -0,0 +1,75 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+)
+
+// SnapshotPersistentVolumeClaimRetentionPolicyType takes a VolumeSnapshot of a pvc before it is deleted.
+// It can be set on CollaSet.spec.scaleStrategy.persistentVolumeClaimRetentionPolicy.whenScaled and whenDeleted.
+const SnapshotPersistentVolumeClaimRetentionPolicyType appsv1alpha1.PersistentVolumeClaimRetentionPolicyType = "Snapshot"
+
+// CollaSet pvc snapshot labels and annotations
+const (
+	// PvcSnapshotCollaSetLabelKey records the name of CollaSet which the snapshotted pvc belonged to
+	PvcSnapshotCollaSetLabelKey = "collaset.kusionstack.io/collaset-name"
+	// PvcTemplateNameLabelKey records the pvc template name of pvcs and their snapshots
+	PvcTemplateNameLabelKey = "collaset.kusionstack.io/pvc-template-name"
+	// PvcSnapshotPendingLabelKey marks pvcs which are kept until their snapshots are taken, and deleted after that
+	PvcSnapshotPendingLabelKey = "collaset.kusionstack.io/pvc-snapshot-pending"
+
+	// CollaSetPvcSnapshotClassAnnoKey indicates the VolumeSnapshotClass used to take pvc snapshots
+	CollaSetPvcSnapshotClassAnnoKey = "collaset.kusionstack.io/pvc-snapshot-class"
+	// CollaSetPvcRestoreFromSnapshotAnnoKey indicates whether new pvcs are restored from the latest
+	// ready snapshot taken with the same instance id and pvc template
+	CollaSetPvcRestoreFromSnapshotAnnoKey = "collaset.kusionstack.io/pvc-restore-from-snapshot"
+	// CollaSetPvcSnapshotCleanupPolicyAnnoKey indicates how pvc snapshots taken by CollaSet are cleaned up
+	CollaSetPvcSnapshotCleanupPolicyAnnoKey = "collaset.kusionstack.io/pvc-snapshot-cleanup-policy"
+	// CollaSetPvcSnapshotHistoryLimitAnnoKey indicates the max number of snapshots kept for each instance id
+	// and pvc template. Older snapshots are deleted when a new one is taken, except the latest ready one
+	// and the new one itself. Snapshots are not limited if it is not set.
+	CollaSetPvcSnapshotHistoryLimitAnnoKey = "collaset.kusionstack.io/pvc-snapshot-history-limit"
+	// PvcRestoredSnapshotAnnoKey records the name of snapshot which the pvc is restored from
+	PvcRestoredSnapshotAnnoKey = "collaset.kusionstack.io/restored-snapshot"
+)
+
+// CollaSet pvc snapshot cleanup policies
+const (
+	// RetainPvcSnapshotCleanupPolicy keeps snapshots until they are deleted by users. It is the default policy.
+	RetainPvcSnapshotCleanupPolicy = "Retain"
+	// DeleteAfterRestorePvcSnapshotCleanupPolicy deletes a snapshot once a pvc restored from it is bound.
+	DeleteAfterRestorePvcSnapshotCleanupPolicy = "DeleteAfterRestore"
+	// DeleteWithCollaSetPvcSnapshotCleanupPolicy makes snapshots owned by CollaSet, so that they are
+	// garbage collected along with it. It can not work with "Snapshot" whenDeleted retention policy.
+	DeleteWithCollaSetPvcSnapshotCleanupPolicy = "DeleteWithCollaSet"
+)
+
+// CollaSet naming policy
+const (
+	// CollaSetNamingPolicyAnnoKey indicates how CollaSet names its pods and pvcs
+	CollaSetNamingPolicyAnnoKey = "collaset.kusionstack.io/naming-policy"
+
+	// RandomNamingPolicy names pods with CollaSet name and a random suffix. It is the default policy.
+	RandomNamingPolicy = "Random"
+	// InstanceIDNamingPolicy names pods <collaset>-<id> and pvcs <template>-<collaset>-<id>,
+	// and sets pod hostname and subdomain, so that pods get stable DNS names from a headless service.
+	// Names are kept by recreate and in-place update. Replace update is not supported with this policy,
+	// since the new pod is created before the origin one is deleted, and can not take its name.
+	// Pods replaced by label take new instance ids, and are named by them.
+	InstanceIDNamingPolicy = "InstanceID"
+)
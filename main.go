@@ -32,8 +32,11 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 	"kusionstack.io/kuperator/pkg/controllers"
 	"kusionstack.io/kuperator/pkg/controllers/operationjob"
+	"kusionstack.io/kuperator/pkg/controllers/podopslifecycle"
+	podopslifecycleutils "kusionstack.io/kuperator/pkg/controllers/utils/podopslifecycle"
 	_ "kusionstack.io/kuperator/pkg/features"
 	"kusionstack.io/kuperator/pkg/utils/feature"
 	"kusionstack.io/kuperator/pkg/utils/inject"
@@ -48,6 +51,7 @@ var (
 
 func init() {
 	utilruntime.Must(appsv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(kuperatorv1alpha1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -58,6 +62,8 @@ func main() {
 		probeAddr            string
 		certDir              string
 		dnsName              string
+		stageTimeouts        string
+		typePriorities       string
 	)
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
@@ -66,6 +72,8 @@ func main() {
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&certDir, "cert-dir", webhookTempCertDir(), "The directory that contains the server key and certificate. If not set, webhook server would look up the server key and certificate in {TempDir}/k8s-webhook-server/serving-certs")
 	flag.StringVar(&dnsName, "dns-name", "kusionstack-controller-manager.kusionstack-system.svc", "The DNS name of the webhook server.")
+	flag.StringVar(&typePriorities, "podopslifecycle-operation-type-priorities", "", "The priorities of PodOpsLifecycle OperationTypes in json map, like {\"delete\": 100, \"update\": 10}. A lifecycle cancels the ones of lower priority still preparing, and waits for the ones of higher priority.")
+	flag.StringVar(&stageTimeouts, "podopslifecycle-stage-timeouts", "", "The default timeouts of PodOpsLifecycle stages in json map from operation type to stage timeout, like {\"update\": {\"preparing\": \"1h\", \"action\": \"Cancel\"}}.")
 
 	klog.InitFlags(nil)
 	defer klog.Flush()
@@ -109,6 +117,20 @@ func main() {
 		setupLog.Error(err, "unable to add APIs scheme")
 		os.Exit(1)
 	}
+	if err = kuperatorv1alpha1.AddToScheme(mgr.GetScheme()); err != nil {
+		setupLog.Error(err, "unable to add kuperator APIs scheme")
+		os.Exit(1)
+	}
+
+	if err = podopslifecycle.SetStageTimeouts(stageTimeouts); err != nil {
+		setupLog.Error(err, "unable to set PodOpsLifecycle stage timeouts")
+		os.Exit(1)
+	}
+
+	if err = podopslifecycleutils.SetOperationTypePriorities(typePriorities); err != nil {
+		setupLog.Error(err, "unable to set PodOpsLifecycle OperationType priorities")
+		os.Exit(1)
+	}
 
 	operationjob.RegisterOperationJobActions()
 
@@ -35,6 +35,7 @@ import (
 
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
 
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 	"kusionstack.io/kuperator/pkg/controllers/collaset/podcontext"
 	"kusionstack.io/kuperator/pkg/controllers/collaset/podcontrol"
 	"kusionstack.io/kuperator/pkg/controllers/collaset/pvccontrol"
@@ -55,6 +56,8 @@ const (
 	controllerName = "collaset-controller"
 
 	preReclaimFinalizer = "apps.kusionstack.io/pre-reclaim"
+
+	pvcSnapshotRequeueInterval = 10 * time.Second
 )
 
 // CollaSetReconciler reconciles a CollaSet object
@@ -118,6 +121,14 @@ func AddToMgr(mgr ctrl.Manager, r reconcile.Reconciler) error {
 		return err
 	}
 
+	err = c.Watch(&source.Kind{Type: &corev1.PersistentVolumeClaim{}}, &handler.EnqueueRequestForOwner{
+		IsController: true,
+		OwnerType:    &appsv1alpha1.CollaSet{},
+	}, &PvcPredicate{})
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -128,6 +139,7 @@ func AddToMgr(mgr ctrl.Manager, r reconcile.Reconciler) error {
 // +kubebuilder:rbac:groups=apps.kusionstack.io,resources=resourcecontexts/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=apps.kusionstack.io,resources=resourcecontexts/finalizers,verbs=update
 // +kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=snapshot.storage.k8s.io,resources=volumesnapshots,verbs=get;list;watch;create;delete
 // +kubebuilder:rbac:groups=apps,resources=controllerrevisions,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=events,verbs=create;update;patch
@@ -156,9 +168,12 @@ func (r *CollaSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 	}
 
 	if instance.DeletionTimestamp != nil {
-		if err := r.ensureReclaimPvcs(ctx, instance); err != nil {
+		if snapshotTaken, err := r.ensureReclaimPvcs(ctx, instance); err != nil {
 			// reclaim pvcs before remove finalizers
 			return ctrl.Result{}, err
+		} else if !snapshotTaken {
+			// keep finalizers until snapshots are taken, otherwise pvcs are garbage collected along with CollaSet
+			return ctrl.Result{RequeueAfter: pvcSnapshotRequeueInterval}, nil
 		}
 		if err := r.ensureReclaimPodOwnerReferences(instance); err != nil {
 			// reclaim pods ownerReferences before remove finalizers
@@ -232,17 +247,31 @@ func (r *CollaSetReconciler) doSync(
 
 	synced, podWrappers, ownedIDs, err := r.syncControl.SyncPods(ctx, instance, resources)
 	if err != nil || synced {
-		return podWrappers, nil, err
+		return podWrappers, pvcSnapshotRequeueAfter(resources), err
 	}
 
 	_, scaleRequeueAfter, scaleErr := r.syncControl.Scale(ctx, instance, resources, podWrappers, ownedIDs)
 	_, updateRequeueAfter, updateErr := r.syncControl.Update(ctx, instance, resources, podWrappers, ownedIDs)
 
 	err = controllerutils.AggregateErrors([]error{scaleErr, updateErr})
-	if updateRequeueAfter != nil && (scaleRequeueAfter == nil || *updateRequeueAfter < *scaleRequeueAfter) {
-		return podWrappers, updateRequeueAfter, err
+	requeueAfter := scaleRequeueAfter
+	if updateRequeueAfter != nil && (requeueAfter == nil || *updateRequeueAfter < *requeueAfter) {
+		requeueAfter = updateRequeueAfter
+	}
+	if snapshotRequeueAfter := pvcSnapshotRequeueAfter(resources); snapshotRequeueAfter != nil && (requeueAfter == nil || *snapshotRequeueAfter < *requeueAfter) {
+		requeueAfter = snapshotRequeueAfter
 	}
-	return podWrappers, scaleRequeueAfter, err
+	return podWrappers, requeueAfter, err
+}
+
+// pvcSnapshotRequeueAfter requeues CollaSet to delete pvcs once their snapshots are taken,
+// since the readiness of snapshots is not watched.
+func pvcSnapshotRequeueAfter(resources *collasetutils.RelatedResources) *time.Duration {
+	if !resources.PvcSnapshotPending {
+		return nil
+	}
+	requeueAfter := pvcSnapshotRequeueInterval
+	return &requeueAfter
 }
 
 func calculateStatus(
@@ -347,12 +376,14 @@ func requeueResult(requeueTime *time.Duration) reconcile.Result {
 	return reconcile.Result{}
 }
 
-func (r *CollaSetReconciler) ensureReclaimPvcs(ctx context.Context, cls *appsv1alpha1.CollaSet) error {
+// ensureReclaimPvcs reclaims pvcs according to whenDelete retention policy,
+// and returns false if the snapshots of pvcs are not taken yet.
+func (r *CollaSetReconciler) ensureReclaimPvcs(ctx context.Context, cls *appsv1alpha1.CollaSet) (bool, error) {
 	var needReclaimPvcs []*corev1.PersistentVolumeClaim
 	pvcControl := pvccontrol.NewRealPvcControl(r.Client, r.Scheme)
 	pvcs, err := pvcControl.GetFilteredPvcs(ctx, cls)
 	if err != nil {
-		return err
+		return false, err
 	}
 	// reclaim pvcs according to whenDelete retention policy
 	for i := range pvcs {
@@ -361,10 +392,16 @@ func (r *CollaSetReconciler) ensureReclaimPvcs(ctx context.Context, cls *appsv1a
 			needReclaimPvcs = append(needReclaimPvcs, pvcs[i])
 		}
 	}
+	// snapshot pvcs before they are garbage collected along with CollaSet
+	if collasetutils.PvcPolicyWhenDelete(cls) == kuperatorv1alpha1.SnapshotPersistentVolumeClaimRetentionPolicyType {
+		if taken, err := pvcControl.SnapshotPvcs(ctx, cls, pvcs); err != nil || !taken {
+			return taken, err
+		}
+	}
 	if len(needReclaimPvcs) > 0 {
 		_, err = pvcControl.ReleasePvcsOwnerRef(cls, needReclaimPvcs)
 	}
-	return err
+	return true, err
 }
 
 func (r *CollaSetReconciler) ensureReclaimPodOwnerReferences(cls *appsv1alpha1.CollaSet) error {
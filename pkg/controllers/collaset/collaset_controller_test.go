@@ -48,6 +48,7 @@ import (
 
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
 
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 	"kusionstack.io/kuperator/pkg/controllers/collaset/synccontrol"
 	collasetutils "kusionstack.io/kuperator/pkg/controllers/collaset/utils"
 	"kusionstack.io/kuperator/pkg/controllers/poddecoration"
@@ -1516,6 +1517,81 @@ var _ = Describe("collaset controller", func() {
 		}
 	})
 
+	It("[instance id naming] replace pod", func() {
+		testcase := "test-replace-pod-named-by-id"
+		Expect(createNamespace(c, testcase)).Should(BeNil())
+
+		cs := &appsv1alpha1.CollaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testcase,
+				Name:      "foo",
+				Annotations: map[string]string{
+					kuperatorv1alpha1.CollaSetNamingPolicyAnnoKey: kuperatorv1alpha1.InstanceIDNamingPolicy,
+				},
+			},
+			Spec: appsv1alpha1.CollaSetSpec{
+				Replicas: int32Pointer(1),
+				Selector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"app": "foo",
+					},
+				},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: map[string]string{
+							"app": "foo",
+						},
+					},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name:  "foo",
+								Image: "nginx:v1",
+							},
+						},
+					},
+				},
+			},
+		}
+
+		Expect(c.Create(context.TODO(), cs)).Should(BeNil())
+
+		podList := &corev1.PodList{}
+		Eventually(func() bool {
+			Expect(c.List(context.TODO(), podList, client.InNamespace(cs.Namespace))).Should(BeNil())
+			return len(podList.Items) == 1
+		}, 5*time.Second, 1*time.Second).Should(BeTrue())
+		originPod := podList.Items[0]
+		Expect(originPod.Name).Should(BeEquivalentTo(fmt.Sprintf("%s-%s", cs.Name, originPod.Labels[appsv1alpha1.PodInstanceIDLabelKey])))
+		Expect(originPod.Spec.Hostname).Should(BeEquivalentTo(originPod.Name))
+
+		// replace update is rejected with instance id naming policy, label pod to trigger replace
+		Expect(updatePodWithRetry(c, originPod.Namespace, originPod.Name, func(pod *corev1.Pod) bool {
+			if pod.Labels == nil {
+				pod.Labels = map[string]string{}
+			}
+			pod.Labels[appsv1alpha1.PodReplaceIndicationLabelKey] = "true"
+			return true
+		})).Should(BeNil())
+
+		Eventually(func() bool {
+			Expect(c.List(context.TODO(), podList, client.InNamespace(cs.Namespace))).Should(BeNil())
+			return len(podList.Items) == 2
+		}, 30*time.Second, 1*time.Second).Should(BeTrue())
+
+		// new pod takes a new instance id, and is named by it instead of keeping the origin pod name
+		for _, pod := range podList.Items {
+			if pod.Name == originPod.Name {
+				continue
+			}
+			newPodID := pod.Labels[appsv1alpha1.PodInstanceIDLabelKey]
+			Expect(newPodID).ShouldNot(BeEquivalentTo(originPod.Labels[appsv1alpha1.PodInstanceIDLabelKey]))
+			Expect(pod.Name).Should(BeEquivalentTo(fmt.Sprintf("%s-%s", cs.Name, newPodID)))
+			Expect(pod.Spec.Hostname).Should(BeEquivalentTo(pod.Name))
+			Expect(pod.Labels[appsv1alpha1.PodReplacePairOriginName]).Should(BeEquivalentTo(originPod.Name))
+		}
+	})
+
 	It("delete origin pod when replace", func() {
 		testcase := "delete-origin-pod-when-replace"
 		Expect(createNamespace(c, testcase)).Should(BeNil())
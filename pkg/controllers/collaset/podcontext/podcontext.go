@@ -19,7 +19,6 @@ package podcontext
 import (
 	"context"
 	"fmt"
-	"sort"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -29,10 +28,11 @@ import (
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
 	"kusionstack.io/kuperator/pkg/controllers/collaset/utils"
 	"kusionstack.io/kuperator/pkg/controllers/utils/expectations"
+	"kusionstack.io/kuperator/pkg/controllers/utils/resourcecontext"
 )
 
 const (
-	OwnerContextKey              = "Owner"
+	OwnerContextKey              = resourcecontext.OwnerContextKey
 	RevisionContextDataKey       = "Revision"
 	PodDecorationRevisionKey     = "PodDecorationRevisions"
 	JustCreateContextDataKey     = "PodJustCreate"
@@ -53,48 +53,19 @@ func AllocateID(c client.Client, instance *appsv1alpha1.CollaSet, defaultRevisio
 		podContext.Name = contextName
 	}
 
-	// store all the IDs crossing Multiple workload
-	existingIDs := map[int]*appsv1alpha1.ContextDetail{}
-	// only store the IDs belonging to this owner
-	ownedIDs := map[int]*appsv1alpha1.ContextDetail{}
-	for i := range podContext.Spec.Contexts {
-		detail := &podContext.Spec.Contexts[i]
-		if detail.Contains(OwnerContextKey, instance.Name) {
-			ownedIDs[detail.ID] = detail
-		}
-
-		existingIDs[detail.ID] = detail
-	}
-
-	// if owner has enough ID, return
-	if len(ownedIDs) >= replicas {
-		return ownedIDs, nil
-	}
-
-	// find new IDs for owner
-	candidateID := 0
-	for len(ownedIDs) < replicas {
-		// find one new ID
-		for {
-			if _, exist := existingIDs[candidateID]; exist {
-				candidateID++
-				continue
-			}
-
-			break
-		}
-
-		detail := &appsv1alpha1.ContextDetail{
-			ID: candidateID,
+	existingCount := len(podContext.Spec.Contexts)
+	ownedIDs, err := resourcecontext.AllocateIDs(podContext, instance.Name, replicas, &resourcecontext.AllocateOptions{
+		NewData: func(int) map[string]string {
 			// TODO choose just create pods' revision according to scaleStrategy
-			Data: map[string]string{
-				OwnerContextKey:          instance.Name,
+			return map[string]string{
 				RevisionContextDataKey:   defaultRevision,
 				JustCreateContextDataKey: "true",
-			},
-		}
-		existingIDs[candidateID] = detail
-		ownedIDs[candidateID] = detail
+			}
+		},
+	})
+	// if owner has enough ID, return
+	if err != nil || len(podContext.Spec.Contexts) == existingCount {
+		return ownedIDs, err
 	}
 
 	if notFound {
@@ -146,24 +117,12 @@ func doCreatePodContext(c client.Client, instance *appsv1alpha1.CollaSet, ownerI
 }
 
 func doUpdatePodContext(c client.Client, instance client.Object, ownedIDs map[int]*appsv1alpha1.ContextDetail, podContext *appsv1alpha1.ResourceContext) error {
-	// store all IDs crossing all workload
-	existingIDs := map[int]*appsv1alpha1.ContextDetail{}
-
-	for i := range podContext.Spec.Contexts {
-		detail := podContext.Spec.Contexts[i]
-		if detail.Contains(OwnerContextKey, instance.GetName()) {
-			continue
-		}
-
-		existingIDs[detail.ID] = &detail
-	}
-
-	for _, contextDetail := range ownedIDs {
-		existingIDs[contextDetail.ID] = contextDetail
+	if err := resourcecontext.SetOwnedIDs(podContext, instance.GetName(), ownedIDs); err != nil {
+		return err
 	}
 
-	// delete PodContext if it is empty
-	if len(existingIDs) == 0 {
+	// delete PodContext if it is empty, and keep it if allocation policy is annotated
+	if resourcecontext.IsDeletable(podContext) {
 		err := c.Delete(context.TODO(), podContext)
 		if err != nil {
 			if err := utils.ActiveExpectations.ExpectDelete(instance, expectations.ResourceContext, podContext.Name); err != nil {
@@ -174,15 +133,6 @@ func doUpdatePodContext(c client.Client, instance client.Object, ownedIDs map[in
 		return err
 	}
 
-	podContext.Spec.Contexts = make([]appsv1alpha1.ContextDetail, len(existingIDs))
-	idx := 0
-	for _, contextDetail := range existingIDs {
-		podContext.Spec.Contexts[idx] = *contextDetail
-		idx++
-	}
-
-	// keep context detail in order by ID
-	sort.Sort(ContextDetailsByOrder(podContext.Spec.Contexts))
 	err := c.Update(context.TODO(), podContext)
 	if err != nil {
 		if err := utils.ActiveExpectations.ExpectUpdate(instance, expectations.ResourceContext, podContext.Name, podContext.ResourceVersion); err != nil {
@@ -201,12 +151,4 @@ func getContextName(instance *appsv1alpha1.CollaSet) string {
 	return instance.Name
 }
 
-type ContextDetailsByOrder []appsv1alpha1.ContextDetail
-
-func (s ContextDetailsByOrder) Len() int      { return len(s) }
-func (s ContextDetailsByOrder) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
-
-func (s ContextDetailsByOrder) Less(i, j int) bool {
-	l, r := s[i], s[j]
-	return l.ID < r.ID
-}
+type ContextDetailsByOrder = resourcecontext.ContextDetailsByOrder
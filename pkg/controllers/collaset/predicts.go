@@ -17,8 +17,10 @@ limitations under the License.
 package collaset
 
 import (
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 	"kusionstack.io/kuperator/pkg/utils"
 )
 
@@ -44,3 +46,33 @@ func (p *PodPredicate) Update(e event.UpdateEvent) bool {
 func (p *PodPredicate) Generic(e event.GenericEvent) bool {
 	return utils.ControlledByKusionStack(e.Object)
 }
+
+// PvcPredicate only processes events of pvcs waiting for their snapshots to be taken before deleted,
+// so that they are deleted as soon as snapshot controller updates them.
+type PvcPredicate struct {
+}
+
+// Create returns true if the Create event should be processed
+func (p *PvcPredicate) Create(e event.CreateEvent) bool {
+	return isPvcSnapshotPending(e.Object)
+}
+
+// Delete returns true if the Delete event should be processed
+func (p *PvcPredicate) Delete(e event.DeleteEvent) bool {
+	return false
+}
+
+// Update returns true if the Update event should be processed
+func (p *PvcPredicate) Update(e event.UpdateEvent) bool {
+	return isPvcSnapshotPending(e.ObjectNew)
+}
+
+// Generic returns true if the Generic event should be processed
+func (p *PvcPredicate) Generic(e event.GenericEvent) bool {
+	return isPvcSnapshotPending(e.Object)
+}
+
+func isPvcSnapshotPending(obj client.Object) bool {
+	_, exist := obj.GetLabels()[kuperatorv1alpha1.PvcSnapshotPendingLabelKey]
+	return exist
+}
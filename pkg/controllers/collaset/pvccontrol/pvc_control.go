@@ -21,13 +21,19 @@ import (
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 	collasetutils "kusionstack.io/kuperator/pkg/controllers/collaset/utils"
 	"kusionstack.io/kuperator/pkg/controllers/utils/expectations"
 	refmanagerutil "kusionstack.io/kuperator/pkg/controllers/utils/refmanager"
@@ -42,6 +48,9 @@ type Interface interface {
 	DeletePodUnusedPvcs(context.Context, *appsv1alpha1.CollaSet, *corev1.Pod, []*corev1.PersistentVolumeClaim) error
 	SetPvcsOwnerRef(*appsv1alpha1.CollaSet, []*corev1.PersistentVolumeClaim) ([]*corev1.PersistentVolumeClaim, error)
 	ReleasePvcsOwnerRef(*appsv1alpha1.CollaSet, []*corev1.PersistentVolumeClaim) ([]*corev1.PersistentVolumeClaim, error)
+	SnapshotPvcs(context.Context, *appsv1alpha1.CollaSet, []*corev1.PersistentVolumeClaim) (bool, error)
+	DeleteSnapshotPendingPvcs(context.Context, *appsv1alpha1.CollaSet, []*corev1.PersistentVolumeClaim) (bool, error)
+	DeleteRestoredPvcSnapshots(context.Context, *appsv1alpha1.CollaSet, []*corev1.PersistentVolumeClaim) error
 }
 
 type RealPvcControl struct {
@@ -153,6 +162,19 @@ func provisionUpdatedPvc(c client.Client, ctx context.Context, cls *appsv1alpha1
 			return nil, err
 		}
 
+		// pvc named by instance id may be still occupied by the old pvc, which is kept until new pvc is provisioned
+		if claim.Name != "" && isPvcNameOccupied(existingPvcs, claim.Name) {
+			claim.GenerateName = claim.Name + "-"
+			claim.Name = ""
+		}
+
+		// restore data from the latest snapshot taken when pvc with same id was deleted
+		if collasetutils.IsPvcRestoredFromSnapshot(cls) && claim.Spec.DataSource == nil {
+			if err := setPvcDataSourceFromSnapshot(c, ctx, cls, pvcTmp.Name, id, claim); err != nil {
+				return nil, err
+			}
+		}
+
 		if err := c.Create(ctx, claim); err != nil {
 			return nil, fmt.Errorf("fail to create pvc for id %s: %s", id, err)
 		} else {
@@ -179,10 +201,8 @@ func (pc *RealPvcControl) DeletePodPvcs(ctx context.Context, cls *appsv1alpha1.C
 			continue
 		}
 
-		// delete pvcs labeled same id with pod
-		if err := pc.client.Delete(ctx, pvc); err != nil {
-			return err
-		} else if err := collasetutils.ActiveExpectations.ExpectDelete(cls, expectations.Pvc, pvc.Name); err != nil {
+		// delete pvcs labeled same id with pod, after snapshots are taken if WhenScaled is "Snapshot"
+		if err := deletePvc(pc.client, ctx, cls, pvc); err != nil {
 			return err
 		}
 	}
@@ -208,8 +228,8 @@ func (pc *RealPvcControl) DeletePodUnusedPvcs(ctx context.Context, cls *appsv1al
 		return err
 	}
 
-	// delete old pvc if new pvc is provisioned and WhenScaled is "Delete"
-	if collasetutils.PvcPolicyWhenScaled(cls) == appsv1alpha1.DeletePersistentVolumeClaimRetentionPolicyType {
+	// delete old pvc if new pvc is provisioned and WhenScaled is "Delete" or "Snapshot"
+	if collasetutils.IsPvcDeletedByPolicy(collasetutils.PvcPolicyWhenScaled(cls)) {
 		return deleteOldPvcs(pc.client, ctx, cls, newPvcs, oldPvcs)
 	}
 	return nil
@@ -260,6 +280,75 @@ func (pc *RealPvcControl) ReleasePvcsOwnerRef(cls *appsv1alpha1.CollaSet, pvcs [
 	return pvcs, nil
 }
 
+// SnapshotPvcs makes sure every pvc has a snapshot, and returns true if all of the snapshots are taken.
+func (pc *RealPvcControl) SnapshotPvcs(ctx context.Context, cls *appsv1alpha1.CollaSet, pvcs []*corev1.PersistentVolumeClaim) (bool, error) {
+	allTaken := true
+	for _, pvc := range pvcs {
+		taken, err := snapshotPvc(pc.client, ctx, cls, pvc)
+		if err != nil {
+			return false, err
+		}
+		allTaken = allTaken && taken
+	}
+	return allTaken, nil
+}
+
+// DeleteSnapshotPendingPvcs retries deleting pvcs which are kept until their snapshots are taken,
+// and returns true if some of them are still pending.
+func (pc *RealPvcControl) DeleteSnapshotPendingPvcs(ctx context.Context, cls *appsv1alpha1.CollaSet, pvcs []*corev1.PersistentVolumeClaim) (bool, error) {
+	pending := false
+	for _, pvc := range pvcs {
+		if !isPvcSnapshotPending(pvc) {
+			continue
+		}
+		taken, err := snapshotPvc(pc.client, ctx, cls, pvc)
+		if err != nil {
+			return pending, err
+		}
+		if !taken {
+			pending = true
+			continue
+		}
+		if err := pc.client.Delete(ctx, pvc); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return pending, err
+		} else if err := collasetutils.ActiveExpectations.ExpectDelete(cls, expectations.Pvc, pvc.Name); err != nil {
+			return pending, err
+		}
+	}
+	return pending, nil
+}
+
+// DeleteRestoredPvcSnapshots deletes snapshots which bound pvcs are restored from under "DeleteAfterRestore"
+// cleanup policy, and clears the restored snapshot annotation of pvcs after that.
+func (pc *RealPvcControl) DeleteRestoredPvcSnapshots(ctx context.Context, cls *appsv1alpha1.CollaSet, pvcs []*corev1.PersistentVolumeClaim) error {
+	if collasetutils.PvcSnapshotCleanupPolicy(cls) != kuperatorv1alpha1.DeleteAfterRestorePvcSnapshotCleanupPolicy {
+		return nil
+	}
+	for _, pvc := range pvcs {
+		name := collasetutils.RestoredPvcSnapshotName(pvc)
+		if name == "" {
+			continue
+		}
+		snapshot := &unstructured.Unstructured{}
+		snapshot.SetGroupVersionKind(collasetutils.VolumeSnapshotGVK)
+		snapshot.SetNamespace(pvc.Namespace)
+		snapshot.SetName(name)
+		if err := pc.client.Delete(ctx, snapshot); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("fail to delete snapshot %s restored by pvc %s: %s", name, pvc.Name, err)
+		}
+
+		patch := client.MergeFrom(pvc.DeepCopy())
+		delete(pvc.Annotations, kuperatorv1alpha1.PvcRestoredSnapshotAnnoKey)
+		if err := pc.client.Patch(ctx, pvc, patch); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("fail to clear restored snapshot of pvc %s: %s", pvc.Name, err)
+		}
+	}
+	return nil
+}
+
 // classify pvcs into old and new ones
 func classifyPodPvcs(cls *appsv1alpha1.CollaSet, id string, existingPvcs []*corev1.PersistentVolumeClaim) (*map[string]*corev1.PersistentVolumeClaim, *map[string]*corev1.PersistentVolumeClaim, error) {
 	newPvcs := map[string]*corev1.PersistentVolumeClaim{}
@@ -274,6 +363,11 @@ func classifyPodPvcs(cls *appsv1alpha1.CollaSet, id string, existingPvcs []*core
 			continue
 		}
 
+		// pvc waiting for its snapshot is going to be deleted, and should not be reused
+		if isPvcSnapshotPending(pvc) {
+			continue
+		}
+
 		if pvc.Labels == nil {
 			continue
 		}
@@ -350,9 +444,7 @@ func deleteUnclaimedPvcs(c client.Client, ctx context.Context, cls *appsv1alpha1
 			continue
 		}
 		// if pvc is not claimed in pvc templates, delete it
-		if err := c.Delete(ctx, pvc); err != nil {
-			return err
-		} else if err := collasetutils.ActiveExpectations.ExpectDelete(cls, expectations.Pvc, pvc.Name); err != nil {
+		if err := deletePvc(c, ctx, cls, pvc); err != nil {
 			return err
 		}
 	}
@@ -365,11 +457,140 @@ func deleteOldPvcs(c client.Client, ctx context.Context, cls *appsv1alpha1.Colla
 		if _, newPvcExist := (*newPvcs)[pvcTmpName]; !newPvcExist {
 			continue
 		}
-		if err := c.Delete(ctx, pvc); err != nil {
+		if err := deletePvc(c, ctx, cls, pvc); err != nil {
 			return err
-		} else if err := collasetutils.ActiveExpectations.ExpectDelete(cls, expectations.Pvc, pvc.Name); err != nil {
+		}
+	}
+	return nil
+}
+
+func isPvcNameOccupied(existingPvcs []*corev1.PersistentVolumeClaim, name string) bool {
+	for _, pvc := range existingPvcs {
+		if pvc.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// deletePvc deletes pvc. If WhenScaled is "Snapshot", pvc is deleted only after its snapshot is taken,
+// otherwise it is labeled as snapshot pending and deleted later in DeleteSnapshotPendingPvcs.
+func deletePvc(c client.Client, ctx context.Context, cls *appsv1alpha1.CollaSet, pvc *corev1.PersistentVolumeClaim) error {
+	if collasetutils.PvcPolicyWhenScaled(cls) == kuperatorv1alpha1.SnapshotPersistentVolumeClaimRetentionPolicyType {
+		taken, err := snapshotPvc(c, ctx, cls, pvc)
+		if err != nil {
 			return err
 		}
+		if !taken {
+			return markPvcSnapshotPending(c, ctx, pvc)
+		}
+	}
+
+	if err := c.Delete(ctx, pvc); err != nil {
+		return err
+	}
+	return collasetutils.ActiveExpectations.ExpectDelete(cls, expectations.Pvc, pvc.Name)
+}
+
+func isPvcSnapshotPending(pvc *corev1.PersistentVolumeClaim) bool {
+	_, exist := pvc.Labels[kuperatorv1alpha1.PvcSnapshotPendingLabelKey]
+	return exist
+}
+
+func markPvcSnapshotPending(c client.Client, ctx context.Context, pvc *corev1.PersistentVolumeClaim) error {
+	if isPvcSnapshotPending(pvc) {
+		return nil
+	}
+	patch := client.MergeFrom(pvc.DeepCopy())
+	if pvc.Labels == nil {
+		pvc.Labels = map[string]string{}
+	}
+	pvc.Labels[kuperatorv1alpha1.PvcSnapshotPendingLabelKey] = "true"
+	if err := c.Patch(ctx, pvc, patch); err != nil {
+		return fmt.Errorf("fail to mark pvc %s as snapshot pending: %s", pvc.Name, err)
+	}
+	return nil
+}
+
+// snapshotPvc creates a VolumeSnapshot of pvc if it does not exist yet, and returns true if the snapshot is taken.
+// The pvc is not safe to delete before that, since nothing protects it until snapshot controller handles the snapshot.
+func snapshotPvc(c client.Client, ctx context.Context, cls *appsv1alpha1.CollaSet, pvc *corev1.PersistentVolumeClaim) (bool, error) {
+	// snapshot controller protects the source pvc from being removed until the snapshot is taken
+	if controllerutil.ContainsFinalizer(pvc, collasetutils.PvcAsSnapshotSourceProtectionFinalizer) {
+		return true, nil
+	}
+
+	snapshot, err := collasetutils.BuildPvcSnapshot(cls, pvc)
+	if err != nil {
+		return false, err
+	}
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(collasetutils.VolumeSnapshotGVK)
+	err = c.Get(ctx, types.NamespacedName{Namespace: snapshot.GetNamespace(), Name: snapshot.GetName()}, existing)
+	if errors.IsNotFound(err) {
+		if err := c.Create(ctx, snapshot); err != nil {
+			if errors.IsAlreadyExists(err) {
+				return false, nil
+			}
+			return false, fmt.Errorf("fail to create snapshot for pvc %s: %s", pvc.Name, err)
+		}
+		return false, prunePvcSnapshots(c, ctx, cls, snapshot)
+	} else if err != nil {
+		return false, fmt.Errorf("fail to get snapshot of pvc %s: %s", pvc.Name, err)
+	}
+	return collasetutils.IsPvcSnapshotTaken(existing), nil
+}
+
+// prunePvcSnapshots deletes the oldest snapshots taken with the same instance id and pvc template
+// as the new snapshot, if they are beyond the history limit.
+func prunePvcSnapshots(c client.Client, ctx context.Context, cls *appsv1alpha1.CollaSet, snapshot *unstructured.Unstructured) error {
+	limit := collasetutils.PvcSnapshotHistoryLimit(cls)
+	if limit <= 0 {
+		return nil
+	}
+	labels := snapshot.GetLabels()
+	snapshotList := &unstructured.UnstructuredList{}
+	snapshotList.SetGroupVersionKind(collasetutils.VolumeSnapshotListGVK)
+	if err := c.List(ctx, snapshotList, client.InNamespace(cls.Namespace), client.MatchingLabels{
+		kuperatorv1alpha1.PvcSnapshotCollaSetLabelKey: cls.Name,
+		kuperatorv1alpha1.PvcTemplateNameLabelKey:     labels[kuperatorv1alpha1.PvcTemplateNameLabelKey],
+		appsv1alpha1.PodInstanceIDLabelKey:            labels[appsv1alpha1.PodInstanceIDLabelKey],
+	}); err != nil {
+		return fmt.Errorf("fail to list snapshots for id %s: %s", labels[appsv1alpha1.PodInstanceIDLabelKey], err)
+	}
+
+	for _, pruned := range collasetutils.PvcSnapshotsToPrune(snapshotList.Items, limit) {
+		if err := c.Delete(ctx, pruned); err != nil && !errors.IsNotFound(err) {
+			return fmt.Errorf("fail to prune snapshot %s: %s", pruned.GetName(), err)
+		}
+	}
+	return nil
+}
+
+func setPvcDataSourceFromSnapshot(c client.Client, ctx context.Context, cls *appsv1alpha1.CollaSet, pvcTmpName, id string, claim *corev1.PersistentVolumeClaim) error {
+	snapshotList := &unstructured.UnstructuredList{}
+	snapshotList.SetGroupVersionKind(collasetutils.VolumeSnapshotListGVK)
+	if err := c.List(ctx, snapshotList, client.InNamespace(cls.Namespace), client.MatchingLabels{
+		kuperatorv1alpha1.PvcSnapshotCollaSetLabelKey: cls.Name,
+		kuperatorv1alpha1.PvcTemplateNameLabelKey:     pvcTmpName,
+		appsv1alpha1.PodInstanceIDLabelKey:            id,
+	}); err != nil {
+		return fmt.Errorf("fail to list snapshots for id %s: %s", id, err)
+	}
+
+	snapshot := collasetutils.LatestReadyPvcSnapshot(snapshotList.Items)
+	if snapshot == nil {
+		return nil
+	}
+	apiGroup := collasetutils.VolumeSnapshotGVK.Group
+	claim.Spec.DataSource = &corev1.TypedLocalObjectReference{
+		APIGroup: &apiGroup,
+		Kind:     collasetutils.VolumeSnapshotGVK.Kind,
+		Name:     snapshot.GetName(),
+	}
+	if claim.Annotations == nil {
+		claim.Annotations = map[string]string{}
 	}
+	claim.Annotations[kuperatorv1alpha1.PvcRestoredSnapshotAnnoKey] = snapshot.GetName()
 	return nil
 }
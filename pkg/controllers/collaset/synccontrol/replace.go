@@ -153,6 +153,11 @@ func (r *RealSyncControl) replaceOriginPods(
 			ownedIDs[newPodId].Put(ReplaceOriginPodIDContextDataKey, strconv.Itoa(originPodId))
 			ownedIDs[newPodId].Remove(podcontext.JustCreateContextDataKey)
 		}
+		if collasetutils.IsNamedByInstanceID(instance) {
+			// new pod runs alongside the origin one and takes a new instance id, so it can not keep the
+			// origin pod name. It is named by its own id, and its name and hostname change after replacing.
+			collasetutils.NamePodByInstanceID(instance, newPod, newPodContext.ID)
+		}
 		newPod.Labels[appsv1alpha1.PodReplacePairOriginName] = originPod.GetName()
 		newPodContext.Put(podcontext.RevisionContextDataKey, replaceRevision.Name)
 		// create pvcs for new pod
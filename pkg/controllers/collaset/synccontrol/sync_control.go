@@ -26,6 +26,7 @@ import (
 	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -122,6 +123,14 @@ func (r *RealSyncControl) SyncPods(
 	} else {
 		resources.ExistingPvcs = append(resources.ExistingPvcs, adoptedPvcs...)
 	}
+	// delete pvcs whose snapshots have been taken since last reconcile
+	if resources.PvcSnapshotPending, err = r.pvcControl.DeleteSnapshotPendingPvcs(ctx, instance, resources.ExistingPvcs); err != nil {
+		return false, nil, nil, fmt.Errorf("fail to delete snapshot pending PVCs: %s", err)
+	}
+	// clean up snapshots which pvcs have been restored from
+	if err = r.pvcControl.DeleteRestoredPvcSnapshots(ctx, instance, resources.ExistingPvcs); err != nil {
+		return false, nil, nil, fmt.Errorf("fail to delete restored PVC snapshots: %s", err)
+	}
 
 	needReplaceOriginPods, needCleanLabelPods, podsNeedCleanLabels, needDeletePods, replaceIndicateCount := dealReplacePods(filteredPods)
 
@@ -375,6 +384,9 @@ func (r *RealSyncControl) Scale(
 				if err != nil {
 					return fmt.Errorf("fail to new Pod from revision %s: %s", revision.Name, err)
 				}
+				if collasetutils.IsNamedByInstanceID(cls) {
+					collasetutils.NamePodByInstanceID(cls, pod, availableIDContext.ID)
+				}
 				err = r.pvcControl.CreatePodPvcs(ctx, cls, pod, resources.ExistingPvcs)
 				if err != nil {
 					return fmt.Errorf("fail to create PVCs for pod %s: %s", pod.Name, err)
@@ -382,6 +394,10 @@ func (r *RealSyncControl) Scale(
 				newPod := pod.DeepCopy()
 				logger.V(1).Info("try to create Pod with revision of collaSet", "revision", revision.Name)
 				if pod, err = r.podControl.CreatePod(newPod); err != nil {
+					if errors.IsAlreadyExists(err) && collasetutils.IsNamedByInstanceID(cls) {
+						// Pod with the same instance id is still terminating, wait for it to be deleted
+						return fmt.Errorf("fail to create Pod %s, the previous one may be still terminating: %s", newPod.Name, err)
+					}
 					return err
 				}
 				// add an expectation for this pod creation, before next reconciling
@@ -500,10 +516,10 @@ func (r *RealSyncControl) Scale(
 				return err
 			}
 
-			// delete PVC if pod is in update replace, or retention policy is "Deleted"
+			// delete PVC if pod is in update replace, or retention policy is "Delete" or "Snapshot"
 			_, originExist := pod.Labels[appsv1alpha1.PodReplacePairNewId]
 			_, replaceExist := pod.Labels[appsv1alpha1.PodReplacePairOriginName]
-			if originExist || replaceExist || collasetutils.PvcPolicyWhenScaled(cls) == appsv1alpha1.DeletePersistentVolumeClaimRetentionPolicyType {
+			if originExist || replaceExist || collasetutils.IsPvcDeletedByPolicy(collasetutils.PvcPolicyWhenScaled(cls)) {
 				return r.pvcControl.DeletePodPvcs(ctx, cls, pod.Pod, resources.ExistingPvcs)
 			}
 			return nil
@@ -28,8 +28,10 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 	controllerutils "kusionstack.io/kuperator/pkg/controllers/utils"
 	revisionutils "kusionstack.io/kuperator/pkg/controllers/utils/revision"
 	"kusionstack.io/kuperator/pkg/utils"
@@ -176,6 +178,30 @@ func GetPodsPrefix(controllerName string) string {
 	return prefix
 }
 
+func IsNamedByInstanceID(cls *appsv1alpha1.CollaSet) bool {
+	return cls.Annotations != nil && cls.Annotations[kuperatorv1alpha1.CollaSetNamingPolicyAnnoKey] == kuperatorv1alpha1.InstanceIDNamingPolicy
+}
+
+func GetPodNameByInstanceID(clsName string, id int) string {
+	return fmt.Sprintf("%s-%d", clsName, id)
+}
+
+// NamePodByInstanceID names pod <collaset>-<id>, and sets its hostname and subdomain
+// so that it can be resolved as <collaset>-<id>.<subdomain> through a headless service.
+// Subdomain in pod template takes precedence, otherwise CollaSet name is used.
+func NamePodByInstanceID(cls *appsv1alpha1.CollaSet, pod *corev1.Pod, id int) {
+	pod.Name = GetPodNameByInstanceID(cls.Name, id)
+	pod.GenerateName = ""
+
+	// hostname and subdomain must be DNS labels, leave them empty if names are too long
+	if len(validation.IsDNS1123Label(pod.Name)) == 0 {
+		pod.Spec.Hostname = pod.Name
+	}
+	if pod.Spec.Subdomain == "" && len(validation.IsDNS1123Label(cls.Name)) == 0 {
+		pod.Spec.Subdomain = cls.Name
+	}
+}
+
 func ComparePod(l, r *corev1.Pod) bool {
 	// 1. Unassigned < assigned
 	// If only one of the pods is unassigned, the unassigned one is smaller
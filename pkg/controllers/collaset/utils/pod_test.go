@@ -29,6 +29,8 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 )
 
 var _ = Describe("Pod utils", func() {
@@ -99,6 +101,26 @@ var _ = Describe("Pod utils", func() {
 			})
 		Expect(err).ShouldNot(BeNil())
 	})
+	It("test name pod by instance id", func() {
+		cls := &appsv1alpha1.CollaSet{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"}}
+		Expect(IsNamedByInstanceID(cls)).Should(BeFalse())
+		cls.Annotations = map[string]string{
+			kuperatorv1alpha1.CollaSetNamingPolicyAnnoKey: kuperatorv1alpha1.InstanceIDNamingPolicy,
+		}
+		Expect(IsNamedByInstanceID(cls)).Should(BeTrue())
+
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{GenerateName: GetPodsPrefix(cls.Name)}}
+		NamePodByInstanceID(cls, pod, 3)
+		Expect(pod.Name).Should(Equal("foo-3"))
+		Expect(pod.GenerateName).Should(BeEmpty())
+		Expect(pod.Spec.Hostname).Should(Equal("foo-3"))
+		Expect(pod.Spec.Subdomain).Should(Equal("foo"))
+
+		// keep subdomain declared in pod template
+		pod = &corev1.Pod{Spec: corev1.PodSpec{Subdomain: "foo-headless"}}
+		NamePodByInstanceID(cls, pod, 3)
+		Expect(pod.Spec.Subdomain).Should(Equal("foo-headless"))
+	})
 	It("test patch pods", func() {
 		currentRevisionPod := &corev1.Pod{
 			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"foo": "bar"}},
@@ -20,15 +20,32 @@ import (
 	"encoding/json"
 	"fmt"
 	"hash/fnv"
+	"sort"
+	"strconv"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/util/rand"
 
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+)
+
+var (
+	// VolumeSnapshotGVK is the kind of snapshots taken before pvcs are deleted.
+	// It is handled as unstructured object to avoid depending on external-snapshotter client.
+	VolumeSnapshotGVK     = schema.GroupVersionKind{Group: "snapshot.storage.k8s.io", Version: "v1", Kind: "VolumeSnapshot"}
+	VolumeSnapshotListGVK = schema.GroupVersionKind{Group: "snapshot.storage.k8s.io", Version: "v1", Kind: "VolumeSnapshotList"}
 )
 
+// PvcAsSnapshotSourceProtectionFinalizer is added to the source pvc by snapshot controller,
+// and prevents the pvc from being removed while its snapshot is being taken.
+const PvcAsSnapshotSourceProtectionFinalizer = "snapshot.storage.kubernetes.io/pvc-as-source-protection"
+
 func BuildPvcWithHash(cls *appsv1alpha1.CollaSet, pvcTmp *corev1.PersistentVolumeClaim, id string) (*corev1.PersistentVolumeClaim, error) {
 	claim := pvcTmp.DeepCopy()
 	claim.Name = ""
@@ -51,10 +68,25 @@ func BuildPvcWithHash(cls *appsv1alpha1.CollaSet, pvcTmp *corev1.PersistentVolum
 	}
 	claim.Labels[appsv1alpha1.PvcTemplateHashLabelKey] = hash
 	claim.Labels[appsv1alpha1.PodInstanceIDLabelKey] = id
+	claim.Labels[kuperatorv1alpha1.PvcTemplateNameLabelKey] = pvcTmp.Name
+
+	if IsNamedByInstanceID(cls) {
+		claim.Name = GetPvcNameByInstanceID(cls.Name, pvcTmp.Name, id)
+		claim.GenerateName = ""
+	}
 	return claim, nil
 }
 
+func GetPvcNameByInstanceID(clsName, pvcTmpName, id string) string {
+	return fmt.Sprintf("%s-%s-%s", pvcTmpName, clsName, id)
+}
+
 func ExtractPvcTmpName(cls *appsv1alpha1.CollaSet, pvc *corev1.PersistentVolumeClaim) (string, error) {
+	// pvc template name is recorded in label since pvcs may be named by instance id
+	if pvcTmpName, exist := pvc.Labels[kuperatorv1alpha1.PvcTemplateNameLabelKey]; exist && pvcTmpName != "" {
+		return pvcTmpName, nil
+	}
+
 	lastDashIndex := strings.LastIndex(pvc.Name, "-")
 	if lastDashIndex == -1 {
 		return "", fmt.Errorf("pvc %s has no postfix", pvc.Name)
@@ -115,3 +147,156 @@ func PvcPolicyWhenDelete(cls *appsv1alpha1.CollaSet) appsv1alpha1.PersistentVolu
 	}
 	return cls.Spec.ScaleStrategy.PersistentVolumeClaimRetentionPolicy.WhenDeleted
 }
+
+// IsPvcDeletedByPolicy returns true if pvcs should be deleted under the retention policy.
+// Pvcs are also deleted under "Snapshot" policy, after their snapshots are created.
+func IsPvcDeletedByPolicy(policy appsv1alpha1.PersistentVolumeClaimRetentionPolicyType) bool {
+	return policy == appsv1alpha1.DeletePersistentVolumeClaimRetentionPolicyType ||
+		policy == kuperatorv1alpha1.SnapshotPersistentVolumeClaimRetentionPolicyType
+}
+
+func PvcSnapshotName(pvc *corev1.PersistentVolumeClaim) string {
+	// pvc uid keeps snapshot names unique among pvcs sharing the same name
+	hf := fnv.New32()
+	hf.Write([]byte(pvc.UID))
+	return fmt.Sprintf("%s-%s", pvc.Name, rand.SafeEncodeString(fmt.Sprint(hf.Sum32())))
+}
+
+func BuildPvcSnapshot(cls *appsv1alpha1.CollaSet, pvc *corev1.PersistentVolumeClaim) (*unstructured.Unstructured, error) {
+	pvcTmpName, err := ExtractPvcTmpName(cls, pvc)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetGroupVersionKind(VolumeSnapshotGVK)
+	snapshot.SetNamespace(pvc.Namespace)
+	snapshot.SetName(PvcSnapshotName(pvc))
+	// snapshots are not owned by CollaSet by default, so that they survive the deletion of CollaSet
+	if PvcSnapshotCleanupPolicy(cls) == kuperatorv1alpha1.DeleteWithCollaSetPvcSnapshotCleanupPolicy {
+		snapshot.SetOwnerReferences([]metav1.OwnerReference{
+			*metav1.NewControllerRef(cls, appsv1alpha1.SchemeGroupVersion.WithKind("CollaSet"))})
+	}
+	snapshot.SetLabels(map[string]string{
+		appsv1alpha1.ControlledByKusionStackLabelKey:  "true",
+		kuperatorv1alpha1.PvcSnapshotCollaSetLabelKey: cls.Name,
+		kuperatorv1alpha1.PvcTemplateNameLabelKey:     pvcTmpName,
+		appsv1alpha1.PodInstanceIDLabelKey:            pvc.Labels[appsv1alpha1.PodInstanceIDLabelKey],
+	})
+
+	spec := map[string]interface{}{
+		"source": map[string]interface{}{
+			"persistentVolumeClaimName": pvc.Name,
+		},
+	}
+	if class := cls.Annotations[kuperatorv1alpha1.CollaSetPvcSnapshotClassAnnoKey]; class != "" {
+		spec["volumeSnapshotClassName"] = class
+	}
+	if err := unstructured.SetNestedMap(snapshot.Object, spec, "spec"); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+func IsPvcRestoredFromSnapshot(cls *appsv1alpha1.CollaSet) bool {
+	return cls.Annotations != nil && cls.Annotations[kuperatorv1alpha1.CollaSetPvcRestoreFromSnapshotAnnoKey] == "true"
+}
+
+// IsPvcSnapshotTaken returns true if the snapshot is ready to use, or bound to its VolumeSnapshotContent.
+func IsPvcSnapshotTaken(snapshot *unstructured.Unstructured) bool {
+	if ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse"); ready {
+		return true
+	}
+	content, _, _ := unstructured.NestedString(snapshot.Object, "status", "boundVolumeSnapshotContentName")
+	return content != ""
+}
+
+// LatestReadyPvcSnapshot returns the latest snapshot which is ready to use, or nil if there is none.
+func LatestReadyPvcSnapshot(snapshots []unstructured.Unstructured) *unstructured.Unstructured {
+	var latest *unstructured.Unstructured
+	for i := range snapshots {
+		snapshot := &snapshots[i]
+		if snapshot.GetDeletionTimestamp() != nil {
+			continue
+		}
+		if ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse"); !ready {
+			continue
+		}
+		if latest == nil {
+			latest = snapshot
+			continue
+		}
+		latestTime, snapshotTime := latest.GetCreationTimestamp(), snapshot.GetCreationTimestamp()
+		if latestTime.Before(&snapshotTime) {
+			latest = snapshot
+		}
+	}
+	return latest
+}
+
+// PvcSnapshotCleanupPolicy returns the cleanup policy of snapshots taken by CollaSet, "Retain" by default.
+func PvcSnapshotCleanupPolicy(cls *appsv1alpha1.CollaSet) string {
+	if policy := cls.Annotations[kuperatorv1alpha1.CollaSetPvcSnapshotCleanupPolicyAnnoKey]; policy != "" {
+		return policy
+	}
+	return kuperatorv1alpha1.RetainPvcSnapshotCleanupPolicy
+}
+
+// PvcSnapshotHistoryLimit returns the max number of snapshots kept for each instance id and pvc template.
+// It returns 0 if snapshots are not limited.
+func PvcSnapshotHistoryLimit(cls *appsv1alpha1.CollaSet) int {
+	limit, err := strconv.Atoi(cls.Annotations[kuperatorv1alpha1.CollaSetPvcSnapshotHistoryLimitAnnoKey])
+	if err != nil || limit < 0 {
+		return 0
+	}
+	return limit
+}
+
+// PvcSnapshotsToPrune returns the oldest snapshots beyond limit. The latest ready snapshot, which new pvcs are
+// restored from, and the newest snapshot, which may be still being taken, are never pruned.
+func PvcSnapshotsToPrune(snapshots []unstructured.Unstructured, limit int) []*unstructured.Unstructured {
+	if limit <= 0 {
+		return nil
+	}
+	latestReady := LatestReadyPvcSnapshot(snapshots)
+	var candidates []*unstructured.Unstructured
+	for i := range snapshots {
+		if snapshots[i].GetDeletionTimestamp() == nil {
+			candidates = append(candidates, &snapshots[i])
+		}
+	}
+	if len(candidates) <= limit {
+		return nil
+	}
+
+	// newest first
+	sort.SliceStable(candidates, func(i, j int) bool {
+		iTime, jTime := candidates[i].GetCreationTimestamp(), candidates[j].GetCreationTimestamp()
+		return jTime.Before(&iTime)
+	})
+	var pruned []*unstructured.Unstructured
+	kept := 0
+	if latestReady != nil {
+		kept++
+	}
+	for i, snapshot := range candidates {
+		if latestReady != nil && snapshot.GetName() == latestReady.GetName() {
+			continue
+		}
+		if i == 0 || kept < limit {
+			kept++
+			continue
+		}
+		pruned = append(pruned, snapshot)
+	}
+	return pruned
+}
+
+// RestoredPvcSnapshotName returns the name of snapshot which pvc is restored from,
+// if the pvc is bound and the snapshot is not cleaned up yet.
+func RestoredPvcSnapshotName(pvc *corev1.PersistentVolumeClaim) string {
+	if pvc.Status.Phase != corev1.ClaimBound {
+		return ""
+	}
+	return pvc.Annotations[kuperatorv1alpha1.PvcRestoredSnapshotAnnoKey]
+}
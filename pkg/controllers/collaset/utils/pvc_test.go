@@ -17,14 +17,19 @@ limitations under the License.
 package utils
 
 import (
+	"time"
+
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 )
 
 var _ = Describe("Pvc utils", func() {
@@ -104,6 +109,124 @@ var _ = Describe("Pvc utils", func() {
 		Expect(PvcPolicyWhenScaled(cs)).Should(BeEquivalentTo(appsv1alpha1.RetainPersistentVolumeClaimRetentionPolicyType))
 		Expect(PvcPolicyWhenDelete(cs)).Should(BeEquivalentTo(appsv1alpha1.RetainPersistentVolumeClaimRetentionPolicyType))
 
+		cs.Annotations = map[string]string{
+			kuperatorv1alpha1.CollaSetNamingPolicyAnnoKey: kuperatorv1alpha1.InstanceIDNamingPolicy,
+		}
+		pvc, _ = BuildPvcWithHash(cs, &cs.Spec.VolumeClaimTemplates[0], "0")
+		Expect(pvc.Name).Should(BeEquivalentTo("pvc1-foo-0"))
+		Expect(pvc.GenerateName).Should(BeEmpty())
+		pvcTmpName, _ = ExtractPvcTmpName(cs, pvc)
+		Expect(pvcTmpName).Should(BeEquivalentTo(cs.Spec.VolumeClaimTemplates[0].Name))
+
+		Expect(IsPvcDeletedByPolicy(appsv1alpha1.DeletePersistentVolumeClaimRetentionPolicyType)).Should(BeTrue())
+		Expect(IsPvcDeletedByPolicy(kuperatorv1alpha1.SnapshotPersistentVolumeClaimRetentionPolicyType)).Should(BeTrue())
+		Expect(IsPvcDeletedByPolicy(appsv1alpha1.RetainPersistentVolumeClaimRetentionPolicyType)).Should(BeFalse())
+	})
+
+	It("test pvc snapshot", func() {
+		cs := &appsv1alpha1.CollaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "foo",
+				Annotations: map[string]string{
+					kuperatorv1alpha1.CollaSetPvcSnapshotClassAnnoKey: "csi-snapclass",
+				},
+			},
+		}
+		pvc := &corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "foo-pvc1-abcde",
+				UID:       "uid-1",
+				Labels: map[string]string{
+					appsv1alpha1.PodInstanceIDLabelKey: "2",
+				},
+			},
+		}
+
+		snapshot, err := BuildPvcSnapshot(cs, pvc)
+		Expect(err).Should(BeNil())
+		Expect(snapshot.GetName()).Should(BeEquivalentTo(PvcSnapshotName(pvc)))
+		Expect(snapshot.GetLabels()[kuperatorv1alpha1.PvcSnapshotCollaSetLabelKey]).Should(BeEquivalentTo("foo"))
+		Expect(snapshot.GetLabels()[kuperatorv1alpha1.PvcTemplateNameLabelKey]).Should(BeEquivalentTo("pvc1"))
+		Expect(snapshot.GetLabels()[appsv1alpha1.PodInstanceIDLabelKey]).Should(BeEquivalentTo("2"))
+		source, _, _ := unstructured.NestedString(snapshot.Object, "spec", "source", "persistentVolumeClaimName")
+		Expect(source).Should(BeEquivalentTo(pvc.Name))
+		class, _, _ := unstructured.NestedString(snapshot.Object, "spec", "volumeSnapshotClassName")
+		Expect(class).Should(BeEquivalentTo("csi-snapclass"))
+
+		// pvc with same name but different uid gets a different snapshot
+		recreated := pvc.DeepCopy()
+		recreated.UID = "uid-2"
+		Expect(PvcSnapshotName(recreated)).ShouldNot(BeEquivalentTo(PvcSnapshotName(pvc)))
+
+		Expect(IsPvcRestoredFromSnapshot(cs)).Should(BeFalse())
+		cs.Annotations[kuperatorv1alpha1.CollaSetPvcRestoreFromSnapshotAnnoKey] = "true"
+		Expect(IsPvcRestoredFromSnapshot(cs)).Should(BeTrue())
+
+		now := metav1.Now()
+		newSnapshot := func(name string, ts metav1.Time, ready bool) unstructured.Unstructured {
+			s := unstructured.Unstructured{Object: map[string]interface{}{}}
+			s.SetName(name)
+			s.SetCreationTimestamp(ts)
+			_ = unstructured.SetNestedField(s.Object, ready, "status", "readyToUse")
+			return s
+		}
+		Expect(LatestReadyPvcSnapshot(nil)).Should(BeNil())
+		latest := LatestReadyPvcSnapshot([]unstructured.Unstructured{
+			newSnapshot("old", metav1.NewTime(now.Add(-time.Hour)), true),
+			newSnapshot("latest", now, true),
+			newSnapshot("not-ready", metav1.NewTime(now.Add(time.Hour)), false),
+		})
+		Expect(latest.GetName()).Should(BeEquivalentTo("latest"))
+
+		// pvc is safe to delete only after its snapshot is taken
+		pending := newSnapshot("pending", now, false)
+		Expect(IsPvcSnapshotTaken(&pending)).Should(BeFalse())
+		_ = unstructured.SetNestedField(pending.Object, "snapcontent-1", "status", "boundVolumeSnapshotContentName")
+		Expect(IsPvcSnapshotTaken(&pending)).Should(BeTrue())
+		ready := newSnapshot("ready", now, true)
+		Expect(IsPvcSnapshotTaken(&ready)).Should(BeTrue())
+
+		// snapshots are owned by CollaSet only if they are deleted with it
+		Expect(PvcSnapshotCleanupPolicy(cs)).Should(BeEquivalentTo(kuperatorv1alpha1.RetainPvcSnapshotCleanupPolicy))
+		Expect(snapshot.GetOwnerReferences()).Should(BeEmpty())
+		cs.Annotations[kuperatorv1alpha1.CollaSetPvcSnapshotCleanupPolicyAnnoKey] = kuperatorv1alpha1.DeleteWithCollaSetPvcSnapshotCleanupPolicy
+		snapshot, err = BuildPvcSnapshot(cs, pvc)
+		Expect(err).Should(BeNil())
+		Expect(snapshot.GetOwnerReferences()).Should(HaveLen(1))
+		Expect(snapshot.GetOwnerReferences()[0].Name).Should(BeEquivalentTo("foo"))
+
+		Expect(PvcSnapshotHistoryLimit(cs)).Should(BeEquivalentTo(0))
+		cs.Annotations[kuperatorv1alpha1.CollaSetPvcSnapshotHistoryLimitAnnoKey] = "2"
+		Expect(PvcSnapshotHistoryLimit(cs)).Should(BeEquivalentTo(2))
+
+		snapshots := []unstructured.Unstructured{
+			newSnapshot("oldest", metav1.NewTime(now.Add(-2*time.Hour)), true),
+			newSnapshot("latest-ready", metav1.NewTime(now.Add(-time.Hour)), true),
+			newSnapshot("not-ready", now, false),
+			newSnapshot("new", metav1.NewTime(now.Add(time.Hour)), false),
+		}
+		Expect(PvcSnapshotsToPrune(snapshots, 0)).Should(BeEmpty())
+		Expect(PvcSnapshotsToPrune(snapshots, 4)).Should(BeEmpty())
+		// latest ready snapshot is kept as one of the limit
+		pruned := PvcSnapshotsToPrune(snapshots, 2)
+		Expect(pruned).Should(HaveLen(2))
+		Expect(pruned[0].GetName()).Should(BeEquivalentTo("not-ready"))
+		Expect(pruned[1].GetName()).Should(BeEquivalentTo("oldest"))
+		// newest snapshot is kept even beyond the limit, since it may be still being taken
+		pruned = PvcSnapshotsToPrune(snapshots, 1)
+		Expect(pruned).Should(HaveLen(2))
+		pruned = PvcSnapshotsToPrune(snapshots[2:], 1)
+		Expect(pruned).Should(HaveLen(1))
+		Expect(pruned[0].GetName()).Should(BeEquivalentTo("not-ready"))
+
+		// restored snapshot is cleaned up after the pvc is bound
+		restored := pvc.DeepCopy()
+		restored.Annotations = map[string]string{kuperatorv1alpha1.PvcRestoredSnapshotAnnoKey: "latest-ready"}
+		Expect(RestoredPvcSnapshotName(restored)).Should(BeEquivalentTo(""))
+		restored.Status.Phase = corev1.ClaimBound
+		Expect(RestoredPvcSnapshotName(restored)).Should(BeEquivalentTo("latest-ready"))
 	})
 })
 
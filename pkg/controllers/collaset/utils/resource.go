@@ -29,6 +29,8 @@ type RelatedResources struct {
 	CurrentRevision *appsv1.ControllerRevision
 	UpdatedRevision *appsv1.ControllerRevision
 	ExistingPvcs    []*corev1.PersistentVolumeClaim
+	// PvcSnapshotPending is true if some pvcs are waiting for their snapshots to be taken before deleted
+	PvcSnapshotPending bool
 
 	PDGetter utilspoddecoration.Getter
 
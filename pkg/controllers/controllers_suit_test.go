@@ -32,6 +32,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 	"kusionstack.io/kuperator/pkg/utils/inject"
 )
 
@@ -60,6 +61,7 @@ var _ = BeforeSuite(func() {
 	sch := scheme.Scheme
 	Expect(appsv1.SchemeBuilder.AddToScheme(sch)).NotTo(HaveOccurred())
 	Expect(appsv1alpha1.SchemeBuilder.AddToScheme(sch)).NotTo(HaveOccurred())
+	Expect(kuperatorv1alpha1.AddToScheme(sch)).NotTo(HaveOccurred())
 	mgr, err = manager.New(config, manager.Options{
 		MetricsBindAddress: "0",
 		NewCache:           inject.NewCacheWithFieldIndex,
@@ -0,0 +1,209 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package disruptionbudget
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+	controllerutils "kusionstack.io/kuperator/pkg/controllers/utils"
+	budgetutils "kusionstack.io/kuperator/pkg/controllers/utils/disruptionbudget"
+	"kusionstack.io/kuperator/pkg/controllers/utils/podopslifecycle"
+	"kusionstack.io/kuperator/pkg/utils/mixin"
+)
+
+const (
+	controllerName = "disruptionbudget-controller"
+
+	// reservationGracePeriod keeps new reservations of pods which have not begun to operate in cache
+	reservationGracePeriod = time.Minute
+)
+
+func Add(mgr manager.Manager) error {
+	return AddToMgr(mgr, NewReconciler(mgr))
+}
+
+// NewReconciler returns a new reconcile.Reconciler
+func NewReconciler(mgr manager.Manager) reconcile.Reconciler {
+	return &DisruptionBudgetReconciler{
+		ReconcilerMixin: mixin.NewReconcilerMixin(controllerName, mgr),
+	}
+}
+
+// AddToMgr adds a new Controller to mgr with r as the reconcile.Reconciler
+func AddToMgr(mgr manager.Manager, r reconcile.Reconciler) error {
+	c, err := controller.New(controllerName, mgr, controller.Options{
+		MaxConcurrentReconciles: 5,
+		Reconciler:              r,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &kuperatorv1alpha1.DisruptionBudget{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	managerClient := mgr.GetClient()
+	// Watch for changes of Pods selected by DisruptionBudgets
+	err = c.Watch(&source.Kind{Type: &corev1.Pod{}}, handler.EnqueueRequestsFromMapFunc(func(podObject client.Object) []reconcile.Request {
+		pod, ok := podObject.(*corev1.Pod)
+		if !ok {
+			return nil
+		}
+		budgets, err := budgetutils.GetMatchedBudgets(context.TODO(), managerClient, pod)
+		if err != nil {
+			return nil
+		}
+		var requests []reconcile.Request
+		for _, budget := range budgets {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: budget.Namespace, Name: budget.Name}})
+		}
+		return requests
+	}))
+	return err
+}
+
+// DisruptionBudgetReconciler reconciles a DisruptionBudget object
+type DisruptionBudgetReconciler struct {
+	*mixin.ReconcilerMixin
+}
+
+// +kubebuilder:rbac:groups=apps.kusionstack.io,resources=disruptionbudgets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps.kusionstack.io,resources=disruptionbudgets/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+
+// Reconcile counts pods selected by DisruptionBudget, and releases slots reserved by pods which finish operating.
+func (r *DisruptionBudgetReconciler) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	logger := r.Logger.WithValues("disruptionBudget", request.String())
+	budget := &kuperatorv1alpha1.DisruptionBudget{}
+	if err := r.Client.Get(ctx, request.NamespacedName, budget); err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	pods, err := r.getSelectedPods(ctx, budget)
+	if err != nil {
+		logger.Error(err, "failed to get selected pods")
+		return reconcile.Result{}, err
+	}
+
+	// release reservations of pods which finish operating, or are no longer selected
+	var requeueAfter time.Duration
+	reserved := sets.NewString()
+	newStatus := budget.Status.DeepCopy()
+	newStatus.Reservations = nil
+	for _, reservation := range budget.Status.Reservations {
+		pod, exist := pods[reservation.Pod]
+		if exist && !podopslifecycle.IsPodOperating(pod) && controllerutils.IsPodReady(pod) {
+			if sinceReserved := time.Since(reservation.ReserveTime.Time); sinceReserved < reservationGracePeriod {
+				requeueAfter = reservationGracePeriod - sinceReserved
+			} else {
+				exist = false
+			}
+		}
+		if !exist {
+			logger.Info("release reservation", "pod", reservation.Pod, "holder", reservation.Holder)
+			continue
+		}
+		reserved.Insert(reservation.Pod)
+		newStatus.Reservations = append(newStatus.Reservations, reservation)
+	}
+
+	unavailable := 0
+	for key, pod := range pods {
+		if !reserved.Has(key) && (pod.DeletionTimestamp != nil || !controllerutils.IsPodReady(pod)) {
+			unavailable++
+		}
+	}
+	newStatus.ObservedGeneration = budget.Generation
+	newStatus.TotalPods = int32(len(pods))
+	newStatus.UnavailablePods = int32(unavailable)
+	newBudget := budget.DeepCopy()
+	newBudget.Status = *newStatus
+	allowed, err := budgetutils.DisruptionsAllowed(newBudget)
+	if err != nil {
+		return reconcile.Result{}, fmt.Errorf("fail to get disruptions allowed: %s", err)
+	}
+	newBudget.Status.DisruptionsAllowed = int32(allowed)
+
+	if !equality.Semantic.DeepEqual(newBudget.Status, budget.Status) {
+		// update with resourceVersion, retry later if reserved by others concurrently
+		if err := r.Client.Status().Update(ctx, newBudget); err != nil {
+			return reconcile.Result{}, fmt.Errorf("fail to update status of DisruptionBudget %s: %s", request, err)
+		}
+	}
+	return reconcile.Result{RequeueAfter: requeueAfter}, nil
+}
+
+func (r *DisruptionBudgetReconciler) getSelectedPods(ctx context.Context, budget *kuperatorv1alpha1.DisruptionBudget) (map[string]*corev1.Pod, error) {
+	pods := map[string]*corev1.Pod{}
+	if budget.Spec.Selector == nil {
+		return pods, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(budget.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	var namespaces []string
+	if budget.Spec.NamespaceSelector == nil {
+		namespaces = []string{budget.Namespace}
+	} else {
+		namespaceSelector, err := metav1.LabelSelectorAsSelector(budget.Spec.NamespaceSelector)
+		if err != nil {
+			return nil, err
+		}
+		namespaceList := &corev1.NamespaceList{}
+		if err := r.Client.List(ctx, namespaceList, &client.ListOptions{LabelSelector: namespaceSelector}); err != nil {
+			return nil, err
+		}
+		for _, namespace := range namespaceList.Items {
+			namespaces = append(namespaces, namespace.Name)
+		}
+	}
+
+	for _, namespace := range namespaces {
+		podList := &corev1.PodList{}
+		if err := r.Client.List(ctx, podList, &client.ListOptions{Namespace: namespace, LabelSelector: selector}); err != nil {
+			return nil, err
+		}
+		for i := range podList.Items {
+			pods[budgetutils.PodKey(&podList.Items[i])] = &podList.Items[i]
+		}
+	}
+	return pods, nil
+}
@@ -0,0 +1,470 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodedrain
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+	controllerutils "kusionstack.io/kuperator/pkg/controllers/utils"
+	"kusionstack.io/kuperator/pkg/utils"
+	"kusionstack.io/kuperator/pkg/utils/inject"
+	"kusionstack.io/kuperator/pkg/utils/mixin"
+)
+
+const (
+	controllerName = "nodedrain-controller"
+
+	// evictionRetryInterval is the interval to retry evictions rejected, e.g. by PodDisruptionBudgets
+	evictionRetryInterval = 5 * time.Second
+
+	ReasonEvictionRejected = "EvictionRejected"
+	ReasonUpdatePodFailed  = "UpdatePodFailed"
+	ReasonUnmanagedPod     = "UnmanagedPod"
+	ReasonDrainTimeout     = "DrainTimeout"
+)
+
+// podEvictor evicts pods through Eviction API
+type podEvictor interface {
+	Evict(ctx context.Context, pod *corev1.Pod) error
+}
+
+type defaultPodEvictor struct {
+	clientset kubernetes.Interface
+}
+
+func (e *defaultPodEvictor) Evict(ctx context.Context, pod *corev1.Pod) error {
+	return e.clientset.PolicyV1().Evictions(pod.Namespace).Evict(ctx, &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name},
+	})
+}
+
+func Add(mgr manager.Manager) error {
+	return AddToMgr(mgr, NewReconciler(mgr))
+}
+
+// NewReconciler returns a new reconcile.Reconciler
+func NewReconciler(mgr manager.Manager) reconcile.Reconciler {
+	return &NodeDrainReconciler{
+		ReconcilerMixin: mixin.NewReconcilerMixin(controllerName, mgr),
+		evictor:         &defaultPodEvictor{clientset: kubernetes.NewForConfigOrDie(mgr.GetConfig())},
+	}
+}
+
+// AddToMgr adds a new Controller to mgr with r as the reconcile.Reconciler
+func AddToMgr(mgr manager.Manager, r reconcile.Reconciler) error {
+	c, err := controller.New(controllerName, mgr, controller.Options{
+		MaxConcurrentReconciles: 5,
+		Reconciler:              r,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &kuperatorv1alpha1.NodeDrain{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	managerClient := mgr.GetClient()
+	// Watch for changes of pods on nodes being drained
+	err = c.Watch(&source.Kind{Type: &corev1.Pod{}}, handler.EnqueueRequestsFromMapFunc(func(podObject client.Object) []reconcile.Request {
+		pod, ok := podObject.(*corev1.Pod)
+		if !ok || pod.Spec.NodeName == "" {
+			return nil
+		}
+		drains := &kuperatorv1alpha1.NodeDrainList{}
+		if err := managerClient.List(context.TODO(), drains); err != nil {
+			return nil
+		}
+		var requests []reconcile.Request
+		for i := range drains.Items {
+			drain := &drains.Items[i]
+			if drain.Spec.NodeName == pod.Spec.NodeName && !isDrainFinished(drain) {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: drain.Name}})
+			}
+		}
+		return requests
+	}))
+	return err
+}
+
+// NodeDrainReconciler reconciles a NodeDrain object
+type NodeDrainReconciler struct {
+	*mixin.ReconcilerMixin
+
+	evictor podEvictor
+}
+
+// +kubebuilder:rbac:groups=apps.kusionstack.io,resources=nodedrains,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps.kusionstack.io,resources=nodedrains/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;update;patch
+// +kubebuilder:rbac:groups=core,resources=pods/eviction,verbs=create
+
+// Reconcile cordons the node of NodeDrain, and drains pods on it one lifecycle per pod until all of them are gone.
+func (r *NodeDrainReconciler) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	logger := r.Logger.WithValues("nodeDrain", request.Name)
+	drain := &kuperatorv1alpha1.NodeDrain{}
+	if err := r.Client.Get(ctx, request.NamespacedName, drain); err != nil {
+		if errors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+	if drain.DeletionTimestamp != nil || isDrainFinished(drain) {
+		return reconcile.Result{}, nil
+	}
+
+	newStatus := drain.Status.DeepCopy()
+	newStatus.ObservedGeneration = drain.Generation
+	result, drainErr := r.drainNode(ctx, drain, newStatus)
+	if drainErr != nil {
+		logger.Error(drainErr, "failed to drain node", "node", drain.Spec.NodeName)
+	}
+
+	if !equality.Semantic.DeepEqual(*newStatus, drain.Status) {
+		newDrain := drain.DeepCopy()
+		newDrain.Status = *newStatus
+		if err := r.Client.Status().Update(ctx, newDrain); err != nil {
+			return reconcile.Result{}, controllerutils.AggregateErrors([]error{drainErr, err})
+		}
+	}
+	return result, drainErr
+}
+
+func (r *NodeDrainReconciler) drainNode(ctx context.Context, drain *kuperatorv1alpha1.NodeDrain, status *kuperatorv1alpha1.NodeDrainStatus) (reconcile.Result, error) {
+	node := &corev1.Node{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: drain.Spec.NodeName}, node); err != nil {
+		if errors.IsNotFound(err) {
+			now := controllerutils.FormatTimeNow()
+			status.Phase = kuperatorv1alpha1.NodeDrainPhaseFailed
+			status.Message = fmt.Sprintf("node %s is not found", drain.Spec.NodeName)
+			status.EndTime = &now
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	// cordon the node, so that no more pods are scheduled on it
+	if !node.Spec.Unschedulable {
+		if err := r.cordonNode(ctx, node); err != nil {
+			return reconcile.Result{}, fmt.Errorf("fail to cordon node %s: %s", node.Name, err)
+		}
+		r.Recorder.Eventf(drain, corev1.EventTypeNormal, "CordonNode", "node %s is cordoned", node.Name)
+	}
+	if status.Phase == "" {
+		now := controllerutils.FormatTimeNow()
+		status.Phase = kuperatorv1alpha1.NodeDrainPhaseDraining
+		status.StartTime = &now
+	}
+
+	pods, err := r.getPodsToDrain(ctx, node.Name)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	// pods scheduled before the node is cordoned are appended to targets
+	targets := map[string]*kuperatorv1alpha1.NodeDrainTargetDetail{}
+	for i := range status.TargetDetails {
+		detail := &status.TargetDetails[i]
+		targets[detail.Namespace+"/"+detail.Name] = detail
+	}
+	for key, pod := range pods {
+		if detail, exist := targets[key]; exist && detail.UID == pod.UID {
+			continue
+		}
+		now := controllerutils.FormatTimeNow()
+		status.TargetDetails = append(status.TargetDetails, kuperatorv1alpha1.NodeDrainTargetDetail{
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+			UID:       pod.UID,
+			Action:    getDrainAction(pod),
+			Progress:  kuperatorv1alpha1.NodeDrainProgressProcessing,
+			StartTime: &now,
+		})
+	}
+
+	var errs []error
+	var requeueAfter time.Duration
+	var succeeded, failed int32
+	for i := range status.TargetDetails {
+		detail := &status.TargetDetails[i]
+		if detail.Progress == kuperatorv1alpha1.NodeDrainProgressSucceeded {
+			succeeded++
+			continue
+		}
+
+		// the pod is drained if it is gone from the node
+		pod, exist := pods[detail.Namespace+"/"+detail.Name]
+		if !exist || pod.UID != detail.UID {
+			now := controllerutils.FormatTimeNow()
+			detail.Progress = kuperatorv1alpha1.NodeDrainProgressSucceeded
+			detail.Reason = ""
+			detail.Message = ""
+			detail.EndTime = &now
+			succeeded++
+			continue
+		}
+
+		// unmanaged pods are not recreated once evicted, so they are only drained by force
+		if detail.Progress == kuperatorv1alpha1.NodeDrainProgressFailed && detail.Reason == ReasonUnmanagedPod && drain.Spec.Force {
+			detail.Progress = kuperatorv1alpha1.NodeDrainProgressProcessing
+			detail.Reason = ""
+			detail.Message = ""
+			detail.EndTime = nil
+		}
+		if detail.Progress == kuperatorv1alpha1.NodeDrainProgressProcessing && isUnmanagedPod(pod) && !drain.Spec.Force {
+			r.failPod(drain, detail, ReasonUnmanagedPod, "pod is not managed by any controller, and is only evicted by force")
+		}
+		if detail.Progress == kuperatorv1alpha1.NodeDrainProgressFailed {
+			failed++
+			continue
+		}
+
+		if drain.Spec.TimeoutSeconds > 0 && detail.StartTime != nil {
+			remaining := time.Until(detail.StartTime.Add(time.Duration(drain.Spec.TimeoutSeconds) * time.Second))
+			if remaining <= 0 {
+				r.failPod(drain, detail, ReasonDrainTimeout, fmt.Sprintf("pod is not drained in %d seconds", drain.Spec.TimeoutSeconds))
+				failed++
+				continue
+			}
+			requeueAfter = minRequeueAfter(requeueAfter, remaining)
+		}
+
+		if err := r.drainPod(ctx, drain, pod, detail); err != nil {
+			errs = append(errs, err)
+		}
+		if detail.Reason == ReasonEvictionRejected {
+			requeueAfter = minRequeueAfter(requeueAfter, evictionRetryInterval)
+		}
+	}
+
+	status.TotalPods = int32(len(status.TargetDetails))
+	status.SucceededPods = succeeded
+	status.FailedPods = failed
+	if succeeded+failed == status.TotalPods && len(errs) == 0 {
+		now := controllerutils.FormatTimeNow()
+		status.EndTime = &now
+		if failed > 0 {
+			status.Phase = kuperatorv1alpha1.NodeDrainPhaseFailed
+			status.Message = fmt.Sprintf("%d of %d pods on node %s are failed to drain", failed, status.TotalPods, node.Name)
+			r.Recorder.Event(drain, corev1.EventTypeWarning, "DrainNode", status.Message)
+			return reconcile.Result{}, nil
+		}
+		status.Phase = kuperatorv1alpha1.NodeDrainPhaseSucceeded
+		r.Recorder.Eventf(drain, corev1.EventTypeNormal, "DrainNode", "all %d pods on node %s are drained", status.TotalPods, node.Name)
+		return reconcile.Result{}, nil
+	}
+	return reconcile.Result{RequeueAfter: requeueAfter}, controllerutils.AggregateErrors(errs)
+}
+
+// failPod marks the pod failed to drain. The action triggered on it is not reverted.
+func (r *NodeDrainReconciler) failPod(drain *kuperatorv1alpha1.NodeDrain, detail *kuperatorv1alpha1.NodeDrainTargetDetail, reason, message string) {
+	now := controllerutils.FormatTimeNow()
+	detail.Progress = kuperatorv1alpha1.NodeDrainProgressFailed
+	detail.Reason = reason
+	detail.Message = message
+	detail.EndTime = &now
+	r.Recorder.Eventf(drain, corev1.EventTypeWarning, reason, "fail to drain pod %s/%s: %s", detail.Namespace, detail.Name, message)
+}
+
+// drainPod triggers the action on pod if it is not triggered yet, and records the progress in detail
+func (r *NodeDrainReconciler) drainPod(ctx context.Context, drain *kuperatorv1alpha1.NodeDrain, pod *corev1.Pod, detail *kuperatorv1alpha1.NodeDrainTargetDetail) error {
+	if pod.DeletionTimestamp != nil {
+		return nil
+	}
+
+	switch detail.Action {
+	case kuperatorv1alpha1.NodeDrainActionReplace:
+		_, replaceIndicated := pod.Labels[appsv1alpha1.PodReplaceIndicationLabelKey]
+		_, replaceByReplaceUpdate := pod.Labels[appsv1alpha1.PodReplaceByReplaceUpdateLabelKey]
+		newPodID, replaceNewPodExists := pod.Labels[appsv1alpha1.PodReplacePairNewId]
+		if replaceNewPodExists {
+			newPod, err := r.getReplaceNewPod(ctx, pod, newPodID)
+			if err != nil {
+				return err
+			}
+			if newPod != nil {
+				detail.ReplaceNewPod = newPod.Name
+			}
+		}
+		if replaceIndicated || replaceByReplaceUpdate || replaceNewPodExists {
+			return nil
+		}
+		// CollaSet creates a new pod on other nodes, and deletes this pod after the new pod is service available
+		return r.updatePod(ctx, drain, pod, detail, func(pod *corev1.Pod) {
+			pod.Labels[appsv1alpha1.PodReplaceIndicationLabelKey] = "true"
+		})
+
+	case kuperatorv1alpha1.NodeDrainActionDelete:
+		if _, deletionIndicated := pod.Labels[appsv1alpha1.PodDeletionIndicationLabelKey]; deletionIndicated {
+			return nil
+		}
+		// poddeletion controller begins the delete lifecycle, and deletes the pod after the lifecycle allows
+		return r.updatePod(ctx, drain, pod, detail, func(pod *corev1.Pod) {
+			if _, deletionIndicated := pod.Labels[appsv1alpha1.PodDeletionIndicationLabelKey]; !deletionIndicated {
+				pod.Labels[appsv1alpha1.PodDeletionIndicationLabelKey] = strconv.FormatInt(time.Now().UnixNano(), 10)
+			}
+		})
+
+	case kuperatorv1alpha1.NodeDrainActionEvict:
+		if err := r.evictor.Evict(ctx, pod); err != nil {
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			if errors.IsTooManyRequests(err) {
+				detail.Reason = ReasonEvictionRejected
+				detail.Message = err.Error()
+				return nil
+			}
+			return fmt.Errorf("fail to evict pod %s: %s", utils.ObjectKeyString(pod), err)
+		}
+		detail.Reason = ""
+		detail.Message = ""
+		r.Recorder.Eventf(drain, corev1.EventTypeNormal, "EvictPod", "pod %s is evicted", utils.ObjectKeyString(pod))
+	}
+	return nil
+}
+
+func (r *NodeDrainReconciler) updatePod(ctx context.Context, drain *kuperatorv1alpha1.NodeDrain, pod *corev1.Pod, detail *kuperatorv1alpha1.NodeDrainTargetDetail, updateFn func(*corev1.Pod)) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		newPod := &corev1.Pod{}
+		if err := r.Client.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}, newPod); err != nil {
+			return err
+		}
+		if newPod.Labels == nil {
+			newPod.Labels = map[string]string{}
+		}
+		updateFn(newPod)
+		return r.Client.Update(ctx, newPod)
+	})
+	if err != nil {
+		err = fmt.Errorf("fail to trigger %s of pod %s: %s", detail.Action, utils.ObjectKeyString(pod), err)
+		detail.Reason = ReasonUpdatePodFailed
+		detail.Message = err.Error()
+		return err
+	}
+	detail.Reason = ""
+	detail.Message = ""
+	r.Recorder.Eventf(drain, corev1.EventTypeNormal, string(detail.Action)+"Pod", "trigger %s of pod %s", detail.Action, utils.ObjectKeyString(pod))
+	return nil
+}
+
+func (r *NodeDrainReconciler) cordonNode(ctx context.Context, node *corev1.Node) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		newNode := &corev1.Node{}
+		if err := r.Client.Get(ctx, types.NamespacedName{Name: node.Name}, newNode); err != nil {
+			return err
+		}
+		if newNode.Spec.Unschedulable {
+			return nil
+		}
+		newNode.Spec.Unschedulable = true
+		return r.Client.Update(ctx, newNode)
+	})
+}
+
+// getPodsToDrain returns pods on the node by namespace/name, except pods of DaemonSet, static pods and finished pods,
+// which are left on the node like kubectl drain does
+func (r *NodeDrainReconciler) getPodsToDrain(ctx context.Context, nodeName string) (map[string]*corev1.Pod, error) {
+	podList := &corev1.PodList{}
+	if err := r.Client.List(ctx, podList, &client.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector(inject.FieldIndexPodNodeName, nodeName)}); err != nil {
+		return nil, fmt.Errorf("fail to list pods on node %s: %s", nodeName, err)
+	}
+
+	pods := map[string]*corev1.Pod{}
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if pod.Spec.NodeName != nodeName || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		if _, isMirrorPod := pod.Annotations[corev1.MirrorPodAnnotationKey]; isMirrorPod {
+			continue
+		}
+		if owner := metav1.GetControllerOf(pod); owner != nil && owner.Kind == "DaemonSet" {
+			continue
+		}
+		pods[utils.ObjectKeyString(pod)] = pod
+	}
+	return pods, nil
+}
+
+func (r *NodeDrainReconciler) getReplaceNewPod(ctx context.Context, pod *corev1.Pod, newPodID string) (*corev1.Pod, error) {
+	newPods := &corev1.PodList{}
+	if err := r.Client.List(ctx, newPods, client.InNamespace(pod.Namespace), client.MatchingLabels{
+		appsv1alpha1.PodReplacePairOriginName: pod.Name,
+	}); err != nil {
+		return nil, fmt.Errorf("fail to list replace new pod of %s: %s", utils.ObjectKeyString(pod), err)
+	}
+	for i := range newPods.Items {
+		if newPods.Items[i].Labels[appsv1alpha1.PodInstanceIDLabelKey] == newPodID {
+			return &newPods.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// getDrainAction returns Replace for pods of CollaSet to keep capacity, Delete for other pods with PodOpsLifecycle,
+// and Evict for pods without PodOpsLifecycle, which are recreated by their controllers
+func getDrainAction(pod *corev1.Pod) kuperatorv1alpha1.NodeDrainAction {
+	if !utils.OpsLifecycleEnabled(pod) {
+		return kuperatorv1alpha1.NodeDrainActionEvict
+	}
+	_, isReplaceNewPod := pod.Labels[appsv1alpha1.PodReplacePairOriginName]
+	if owner := metav1.GetControllerOf(pod); owner != nil && owner.Kind == "CollaSet" && !isReplaceNewPod {
+		return kuperatorv1alpha1.NodeDrainActionReplace
+	}
+	return kuperatorv1alpha1.NodeDrainActionDelete
+}
+
+// isUnmanagedPod returns true if the pod is neither drained through PodOpsLifecycle nor recreated by a controller
+func isUnmanagedPod(pod *corev1.Pod) bool {
+	return !utils.OpsLifecycleEnabled(pod) && metav1.GetControllerOf(pod) == nil
+}
+
+func minRequeueAfter(current, d time.Duration) time.Duration {
+	if current == 0 || d < current {
+		return d
+	}
+	return current
+}
+
+func isDrainFinished(drain *kuperatorv1alpha1.NodeDrain) bool {
+	return drain.Status.Phase == kuperatorv1alpha1.NodeDrainPhaseSucceeded || drain.Status.Phase == kuperatorv1alpha1.NodeDrainPhaseFailed
+}
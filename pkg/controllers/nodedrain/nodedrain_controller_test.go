@@ -0,0 +1,206 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package nodedrain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/klogr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+	"kusionstack.io/kuperator/pkg/utils/mixin"
+)
+
+type mockPodEvictor struct {
+	err     error
+	evicted []string
+}
+
+func (e *mockPodEvictor) Evict(ctx context.Context, pod *corev1.Pod) error {
+	e.evicted = append(e.evicted, pod.Name)
+	return e.err
+}
+
+func newPod(name, nodeName string, labels map[string]string, owner *metav1.OwnerReference) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      name,
+			UID:       types.UID(name),
+			Labels:    labels,
+		},
+		Spec: corev1.PodSpec{NodeName: nodeName},
+	}
+	if owner != nil {
+		pod.OwnerReferences = []metav1.OwnerReference{*owner}
+	}
+	return pod
+}
+
+func TestNodeDrain(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(gomega.Succeed())
+	g.Expect(kuperatorv1alpha1.AddToScheme(scheme)).To(gomega.Succeed())
+
+	controller := true
+	collaSetPod := newPod("collaset", "node1", map[string]string{appsv1alpha1.ControlledByKusionStackLabelKey: "true"},
+		&metav1.OwnerReference{APIVersion: "apps.kusionstack.io/v1alpha1", Kind: "CollaSet", Name: "cls", UID: "cls", Controller: &controller})
+	optedInPod := newPod("opted-in", "node1", map[string]string{kuperatorv1alpha1.PodOpsLifecycleEnabledLabelKey: "true"}, nil)
+	plainPod := newPod("plain", "node1", nil,
+		&metav1.OwnerReference{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "rs", UID: "rs", Controller: &controller})
+	barePod := newPod("bare", "node1", nil, nil)
+	daemonSetPod := newPod("daemonset", "node1", nil,
+		&metav1.OwnerReference{APIVersion: "apps/v1", Kind: "DaemonSet", Name: "ds", UID: "ds", Controller: &controller})
+	otherNodePod := newPod("other-node", "node2", nil, nil)
+
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}},
+		&kuperatorv1alpha1.NodeDrain{ObjectMeta: metav1.ObjectMeta{Name: "drain1"}, Spec: kuperatorv1alpha1.NodeDrainSpec{NodeName: "node1"}},
+		&kuperatorv1alpha1.NodeDrain{ObjectMeta: metav1.ObjectMeta{Name: "drain2"}, Spec: kuperatorv1alpha1.NodeDrainSpec{NodeName: "node3"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node4"}},
+		&kuperatorv1alpha1.NodeDrain{ObjectMeta: metav1.ObjectMeta{Name: "drain3"}, Spec: kuperatorv1alpha1.NodeDrainSpec{NodeName: "node4", Force: true, TimeoutSeconds: 60}},
+		collaSetPod, optedInPod, plainPod, barePod, daemonSetPod, otherNodePod, newPod("forced", "node4", nil, nil),
+	).Build()
+	evictor := &mockPodEvictor{err: errors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 10)}
+	r := &NodeDrainReconciler{
+		ReconcilerMixin: &mixin.ReconcilerMixin{
+			Client:   fakeClient,
+			Logger:   klogr.New().WithName(controllerName),
+			Recorder: record.NewFakeRecorder(100),
+		},
+		evictor: evictor,
+	}
+	ctx := context.Background()
+	getPod := func(name string) *corev1.Pod {
+		pod := &corev1.Pod{}
+		g.Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, pod)).To(gomega.Succeed())
+		return pod
+	}
+	getDrain := func(name string) *kuperatorv1alpha1.NodeDrain {
+		drain := &kuperatorv1alpha1.NodeDrain{}
+		g.Expect(fakeClient.Get(ctx, types.NamespacedName{Name: name}, drain)).To(gomega.Succeed())
+		return drain
+	}
+
+	// node is cordoned, and pods on it are drained by their actions
+	result, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: "drain1"}})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.RequeueAfter).To(gomega.Equal(evictionRetryInterval))
+
+	node := &corev1.Node{}
+	g.Expect(fakeClient.Get(ctx, types.NamespacedName{Name: "node1"}, node)).To(gomega.Succeed())
+	g.Expect(node.Spec.Unschedulable).To(gomega.BeTrue())
+	g.Expect(getPod("collaset").Labels).To(gomega.HaveKey(appsv1alpha1.PodReplaceIndicationLabelKey))
+	g.Expect(getPod("opted-in").Labels).To(gomega.HaveKey(appsv1alpha1.PodDeletionIndicationLabelKey))
+	g.Expect(getPod("daemonset").Labels).NotTo(gomega.HaveKey(appsv1alpha1.PodDeletionIndicationLabelKey))
+	g.Expect(evictor.evicted).To(gomega.ConsistOf("plain"))
+
+	drain := getDrain("drain1")
+	g.Expect(drain.Status.Phase).To(gomega.Equal(kuperatorv1alpha1.NodeDrainPhaseDraining))
+	g.Expect(drain.Status.StartTime).NotTo(gomega.BeNil())
+	g.Expect(drain.Status.TotalPods).To(gomega.Equal(int32(4)))
+	g.Expect(drain.Status.SucceededPods).To(gomega.Equal(int32(0)))
+	g.Expect(drain.Status.FailedPods).To(gomega.Equal(int32(1)))
+	actions := map[string]kuperatorv1alpha1.NodeDrainAction{}
+	for _, detail := range drain.Status.TargetDetails {
+		actions[detail.Name] = detail.Action
+		switch detail.Name {
+		case "bare":
+			// unmanaged pod is not evicted without force
+			g.Expect(detail.Progress).To(gomega.Equal(kuperatorv1alpha1.NodeDrainProgressFailed))
+			g.Expect(detail.Reason).To(gomega.Equal(ReasonUnmanagedPod))
+		case "plain":
+			g.Expect(detail.Progress).To(gomega.Equal(kuperatorv1alpha1.NodeDrainProgressProcessing))
+			g.Expect(detail.Reason).To(gomega.Equal(ReasonEvictionRejected))
+		default:
+			g.Expect(detail.Progress).To(gomega.Equal(kuperatorv1alpha1.NodeDrainProgressProcessing))
+		}
+	}
+	g.Expect(actions).To(gomega.Equal(map[string]kuperatorv1alpha1.NodeDrainAction{
+		"collaset": kuperatorv1alpha1.NodeDrainActionReplace,
+		"opted-in": kuperatorv1alpha1.NodeDrainActionDelete,
+		"plain":    kuperatorv1alpha1.NodeDrainActionEvict,
+		"bare":     kuperatorv1alpha1.NodeDrainActionEvict,
+	}))
+
+	// drain fails after other pods are gone from the node
+	evictor.err = nil
+	for _, pod := range []client.Object{collaSetPod, optedInPod, plainPod} {
+		g.Expect(fakeClient.Delete(ctx, pod)).To(gomega.Succeed())
+	}
+	result, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: "drain1"}})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.RequeueAfter).To(gomega.Equal(time.Duration(0)))
+
+	drain = getDrain("drain1")
+	g.Expect(drain.Status.Phase).To(gomega.Equal(kuperatorv1alpha1.NodeDrainPhaseFailed))
+	g.Expect(drain.Status.EndTime).NotTo(gomega.BeNil())
+	g.Expect(drain.Status.SucceededPods).To(gomega.Equal(int32(3)))
+	g.Expect(drain.Status.FailedPods).To(gomega.Equal(int32(1)))
+	for _, detail := range drain.Status.TargetDetails {
+		if detail.Name == "bare" {
+			continue
+		}
+		g.Expect(detail.Progress).To(gomega.Equal(kuperatorv1alpha1.NodeDrainProgressSucceeded))
+		g.Expect(detail.Reason).To(gomega.BeEmpty())
+	}
+	g.Expect(evictor.evicted).NotTo(gomega.ContainElement("bare"))
+
+	// unmanaged pod is evicted by force, and fails on timeout
+	evictor.evicted = nil
+	evictor.err = errors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 10)
+	result, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: "drain3"}})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.RequeueAfter).To(gomega.Equal(evictionRetryInterval))
+	g.Expect(evictor.evicted).To(gomega.ConsistOf("forced"))
+
+	drain = getDrain("drain3")
+	g.Expect(drain.Status.TargetDetails).To(gomega.HaveLen(1))
+	startTime := metav1.NewTime(time.Now().Add(-time.Minute))
+	drain.Status.TargetDetails[0].StartTime = &startTime
+	g.Expect(fakeClient.Status().Update(ctx, drain)).To(gomega.Succeed())
+	result, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: "drain3"}})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(result.RequeueAfter).To(gomega.Equal(time.Duration(0)))
+	drain = getDrain("drain3")
+	g.Expect(drain.Status.Phase).To(gomega.Equal(kuperatorv1alpha1.NodeDrainPhaseFailed))
+	g.Expect(drain.Status.FailedPods).To(gomega.Equal(int32(1)))
+	g.Expect(drain.Status.TargetDetails[0].Progress).To(gomega.Equal(kuperatorv1alpha1.NodeDrainProgressFailed))
+	g.Expect(drain.Status.TargetDetails[0].Reason).To(gomega.Equal(ReasonDrainTimeout))
+
+	// drain fails if node is not found
+	_, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: "drain2"}})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	drain = getDrain("drain2")
+	g.Expect(drain.Status.Phase).To(gomega.Equal(kuperatorv1alpha1.NodeDrainPhaseFailed))
+	g.Expect(drain.Status.Message).To(gomega.ContainSubstring("node3"))
+}
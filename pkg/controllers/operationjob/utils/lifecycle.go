@@ -21,7 +21,6 @@ import (
 	"fmt"
 
 	corev1 "k8s.io/api/core/v1"
-	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	podopslifecycleutil "kusionstack.io/kuperator/pkg/controllers/podopslifecycle"
@@ -78,10 +77,6 @@ func CancelOpsLifecycle(ctx context.Context, client client.Client, adapter podop
 		return nil
 	}
 
-	labelUndo := fmt.Sprintf("%s/%s", appsv1alpha1.PodUndoOperationTypeLabelPrefix, adapter.GetID())
-	if pod.Labels == nil {
-		pod.Labels = make(map[string]string)
-	}
-	pod.Labels[labelUndo] = string(adapter.GetType())
+	podopslifecycle.SetUndo(pod, adapter.GetID(), adapter.GetType())
 	return client.Update(ctx, pod)
 }
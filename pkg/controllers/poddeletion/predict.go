@@ -29,22 +29,22 @@ type PredicateDeletionIndicatedPod struct {
 
 // Create returns true if the Create event should be processed
 func (p *PredicateDeletionIndicatedPod) Create(e event.CreateEvent) bool {
-	return utils.ControlledByKusionStack(e.Object) && hasTerminatingLabel(e.Object)
+	return utils.OpsLifecycleEnabled(e.Object) && hasTerminatingLabel(e.Object)
 }
 
 // Delete returns true if the Delete event should be processed
 func (p *PredicateDeletionIndicatedPod) Delete(e event.DeleteEvent) bool {
-	return utils.ControlledByKusionStack(e.Object) && hasTerminatingLabel(e.Object)
+	return utils.OpsLifecycleEnabled(e.Object) && hasTerminatingLabel(e.Object)
 }
 
 // Update returns true if the Update event should be processed
 func (p *PredicateDeletionIndicatedPod) Update(e event.UpdateEvent) bool {
-	return utils.ControlledByKusionStack(e.ObjectNew) && hasTerminatingLabel(e.ObjectNew)
+	return utils.OpsLifecycleEnabled(e.ObjectNew) && hasTerminatingLabel(e.ObjectNew)
 }
 
 // Generic returns true if the Generic event should be processed
 func (p *PredicateDeletionIndicatedPod) Generic(e event.GenericEvent) bool {
-	return utils.ControlledByKusionStack(e.Object) && hasTerminatingLabel(e.Object)
+	return utils.OpsLifecycleEnabled(e.Object) && hasTerminatingLabel(e.Object)
 }
 
 func hasTerminatingLabel(pod client.Object) bool {
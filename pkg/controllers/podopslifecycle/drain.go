@@ -0,0 +1,139 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podopslifecycle
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+
+	controllersutils "kusionstack.io/kuperator/pkg/controllers/utils"
+)
+
+// drainCheckInterval is the interval to check EndpointSlices until the traffic of pod is drained
+const drainCheckInterval = 5 * time.Second
+
+// drainEndpointSlices sets the pod not ready if it requires traffic draining, and returns true if its traffic
+// is drained from EndpointSlices and the drain delay is passed. Otherwise, it returns the time to check again.
+func (r *ReconcilePodOpsLifecycle) drainEndpointSlices(ctx context.Context, pod *corev1.Pod) (bool, time.Duration, error) {
+	value, ok := pod.Annotations[kuperatorv1alpha1.PodEndpointSliceDrainAnnoKey]
+	if !ok {
+		return true, 0, nil
+	}
+	logger := r.Logger.WithValues("pod", controllerKey(pod))
+	delay, err := time.ParseDuration(value)
+	if err != nil {
+		logger.Error(err, "invalid drain delay, ignore it", "annotation", kuperatorv1alpha1.PodEndpointSliceDrainAnnoKey)
+		delay = 0
+	}
+
+	updated, err := r.updateServiceReadiness(ctx, pod, false)
+	if err != nil {
+		return false, 0, err
+	}
+	if updated {
+		return false, drainCheckInterval, nil
+	}
+	index, condition := controllersutils.GetPodCondition(&pod.Status, v1alpha1.ReadinessGatePodServiceReady)
+	if index == -1 {
+		// traffic is not managed by readiness gate
+		return true, 0, nil
+	}
+
+	services, err := r.undrainedServices(ctx, pod)
+	if err != nil {
+		return false, 0, err
+	}
+	if len(services) > 0 {
+		logger.Info("wait for traffic drained from EndpointSlices", "services", services)
+		return false, drainCheckInterval, nil
+	}
+
+	if remaining := delay - time.Since(condition.LastTransitionTime.Time); remaining > 0 {
+		return false, remaining, nil
+	}
+	return true, 0, nil
+}
+
+// undrainedServices returns names of Services selecting the pod, whose EndpointSlices still mark the pod ready.
+// Services publishing not ready addresses are skipped, since their EndpointSlices mark pods ready regardless of
+// readiness of pods.
+func (r *ReconcilePodOpsLifecycle) undrainedServices(ctx context.Context, pod *corev1.Pod) ([]string, error) {
+	svcList := &corev1.ServiceList{}
+	if err := r.Client.List(ctx, svcList, client.InNamespace(pod.Namespace)); err != nil {
+		return nil, err
+	}
+
+	var services []string
+	for i := range svcList.Items {
+		svc := &svcList.Items[i]
+		if len(svc.Spec.Selector) == 0 || !labels.SelectorFromSet(svc.Spec.Selector).Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		if svc.Spec.PublishNotReadyAddresses {
+			continue
+		}
+
+		sliceList := &discoveryv1.EndpointSliceList{}
+		if err := r.Client.List(ctx, sliceList, client.InNamespace(pod.Namespace), client.MatchingLabels{discoveryv1.LabelServiceName: svc.Name}); err != nil {
+			return nil, err
+		}
+		if isReadyInEndpointSlices(pod, sliceList.Items) {
+			services = append(services, svc.Name)
+		}
+	}
+	return services, nil
+}
+
+// isReadyInEndpointSlices returns true if any endpoint of pod is ready. A nil ready condition is interpreted as ready.
+func isReadyInEndpointSlices(pod *corev1.Pod, slices []discoveryv1.EndpointSlice) bool {
+	for _, slice := range slices {
+		for _, endpoint := range slice.Endpoints {
+			if !isEndpointOfPod(pod, endpoint) {
+				continue
+			}
+			if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isEndpointOfPod(pod *corev1.Pod, endpoint discoveryv1.Endpoint) bool {
+	if endpoint.TargetRef != nil && endpoint.TargetRef.Kind == "Pod" {
+		return endpoint.TargetRef.UID == pod.UID
+	}
+	for _, address := range endpoint.Addresses {
+		if address == pod.Status.PodIP {
+			return address != ""
+		}
+		for _, podIP := range pod.Status.PodIPs {
+			if address == podIP.IP {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,536 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podopslifecycle
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	"kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+	collasetutils "kusionstack.io/kuperator/pkg/controllers/collaset/utils"
+	"kusionstack.io/kuperator/pkg/utils"
+)
+
+const (
+	// hookRetryInterval is the interval to retry failed lifecycle hooks
+	hookRetryInterval = 10 * time.Second
+	// hookFinishedEventBuffer is the capacity of channel to enqueue pods with hooks finished
+	hookFinishedEventBuffer = 1024
+)
+
+// hookRunner runs actions of lifecycle hooks on pod
+type hookRunner interface {
+	Exec(ctx context.Context, pod *corev1.Pod, action *kuperatorv1alpha1.ExecHookAction) error
+	HTTPGet(ctx context.Context, pod *corev1.Pod, action *kuperatorv1alpha1.HTTPGetHookAction) error
+}
+
+type defaultHookRunner struct {
+	config     *rest.Config
+	clientset  kubernetes.Interface
+	httpClient *http.Client
+}
+
+func newHookRunner(config *rest.Config) hookRunner {
+	return &defaultHookRunner{
+		config:    config,
+		clientset: kubernetes.NewForConfigOrDie(config),
+		httpClient: &http.Client{
+			Transport: &http.Transport{
+				// like kubelet probes, certificates of pods are not verified
+				TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+				DisableKeepAlives: true,
+			},
+			// do not follow redirects, and take 3xx as success
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// closableUpgrader keeps the connection upgraded for exec, so that the stream can be closed on timeout
+type closableUpgrader struct {
+	spdy.Upgrader
+
+	mu     sync.Mutex
+	conn   httpstream.Connection
+	closed bool
+}
+
+func (u *closableUpgrader) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	conn, err := u.Upgrader.NewConnection(resp)
+	if err != nil {
+		return nil, err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.conn = conn
+	if u.closed {
+		conn.Close()
+	}
+	return conn, nil
+}
+
+func (u *closableUpgrader) Close() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.closed = true
+	if u.conn != nil {
+		u.conn.Close()
+	}
+}
+
+func (h *defaultHookRunner) Exec(ctx context.Context, pod *corev1.Pod, action *kuperatorv1alpha1.ExecHookAction) error {
+	req := h.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").Namespace(pod.Namespace).Name(pod.Name).SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: action.Container,
+			Command:   action.Command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+	transport, upgrader, err := spdy.RoundTripperFor(h.config)
+	if err != nil {
+		return err
+	}
+	closable := &closableUpgrader{Upgrader: upgrader}
+	executor, err := remotecommand.NewSPDYExecutorForTransports(transport, closable, http.MethodPost, req.URL())
+	if err != nil {
+		return err
+	}
+
+	var stdout, stderr bytes.Buffer
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- executor.Stream(remotecommand.StreamOptions{Stdout: &stdout, Stderr: &stderr})
+	}()
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	case <-ctx.Done():
+		// the command is not waited any more, and the attempt is failed
+		closable.Close()
+		return fmt.Errorf("command is timed out")
+	}
+}
+
+func (h *defaultHookRunner) HTTPGet(ctx context.Context, pod *corev1.Pod, action *kuperatorv1alpha1.HTTPGetHookAction) error {
+	if pod.Status.PodIP == "" {
+		return fmt.Errorf("pod has no IP")
+	}
+	uriScheme := action.Scheme
+	if uriScheme == "" {
+		uriScheme = corev1.URISchemeHTTP
+	}
+	url := fmt.Sprintf("%s://%s/%s", strings.ToLower(string(uriScheme)),
+		net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(int(action.Port))), strings.TrimPrefix(action.Path, "/"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("GET %s returns %s", url, resp.Status)
+	}
+	return nil
+}
+
+// hookExecution is the result of a hook running in background
+type hookExecution struct {
+	finished   bool
+	err        error
+	finishTime metav1.Time
+}
+
+// hookExecutions tracks hooks running in background, keyed by pod, lifecycle id, stage and hook name.
+// Results are kept until they are recorded on pod.
+type hookExecutions struct {
+	mu         sync.Mutex
+	executions map[string]*hookExecution
+}
+
+func newHookExecutions() *hookExecutions {
+	return &hookExecutions{executions: map[string]*hookExecution{}}
+}
+
+func hookExecutionKey(pod *corev1.Pod, id, stage, name string) string {
+	return fmt.Sprintf("%s/%s/%s/%s", controllerKey(pod), id, stage, name)
+}
+
+// start records the hook as running, and returns false if it is running or its result is not recorded yet
+func (e *hookExecutions) start(key string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.executions[key]; ok {
+		return false
+	}
+	e.executions[key] = &hookExecution{}
+	return true
+}
+
+func (e *hookExecutions) finish(key string, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if execution, ok := e.executions[key]; ok {
+		execution.finished = true
+		execution.err = err
+		execution.finishTime = metav1.Now()
+	}
+}
+
+func (e *hookExecutions) get(key string) (hookExecution, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	execution, ok := e.executions[key]
+	if !ok {
+		return hookExecution{}, false
+	}
+	return *execution, true
+}
+
+func (e *hookExecutions) delete(key string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.executions, key)
+}
+
+// deleteByPrefix deletes finished executions with key prefix, like those of a deleted pod or lifecycle
+func (e *hookExecutions) deleteByPrefix(prefix string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for key, execution := range e.executions {
+		if execution.finished && strings.HasPrefix(key, prefix) {
+			delete(e.executions, key)
+		}
+	}
+}
+
+// runLifecycleHooks runs hooks of stage for lifecycles not passing the stage yet, and records their progress on pod.
+// Hooks run in background one by one, and each attempt is recorded as Running before started. The pod is enqueued
+// again once the hook finishes. It returns true if all hooks are succeeded, or the time to check hooks again.
+func (r *ReconcilePodOpsLifecycle) runLifecycleHooks(ctx context.Context, pod *corev1.Pod, idToLabelsMap map[string]map[string]string, stage string) (bool, time.Duration, error) {
+	passedLabel := v1alpha1.PodPreCheckedLabelPrefix
+	if stage == kuperatorv1alpha1.PodOpsLifecycleStageCompleting {
+		passedLabel = v1alpha1.PodPostCheckedLabelPrefix
+	}
+	logger := r.Logger.WithValues("pod", controllerKey(pod), "stage", stage)
+
+	ids := make([]string, 0, len(idToLabelsMap))
+	for id := range idToLabelsMap {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	passed := true
+	var requeueAfter time.Duration
+	annotations := map[string]string{}
+	var recordedKeys []string
+	hooksToStart := map[string]kuperatorv1alpha1.LifecycleHook{}
+	for _, id := range ids {
+		if _, ok := idToLabelsMap[id][passedLabel]; ok {
+			continue
+		}
+		hooks, err := r.getLifecycleHooks(ctx, pod, id)
+		if err != nil {
+			return false, 0, err
+		}
+		stageHooks := hooks.GetStageHooks(stage)
+		if len(stageHooks) == 0 {
+			continue
+		}
+
+		statusKey := fmt.Sprintf("%s/%s", kuperatorv1alpha1.PodOpsLifecycleHookStatusAnnoPrefix, id)
+		var statuses []kuperatorv1alpha1.LifecycleHookStatus
+		if value := pod.Annotations[statusKey]; value != "" {
+			if err := json.Unmarshal([]byte(value), &statuses); err != nil {
+				logger.Error(err, "invalid progress of lifecycle hooks, run them again", "id", id)
+				statuses = nil
+			}
+		}
+
+		changed := false
+		for i := range stageHooks {
+			hook := &stageHooks[i]
+			index := findHookStatus(statuses, stage, hook.Name)
+			if index == -1 {
+				statuses = append(statuses, kuperatorv1alpha1.LifecycleHookStatus{Name: hook.Name, Stage: stage})
+				index = len(statuses) - 1
+			}
+			status := &statuses[index]
+			if status.Phase == kuperatorv1alpha1.LifecycleHookPhaseSucceeded {
+				continue
+			}
+			timeout := time.Duration(hook.GetTimeoutSeconds()) * time.Second
+
+			executionKey := hookExecutionKey(pod, id, stage, hook.Name)
+			if execution, ok := r.hookExecutions.get(executionKey); ok {
+				if !execution.finished {
+					// wait for the hook finished, and check again on timeout in case the event is missed
+					passed = false
+					requeueAfter = minRequeueAfter(requeueAfter, timeout)
+					break
+				}
+
+				changed = true
+				recordedKeys = append(recordedKeys, executionKey)
+				status.LastProbeTime = execution.finishTime
+				if execution.err != nil {
+					status.Phase = kuperatorv1alpha1.LifecycleHookPhaseFailed
+					status.Message = execution.err.Error()
+					r.Recorder.Eventf(pod, corev1.EventTypeWarning, "LifecycleHookFailed",
+						"hook %s of lifecycle %s failed in stage %s: %s", hook.Name, id, stage, execution.err)
+					passed = false
+					requeueAfter = minRequeueAfter(requeueAfter, hookRetryInterval)
+					break
+				}
+				status.Phase = kuperatorv1alpha1.LifecycleHookPhaseSucceeded
+				status.Message = ""
+				r.Recorder.Eventf(pod, corev1.EventTypeNormal, "LifecycleHookSucceeded",
+					"hook %s of lifecycle %s succeeded in stage %s", hook.Name, id, stage)
+				continue
+			}
+
+			if status.Phase == kuperatorv1alpha1.LifecycleHookPhaseRunning {
+				// the result of hook is lost, like controller restarted. Wait until the attempt is timed out,
+				// then take it as failed and retry
+				passed = false
+				if remaining := timeout - time.Since(status.LastProbeTime.Time); remaining > 0 {
+					requeueAfter = minRequeueAfter(requeueAfter, remaining)
+					break
+				}
+				changed = true
+				status.Phase = kuperatorv1alpha1.LifecycleHookPhaseFailed
+				status.Message = "hook is interrupted before finished"
+				status.LastProbeTime = metav1.Now()
+				requeueAfter = minRequeueAfter(requeueAfter, hookRetryInterval)
+				break
+			}
+			if status.Phase == kuperatorv1alpha1.LifecycleHookPhaseFailed {
+				if remaining := hookRetryInterval - time.Since(status.LastProbeTime.Time); remaining > 0 {
+					passed = false
+					requeueAfter = minRequeueAfter(requeueAfter, remaining)
+					break
+				}
+			}
+
+			// record the attempt before starting it, so that it is never started twice
+			changed = true
+			status.Phase = kuperatorv1alpha1.LifecycleHookPhaseRunning
+			status.Attempts++
+			status.Message = ""
+			status.LastProbeTime = metav1.Now()
+			hooksToStart[executionKey] = *hook
+			passed = false
+			requeueAfter = minRequeueAfter(requeueAfter, timeout)
+			break
+		}
+		if changed {
+			annotations[statusKey] = utils.DumpJSON(statuses)
+		}
+	}
+
+	if err := r.updateAnnotations(ctx, pod, annotations, nil); err != nil {
+		return false, 0, err
+	}
+	for _, key := range recordedKeys {
+		r.hookExecutions.delete(key)
+	}
+	for key, hook := range hooksToStart {
+		r.startLifecycleHook(pod, key, hook)
+	}
+	return passed, requeueAfter, nil
+}
+
+// startLifecycleHook runs hook in background, and enqueues the pod again once it finishes
+func (r *ReconcilePodOpsLifecycle) startLifecycleHook(pod *corev1.Pod, key string, hook kuperatorv1alpha1.LifecycleHook) {
+	if !r.hookExecutions.start(key) {
+		return
+	}
+
+	pod = pod.DeepCopy()
+	go func() {
+		err := r.runLifecycleHook(context.Background(), pod, &hook)
+		r.hookExecutions.finish(key, err)
+		select {
+		case r.hookFinishedEvents <- event.GenericEvent{Object: pod}:
+		default:
+			// the pod is checked again on hook timeout anyway
+		}
+	}()
+}
+
+func (r *ReconcilePodOpsLifecycle) runLifecycleHook(ctx context.Context, pod *corev1.Pod, hook *kuperatorv1alpha1.LifecycleHook) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(hook.GetTimeoutSeconds())*time.Second)
+	defer cancel()
+
+	switch {
+	case hook.Exec != nil:
+		return r.hookRunner.Exec(ctx, pod, hook.Exec)
+	case hook.HTTPGet != nil:
+		return r.hookRunner.HTTPGet(ctx, pod, hook.HTTPGet)
+	}
+	return fmt.Errorf("no action in hook")
+}
+
+// getLifecycleHooks loads hooks of the lifecycle from the CollaSet owning the pod or the OperationJob targeting it,
+// which begins the lifecycle. Hooks are never read from the pod, so that commands run by controller are only declared
+// by writers of the workloads.
+func (r *ReconcilePodOpsLifecycle) getLifecycleHooks(ctx context.Context, pod *corev1.Pod, id string) (*kuperatorv1alpha1.PodOpsLifecycleHooks, error) {
+	var annotations map[string]string
+	if id == collasetutils.UpdateOpsLifecycleAdapter.GetID() {
+		owner := metav1.GetControllerOf(pod)
+		if owner == nil || owner.Kind != "CollaSet" {
+			return nil, nil
+		}
+		cls := &v1alpha1.CollaSet{}
+		if err := r.Client.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: owner.Name}, cls); err != nil {
+			return nil, client.IgnoreNotFound(err)
+		}
+		if cls.UID != owner.UID {
+			return nil, nil
+		}
+		annotations = cls.Annotations
+	} else {
+		ojs := &v1alpha1.OperationJobList{}
+		if err := r.Client.List(ctx, ojs, client.InNamespace(pod.Namespace)); err != nil {
+			return nil, err
+		}
+		for i := range ojs.Items {
+			if kuperatorv1alpha1.GenerateLifecycleID(ojs.Items[i].Name) == id && isOperationJobTarget(&ojs.Items[i], pod) {
+				annotations = ojs.Items[i].Annotations
+				break
+			}
+		}
+	}
+
+	hooks, err := kuperatorv1alpha1.ParseLifecycleHooks(annotations[kuperatorv1alpha1.PodOpsLifecycleHooksAnnoKey])
+	if err != nil {
+		// hooks are validated by webhook, and invalid ones are ignored
+		r.Logger.Error(err, "invalid lifecycle hooks, ignore them", "pod", controllerKey(pod), "id", id)
+		return nil, nil
+	}
+	return hooks, nil
+}
+
+func isOperationJobTarget(oj *v1alpha1.OperationJob, pod *corev1.Pod) bool {
+	for _, target := range oj.Spec.Targets {
+		if target.Name == pod.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanupLifecycleHooks removes progress of hooks of lifecycles no longer on pod, like finished or cancelled ones
+func (r *ReconcilePodOpsLifecycle) cleanupLifecycleHooks(ctx context.Context, pod *corev1.Pod, idToLabelsMap map[string]map[string]string) (bool, error) {
+	var deleted []string
+	prefix := kuperatorv1alpha1.PodOpsLifecycleHookStatusAnnoPrefix + "/"
+	for k := range pod.Annotations {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		id := strings.TrimPrefix(k, prefix)
+		if _, ok := idToLabelsMap[id]; !ok {
+			deleted = append(deleted, k)
+			r.hookExecutions.deleteByPrefix(fmt.Sprintf("%s/%s/", controllerKey(pod), id))
+		}
+	}
+	if len(deleted) == 0 {
+		return false, nil
+	}
+	sort.Strings(deleted)
+	return true, r.updateAnnotations(ctx, pod, nil, deleted)
+}
+
+func findHookStatus(statuses []kuperatorv1alpha1.LifecycleHookStatus, stage, name string) int {
+	for i := range statuses {
+		if statuses[i].Stage == stage && statuses[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func minRequeueAfter(current, d time.Duration) time.Duration {
+	if current == 0 || d < current {
+		return d
+	}
+	return current
+}
+
+func (r *ReconcilePodOpsLifecycle) updateAnnotations(ctx context.Context, pod *corev1.Pod, annotations map[string]string, deleted []string) error {
+	if len(annotations) == 0 && len(deleted) == 0 {
+		return nil
+	}
+
+	key := controllerKey(pod)
+	r.expectation.ExpectUpdate(key, pod.ResourceVersion)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		newPod := &corev1.Pod{}
+		err := r.Client.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}, newPod)
+		if err != nil {
+			return err
+		}
+		if newPod.Annotations == nil {
+			newPod.Annotations = map[string]string{}
+		}
+		for k, v := range annotations {
+			newPod.Annotations[k] = v
+		}
+		for _, k := range deleted {
+			delete(newPod.Annotations, k)
+		}
+		return r.Client.Update(ctx, newPod)
+	})
+	if err != nil {
+		r.Logger.Error(err, "failed to update pod with annotations", "pod", utils.ObjectKeyString(pod), "annotations", annotations, "deleted", deleted)
+		r.expectation.DeleteExpectations(key)
+	}
+
+	return err
+}
@@ -31,15 +31,18 @@ import (
 	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 
 	"kusionstack.io/kuperator/pkg/controllers/podtransitionrule"
 	controllersutils "kusionstack.io/kuperator/pkg/controllers/utils"
+	budgetutils "kusionstack.io/kuperator/pkg/controllers/utils/disruptionbudget"
 	"kusionstack.io/kuperator/pkg/controllers/utils/expectations"
 	"kusionstack.io/kuperator/pkg/utils"
 	"kusionstack.io/kuperator/pkg/utils/mixin"
@@ -47,6 +50,9 @@ import (
 
 const (
 	controllerName = "podopslifecycle-controller"
+
+	// disruptionBudgetRetryInterval is the interval to retry reserving DisruptionBudgets exhausted by other pods
+	disruptionBudgetRetryInterval = 10 * time.Second
 )
 
 var (
@@ -68,12 +74,22 @@ func AddToMgr(mgr manager.Manager, r reconcile.Reconciler) error {
 
 	err = c.Watch(&source.Kind{Type: &corev1.Pod{}}, &handler.EnqueueRequestForObject{}, &PodPredicate{
 		NeedOpsLifecycle: func(oldPod, newPod *corev1.Pod) bool {
-			return utils.ControlledByKusionStack(newPod)
+			return utils.OpsLifecycleEnabled(newPod)
 		},
 	})
 	if err != nil {
 		return err
 	}
+
+	if lr, ok := r.(*ReconcilePodOpsLifecycle); ok {
+		ch := make(chan event.GenericEvent, hookFinishedEventBuffer)
+		lr.registerHookFinishedEventChannel(ch)
+		// Watch pods with lifecycle hooks finished in background
+		err = c.Watch(&source.Channel{Source: ch}, &handler.EnqueueRequestForObject{})
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -88,6 +104,8 @@ func NewReconciler(mgr manager.Manager) *ReconcilePodOpsLifecycle {
 
 		podTransitionRuleManager: podtransitionrule.PodTransitionRuleManager(),
 		expectation:              expectation,
+		hookRunner:               newHookRunner(mgr.GetConfig()),
+		hookExecutions:           newHookExecutions(),
 	}
 	r.initPodTransitionRuleManager()
 
@@ -99,11 +117,27 @@ type ReconcilePodOpsLifecycle struct {
 
 	podTransitionRuleManager podtransitionrule.ManagerInterface
 	expectation              *expectations.ResourceVersionExpectation
+	hookRunner               hookRunner
+	hookExecutions           *hookExecutions
+	hookFinishedEvents       chan<- event.GenericEvent
+}
+
+func (r *ReconcilePodOpsLifecycle) registerHookFinishedEventChannel(ch chan<- event.GenericEvent) {
+	r.hookFinishedEvents = ch
 }
 
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=core,resources=pods/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=core,resources=pods/exec,verbs=create
 // +kubebuilder:rbac:groups=core,resources=events,verbs=create;update;patch
+// +kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch
+// +kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps.kusionstack.io,resources=collasets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps.kusionstack.io,resources=operationjobs,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps.kusionstack.io,resources=podtransitionrules,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps.kusionstack.io,resources=disruptionbudgets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps.kusionstack.io,resources=disruptionbudgets/status,verbs=get;update;patch
 
 func (r *ReconcilePodOpsLifecycle) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
 	key := request.String()
@@ -116,6 +150,7 @@ func (r *ReconcilePodOpsLifecycle) Reconcile(ctx context.Context, request reconc
 		logger.Error(err, "failed to get pod")
 		if errors.IsNotFound(err) {
 			r.expectation.DeleteExpectations(key)
+			r.hookExecutions.deleteByPrefix(key + "/")
 			return reconcile.Result{}, nil
 		}
 		return reconcile.Result{}, err
@@ -135,10 +170,29 @@ func (r *ReconcilePodOpsLifecycle) Reconcile(ctx context.Context, request reconc
 		return reconcile.Result{}, err
 	}
 
+	updated, err := r.cleanupLifecycleHooks(ctx, pod, idToLabelsMap)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if updated {
+		return reconcile.Result{}, nil
+	}
+
 	// All lifecycles are finished, and should be online
 	lifecyclesFinished := len(idToLabelsMap) == 0
 	_, stayOffline := pod.Labels[v1alpha1.PodStayOfflineLabel]
+	if lifecyclesFinished {
+		if _, err := r.updateStageTimeoutCondition(ctx, pod, corev1.ConditionFalse, "all lifecycles are finished"); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
 	if lifecyclesFinished && !stayOffline {
+		if IsPodReadyFunc(pod) {
+			if err := r.releaseDisruptionBudgets(ctx, pod); err != nil {
+				return reconcile.Result{}, err
+			}
+		}
+
 		updated, err := r.addServiceAvailable(pod)
 		if err != nil {
 			return reconcile.Result{}, err
@@ -163,12 +217,50 @@ func (r *ReconcilePodOpsLifecycle) Reconcile(ctx context.Context, request reconc
 		return reconcile.Result{}, err
 	}
 
+	// Take actions on lifecycles stuck in stages over timeout
+	requeueAfter, updated, err := r.handleStageTimeouts(ctx, pod, idToLabelsMap, state)
+	if err != nil {
+		logger.Error(err, "failed to handle stage timeouts")
+		return reconcile.Result{}, err
+	}
+	if updated {
+		return reconcile.Result{}, nil
+	}
+
 	var labels map[string]string
 	if state.InStageAndPassed() {
 		switch state.Stage {
 		case v1alpha1.PodOpsLifecyclePreCheckStage:
+			reserved, reserveErr := r.reserveDisruptionBudgets(ctx, pod)
+			if reserveErr != nil {
+				return reconcile.Result{}, reserveErr
+			}
+			if !reserved {
+				return reconcile.Result{RequeueAfter: disruptionBudgetRetryInterval}, nil
+			}
+			hooksPassed, hookRequeueAfter, hookErr := r.runLifecycleHooks(ctx, pod, idToLabelsMap, kuperatorv1alpha1.PodOpsLifecycleStagePreparing)
+			if hookErr != nil {
+				return reconcile.Result{}, hookErr
+			}
+			if !hooksPassed {
+				return reconcile.Result{RequeueAfter: hookRequeueAfter}, nil
+			}
+			drained, drainRequeueAfter, drainErr := r.drainEndpointSlices(ctx, pod)
+			if drainErr != nil {
+				return reconcile.Result{}, drainErr
+			}
+			if !drained {
+				return reconcile.Result{RequeueAfter: drainRequeueAfter}, nil
+			}
 			labels, err = r.preCheckStage(pod, idToLabelsMap)
 		case v1alpha1.PodOpsLifecyclePostCheckStage:
+			hooksPassed, hookRequeueAfter, hookErr := r.runLifecycleHooks(ctx, pod, idToLabelsMap, kuperatorv1alpha1.PodOpsLifecycleStageCompleting)
+			if hookErr != nil {
+				return reconcile.Result{}, hookErr
+			}
+			if !hooksPassed {
+				return reconcile.Result{RequeueAfter: hookRequeueAfter}, nil
+			}
 			labels, err = r.postCheckStage(pod, idToLabelsMap)
 		}
 	}
@@ -212,10 +304,10 @@ func (r *ReconcilePodOpsLifecycle) Reconcile(ctx context.Context, request reconc
 	// Remove label service-available if pod is not ready
 	if !IsPodReadyFunc(pod) {
 		err := r.removeLabels(ctx, pod, []string{v1alpha1.PodServiceAvailableLabel})
-		return reconcile.Result{}, err
+		return reconcile.Result{RequeueAfter: requeueAfter}, err
 	}
 
-	return reconcile.Result{}, nil
+	return reconcile.Result{RequeueAfter: requeueAfter}, nil
 }
 
 // addServiceAvailable try to add service available label to pod
@@ -431,6 +523,57 @@ func (r *ReconcilePodOpsLifecycle) preCheckStage(pod *corev1.Pod, idToLabelsMap
 	return
 }
 
+// reserveDisruptionBudgets reserves slots of all DisruptionBudgets selecting the pod before it is permitted to operate,
+// and releases the slots reserved in this call if any budget is exhausted, to avoid holding slots of other budgets.
+// Slots held before, such as those reserved through PodTransitionRule, are kept.
+func (r *ReconcilePodOpsLifecycle) reserveDisruptionBudgets(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	budgets, err := budgetutils.GetMatchedBudgets(ctx, r.Client, pod)
+	if err != nil {
+		return false, err
+	}
+	var reservedKeys []types.NamespacedName
+	for _, budget := range budgets {
+		key := types.NamespacedName{Namespace: budget.Namespace, Name: budget.Name}
+		reserved, created, msg, err := budgetutils.Reserve(ctx, r.Client, key, pod, budgetutils.HolderPodOpsLifecycle)
+		if err != nil {
+			return false, err
+		}
+		if reserved {
+			if created {
+				reservedKeys = append(reservedKeys, key)
+			}
+			continue
+		}
+
+		r.Recorder.Eventf(pod, corev1.EventTypeNormal, "DisruptionBudgetExhausted", "wait for DisruptionBudget: %s", msg)
+		for _, reservedKey := range reservedKeys {
+			if err := budgetutils.Release(ctx, r.Client, reservedKey, budgetutils.PodKey(pod)); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// releaseDisruptionBudgets releases slots of DisruptionBudgets reserved by the pod after all lifecycles are finished
+func (r *ReconcilePodOpsLifecycle) releaseDisruptionBudgets(ctx context.Context, pod *corev1.Pod) error {
+	budgets, err := budgetutils.GetMatchedBudgets(ctx, r.Client, pod)
+	if err != nil {
+		return err
+	}
+	podKey := budgetutils.PodKey(pod)
+	for _, budget := range budgets {
+		if !budgetutils.IsReserved(budget, podKey) {
+			continue
+		}
+		if err := budgetutils.Release(ctx, r.Client, types.NamespacedName{Namespace: budget.Namespace, Name: budget.Name}, podKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (r *ReconcilePodOpsLifecycle) postCheckStage(pod *corev1.Pod, idToLabelsMap map[string]map[string]string) (labels map[string]string, err error) {
 	labels = map[string]string{}
 	currentTime := strconv.FormatInt(time.Now().UnixNano(), 10)
@@ -18,8 +18,11 @@ package podopslifecycle
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -27,24 +30,30 @@ import (
 	. "github.com/onsi/gomega"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/klogr"
 	"kusionstack.io/kube-api/apps/v1alpha1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 	"kusionstack.io/kuperator/pkg/controllers/podtransitionrule"
 	"kusionstack.io/kuperator/pkg/controllers/podtransitionrule/checker"
 	controllersutils "kusionstack.io/kuperator/pkg/controllers/utils"
 	"kusionstack.io/kuperator/pkg/controllers/utils/expectations"
+	"kusionstack.io/kuperator/pkg/utils"
 	"kusionstack.io/kuperator/pkg/utils/mixin"
 )
 
@@ -634,6 +643,7 @@ var _ = Describe("Label service-available processing", func() {
 		},
 		podTransitionRuleManager: &mockPodTransitionRuleManager{},
 		expectation:              expectations.NewResourceVersionExpectation(),
+		hookExecutions:           newHookExecutions(),
 	}
 
 	It("Pod is ready", func() {
@@ -707,6 +717,7 @@ var _ = Describe("Label stay-offline processing", func() {
 			Logger: klogr.New().WithName(controllerName),
 		},
 		expectation:              expectations.NewResourceVersionExpectation(),
+		hookExecutions:           newHookExecutions(),
 		podTransitionRuleManager: &mockPodTransitionRuleManager{},
 	}
 
@@ -729,6 +740,602 @@ var _ = Describe("Label stay-offline processing", func() {
 	})
 })
 
+var _ = Describe("Stage timeout processing", func() {
+	scheme := runtime.NewScheme()
+	Expect(corev1.AddToScheme(scheme)).NotTo(HaveOccurred())
+	Expect(v1alpha1.AddToScheme(scheme)).NotTo(HaveOccurred())
+
+	longAgo := strconv.FormatInt(time.Now().Add(-2*time.Hour).UnixNano(), 10)
+	objs := []client.Object{
+		&v1alpha1.PodTransitionRule{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "rule",
+				Namespace: "default",
+				Annotations: map[string]string{
+					kuperatorv1alpha1.PodTransitionRuleStageTimeoutAnnoKey: `{"preparing": "30m", "action": "Cancel"}`,
+				},
+			},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "preparing",
+				Namespace: "default",
+				Labels: map[string]string{
+					v1alpha1.ControlledByKusionStackLabelKey:                          "true",
+					fmt.Sprintf("%s/%s", v1alpha1.PodOperatingLabelPrefix, "123"):     longAgo,
+					fmt.Sprintf("%s/%s", v1alpha1.PodOperationTypeLabelPrefix, "123"): "update",
+					fmt.Sprintf("%s/%s", v1alpha1.PodPreCheckLabelPrefix, "123"):      longAgo,
+				},
+			},
+		},
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "completing",
+				Namespace: "default",
+				Labels: map[string]string{
+					v1alpha1.ControlledByKusionStackLabelKey:                              "true",
+					fmt.Sprintf("%s/%s", v1alpha1.PodOperatedLabelPrefix, "456"):          longAgo,
+					fmt.Sprintf("%s/%s", v1alpha1.PodDoneOperationTypeLabelPrefix, "456"): "delete",
+					fmt.Sprintf("%s/%s", v1alpha1.PodCompletingLabelPrefix, "456"):        longAgo,
+				},
+			},
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objs...).
+		Build()
+	recorder := record.NewFakeRecorder(10)
+
+	podOpsLifecycle := &ReconcilePodOpsLifecycle{
+		ReconcilerMixin: &mixin.ReconcilerMixin{
+			Client:   fakeClient,
+			Logger:   klogr.New().WithName(controllerName),
+			Recorder: recorder,
+		},
+		podTransitionRuleManager: &mockPodTransitionRuleManager{
+			CheckState: &checker.CheckState{
+				Stage: v1alpha1.PodOpsLifecyclePreCheckStage,
+				States: []checker.State{
+					{
+						PodTransitionRuleName: "rule",
+						Detail:                &v1alpha1.PodTransitionDetail{Stage: v1alpha1.PodOpsLifecyclePreCheckStage},
+					},
+				},
+			},
+		},
+		expectation:    expectations.NewResourceVersionExpectation(),
+		hookExecutions: newHookExecutions(),
+	}
+
+	It("Cancel lifecycle timed out in preparing stage", func() {
+		_, err := podOpsLifecycle.Reconcile(context.Background(), reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: "preparing", Namespace: "default"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		pod := &corev1.Pod{}
+		Expect(fakeClient.Get(context.Background(), client.ObjectKey{Name: "preparing", Namespace: "default"}, pod)).NotTo(HaveOccurred())
+		Expect(pod.Labels[fmt.Sprintf("%s/%s", v1alpha1.PodUndoOperationTypeLabelPrefix, "123")]).To(Equal("update"))
+		_, condition := controllersutils.GetPodCondition(&pod.Status, kuperatorv1alpha1.PodOpsLifecycleStageTimeoutCondition)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+		Expect(condition.Message).To(ContainSubstring("PodTransitionRule rule, action Cancel"))
+		Expect(recorder.Events).To(HaveLen(1))
+		<-recorder.Events
+	})
+
+	It("Mark lifecycle failed when timed out in completing stage", func() {
+		Expect(SetStageTimeouts(`{"delete": {"completing": "1h"}}`)).NotTo(HaveOccurred())
+		defer SetStageTimeouts("")
+
+		for i := 0; i < 2; i++ {
+			_, err := podOpsLifecycle.Reconcile(context.Background(), reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: "completing", Namespace: "default"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		pod := &corev1.Pod{}
+		Expect(fakeClient.Get(context.Background(), client.ObjectKey{Name: "completing", Namespace: "default"}, pod)).NotTo(HaveOccurred())
+		Expect(pod.Labels).To(HaveKey(fmt.Sprintf("%s/%s", v1alpha1.PodCompletingLabelPrefix, "456")))
+		_, condition := controllersutils.GetPodCondition(&pod.Status, kuperatorv1alpha1.PodOpsLifecycleStageTimeoutCondition)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(corev1.ConditionTrue))
+		Expect(condition.Message).To(ContainSubstring("operation type delete, action Fail"))
+		// event is emitted only once
+		Expect(recorder.Events).To(HaveLen(1))
+		<-recorder.Events
+	})
+
+	It("Reject invalid stage timeouts", func() {
+		Expect(SetStageTimeouts(`{"delete": {"completing": "1h", "action": "Retry"}}`)).To(HaveOccurred())
+		Expect(SetStageTimeouts(`{"delete": {"preparing": "0s"}}`)).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Traffic drain processing", func() {
+	scheme := runtime.NewScheme()
+	Expect(corev1.AddToScheme(scheme)).NotTo(HaveOccurred())
+	Expect(discoveryv1.AddToScheme(scheme)).NotTo(HaveOccurred())
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "drain",
+			Namespace: "default",
+			UID:       "drain-uid",
+			Labels:    map[string]string{"app": "drain"},
+			Annotations: map[string]string{
+				kuperatorv1alpha1.PodEndpointSliceDrainAnnoKey: "0s",
+			},
+		},
+		Spec: corev1.PodSpec{
+			ReadinessGates: []corev1.PodReadinessGate{
+				{
+					ConditionType: v1alpha1.ReadinessGatePodServiceReady,
+				},
+			},
+		},
+		Status: corev1.PodStatus{
+			PodIP: "10.0.0.1",
+		},
+	}
+	ready := true
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "drain-abc",
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: "drain"},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Endpoints: []discoveryv1.Endpoint{
+			{
+				Addresses:  []string{"10.0.0.1"},
+				Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+			},
+		},
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "drain",
+			Namespace: "default",
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": "drain"},
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(pod, slice, svc).
+		Build()
+
+	podOpsLifecycle := &ReconcilePodOpsLifecycle{
+		ReconcilerMixin: &mixin.ReconcilerMixin{
+			Client:   fakeClient,
+			Logger:   klogr.New().WithName(controllerName),
+			Recorder: record.NewFakeRecorder(10),
+		},
+		podTransitionRuleManager: &mockPodTransitionRuleManager{},
+		expectation:              expectations.NewResourceVersionExpectation(),
+	}
+
+	It("Wait until pod is not ready in EndpointSlices", func() {
+		current := &corev1.Pod{}
+		Expect(fakeClient.Get(context.Background(), client.ObjectKeyFromObject(pod), current)).NotTo(HaveOccurred())
+		drained, _, err := podOpsLifecycle.drainEndpointSlices(context.Background(), current)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drained).To(BeFalse())
+
+		// readiness gate is set false at first
+		Expect(fakeClient.Get(context.Background(), client.ObjectKeyFromObject(pod), current)).NotTo(HaveOccurred())
+		_, condition := controllersutils.GetPodCondition(&current.Status, v1alpha1.ReadinessGatePodServiceReady)
+		Expect(condition).NotTo(BeNil())
+		Expect(condition.Status).To(Equal(corev1.ConditionFalse))
+
+		drained, requeueAfter, err := podOpsLifecycle.drainEndpointSlices(context.Background(), current)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drained).To(BeFalse())
+		Expect(requeueAfter).To(Equal(drainCheckInterval))
+
+		notReady := false
+		currentSlice := &discoveryv1.EndpointSlice{}
+		Expect(fakeClient.Get(context.Background(), client.ObjectKeyFromObject(slice), currentSlice)).NotTo(HaveOccurred())
+		currentSlice.Endpoints[0].Conditions.Ready = &notReady
+		Expect(fakeClient.Update(context.Background(), currentSlice)).NotTo(HaveOccurred())
+		drained, _, err = podOpsLifecycle.drainEndpointSlices(context.Background(), current)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drained).To(BeTrue())
+
+		// wait for drain delay
+		current.Annotations[kuperatorv1alpha1.PodEndpointSliceDrainAnnoKey] = "1h"
+		drained, requeueAfter, err = podOpsLifecycle.drainEndpointSlices(context.Background(), current)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drained).To(BeFalse())
+		Expect(requeueAfter > 59*time.Minute).To(BeTrue())
+	})
+
+	It("Skip Services publishing not ready addresses", func() {
+		published := pod.DeepCopy()
+		published.Name = "drain-published"
+		published.UID = "drain-published-uid"
+		published.Labels = map[string]string{"app": "drain-published"}
+		published.Status.PodIP = "10.0.0.2"
+		Expect(fakeClient.Create(context.Background(), published)).NotTo(HaveOccurred())
+		Expect(fakeClient.Create(context.Background(), &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "drain-published",
+				Namespace: "default",
+			},
+			Spec: corev1.ServiceSpec{
+				Selector:                 map[string]string{"app": "drain-published"},
+				PublishNotReadyAddresses: true,
+			},
+		})).NotTo(HaveOccurred())
+		Expect(fakeClient.Create(context.Background(), &discoveryv1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "drain-published-abc",
+				Namespace: "default",
+				Labels:    map[string]string{discoveryv1.LabelServiceName: "drain-published"},
+			},
+			AddressType: discoveryv1.AddressTypeIPv4,
+			Endpoints: []discoveryv1.Endpoint{
+				{
+					Addresses:  []string{"10.0.0.2"},
+					Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+				},
+			},
+		})).NotTo(HaveOccurred())
+
+		current := &corev1.Pod{}
+		Expect(fakeClient.Get(context.Background(), client.ObjectKeyFromObject(published), current)).NotTo(HaveOccurred())
+		drained, _, err := podOpsLifecycle.drainEndpointSlices(context.Background(), current)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drained).To(BeFalse())
+
+		// the pod is always ready in EndpointSlices of the Service, which is not waited
+		Expect(fakeClient.Get(context.Background(), client.ObjectKeyFromObject(published), current)).NotTo(HaveOccurred())
+		drained, _, err = podOpsLifecycle.drainEndpointSlices(context.Background(), current)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drained).To(BeTrue())
+	})
+
+	It("Skip pods not requiring drain", func() {
+		drained, _, err := podOpsLifecycle.drainEndpointSlices(context.Background(), &corev1.Pod{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(drained).To(BeTrue())
+	})
+})
+
+var _ = Describe("Lifecycle hooks processing", func() {
+	scheme := runtime.NewScheme()
+	Expect(corev1.AddToScheme(scheme)).NotTo(HaveOccurred())
+	Expect(v1alpha1.AddToScheme(scheme)).NotTo(HaveOccurred())
+
+	hooks := &kuperatorv1alpha1.PodOpsLifecycleHooks{
+		Preparing: []kuperatorv1alpha1.LifecycleHook{
+			{
+				Name: "deregister",
+				Exec: &kuperatorv1alpha1.ExecHookAction{Container: "app", Command: []string{"/deregister.sh"}},
+			},
+			{
+				Name:    "warmup",
+				HTTPGet: &kuperatorv1alpha1.HTTPGetHookAction{Port: 8080, Path: "/offline"},
+			},
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "hook",
+			Namespace: "default",
+			Labels: map[string]string{
+				fmt.Sprintf("%s/%s", v1alpha1.PodOperatingLabelPrefix, "123"):     "1717505885197871195",
+				fmt.Sprintf("%s/%s", v1alpha1.PodOperationTypeLabelPrefix, "123"): "upgrade",
+				fmt.Sprintf("%s/%s", v1alpha1.PodPreCheckLabelPrefix, "123"):      "1717505885197871195",
+			},
+			Annotations: map[string]string{},
+		},
+	}
+	oj := &v1alpha1.OperationJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "123",
+			Namespace: "default",
+			Annotations: map[string]string{
+				kuperatorv1alpha1.PodOpsLifecycleHooksAnnoKey: utils.DumpJSON(hooks),
+			},
+		},
+		Spec: v1alpha1.OperationJobSpec{
+			Targets: []v1alpha1.PodOpsTarget{{Name: "hook"}, {Name: "hook-interrupted"}},
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(pod, oj).
+		Build()
+
+	runner := &mockHookRunner{execErr: fmt.Errorf("exit code 1")}
+	events := make(chan event.GenericEvent, 10)
+	podOpsLifecycle := &ReconcilePodOpsLifecycle{
+		ReconcilerMixin: &mixin.ReconcilerMixin{
+			Client:   fakeClient,
+			Logger:   klogr.New().WithName(controllerName),
+			Recorder: record.NewFakeRecorder(10),
+		},
+		podTransitionRuleManager: &mockPodTransitionRuleManager{},
+		expectation:              expectations.NewResourceVersionExpectation(),
+		hookRunner:               runner,
+		hookExecutions:           newHookExecutions(),
+		hookFinishedEvents:       events,
+	}
+
+	statusKey := fmt.Sprintf("%s/%s", kuperatorv1alpha1.PodOpsLifecycleHookStatusAnnoPrefix, "123")
+	getStatuses := func(name string) []kuperatorv1alpha1.LifecycleHookStatus {
+		current := &corev1.Pod{}
+		Expect(fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: name}, current)).NotTo(HaveOccurred())
+		var statuses []kuperatorv1alpha1.LifecycleHookStatus
+		Expect(json.Unmarshal([]byte(current.Annotations[statusKey]), &statuses)).NotTo(HaveOccurred())
+		return statuses
+	}
+	runHooks := func(name string) (bool, time.Duration) {
+		current := &corev1.Pod{}
+		Expect(fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: name}, current)).NotTo(HaveOccurred())
+		idToLabelsMap, _, err := IDToLabelsMap(current)
+		Expect(err).NotTo(HaveOccurred())
+		passed, requeueAfter, err := podOpsLifecycle.runLifecycleHooks(context.Background(), current, idToLabelsMap, kuperatorv1alpha1.PodOpsLifecycleStagePreparing)
+		Expect(err).NotTo(HaveOccurred())
+		return passed, requeueAfter
+	}
+
+	It("Wait until hooks succeed in order", func() {
+		runner.block = make(chan struct{})
+		passed, requeueAfter := runHooks(pod.Name)
+		Expect(passed).To(BeFalse())
+		Expect(requeueAfter).To(Equal(10 * time.Second))
+		statuses := getStatuses(pod.Name)
+		Expect(statuses).To(HaveLen(1))
+		Expect(statuses[0].Phase).To(Equal(kuperatorv1alpha1.LifecycleHookPhaseRunning))
+		Expect(statuses[0].Attempts).To(Equal(int32(1)))
+
+		// running hook is not started twice
+		passed, _ = runHooks(pod.Name)
+		Expect(passed).To(BeFalse())
+		Expect(getStatuses(pod.Name)[0].Attempts).To(Equal(int32(1)))
+		close(runner.block)
+		Eventually(events).Should(Receive())
+		Expect(runner.counts()).To(Equal([]int{1, 0}))
+
+		// result is recorded after hook finished
+		passed, requeueAfter = runHooks(pod.Name)
+		Expect(passed).To(BeFalse())
+		Expect(requeueAfter).To(Equal(hookRetryInterval))
+		statuses = getStatuses(pod.Name)
+		Expect(statuses[0].Phase).To(Equal(kuperatorv1alpha1.LifecycleHookPhaseFailed))
+		Expect(statuses[0].Message).To(Equal("exit code 1"))
+
+		// failed hook is not retried within retry interval
+		passed, _ = runHooks(pod.Name)
+		Expect(passed).To(BeFalse())
+		Expect(getStatuses(pod.Name)[0].Attempts).To(Equal(int32(1)))
+
+		// retry after interval
+		runner.setExecErr(nil)
+		current := &corev1.Pod{}
+		Expect(fakeClient.Get(context.Background(), client.ObjectKeyFromObject(pod), current)).NotTo(HaveOccurred())
+		statuses[0].LastProbeTime = metav1.NewTime(time.Now().Add(-hookRetryInterval))
+		current.Annotations[statusKey] = utils.DumpJSON(statuses)
+		Expect(fakeClient.Update(context.Background(), current)).NotTo(HaveOccurred())
+		passed, _ = runHooks(pod.Name)
+		Expect(passed).To(BeFalse())
+		Eventually(events).Should(Receive())
+
+		// next hook is started after the former succeeded
+		passed, _ = runHooks(pod.Name)
+		Expect(passed).To(BeFalse())
+		Eventually(events).Should(Receive())
+		passed, _ = runHooks(pod.Name)
+		Expect(passed).To(BeTrue())
+		Expect(runner.counts()).To(Equal([]int{2, 1}))
+		statuses = getStatuses(pod.Name)
+		Expect(statuses).To(HaveLen(2))
+		Expect(statuses[0].Phase).To(Equal(kuperatorv1alpha1.LifecycleHookPhaseSucceeded))
+		Expect(statuses[0].Attempts).To(Equal(int32(2)))
+		Expect(statuses[1].Phase).To(Equal(kuperatorv1alpha1.LifecycleHookPhaseSucceeded))
+
+		// succeeded hooks are not run again
+		passed, _ = runHooks(pod.Name)
+		Expect(passed).To(BeTrue())
+		Expect(runner.counts()).To(Equal([]int{2, 1}))
+	})
+
+	It("Fail hooks interrupted while running", func() {
+		interrupted := pod.DeepCopy()
+		interrupted.Name = "hook-interrupted"
+		interrupted.ResourceVersion = ""
+		interrupted.Annotations[statusKey] = utils.DumpJSON([]kuperatorv1alpha1.LifecycleHookStatus{
+			{
+				Name:          "deregister",
+				Stage:         kuperatorv1alpha1.PodOpsLifecycleStagePreparing,
+				Phase:         kuperatorv1alpha1.LifecycleHookPhaseRunning,
+				Attempts:      1,
+				LastProbeTime: metav1.NewTime(time.Now().Add(-5 * time.Second)),
+			},
+		})
+		Expect(fakeClient.Create(context.Background(), interrupted)).NotTo(HaveOccurred())
+		execCount := runner.counts()[0]
+
+		// wait until the attempt is timed out
+		passed, requeueAfter := runHooks(interrupted.Name)
+		Expect(passed).To(BeFalse())
+		Expect(requeueAfter).To(BeNumerically("<=", 5*time.Second))
+		Expect(getStatuses(interrupted.Name)[0].Phase).To(Equal(kuperatorv1alpha1.LifecycleHookPhaseRunning))
+
+		current := &corev1.Pod{}
+		Expect(fakeClient.Get(context.Background(), client.ObjectKeyFromObject(interrupted), current)).NotTo(HaveOccurred())
+		statuses := getStatuses(interrupted.Name)
+		statuses[0].LastProbeTime = metav1.NewTime(time.Now().Add(-10 * time.Second))
+		current.Annotations[statusKey] = utils.DumpJSON(statuses)
+		Expect(fakeClient.Update(context.Background(), current)).NotTo(HaveOccurred())
+		passed, requeueAfter = runHooks(interrupted.Name)
+		Expect(passed).To(BeFalse())
+		Expect(requeueAfter).To(Equal(hookRetryInterval))
+		statuses = getStatuses(interrupted.Name)
+		Expect(statuses[0].Phase).To(Equal(kuperatorv1alpha1.LifecycleHookPhaseFailed))
+		Expect(statuses[0].Message).To(Equal("hook is interrupted before finished"))
+		Expect(runner.counts()[0]).To(Equal(execCount))
+	})
+
+	It("Ignore hooks annotated on pod", func() {
+		forged := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "hook-forged",
+				Namespace: "default",
+				Labels: map[string]string{
+					fmt.Sprintf("%s/%s", v1alpha1.PodOperatingLabelPrefix, "123"):     "1717505885197871195",
+					fmt.Sprintf("%s/%s", v1alpha1.PodOperationTypeLabelPrefix, "123"): "upgrade",
+					fmt.Sprintf("%s/%s", v1alpha1.PodPreCheckLabelPrefix, "123"):      "1717505885197871195",
+				},
+				Annotations: map[string]string{
+					kuperatorv1alpha1.PodOpsLifecycleHooksAnnoKey: utils.DumpJSON(hooks),
+				},
+			},
+		}
+		Expect(fakeClient.Create(context.Background(), forged)).NotTo(HaveOccurred())
+		counts := runner.counts()
+
+		// the pod is not targeted by OperationJob 123
+		passed, _ := runHooks(forged.Name)
+		Expect(passed).To(BeTrue())
+		Expect(runner.counts()).To(Equal(counts))
+	})
+
+	It("Skip stages without hooks", func() {
+		current := &corev1.Pod{}
+		Expect(fakeClient.Get(context.Background(), client.ObjectKeyFromObject(pod), current)).NotTo(HaveOccurred())
+		idToLabelsMap, _, err := IDToLabelsMap(current)
+		Expect(err).NotTo(HaveOccurred())
+
+		passed, _, err := podOpsLifecycle.runLifecycleHooks(context.Background(), current, idToLabelsMap, kuperatorv1alpha1.PodOpsLifecycleStageCompleting)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(passed).To(BeTrue())
+	})
+
+	It("Clean up hooks of finished lifecycles", func() {
+		current := &corev1.Pod{}
+		Expect(fakeClient.Get(context.Background(), client.ObjectKeyFromObject(pod), current)).NotTo(HaveOccurred())
+		idToLabelsMap, _, err := IDToLabelsMap(current)
+		Expect(err).NotTo(HaveOccurred())
+		updated, err := podOpsLifecycle.cleanupLifecycleHooks(context.Background(), current, idToLabelsMap)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updated).To(BeFalse())
+
+		updated, err = podOpsLifecycle.cleanupLifecycleHooks(context.Background(), current, map[string]map[string]string{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updated).To(BeTrue())
+		Expect(fakeClient.Get(context.Background(), client.ObjectKeyFromObject(pod), current)).NotTo(HaveOccurred())
+		Expect(current.Annotations).NotTo(HaveKey(statusKey))
+	})
+})
+
+var _ = Describe("Disruption budget processing", func() {
+	scheme := runtime.NewScheme()
+	Expect(corev1.AddToScheme(scheme)).NotTo(HaveOccurred())
+	Expect(kuperatorv1alpha1.AddToScheme(scheme)).NotTo(HaveOccurred())
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test",
+			Namespace: "default",
+			Labels:    map[string]string{"app": "budget"},
+		},
+	}
+	newBudget := func(name string, maxUnavailable int, reservations ...kuperatorv1alpha1.DisruptionReservation) *kuperatorv1alpha1.DisruptionBudget {
+		value := intstr.FromInt(maxUnavailable)
+		return &kuperatorv1alpha1.DisruptionBudget{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: kuperatorv1alpha1.DisruptionBudgetSpec{
+				Selector:       &metav1.LabelSelector{MatchLabels: map[string]string{"app": "budget"}},
+				MaxUnavailable: &value,
+			},
+			Status: kuperatorv1alpha1.DisruptionBudgetStatus{TotalPods: 2, Reservations: reservations},
+		}
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(pod,
+			newBudget("held", 1, kuperatorv1alpha1.DisruptionReservation{Pod: "default/test", Holder: "PodTransitionRule/default/rule"}),
+			newBudget("free", 1),
+			newBudget("exhausted", 0)).
+		Build()
+
+	podOpsLifecycle := &ReconcilePodOpsLifecycle{
+		ReconcilerMixin: &mixin.ReconcilerMixin{
+			Client:   fakeClient,
+			Logger:   klogr.New().WithName(controllerName),
+			Recorder: record.NewFakeRecorder(10),
+		},
+		podTransitionRuleManager: &mockPodTransitionRuleManager{},
+		expectation:              expectations.NewResourceVersionExpectation(),
+		hookExecutions:           newHookExecutions(),
+	}
+
+	It("Release only slots reserved in the same call when any budget is exhausted", func() {
+		reserved, err := podOpsLifecycle.reserveDisruptionBudgets(context.Background(), pod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reserved).To(BeFalse())
+
+		budget := &kuperatorv1alpha1.DisruptionBudget{}
+		Expect(fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "held"}, budget)).NotTo(HaveOccurred())
+		Expect(budget.Status.Reservations).To(HaveLen(1))
+		Expect(budget.Status.Reservations[0].Holder).To(Equal("PodTransitionRule/default/rule"))
+		Expect(fakeClient.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "free"}, budget)).NotTo(HaveOccurred())
+		Expect(budget.Status.Reservations).To(BeEmpty())
+	})
+})
+
+type mockHookRunner struct {
+	mu           sync.Mutex
+	block        chan struct{}
+	execErr      error
+	execCount    int
+	httpGetCount int
+}
+
+func (m *mockHookRunner) Exec(context.Context, *corev1.Pod, *kuperatorv1alpha1.ExecHookAction) error {
+	m.mu.Lock()
+	block := m.block
+	m.mu.Unlock()
+	if block != nil {
+		<-block
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.execCount++
+	return m.execErr
+}
+
+func (m *mockHookRunner) HTTPGet(context.Context, *corev1.Pod, *kuperatorv1alpha1.HTTPGetHookAction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.httpGetCount++
+	return nil
+}
+
+func (m *mockHookRunner) setExecErr(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.execErr = err
+}
+
+func (m *mockHookRunner) counts() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return []int{m.execCount, m.httpGetCount}
+}
+
 func testReconcile(inner reconcile.Reconciler) (reconcile.Reconciler, chan reconcile.Request) {
 	requests := make(chan reconcile.Request, 5)
 	fn := reconcile.Func(func(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
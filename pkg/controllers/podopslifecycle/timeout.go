@@ -0,0 +1,332 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podopslifecycle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+
+	"kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+
+	"kusionstack.io/kuperator/pkg/controllers/podtransitionrule/checker"
+	controllersutils "kusionstack.io/kuperator/pkg/controllers/utils"
+	podopslifecycleutils "kusionstack.io/kuperator/pkg/controllers/utils/podopslifecycle"
+	"kusionstack.io/kuperator/pkg/utils"
+)
+
+const stageTimeoutEvent = "StageTimeout"
+
+// stageTimeouts are the default stage timeouts of each operation type
+var stageTimeouts = map[string]*kuperatorv1alpha1.PodOpsLifecycleStageTimeout{}
+
+// SetStageTimeouts parses the default stage timeouts in the format of json map from operation type to
+// PodOpsLifecycleStageTimeout, like {"update": {"preparing": "1h", "action": "Cancel"}}
+func SetStageTimeouts(value string) error {
+	timeouts := map[string]*kuperatorv1alpha1.PodOpsLifecycleStageTimeout{}
+	if value != "" {
+		if err := json.Unmarshal([]byte(value), &timeouts); err != nil {
+			return fmt.Errorf("fail to parse stage timeouts: %s", err)
+		}
+	}
+	for operationType, timeout := range timeouts {
+		if err := kuperatorv1alpha1.ValidateStageTimeout(timeout); err != nil {
+			return fmt.Errorf("invalid stage timeout of operation type %s: %s", operationType, err)
+		}
+	}
+	stageTimeouts = timeouts
+	return nil
+}
+
+// stageTimeoutSource is a stage timeout and where it is configured
+type stageTimeoutSource struct {
+	source  string
+	timeout *kuperatorv1alpha1.PodOpsLifecycleStageTimeout
+}
+
+// lifecycleStage returns the stage which may be timed out, and when the lifecycle entered it.
+// Preparing stage begins at the operating label set by Begin, rather than the preparing label which is only set after
+// PreCheck passed, so that lifecycles stuck in PreCheck are timed out as well.
+func lifecycleStage(labels map[string]string) (stage, operationType string, begin time.Time, ok bool) {
+	if value, operating := labels[v1alpha1.PodOperatingLabelPrefix]; operating {
+		_, operate := labels[v1alpha1.PodOperateLabelPrefix]
+		_, operated := labels[v1alpha1.PodOperatedLabelPrefix]
+		if operate || operated {
+			return "", "", begin, false
+		}
+		stage, operationType = kuperatorv1alpha1.PodOpsLifecycleStagePreparing, labels[v1alpha1.PodOperationTypeLabelPrefix]
+		begin, ok = parseLabelTime(value)
+		return
+	}
+	if value, operated := labels[v1alpha1.PodOperatedLabelPrefix]; operated {
+		stage, operationType = kuperatorv1alpha1.PodOpsLifecycleStageCompleting, labels[v1alpha1.PodDoneOperationTypeLabelPrefix]
+		begin, ok = parseLabelTime(value)
+		return
+	}
+	return "", "", begin, false
+}
+
+func parseLabelTime(value string) (time.Time, bool) {
+	nano, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, nano), true
+}
+
+// getStageTimeoutSources collects stage timeouts of the operation type and the PodTransitionRules of pod
+func (r *ReconcilePodOpsLifecycle) getStageTimeoutSources(ctx context.Context, pod *corev1.Pod, state checker.CheckState) ([]*stageTimeoutSource, error) {
+	var sources []*stageTimeoutSource
+	for _, s := range state.States {
+		rs := &v1alpha1.PodTransitionRule{}
+		if err := r.Client.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: s.PodTransitionRuleName}, rs); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		timeout, err := kuperatorv1alpha1.GetTransitionRuleStageTimeout(rs)
+		if err != nil {
+			r.Logger.Error(err, "ignore invalid stage timeout", "podtransitionrule", s.PodTransitionRuleName)
+			continue
+		}
+		if timeout != nil {
+			sources = append(sources, &stageTimeoutSource{source: "PodTransitionRule " + rs.Name, timeout: timeout})
+		}
+	}
+	return sources, nil
+}
+
+// matchStageTimeout returns the shortest timeout of stage among the operation type and sources
+func matchStageTimeout(sources []*stageTimeoutSource, stage, operationType string) (*stageTimeoutSource, time.Duration) {
+	candidates := sources
+	if timeout, ok := stageTimeouts[operationType]; ok {
+		candidates = append([]*stageTimeoutSource{{source: "operation type " + operationType, timeout: timeout}}, sources...)
+	}
+
+	var matched *stageTimeoutSource
+	var shortest time.Duration
+	for _, candidate := range candidates {
+		d := candidate.timeout.GetStageTimeout(stage)
+		if d == nil {
+			continue
+		}
+		if matched == nil || d.Duration < shortest {
+			matched, shortest = candidate, d.Duration
+		}
+	}
+	return matched, shortest
+}
+
+// handleStageTimeouts takes actions on lifecycles timed out, and returns the time until the next stage timeout.
+// The timed out lifecycles are recorded in pod condition, so that events are emitted only once.
+func (r *ReconcilePodOpsLifecycle) handleStageTimeouts(ctx context.Context, pod *corev1.Pod, idToLabelsMap map[string]map[string]string, state checker.CheckState) (requeueAfter time.Duration, updated bool, err error) {
+	var sources []*stageTimeoutSource
+	if len(state.States) > 0 {
+		if sources, err = r.getStageTimeoutSources(ctx, pod, state); err != nil {
+			return 0, false, err
+		}
+	}
+
+	ids := make([]string, 0, len(idToLabelsMap))
+	for id := range idToLabelsMap {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	now := time.Now()
+	currentTime := strconv.FormatInt(now.UnixNano(), 10)
+	var messages []string
+	labelsToAdd := map[string]string{}
+	var labelsToRemove []string
+	lifecyclesToCancel := map[string]string{}
+	clearExpectedFinalizers := false
+	for _, id := range ids {
+		labels := idToLabelsMap[id]
+		stage, operationType, begin, ok := lifecycleStage(labels)
+		if !ok {
+			continue
+		}
+		matched, timeout := matchStageTimeout(sources, stage, operationType)
+		if matched == nil {
+			continue
+		}
+		if elapsed := now.Sub(begin); elapsed < timeout {
+			if requeueAfter == 0 || timeout-elapsed < requeueAfter {
+				requeueAfter = timeout - elapsed
+			}
+			continue
+		}
+
+		action := matched.timeout.GetAction()
+		switch {
+		case action == kuperatorv1alpha1.StageTimeoutActionForcePass && stage == kuperatorv1alpha1.PodOpsLifecycleStagePreparing:
+			if _, ok := pod.Labels[fmt.Sprintf("%s/%s", v1alpha1.PodOperationPermissionLabelPrefix, operationType)]; !ok {
+				labelsToAdd[fmt.Sprintf("%s/%s", v1alpha1.PodOperationPermissionLabelPrefix, operationType)] = currentTime
+			}
+			if _, ok := labels[v1alpha1.PodPreCheckedLabelPrefix]; !ok {
+				labelsToAdd[fmt.Sprintf("%s/%s", v1alpha1.PodPreCheckedLabelPrefix, id)] = currentTime
+			}
+			labelsToAdd[fmt.Sprintf("%s/%s", v1alpha1.PodOperateLabelPrefix, id)] = currentTime
+			labelsToRemove = append(labelsToRemove, fmt.Sprintf("%s/%s", v1alpha1.PodPreparingLabelPrefix, id), v1alpha1.PodServiceAvailableLabel)
+		case action == kuperatorv1alpha1.StageTimeoutActionForcePass && stage == kuperatorv1alpha1.PodOpsLifecycleStageCompleting:
+			if _, ok := labels[v1alpha1.PodPostCheckedLabelPrefix]; !ok {
+				labelsToAdd[fmt.Sprintf("%s/%s", v1alpha1.PodPostCheckedLabelPrefix, id)] = currentTime
+			}
+			clearExpectedFinalizers = true
+		case action == kuperatorv1alpha1.StageTimeoutActionCancel && stage == kuperatorv1alpha1.PodOpsLifecycleStagePreparing:
+			lifecyclesToCancel[id] = operationType
+		default:
+			action = kuperatorv1alpha1.StageTimeoutActionFail
+		}
+		messages = append(messages, fmt.Sprintf("lifecycle %s of %s stays in stage %s over %s configured by %s, action %s",
+			id, operationType, stage, timeout, matched.source, action))
+	}
+	if len(messages) == 0 {
+		return requeueAfter, false, nil
+	}
+
+	message := strings.Join(messages, "; ")
+	conditionUpdated, err := r.updateStageTimeoutCondition(ctx, pod, corev1.ConditionTrue, message)
+	if err != nil {
+		return 0, false, err
+	}
+	if conditionUpdated {
+		for _, msg := range messages {
+			r.Recorder.Event(pod, corev1.EventTypeWarning, stageTimeoutEvent, msg)
+		}
+	}
+
+	if len(labelsToAdd) > 0 || len(lifecyclesToCancel) > 0 || clearExpectedFinalizers {
+		if err := r.passStageTimeouts(ctx, pod, labelsToAdd, labelsToRemove, lifecyclesToCancel, clearExpectedFinalizers); err != nil {
+			return 0, false, err
+		}
+		return requeueAfter, true, nil
+	}
+	return requeueAfter, conditionUpdated, nil
+}
+
+// passStageTimeouts updates lifecycle labels to pass timed out stages, cancels lifecycles from id to operation type,
+// and clears expected finalizers not satisfied
+func (r *ReconcilePodOpsLifecycle) passStageTimeouts(ctx context.Context, pod *corev1.Pod, labelsToAdd map[string]string, labelsToRemove []string, lifecyclesToCancel map[string]string, clearExpectedFinalizers bool) error {
+	key := controllerKey(pod)
+	r.expectation.ExpectUpdate(key, pod.ResourceVersion)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		newPod := &corev1.Pod{}
+		err := r.Client.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}, newPod)
+		if err != nil {
+			return err
+		}
+		if newPod.Labels == nil {
+			newPod.Labels = map[string]string{}
+		}
+		for k, v := range labelsToAdd {
+			newPod.Labels[k] = v
+		}
+		for _, k := range labelsToRemove {
+			delete(newPod.Labels, k)
+		}
+		for id, operationType := range lifecyclesToCancel {
+			podopslifecycleutils.SetUndo(newPod, id, podopslifecycleutils.OperationType(operationType))
+		}
+
+		if clearExpectedFinalizers {
+			satisfied, notSatisfiedFinalizers, err := controllersutils.IsExpectedFinalizerSatisfied(newPod)
+			if err != nil {
+				return err
+			}
+			if !satisfied {
+				podAvailableConditions, err := controllersutils.PodAvailableConditions(newPod)
+				if err != nil {
+					return err
+				}
+				for expectedFlzKey := range notSatisfiedFinalizers {
+					delete(podAvailableConditions.ExpectedFinalizers, expectedFlzKey)
+				}
+				if newPod.Annotations == nil {
+					newPod.Annotations = map[string]string{}
+				}
+				newPod.Annotations[v1alpha1.PodAvailableConditionsAnnotation] = utils.DumpJSON(podAvailableConditions)
+			}
+		}
+		return r.Client.Update(ctx, newPod)
+	})
+	if err != nil {
+		r.Logger.Error(err, "failed to update pod for stage timeout", "pod", key)
+		r.expectation.DeleteExpectations(key)
+	}
+	return err
+}
+
+// updateStageTimeoutCondition sets the stage timeout condition on pod status, and returns whether it is changed
+func (r *ReconcilePodOpsLifecycle) updateStageTimeoutCondition(ctx context.Context, pod *corev1.Pod, status corev1.ConditionStatus, message string) (bool, error) {
+	index, condition := controllersutils.GetPodCondition(&pod.Status, kuperatorv1alpha1.PodOpsLifecycleStageTimeoutCondition)
+	if index == -1 && status == corev1.ConditionFalse {
+		return false, nil
+	}
+	if index != -1 && condition.Status == status && condition.Message == message {
+		return false, nil
+	}
+
+	reason := "StageTimeout"
+	if status == corev1.ConditionFalse {
+		reason = "Finished"
+	}
+
+	key := controllerKey(pod)
+	r.expectation.ExpectUpdate(key, pod.ResourceVersion)
+	if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		newPod := &corev1.Pod{}
+		err := r.Client.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}, newPod)
+		if err != nil {
+			return err
+		}
+		newCondition := corev1.PodCondition{
+			Type:               kuperatorv1alpha1.PodOpsLifecycleStageTimeoutCondition,
+			Status:             status,
+			LastTransitionTime: metav1.Now(),
+			Reason:             reason,
+			Message:            message,
+		}
+		index, condition := controllersutils.GetPodCondition(&newPod.Status, kuperatorv1alpha1.PodOpsLifecycleStageTimeoutCondition)
+		if index == -1 {
+			newPod.Status.Conditions = append(newPod.Status.Conditions, newCondition)
+		} else {
+			if condition.Status == status {
+				newCondition.LastTransitionTime = condition.LastTransitionTime
+			}
+			newPod.Status.Conditions[index] = newCondition
+		}
+		return r.Client.Status().Update(ctx, newPod)
+	}); err != nil {
+		r.Logger.Error(err, "failed to update stage timeout condition", "pod", key)
+		r.expectation.DeleteExpectations(key)
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,306 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podopslifecyclesummary
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+	"kusionstack.io/kuperator/pkg/controllers/podopslifecycle"
+	controllerutils "kusionstack.io/kuperator/pkg/controllers/utils"
+	"kusionstack.io/kuperator/pkg/utils"
+	"kusionstack.io/kuperator/pkg/utils/mixin"
+)
+
+const (
+	controllerName = "podopslifecyclesummary-controller"
+
+	// StageCanceling is the stage of lifecycles being canceled
+	StageCanceling = "Canceling"
+)
+
+// lifecycleSteps are the lifecycle labels in order, and the stages named after them
+var lifecycleSteps = []struct {
+	labelPrefix string
+	stage       string
+}{
+	{appsv1alpha1.PodOperatingLabelPrefix, "Operating"},
+	{appsv1alpha1.PodPreCheckLabelPrefix, "PreCheck"},
+	{appsv1alpha1.PodPreCheckedLabelPrefix, "PreChecked"},
+	{appsv1alpha1.PodPreparingLabelPrefix, "Preparing"},
+	{appsv1alpha1.PodOperateLabelPrefix, "Operate"},
+	{appsv1alpha1.PodOperatedLabelPrefix, "Operated"},
+	{appsv1alpha1.PodPostCheckLabelPrefix, "PostCheck"},
+	{appsv1alpha1.PodPostCheckedLabelPrefix, "PostChecked"},
+	{appsv1alpha1.PodCompletingLabelPrefix, "Completing"},
+}
+
+func Add(mgr manager.Manager) error {
+	return AddToMgr(mgr, NewReconciler(mgr))
+}
+
+// NewReconciler returns a new reconcile.Reconciler
+func NewReconciler(mgr manager.Manager) reconcile.Reconciler {
+	return &PodOpsLifecycleSummaryReconciler{
+		ReconcilerMixin: mixin.NewReconcilerMixin(controllerName, mgr),
+	}
+}
+
+// AddToMgr adds a new Controller to mgr with r as the reconcile.Reconciler
+func AddToMgr(mgr manager.Manager, r reconcile.Reconciler) error {
+	c, err := controller.New(controllerName, mgr, controller.Options{
+		MaxConcurrentReconciles: 5,
+		Reconciler:              r,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &corev1.Pod{}}, &handler.EnqueueRequestForObject{}, predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return utils.OpsLifecycleEnabled(e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return utils.OpsLifecycleEnabled(e.ObjectNew)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return false
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.Watch(&source.Kind{Type: &kuperatorv1alpha1.PodOpsLifecycleSummary{}}, &handler.EnqueueRequestForObject{})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes of rejections of PodTransitionRules on pods
+	err = c.Watch(&source.Kind{Type: &appsv1alpha1.PodTransitionRule{}}, handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+		rs, ok := obj.(*appsv1alpha1.PodTransitionRule)
+		if !ok {
+			return nil
+		}
+		var requests []reconcile.Request
+		for _, detail := range rs.Status.Details {
+			if detail == nil {
+				continue
+			}
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: rs.Namespace, Name: detail.Name}})
+		}
+		return requests
+	}))
+	return err
+}
+
+// PodOpsLifecycleSummaryReconciler maintains PodOpsLifecycleSummary for pods with lifecycles
+type PodOpsLifecycleSummaryReconciler struct {
+	*mixin.ReconcilerMixin
+}
+
+// +kubebuilder:rbac:groups=apps.kusionstack.io,resources=podopslifecyclesummaries,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=apps.kusionstack.io,resources=podtransitionrules,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+
+// Reconcile builds the summary of lifecycles on pod, and deletes it after all lifecycles are finished.
+func (r *PodOpsLifecycleSummaryReconciler) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	logger := r.Logger.WithValues("pod", request.String())
+
+	summary := &kuperatorv1alpha1.PodOpsLifecycleSummary{}
+	if err := r.Client.Get(ctx, request.NamespacedName, summary); err != nil {
+		if !errors.IsNotFound(err) {
+			return reconcile.Result{}, err
+		}
+		summary = nil
+	}
+
+	pod := &corev1.Pod{}
+	if err := r.Client.Get(ctx, request.NamespacedName, pod); err != nil {
+		if !errors.IsNotFound(err) {
+			return reconcile.Result{}, err
+		}
+		pod = nil
+	}
+
+	var idToLabelsMap map[string]map[string]string
+	if pod != nil && pod.DeletionTimestamp == nil {
+		var err error
+		if idToLabelsMap, _, err = podopslifecycle.IDToLabelsMap(pod); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+	if len(idToLabelsMap) == 0 {
+		if summary == nil {
+			return reconcile.Result{}, nil
+		}
+		logger.V(1).Info("delete summary since no lifecycle is on pod")
+		return reconcile.Result{}, client.IgnoreNotFound(r.Client.Delete(ctx, summary))
+	}
+
+	blockingRules, err := r.getBlockingRules(ctx, pod)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	status := BuildSummaryStatus(pod, idToLabelsMap, blockingRules)
+
+	if summary == nil {
+		summary = &kuperatorv1alpha1.PodOpsLifecycleSummary{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: pod.Namespace,
+				Name:      pod.Name,
+				OwnerReferences: []metav1.OwnerReference{
+					*metav1.NewControllerRef(pod, corev1.SchemeGroupVersion.WithKind("Pod")),
+				},
+			},
+			Status: *status,
+		}
+		return reconcile.Result{}, r.Client.Create(ctx, summary)
+	}
+
+	if len(summary.OwnerReferences) > 0 && summary.OwnerReferences[0].UID != pod.UID {
+		// the summary belongs to a former pod with the same name, and is recreated for the new one
+		return reconcile.Result{Requeue: true}, client.IgnoreNotFound(r.Client.Delete(ctx, summary))
+	}
+
+	if equalSummaryStatus(&summary.Status, status) {
+		return reconcile.Result{}, nil
+	}
+	summary.Status = *status
+	return reconcile.Result{}, r.Client.Update(ctx, summary)
+}
+
+// getBlockingRules returns the rejections of PodTransitionRules on pod, except the ones in audit mode
+func (r *PodOpsLifecycleSummaryReconciler) getBlockingRules(ctx context.Context, pod *corev1.Pod) ([]kuperatorv1alpha1.BlockingRule, error) {
+	rsList := &appsv1alpha1.PodTransitionRuleList{}
+	if err := r.Client.List(ctx, rsList, client.InNamespace(pod.Namespace)); err != nil {
+		return nil, err
+	}
+
+	var blockingRules []kuperatorv1alpha1.BlockingRule
+	for i := range rsList.Items {
+		rs := &rsList.Items[i]
+		for _, detail := range rs.Status.Details {
+			if detail == nil || detail.Name != pod.Name || detail.Passed {
+				continue
+			}
+			for _, rej := range detail.RejectInfo {
+				if kuperatorv1alpha1.IsTransitionRuleAudited(rs, rej.RuleName) {
+					continue
+				}
+				blockingRules = append(blockingRules, kuperatorv1alpha1.BlockingRule{
+					PodTransitionRule: rs.Name,
+					Stage:             detail.Stage,
+					RuleName:          rej.RuleName,
+					Reason:            rej.Reason,
+				})
+			}
+		}
+	}
+	sort.Slice(blockingRules, func(i, j int) bool {
+		if blockingRules[i].PodTransitionRule != blockingRules[j].PodTransitionRule {
+			return blockingRules[i].PodTransitionRule < blockingRules[j].PodTransitionRule
+		}
+		return blockingRules[i].RuleName < blockingRules[j].RuleName
+	})
+	return blockingRules, nil
+}
+
+// BuildSummaryStatus builds the summary of lifecycles on pod from its lifecycle labels and finalizers
+func BuildSummaryStatus(pod *corev1.Pod, idToLabelsMap map[string]map[string]string, blockingRules []kuperatorv1alpha1.BlockingRule) *kuperatorv1alpha1.PodOpsLifecycleSummaryStatus {
+	status := &kuperatorv1alpha1.PodOpsLifecycleSummaryStatus{
+		ObservedPodResourceVersion:  pod.ResourceVersion,
+		BlockingRules:               blockingRules,
+		PendingProtectionFinalizers: controllerutils.GetProtectionFinalizers(pod),
+	}
+
+	ids := make([]string, 0, len(idToLabelsMap))
+	for id := range idToLabelsMap {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		status.Lifecycles = append(status.Lifecycles, buildLifecycleSummary(pod, id, idToLabelsMap[id]))
+	}
+
+	if satisfied, notSatisfiedFinalizers, err := controllerutils.IsExpectedFinalizerSatisfied(pod); err == nil && !satisfied {
+		status.PendingExpectedFinalizers = notSatisfiedFinalizers
+	}
+
+	now := metav1.Now()
+	status.LastUpdateTime = &now
+	return status
+}
+
+func buildLifecycleSummary(pod *corev1.Pod, id string, labels map[string]string) kuperatorv1alpha1.LifecycleSummary {
+	lifecycle := kuperatorv1alpha1.LifecycleSummary{
+		ID:            id,
+		OperationType: labels[appsv1alpha1.PodOperationTypeLabelPrefix],
+	}
+	if lifecycle.OperationType == "" {
+		lifecycle.OperationType = labels[appsv1alpha1.PodDoneOperationTypeLabelPrefix]
+	}
+
+	for _, step := range lifecycleSteps {
+		value, ok := labels[step.labelPrefix]
+		if !ok {
+			continue
+		}
+		entry := kuperatorv1alpha1.StageEntry{Stage: step.stage}
+		if nano, err := strconv.ParseInt(value, 10, 64); err == nil {
+			enterTime := metav1.NewTime(time.Unix(0, nano))
+			entry.EnterTime = &enterTime
+		}
+		lifecycle.StageEntries = append(lifecycle.StageEntries, entry)
+		lifecycle.Stage = step.stage
+	}
+
+	// undo label is not well known with id
+	if _, ok := pod.Labels[appsv1alpha1.PodUndoOperationTypeLabelPrefix+"/"+id]; ok {
+		lifecycle.Stage = StageCanceling
+	}
+	return lifecycle
+}
+
+// equalSummaryStatus compares summaries, ignoring the resource version of pod and update time
+func equalSummaryStatus(oldStatus, newStatus *kuperatorv1alpha1.PodOpsLifecycleSummaryStatus) bool {
+	oldCopy, newCopy := oldStatus.DeepCopy(), newStatus.DeepCopy()
+	oldCopy.ObservedPodResourceVersion, newCopy.ObservedPodResourceVersion = "", ""
+	oldCopy.LastUpdateTime, newCopy.LastUpdateTime = nil, nil
+	return equality.Semantic.DeepEqual(oldCopy, newCopy)
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podopslifecyclesummary
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+	"kusionstack.io/kuperator/pkg/controllers/podopslifecycle"
+)
+
+func TestBuildSummaryStatus(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	now := time.Now()
+	nano := func(d time.Duration) string {
+		return strconv.FormatInt(now.Add(d).UnixNano(), 10)
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			Name:            "test",
+			ResourceVersion: "10",
+			Labels: map[string]string{
+				fmt.Sprintf("%s/%s", appsv1alpha1.PodOperatingLabelPrefix, "123"):     nano(-3 * time.Minute),
+				fmt.Sprintf("%s/%s", appsv1alpha1.PodOperationTypeLabelPrefix, "123"): "update",
+				fmt.Sprintf("%s/%s", appsv1alpha1.PodPreCheckedLabelPrefix, "123"):    nano(-2 * time.Minute),
+				fmt.Sprintf("%s/%s", appsv1alpha1.PodPreparingLabelPrefix, "123"):     nano(-time.Minute),
+
+				fmt.Sprintf("%s/%s", appsv1alpha1.PodOperatingLabelPrefix, "456"):         nano(-time.Minute),
+				fmt.Sprintf("%s/%s", appsv1alpha1.PodOperationTypeLabelPrefix, "456"):     "scale-in",
+				fmt.Sprintf("%s/%s", appsv1alpha1.PodPreCheckLabelPrefix, "456"):          nano(-time.Minute),
+				fmt.Sprintf("%s/%s", appsv1alpha1.PodUndoOperationTypeLabelPrefix, "456"): "scale-in",
+			},
+			Finalizers: []string{
+				fmt.Sprintf("%s/%s", appsv1alpha1.PodOperationProtectionFinalizerPrefix, "traffic"),
+			},
+		},
+	}
+	idToLabelsMap, _, err := podopslifecycle.IDToLabelsMap(pod)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	blockingRules := []kuperatorv1alpha1.BlockingRule{
+		{PodTransitionRule: "rs", Stage: "PreCheck", RuleName: "webhook", Reason: "rejected"},
+	}
+	status := BuildSummaryStatus(pod, idToLabelsMap, blockingRules)
+	g.Expect(status.ObservedPodResourceVersion).To(gomega.Equal("10"))
+	g.Expect(status.BlockingRules).To(gomega.Equal(blockingRules))
+	g.Expect(status.PendingProtectionFinalizers).To(gomega.ConsistOf(pod.Finalizers[0]))
+	g.Expect(status.PendingExpectedFinalizers).To(gomega.BeEmpty())
+	g.Expect(status.LastUpdateTime).NotTo(gomega.BeNil())
+
+	g.Expect(status.Lifecycles).To(gomega.HaveLen(2))
+	g.Expect(status.Lifecycles[0].ID).To(gomega.Equal("123"))
+	g.Expect(status.Lifecycles[0].OperationType).To(gomega.Equal("update"))
+	g.Expect(status.Lifecycles[0].Stage).To(gomega.Equal("Preparing"))
+	g.Expect(status.Lifecycles[0].StageEntries).To(gomega.HaveLen(3))
+	g.Expect(status.Lifecycles[0].StageEntries[0].Stage).To(gomega.Equal("Operating"))
+	g.Expect(status.Lifecycles[0].StageEntries[0].EnterTime.UnixNano()).To(gomega.Equal(now.Add(-3 * time.Minute).UnixNano()))
+	g.Expect(status.Lifecycles[0].StageEntries[1].Stage).To(gomega.Equal("PreChecked"))
+	g.Expect(status.Lifecycles[0].StageEntries[2].Stage).To(gomega.Equal("Preparing"))
+
+	g.Expect(status.Lifecycles[1].ID).To(gomega.Equal("456"))
+	g.Expect(status.Lifecycles[1].OperationType).To(gomega.Equal("scale-in"))
+	g.Expect(status.Lifecycles[1].Stage).To(gomega.Equal(StageCanceling))
+
+	// summary is not changed if only the pod resource version and update time are changed
+	pod.ResourceVersion = "11"
+	newStatus := BuildSummaryStatus(pod, idToLabelsMap, blockingRules)
+	g.Expect(equalSummaryStatus(status, newStatus)).To(gomega.BeTrue())
+
+	newStatus = BuildSummaryStatus(pod, idToLabelsMap, nil)
+	g.Expect(equalSummaryStatus(status, newStatus)).To(gomega.BeFalse())
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package podtransitionrule
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+)
+
+const auditRejectedReason = "AuditRejected"
+
+var auditRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "podtransitionrule_audit_rejections_total",
+	Help: "Total number of pods which would have been rejected by rules in audit mode",
+}, []string{"namespace", "podtransitionrule", "rule"})
+
+func init() {
+	metrics.Registry.MustRegister(auditRejections)
+}
+
+// recordAuditRejections emits events and metrics for rejections of rules in audit mode, which are not found in
+// the current status, so that the same rejection is recorded only once. Rejections are told apart by the audit mode
+// of their rules, not by their reasons.
+func (r *PodTransitionRuleReconciler) recordAuditRejections(rs *appsv1alpha1.PodTransitionRule, current, updated []*appsv1alpha1.PodTransitionDetail) {
+	recorded := sets.NewString()
+	for _, detail := range current {
+		for _, rej := range detail.RejectInfo {
+			if kuperatorv1alpha1.IsTransitionRuleAudited(rs, rej.RuleName) {
+				recorded.Insert(detail.Name + "/" + rej.RuleName)
+			}
+		}
+	}
+	for _, detail := range updated {
+		for _, rej := range detail.RejectInfo {
+			if !kuperatorv1alpha1.IsTransitionRuleAudited(rs, rej.RuleName) || recorded.Has(detail.Name+"/"+rej.RuleName) {
+				continue
+			}
+			auditRejections.WithLabelValues(rs.Namespace, rs.Name, rej.RuleName).Inc()
+			r.Recorder.Eventf(rs, corev1.EventTypeWarning, auditRejectedReason,
+				"pod %s on stage %s would be rejected by rule %s in audit mode: %s",
+				detail.Name, detail.Stage, rej.RuleName, rej.Reason)
+		}
+	}
+}
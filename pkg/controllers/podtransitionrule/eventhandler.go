@@ -31,12 +31,15 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
 
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 	processorrules "kusionstack.io/kuperator/pkg/controllers/podtransitionrule/processor/rules"
 	commonutils "kusionstack.io/kuperator/pkg/utils"
 )
 
 var _ inject.Client = &EventHandler{}
 var _ inject.Logger = &EventHandler{}
+var _ inject.Client = &DependencyEventHandler{}
+var _ inject.Logger = &DependencyEventHandler{}
 
 func NewWebhookGenericEventChannel() <-chan event.GenericEvent {
 	webhookTriggerChannel := make(chan event.GenericEvent, 1<<10)
@@ -72,6 +75,7 @@ func (p *EventHandler) Create(e event.CreateEvent, q workqueue.RateLimitingInter
 			Name:      rs.Name,
 			Namespace: rs.Namespace,
 		}})
+		p.enqueueDependents(rs, q)
 	}
 }
 
@@ -87,6 +91,7 @@ func (p *EventHandler) Update(e event.UpdateEvent, q workqueue.RateLimitingInter
 			Name:      rs.Name,
 			Namespace: rs.Namespace,
 		}})
+		p.enqueueDependents(rs, q)
 	}
 }
 
@@ -102,12 +107,28 @@ func (p *EventHandler) Delete(e event.DeleteEvent, q workqueue.RateLimitingInter
 			Name:      rs.Name,
 			Namespace: rs.Namespace,
 		}})
+		p.enqueueDependents(rs, q)
 	}
 }
 
 func (p *EventHandler) Generic(e event.GenericEvent, q workqueue.RateLimitingInterface) {
 }
 
+// enqueueDependents enqueues PodTransitionRules depending on rs, since pods of rs changed
+func (p *EventHandler) enqueueDependents(rs *appsv1alpha1.PodTransitionRule, q workqueue.RateLimitingInterface) {
+	dependents, err := dependentPodTransitionRules(p.client, kuperatorv1alpha1.DependentKindPodTransitionRule, rs)
+	if err != nil {
+		p.logger.Error(err, "failed to get dependent podtransitionrules for objects", "obj", commonutils.ObjectKeyString(rs))
+		return
+	}
+	for _, dependent := range dependents {
+		q.Add(reconcile.Request{NamespacedName: types.NamespacedName{
+			Name:      dependent.Name,
+			Namespace: dependent.Namespace,
+		}})
+	}
+}
+
 func involvedPodTransitionRules(c client.Client, obj client.Object) ([]*appsv1alpha1.PodTransitionRule, error) {
 	podTransitionRuleList := &appsv1alpha1.PodTransitionRuleList{}
 	var podTransitionRules []*appsv1alpha1.PodTransitionRule
@@ -132,6 +153,82 @@ func involvedPodTransitionRules(c client.Client, obj client.Object) ([]*appsv1al
 	return podTransitionRules, nil
 }
 
+// DependencyEventHandler enqueues PodTransitionRules whose dependency rules refer to the changed workload
+type DependencyEventHandler struct {
+	Kind string
+
+	// client and logger will be injected
+	client client.Client
+	logger logr.Logger
+}
+
+func (p *DependencyEventHandler) InjectClient(c client.Client) error {
+	p.client = c
+	return nil
+}
+
+func (p *DependencyEventHandler) InjectLogger(l logr.Logger) error {
+	p.logger = l.WithName("podtransitionrule").WithName("dependencyEventHandler")
+	return nil
+}
+
+func (p *DependencyEventHandler) Create(e event.CreateEvent, q workqueue.RateLimitingInterface) {
+	p.enqueue(e.Object, q)
+}
+
+func (p *DependencyEventHandler) Update(e event.UpdateEvent, q workqueue.RateLimitingInterface) {
+	p.enqueue(e.ObjectNew, q)
+}
+
+func (p *DependencyEventHandler) Delete(e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	if e.Object == nil {
+		return
+	}
+	p.enqueue(e.Object, q)
+}
+
+func (p *DependencyEventHandler) Generic(e event.GenericEvent, q workqueue.RateLimitingInterface) {
+}
+
+func (p *DependencyEventHandler) enqueue(obj client.Object, q workqueue.RateLimitingInterface) {
+	podTransitionRules, err := dependentPodTransitionRules(p.client, p.Kind, obj)
+	if err != nil {
+		p.logger.Error(err, "failed to get dependent podtransitionrules for objects", "obj", commonutils.ObjectKeyString(obj))
+		return
+	}
+	for _, rs := range podTransitionRules {
+		q.Add(reconcile.Request{NamespacedName: types.NamespacedName{
+			Name:      rs.Name,
+			Namespace: rs.Namespace,
+		}})
+	}
+}
+
+func dependentPodTransitionRules(c client.Client, kind string, obj client.Object) ([]*appsv1alpha1.PodTransitionRule, error) {
+	podTransitionRuleList := &appsv1alpha1.PodTransitionRuleList{}
+	var podTransitionRules []*appsv1alpha1.PodTransitionRule
+	if err := c.List(context.TODO(), podTransitionRuleList, client.InNamespace(obj.GetNamespace())); err != nil {
+		return podTransitionRules, err
+	}
+	for i := range podTransitionRuleList.Items {
+		rs := &podTransitionRuleList.Items[i]
+		if kind == kuperatorv1alpha1.DependentKindPodTransitionRule && rs.Name == obj.GetName() {
+			continue
+		}
+		extensions, err := kuperatorv1alpha1.GetTransitionRuleExtensions(rs)
+		if err != nil {
+			continue
+		}
+		for _, extension := range extensions {
+			if extension.Dependency != nil && processorrules.IsDependentWorkload(extension.Dependency, kind, obj) {
+				podTransitionRules = append(podTransitionRules, rs)
+				break
+			}
+		}
+	}
+	return podTransitionRules, nil
+}
+
 type PodTransitionRuleEventHandler struct {
 }
 
@@ -23,6 +23,7 @@ import (
 	"sync"
 	"time"
 
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -39,6 +40,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 	"kusionstack.io/kuperator/pkg/controllers/podtransitionrule/processor"
 	"kusionstack.io/kuperator/pkg/controllers/podtransitionrule/register"
 	podtransitionruleutils "kusionstack.io/kuperator/pkg/controllers/podtransitionrule/utils"
@@ -82,6 +84,22 @@ func addToMgr(mgr manager.Manager, r reconcile.Reconciler) (controller.Controlle
 		return c, err
 	}
 
+	// Watch for changes to workloads referred by dependency rules
+	err = c.Watch(&source.Kind{Type: &appsv1alpha1.CollaSet{}}, &DependencyEventHandler{Kind: kuperatorv1alpha1.DependentKindCollaSet})
+	if err != nil {
+		return c, err
+	}
+
+	err = c.Watch(&source.Kind{Type: &appsv1.Deployment{}}, &DependencyEventHandler{Kind: kuperatorv1alpha1.DependentKindDeployment})
+	if err != nil {
+		return c, err
+	}
+
+	err = c.Watch(&source.Kind{Type: &appsv1alpha1.PodTransitionRule{}}, &DependencyEventHandler{Kind: kuperatorv1alpha1.DependentKindPodTransitionRule})
+	if err != nil {
+		return c, err
+	}
+
 	err = c.Watch(&source.Channel{Source: NewWebhookGenericEventChannel()}, &handler.EnqueueRequestForObject{})
 	if err != nil {
 		return c, err
@@ -100,6 +118,14 @@ type PodTransitionRuleReconciler struct {
 // +kubebuilder:rbac:groups=apps.kusionstack.io,resources=podtransitionrules/finalizers,verbs=update
 // +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;update;patch
 // +kubebuilder:rbac:groups=core,resources=events,verbs=create;update;patch
+// +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps.kusionstack.io,resources=collasets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get
+// +kubebuilder:rbac:groups=apps.kusionstack.io,resources=disruptionbudgets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps.kusionstack.io,resources=disruptionbudgets/status,verbs=get;update;patch
 
 func (r *PodTransitionRuleReconciler) Reconcile(ctx context.Context, request reconcile.Request) (result reconcile.Result, reconcileErr error) {
 	logger := r.Logger.WithValues("podTransitionRule", request.String())
@@ -165,7 +191,7 @@ func (r *PodTransitionRuleReconciler) Reconcile(ctx context.Context, request rec
 	}
 
 	// process rules
-	shouldRetry, interval, details, ruleStates := r.process(podTransitionRule, targetPods)
+	shouldRetry, interval, details, ruleStates, webhookProgresses := r.process(podTransitionRule, targetPods)
 
 	res := reconcile.Result{
 		Requeue: shouldRetry,
@@ -196,6 +222,8 @@ func (r *PodTransitionRuleReconciler) Reconcile(ctx context.Context, request rec
 		UpdateTime:         &tm,
 	}
 
+	r.recordAuditRejections(podTransitionRule, podTransitionRule.Status.Details, detailList)
+
 	if !equalStatus(newStatus, &podTransitionRule.Status) {
 		podtransitionruleutils.PodTransitionRuleVersionExpectation.ExpectUpdate(commonutils.ObjectKeyString(podTransitionRule), podTransitionRule.ResourceVersion)
 		podTransitionRule.Status = *newStatus
@@ -205,6 +233,10 @@ func (r *PodTransitionRuleReconciler) Reconcile(ctx context.Context, request rec
 			return reconcile.Result{}, err
 		}
 	}
+	if err := r.updateWebhookProgresses(ctx, podTransitionRule, webhookProgresses); err != nil {
+		logger.Error(err, "failed to update webhook progress of podtransitionrule")
+		return reconcile.Result{}, err
+	}
 	pods := make([]*corev1.Pod, 0, len(targetPods))
 	for _, pod := range targetPods {
 		pods = append(pods, pod)
@@ -244,17 +276,19 @@ func (r *PodTransitionRuleReconciler) process(
 	interval *time.Duration,
 	details map[string]*appsv1alpha1.PodTransitionDetail,
 	ruleStates []*appsv1alpha1.RuleState,
+	webhookProgresses map[string]*kuperatorv1alpha1.TransitionRuleWebhookProgress,
 ) {
 	stages := r.GetStages()
 	wg := sync.WaitGroup{}
 	wg.Add(len(stages))
 	mu := sync.RWMutex{}
 	details = map[string]*appsv1alpha1.PodTransitionDetail{}
+	webhookProgresses = map[string]*kuperatorv1alpha1.TransitionRuleWebhookProgress{}
 	for _, stage := range stages {
 		currentStage := stage
 		go func() {
 			defer wg.Done()
-			res := processor.NewRuleProcessor(r.Client, currentStage, rs, r.Logger).Process(pods)
+			res := processor.NewRuleProcessor(r.Client, r.APIReader, currentStage, rs, r.Logger).Process(pods)
 			mu.Lock()
 			defer mu.Unlock()
 			if res.Interval != nil {
@@ -265,6 +299,9 @@ func (r *PodTransitionRuleReconciler) process(
 			if res.RuleStates != nil {
 				ruleStates = append(ruleStates, res.RuleStates...)
 			}
+			for name, progress := range res.WebhookProgresses {
+				webhookProgresses[name] = progress
+			}
 			if res.Retry {
 				shouldRetry = true
 			}
@@ -272,7 +309,55 @@ func (r *PodTransitionRuleReconciler) process(
 		}()
 	}
 	wg.Wait()
-	return shouldRetry, interval, details, ruleStates
+	return shouldRetry, interval, details, ruleStates, webhookProgresses
+}
+
+// updateWebhookProgresses persists progress of webhook rules in annotation, which WebhookStatus has no field for.
+// Progress of rules not processed this time is kept, and progress of rules removed from spec is dropped.
+func (r *PodTransitionRuleReconciler) updateWebhookProgresses(ctx context.Context, rs *appsv1alpha1.PodTransitionRule, updated map[string]*kuperatorv1alpha1.TransitionRuleWebhookProgress) error {
+	progresses, err := kuperatorv1alpha1.GetTransitionRuleWebhookProgresses(rs)
+	if err != nil {
+		// overwrite invalid annotation
+		r.Logger.Error(err, "invalid webhook progress, overwrite it", "podTransitionRule", commonutils.ObjectKeyString(rs))
+		progresses = map[string]*kuperatorv1alpha1.TransitionRuleWebhookProgress{}
+	}
+	webhookRules := sets.NewString()
+	for _, rule := range rs.Spec.Rules {
+		if rule.Webhook != nil {
+			webhookRules.Insert(rule.Name)
+		}
+	}
+	for name, progress := range updated {
+		progresses[name] = progress
+	}
+	for name, progress := range progresses {
+		if !webhookRules.Has(name) || progress.IsEmpty() {
+			delete(progresses, name)
+		}
+	}
+
+	var value string
+	if len(progresses) > 0 {
+		value = utils.DumpJSON(progresses)
+	}
+	if rs.Annotations[kuperatorv1alpha1.PodTransitionRuleWebhookProgressAnnoKey] == value {
+		return nil
+	}
+	var anno *string
+	if value != "" {
+		anno = &value
+	}
+	patch := client.RawPatch(types.MergePatchType, []byte(utils.DumpJSON(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]*string{kuperatorv1alpha1.PodTransitionRuleWebhookProgressAnnoKey: anno},
+		},
+	})))
+	podtransitionruleutils.PodTransitionRuleVersionExpectation.ExpectUpdate(commonutils.ObjectKeyString(rs), rs.ResourceVersion)
+	if err := r.Client.Patch(ctx, rs, patch); err != nil {
+		podtransitionruleutils.PodTransitionRuleVersionExpectation.DeleteExpectations(commonutils.ObjectKeyString(rs))
+		return err
+	}
+	return nil
 }
 
 func (r *PodTransitionRuleReconciler) cleanUpPodTransitionRulePods(ctx context.Context, podTransitionRule *appsv1alpha1.PodTransitionRule) error {
@@ -312,15 +397,23 @@ func updateDetail(details map[string]*appsv1alpha1.PodTransitionDetail, passRule
 		detail, ok := details[po]
 		if !ok {
 			detail = &appsv1alpha1.PodTransitionDetail{
-				Name:  po,
-				Stage: stage,
+				Name:   po,
+				Stage:  stage,
+				Passed: true,
 			}
 		}
 		detail.PassedRules = append(detail.PassedRules, rules.List()...)
 		if rejectInfo != nil {
 			detail.RejectInfo = append(detail.RejectInfo, *rejectInfo)
+			detail.Passed = false
+		}
+		// rejections of rules in audit mode are recorded, but do not block pod
+		for _, rej := range passRules.AuditRejected[po] {
+			detail.RejectInfo = append(detail.RejectInfo, appsv1alpha1.RejectInfo{
+				RuleName: rej.RuleName,
+				Reason:   rej.Reason,
+			})
 		}
-		detail.Passed = detail.RejectInfo == nil || len(detail.RejectInfo) == 0
 		details[po] = detail
 	}
 }
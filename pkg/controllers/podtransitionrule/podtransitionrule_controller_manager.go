@@ -22,6 +22,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 
 	"kusionstack.io/kuperator/pkg/controllers/podtransitionrule/checker"
+	"kusionstack.io/kuperator/pkg/controllers/podtransitionrule/processor/rules"
 	"kusionstack.io/kuperator/pkg/controllers/podtransitionrule/register"
 )
 
@@ -48,6 +49,11 @@ func AddUnAvailableFunc(f func(pod *corev1.Pod) (bool, *int64)) {
 	register.UnAvailableFuncList = append(register.UnAvailableFuncList, f)
 }
 
+// AddOwnerReplicasResolver resolves desired replicas of pod owners of the kind, whose uncreated replicas are counted as unavailable
+func AddOwnerReplicasResolver(kind string, f rules.OwnerReplicasResolver) {
+	rules.OwnerReplicasResolvers[kind] = f
+}
+
 func newPodTransitionRuleManager() ManagerInterface {
 	return &rsManager{
 		Register: register.DefaultRegister(),
@@ -32,10 +32,12 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	"kusionstack.io/kuperator/pkg/controllers/podtransitionrule/processor"
 	"kusionstack.io/kuperator/pkg/controllers/podtransitionrule/register"
 	"kusionstack.io/kuperator/pkg/utils/inject"
 )
@@ -167,6 +169,41 @@ func TestPodTransitionRule(t *testing.T) {
 	}, 5*time.Second, 1*time.Second).Should(gomega.HaveOccurred())
 }
 
+func TestUpdateDetailAudit(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	details := map[string]*appsv1alpha1.PodTransitionDetail{}
+	updateDetail(details, &processor.ProcessResult{
+		PassRules: map[string]sets.String{
+			"pod-a": sets.NewString("available"),
+			"pod-b": sets.NewString(),
+		},
+		Rejected: map[string]processor.RejectInfo{
+			"pod-b": {RuleName: "available", Reason: "not available"},
+		},
+		AuditRejected: map[string][]processor.RejectInfo{
+			"pod-a": {{RuleName: "expression", Reason: "expression not satisfied"}},
+			"pod-b": {{RuleName: "expression", Reason: "expression not satisfied"}},
+		},
+	}, PreTrafficOffStage)
+
+	// rejection in audit mode is recorded, but does not block pod
+	g.Expect(details["pod-a"].Passed).Should(gomega.BeTrue())
+	g.Expect(len(details["pod-a"].RejectInfo)).Should(gomega.Equal(1))
+	g.Expect(details["pod-a"].RejectInfo[0].Reason).Should(gomega.Equal("expression not satisfied"))
+	g.Expect(details["pod-b"].Passed).Should(gomega.BeFalse())
+	g.Expect(len(details["pod-b"].RejectInfo)).Should(gomega.Equal(2))
+
+	// reason of a rule not in audit mode is never taken as audit rejection
+	details = map[string]*appsv1alpha1.PodTransitionDetail{}
+	updateDetail(details, &processor.ProcessResult{
+		PassRules: map[string]sets.String{"pod-c": sets.NewString()},
+		Rejected: map[string]processor.RejectInfo{
+			"pod-c": {RuleName: "audit", Reason: "[audit] rate limited"},
+		},
+	}, PreTrafficOffStage)
+	g.Expect(details["pod-c"].Passed).Should(gomega.BeFalse())
+}
+
 func TestWebhookRule(t *testing.T) {
 	g := gomega.NewGomegaWithT(t)
 	stop, finish := RunHttpServer(handleHttpAlwaysSuccess, "8899")
@@ -32,14 +32,16 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 	"kusionstack.io/kuperator/pkg/controllers/podtransitionrule/processor/rules"
 	"kusionstack.io/kuperator/pkg/controllers/podtransitionrule/register"
 	"kusionstack.io/kuperator/pkg/controllers/podtransitionrule/utils"
 )
 
-func NewRuleProcessor(client client.Client, stage string, podTransitionRule *appsv1alpha1.PodTransitionRule, log logr.Logger) *Processor {
+func NewRuleProcessor(client client.Client, apiReader client.Reader, stage string, podTransitionRule *appsv1alpha1.PodTransitionRule, log logr.Logger) *Processor {
 	processor := &Processor{
 		client:            client,
+		apiReader:         apiReader,
 		stage:             stage,
 		podTransitionRule: podTransitionRule,
 		Logger:            log,
@@ -51,6 +53,7 @@ func NewRuleProcessor(client client.Client, stage string, podTransitionRule *app
 type Processor struct {
 	podTransitionRule *appsv1alpha1.PodTransitionRule
 	client            client.Client
+	apiReader         client.Reader
 	stage             string
 	register.Policy
 	logr.Logger
@@ -85,12 +88,14 @@ func (p *Processor) Process(targets map[string]*corev1.Pod) *ProcessResult {
 	}
 
 	if processingPods.Len() == 0 {
-		return &ProcessResult{}
+		return &ProcessResult{RuleStates: p.keepRuleStates(effectiveRules)}
 	}
 
 	passInfo := map[string]sets.String{}
 	rejected := map[string]RejectInfo{}
+	auditRejected := map[string][]RejectInfo{}
 	var ruleStates []*appsv1alpha1.RuleState
+	webhookProgresses := map[string]*kuperatorv1alpha1.TransitionRuleWebhookProgress{}
 
 	minInterval := time.Duration(math.MaxInt32) * time.Second
 	retry := false
@@ -101,7 +106,7 @@ func (p *Processor) Process(targets map[string]*corev1.Pod) *ProcessResult {
 
 	for _, rule := range effectiveRules {
 		// get rule processor
-		ruler := rules.GetRuler(rule, p.client)
+		ruler := rules.GetRuler(p.podTransitionRule, rule, p.client, p.apiReader)
 		if ruler == nil {
 			continue
 		}
@@ -136,10 +141,14 @@ func (p *Processor) Process(targets map[string]*corev1.Pod) *ProcessResult {
 
 		// do rule processor
 		result := ruler.Filter(p.podTransitionRule, targets, processingPods)
+		audited := kuperatorv1alpha1.IsTransitionRuleAudited(p.podTransitionRule, rule.Name)
 
 		if result.RuleState != nil {
 			ruleStates = append(ruleStates, result.RuleState)
 		}
+		if result.WebhookProgress != nil {
+			webhookProgresses[rule.Name] = result.WebhookProgress
+		}
 
 		if result.Err != nil {
 			retry = true
@@ -156,11 +165,18 @@ func (p *Processor) Process(targets map[string]*corev1.Pod) *ProcessResult {
 			passInfo[passPodName].Insert(rule.Name)
 		}
 
+		auditPassed := sets.NewString()
 		for podName, reason := range result.Rejected {
+			if audited {
+				// audit mode, record the rejection without blocking pod
+				auditRejected[podName] = append(auditRejected[podName], RejectInfo{Reason: reason, RuleName: rule.Name})
+				auditPassed.Insert(podName)
+				continue
+			}
 			rejected[podName] = RejectInfo{Reason: reason, RuleName: rule.Name}
 		}
 
-		processingPods = result.Passed.Union(skipPods)
+		processingPods = result.Passed.Union(skipPods).Union(auditPassed)
 		// do not break: ensure update status
 		//if processingPods.Len() == 0 {
 		//	break
@@ -168,10 +184,13 @@ func (p *Processor) Process(targets map[string]*corev1.Pod) *ProcessResult {
 	}
 
 	res := &ProcessResult{
-		Rejected:   rejected,
-		PassRules:  passInfo,
-		Retry:      retry,
-		RuleStates: ruleStates,
+		Rejected:      rejected,
+		AuditRejected: auditRejected,
+		PassRules:     passInfo,
+		Retry:         retry,
+		RuleStates:    ruleStates,
+
+		WebhookProgresses: webhookProgresses,
 	}
 
 	if minInterval != time.Duration(math.MaxInt32)*time.Second {
@@ -180,14 +199,32 @@ func (p *Processor) Process(targets map[string]*corev1.Pod) *ProcessResult {
 	return res
 }
 
+func (p *Processor) keepRuleStates(effectiveRules utils.Rules) []*appsv1alpha1.RuleState {
+	var ruleStates []*appsv1alpha1.RuleState
+	for _, rule := range effectiveRules {
+		keeper, ok := rules.GetRuler(p.podTransitionRule, rule, p.client, p.apiReader).(rules.RuleStateKeeper)
+		if !ok {
+			continue
+		}
+		if state := keeper.KeepRuleState(p.podTransitionRule); state != nil {
+			ruleStates = append(ruleStates, state)
+		}
+	}
+	return ruleStates
+}
+
 type ProcessResult struct {
 	Rejected map[string]RejectInfo
+	// AuditRejected records rejections of rules in audit mode, which do not block pods
+	AuditRejected map[string][]RejectInfo
 	// pod:rules
 	PassRules map[string]sets.String
 	Retry     bool
 	Interval  *time.Duration
 
 	RuleStates []*appsv1alpha1.RuleState
+	// WebhookProgresses is the progress of processed webhook rules, rule:progress
+	WebhookProgresses map[string]*kuperatorv1alpha1.TransitionRuleWebhookProgress
 }
 
 type RejectInfo struct {
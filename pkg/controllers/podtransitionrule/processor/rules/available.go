@@ -23,6 +23,7 @@ import (
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -32,6 +33,7 @@ import (
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
 	"kusionstack.io/kuperator/pkg/controllers/podtransitionrule/register"
 	"kusionstack.io/kuperator/pkg/controllers/podtransitionrule/utils"
+	"kusionstack.io/kuperator/pkg/utils/inject"
 )
 
 type AvailableRuler struct {
@@ -45,6 +47,20 @@ type AvailableRuler struct {
 
 // Filter unavailable pods and try approve available pods as much as possible
 func (r *AvailableRuler) Filter(podTransitionRule *appsv1alpha1.PodTransitionRule, targets map[string]*corev1.Pod, subjects sets.String) *FilterResult {
+	// desired but uncreated replicas of owners are counted as unavailable
+	ownerUncreatedReplicas, err := r.getUncreatedReplicas(podTransitionRule.Namespace, targets)
+	if err != nil {
+		return rejectAllWithErr(subjects, sets.NewString(), map[string]string{}, "[%s] fail to get uncreated replicas, error: %v", r.Name, err)
+	}
+	uncreatedReplicas := 0
+	for _, replicas := range ownerUncreatedReplicas {
+		uncreatedReplicas += replicas
+	}
+	return r.filter(podTransitionRule, targets, subjects, uncreatedReplicas)
+}
+
+// filter approves pods with uncreatedReplicas counted as unavailable
+func (r *AvailableRuler) filter(podTransitionRule *appsv1alpha1.PodTransitionRule, targets map[string]*corev1.Pod, subjects sets.String, uncreatedReplicas int) *FilterResult {
 	effectiveTargets := sets.NewString()
 	pass := sets.NewString()
 	rejects := map[string]string{}
@@ -70,8 +86,7 @@ func (r *AvailableRuler) Filter(podTransitionRule *appsv1alpha1.PodTransitionRul
 		}
 		minAvailableQuota = quota
 	}
-	// TODO: UncreatedReplicas
-	// allowUnavailable -= uncreatedReplicas
+	allowUnavailable -= uncreatedReplicas
 	allAvailableSize := 0
 	var minTimeLeft *int64
 	// filter unavailable pods
@@ -125,6 +140,9 @@ func (r *AvailableRuler) Filter(podTransitionRule *appsv1alpha1.PodTransitionRul
 	}
 	for podName := range rejectByMaxUnavailablePods {
 		rejects[podName] = fmt.Sprintf("[%s] blocked by max unavailable policy: [max unavailable]=%d/%d, [current unavailable]=%d/%d", r.Name, maxUnavailableQuota, len(effectiveTargets), len(effectiveTargets)-allAvailableSize, len(effectiveTargets))
+		if uncreatedReplicas > 0 {
+			rejects[podName] += fmt.Sprintf(", [uncreated replicas]=%d", uncreatedReplicas)
+		}
 	}
 
 	if minTimeLeft != nil {
@@ -135,9 +153,67 @@ func (r *AvailableRuler) Filter(podTransitionRule *appsv1alpha1.PodTransitionRul
 	return &FilterResult{Passed: pass, Rejected: rejects}
 }
 
-func (r *AvailableRuler) getPodReplicaSetReplication(controllerRef *metav1.OwnerReference, namespace string) (int, bool, error) {
+// OwnerReplicasResolver returns the desired replicas of the controller owner of pods, and false if the owner is not found.
+type OwnerReplicasResolver func(c client.Client, controllerRef *metav1.OwnerReference, namespace string) (int, bool, error)
+
+// OwnerReplicasResolvers resolves desired replicas by kind of controller owner, to count uncreated replicas as unavailable.
+var OwnerReplicasResolvers = map[string]OwnerReplicasResolver{
+	"CollaSet":    getCollaSetReplication,
+	"ReplicaSet":  getPodReplicaSetReplication,
+	"StatefulSet": getStatefulSetReplication,
+}
+
+// getUncreatedReplicas returns desired but uncreated replicas of each controller owner of targets, by UID of owner
+func (r *AvailableRuler) getUncreatedReplicas(namespace string, targets map[string]*corev1.Pod) (map[types.UID]int, error) {
+	owners := map[types.UID]*metav1.OwnerReference{}
+	for _, pod := range targets {
+		controllerRef := metav1.GetControllerOf(pod)
+		if controllerRef == nil || OwnerReplicasResolvers[controllerRef.Kind] == nil {
+			continue
+		}
+		owners[controllerRef.UID] = controllerRef
+	}
+	if len(owners) == 0 {
+		return nil, nil
+	}
+	if r.Client == nil {
+		return nil, fmt.Errorf("no client to get owners of pods")
+	}
+
+	uncreated := map[types.UID]int{}
+	for uid, controllerRef := range owners {
+		replicas, found, err := OwnerReplicasResolvers[controllerRef.Kind](r.Client, controllerRef, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+		// count all created pods of owner, including those not selected by PodTransitionRule
+		podList := &corev1.PodList{}
+		if err := r.Client.List(context.TODO(), podList, client.InNamespace(namespace),
+			client.MatchingFields{inject.FieldIndexOwnerRefUID: string(uid)}); err != nil {
+			return nil, fmt.Errorf("fail to list pods of %s %s/%s: %s", controllerRef.Kind, namespace, controllerRef.Name, err)
+		}
+		created := 0
+		for i := range podList.Items {
+			if ref := metav1.GetControllerOf(&podList.Items[i]); ref != nil && ref.UID == uid {
+				created++
+			}
+		}
+		if replicas > created {
+			uncreated[uid] = replicas - created
+		}
+	}
+	return uncreated, nil
+}
+
+func getPodReplicaSetReplication(c client.Client, controllerRef *metav1.OwnerReference, namespace string) (int, bool, error) {
 	rs := &appsv1.ReplicaSet{}
-	if err := r.Client.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: controllerRef.Name}, rs); err != nil {
+	if err := c.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: controllerRef.Name}, rs); err != nil {
+		if errors.IsNotFound(err) {
+			return 0, false, nil
+		}
 		return 0, false, fmt.Errorf("fail to find controller ReplicaSet %s/%s: %s", namespace, controllerRef.Name, err)
 	}
 	if rs.UID != controllerRef.UID {
@@ -150,6 +226,42 @@ func (r *AvailableRuler) getPodReplicaSetReplication(controllerRef *metav1.Owner
 	return int(*rs.Spec.Replicas), true, nil
 }
 
+func getStatefulSetReplication(c client.Client, controllerRef *metav1.OwnerReference, namespace string) (int, bool, error) {
+	sts := &appsv1.StatefulSet{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: controllerRef.Name}, sts); err != nil {
+		if errors.IsNotFound(err) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("fail to find controller StatefulSet %s/%s: %s", namespace, controllerRef.Name, err)
+	}
+	if sts.UID != controllerRef.UID {
+		return 0, false, nil
+	}
+
+	if sts.Spec.Replicas == nil {
+		return 1, true, nil
+	}
+	return int(*sts.Spec.Replicas), true, nil
+}
+
+func getCollaSetReplication(c client.Client, controllerRef *metav1.OwnerReference, namespace string) (int, bool, error) {
+	cls := &appsv1alpha1.CollaSet{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: controllerRef.Name}, cls); err != nil {
+		if errors.IsNotFound(err) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("fail to find controller CollaSet %s/%s: %s", namespace, controllerRef.Name, err)
+	}
+	if cls.UID != controllerRef.UID {
+		return 0, false, nil
+	}
+
+	if cls.Spec.Replicas == nil {
+		return 0, true, nil
+	}
+	return int(*cls.Spec.Replicas), true, nil
+}
+
 func processUnavailableFunc(pod *corev1.Pod) (bool, *int64) {
 	isUnavailable := false
 	var minInterval *int64
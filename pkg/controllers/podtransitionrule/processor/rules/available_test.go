@@ -0,0 +1,76 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAvailableUncreatedReplicas(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	replicas := int32(4)
+	rs := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-rs", UID: "test-rs-uid"},
+		Spec:       appsv1.ReplicaSetSpec{Replicas: &replicas},
+	}
+	isController := true
+	targets := map[string]*corev1.Pod{}
+	objs := []runtime.Object{rs}
+	for _, name := range []string{"test-pod-a", "test-pod-b"} {
+		pod := (&podTemplate{Name: name}).GetPod()
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: rs.Name, UID: rs.UID, Controller: &isController}}
+		targets[name] = pod
+		objs = append(objs, pod)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(objs...).Build()
+
+	maxUnavailable := intstr.FromInt(2)
+	ruler := &AvailableRuler{Name: "available", MaxUnavailableValue: &maxUnavailable, Client: c}
+	subjects := sets.NewString("test-pod-a", "test-pod-b")
+
+	// 2 uncreated replicas use up max unavailable
+	res := ruler.Filter(normalRS, targets, subjects)
+	g.Expect(res.Err).Should(gomega.BeNil())
+	g.Expect(res.Passed.Len()).Should(gomega.BeEquivalentTo(0))
+	g.Expect(strings.Contains(res.Rejected["test-pod-a"], "[uncreated replicas]=2")).Should(gomega.BeTrue())
+
+	// 1 uncreated replica
+	replicas = 3
+	g.Expect(c.Update(context.TODO(), rs)).Should(gomega.BeNil())
+	res = ruler.Filter(normalRS, targets, subjects)
+	g.Expect(res.Err).Should(gomega.BeNil())
+	g.Expect(res.Passed.Len()).Should(gomega.BeEquivalentTo(1))
+	g.Expect(len(res.Rejected)).Should(gomega.BeEquivalentTo(1))
+
+	// owner not found
+	g.Expect(c.Delete(context.TODO(), rs)).Should(gomega.BeNil())
+	res = ruler.Filter(normalRS, targets, subjects)
+	g.Expect(res.Err).Should(gomega.BeNil())
+	g.Expect(res.Passed.Len()).Should(gomega.BeEquivalentTo(2))
+}
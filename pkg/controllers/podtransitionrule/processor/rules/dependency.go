@@ -0,0 +1,233 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+	controllerutils "kusionstack.io/kuperator/pkg/controllers/utils"
+	"kusionstack.io/kuperator/pkg/controllers/utils/podopslifecycle"
+)
+
+type DependencyRuler struct {
+	Name string
+
+	Dependency *kuperatorv1alpha1.TransitionRuleDependency
+
+	Client client.Client
+}
+
+// workloadStatus is the readiness of a dependent workload
+type workloadStatus struct {
+	key      string
+	replicas int
+	ready    int
+	updating bool
+}
+
+// Filter blocks all pods while any dependent workload is below ready threshold or is updating.
+// The dependent workloads are watched, so PodTransitionRule is reconciled again once they change.
+func (r *DependencyRuler) Filter(podTransitionRule *appsv1alpha1.PodTransitionRule, targets map[string]*corev1.Pod, subjects sets.String) *FilterResult {
+	passed := sets.NewString()
+	rejected := map[string]string{}
+	if subjects.Len() == 0 {
+		return &FilterResult{Passed: passed, Rejected: rejected}
+	}
+
+	var reasons []string
+	for i := range r.Dependency.Workloads {
+		dependent := &r.Dependency.Workloads[i]
+		statuses, err := r.getWorkloadStatuses(podTransitionRule.Namespace, dependent)
+		if err != nil {
+			return rejectAllWithErr(subjects, passed, rejected, "[%s] fail to get dependent %s: %v", r.Name, dependent.Kind, err)
+		}
+		if len(statuses) == 0 {
+			reasons = append(reasons, fmt.Sprintf("dependent %s not found", dependent.Kind))
+			continue
+		}
+
+		minReady := intstr.FromString("100%")
+		if dependent.MinReadyValue != nil {
+			minReady = *dependent.MinReadyValue
+		}
+		for _, status := range statuses {
+			minReadyQuota, err := intstr.GetScaledValueFromIntOrPercent(&minReady, status.replicas, true)
+			if err != nil {
+				return rejectAllWithErr(subjects, passed, rejected, "[%s] fail to get int value from min ready value(%s): %v", r.Name, minReady.String(), err)
+			}
+			if status.ready < minReadyQuota {
+				reasons = append(reasons, fmt.Sprintf("%s ready %d/%d, below %d", status.key, status.ready, status.replicas, minReadyQuota))
+			}
+			if status.updating && !dependent.AllowUpdating {
+				reasons = append(reasons, fmt.Sprintf("%s is updating", status.key))
+			}
+		}
+	}
+
+	if len(reasons) > 0 {
+		reject(subjects, passed, rejected, fmt.Sprintf("[%s] blocked by dependency: %s", r.Name, strings.Join(reasons, "; ")))
+		return &FilterResult{Passed: passed, Rejected: rejected}
+	}
+	return &FilterResult{Passed: sets.NewString(subjects.List()...), Rejected: rejected}
+}
+
+func (r *DependencyRuler) getWorkloadStatuses(namespace string, dependent *kuperatorv1alpha1.DependentWorkload) ([]*workloadStatus, error) {
+	var objs []client.Object
+	switch dependent.Kind {
+	case kuperatorv1alpha1.DependentKindCollaSet:
+		list := &appsv1alpha1.CollaSetList{}
+		if err := r.listOrGet(namespace, dependent, list, &appsv1alpha1.CollaSet{}, &objs); err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			objs = append(objs, &list.Items[i])
+		}
+	case kuperatorv1alpha1.DependentKindDeployment:
+		list := &appsv1.DeploymentList{}
+		if err := r.listOrGet(namespace, dependent, list, &appsv1.Deployment{}, &objs); err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			objs = append(objs, &list.Items[i])
+		}
+	case kuperatorv1alpha1.DependentKindPodTransitionRule:
+		list := &appsv1alpha1.PodTransitionRuleList{}
+		if err := r.listOrGet(namespace, dependent, list, &appsv1alpha1.PodTransitionRule{}, &objs); err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			objs = append(objs, &list.Items[i])
+		}
+	default:
+		return nil, fmt.Errorf("unsupported kind %s", dependent.Kind)
+	}
+
+	statuses := make([]*workloadStatus, 0, len(objs))
+	for _, obj := range objs {
+		status, err := r.getWorkloadStatus(obj)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// listOrGet gets the workload into obj by name, or lists workloads into list by selector
+func (r *DependencyRuler) listOrGet(namespace string, dependent *kuperatorv1alpha1.DependentWorkload, list client.ObjectList, obj client.Object, objs *[]client.Object) error {
+	if dependent.Name != "" {
+		if err := r.Client.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: dependent.Name}, obj); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		*objs = append(*objs, obj)
+		return nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(dependent.Selector)
+	if err != nil {
+		return err
+	}
+	return r.Client.List(context.TODO(), list, &client.ListOptions{Namespace: namespace, LabelSelector: selector})
+}
+
+func (r *DependencyRuler) getWorkloadStatus(obj client.Object) (*workloadStatus, error) {
+	switch workload := obj.(type) {
+	case *appsv1alpha1.CollaSet:
+		status := &workloadStatus{
+			key:      "CollaSet " + workload.Name,
+			replicas: replicasOrDefault(workload.Spec.Replicas, 0),
+			ready:    int(workload.Status.ReadyReplicas),
+		}
+		status.updating = workload.Status.ObservedGeneration != workload.Generation ||
+			int(workload.Status.UpdatedReplicas) < status.replicas || workload.Status.OperatingReplicas > 0
+		return status, nil
+	case *appsv1.Deployment:
+		status := &workloadStatus{
+			key:      "Deployment " + workload.Name,
+			replicas: replicasOrDefault(workload.Spec.Replicas, 1),
+			ready:    int(workload.Status.AvailableReplicas),
+		}
+		status.updating = workload.Status.ObservedGeneration != workload.Generation ||
+			int(workload.Status.UpdatedReplicas) < status.replicas || workload.Status.Replicas > workload.Status.UpdatedReplicas
+		return status, nil
+	case *appsv1alpha1.PodTransitionRule:
+		status := &workloadStatus{
+			key:      "PodTransitionRule " + workload.Name,
+			replicas: len(workload.Status.Targets),
+		}
+		for _, name := range workload.Status.Targets {
+			pod := &corev1.Pod{}
+			if err := r.Client.Get(context.TODO(), types.NamespacedName{Namespace: workload.Namespace, Name: name}, pod); err != nil {
+				if errors.IsNotFound(err) {
+					continue
+				}
+				return nil, err
+			}
+			if controllerutils.IsPodReady(pod) {
+				status.ready++
+			}
+			if podopslifecycle.IsPodOperating(pod) {
+				status.updating = true
+			}
+		}
+		return status, nil
+	}
+	return nil, fmt.Errorf("unsupported workload %T", obj)
+}
+
+// replicasOrDefault returns desired replicas of workload. The default is 0 for CollaSet, the same as available
+// policy counts replicas of CollaSet, and 1 for Deployment, the same as apiserver defaults.
+func replicasOrDefault(replicas *int32, defaultReplicas int) int {
+	if replicas == nil {
+		return defaultReplicas
+	}
+	return int(*replicas)
+}
+
+// IsDependentWorkload returns true if obj of kind is referred by dependency.
+func IsDependentWorkload(dependency *kuperatorv1alpha1.TransitionRuleDependency, kind string, obj client.Object) bool {
+	for _, dependent := range dependency.Workloads {
+		if dependent.Kind != kind {
+			continue
+		}
+		if dependent.Name != "" {
+			if dependent.Name == obj.GetName() {
+				return true
+			}
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(dependent.Selector)
+		if err == nil && selector.Matches(labels.Set(obj.GetLabels())) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+)
+
+func TestDependency(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	sch := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(sch)).Should(gomega.BeNil())
+	g.Expect(appsv1alpha1.AddToScheme(sch)).Should(gomega.BeNil())
+
+	clsReplicas, deployReplicas := int32(4), int32(2)
+	cls := &appsv1alpha1.CollaSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: normalRS.Namespace, Name: "database", Labels: map[string]string{"tier": "db"}},
+		Spec:       appsv1alpha1.CollaSetSpec{Replicas: &clsReplicas},
+		Status:     appsv1alpha1.CollaSetStatus{ReadyReplicas: 3, UpdatedReplicas: 4},
+	}
+	deploy := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: normalRS.Namespace, Name: "cache"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &deployReplicas},
+		Status:     appsv1.DeploymentStatus{Replicas: 2, AvailableReplicas: 2, UpdatedReplicas: 1},
+	}
+	c := fake.NewClientBuilder().WithScheme(sch).WithObjects(cls, deploy).Build()
+
+	targets := map[string]*corev1.Pod{
+		"test-pod-a": (&podTemplate{Name: "test-pod-a"}).GetPod(),
+		"test-pod-b": (&podTemplate{Name: "test-pod-b"}).GetPod(),
+	}
+	subjects := sets.NewString("test-pod-a", "test-pod-b")
+	minReady := intstr.FromString("75%")
+	ruler := &DependencyRuler{
+		Name: "dependency",
+		Dependency: &kuperatorv1alpha1.TransitionRuleDependency{
+			Workloads: []kuperatorv1alpha1.DependentWorkload{
+				{
+					Kind:          kuperatorv1alpha1.DependentKindCollaSet,
+					Selector:      &metav1.LabelSelector{MatchLabels: map[string]string{"tier": "db"}},
+					MinReadyValue: &minReady,
+				},
+				{
+					Kind: kuperatorv1alpha1.DependentKindDeployment,
+					Name: "cache",
+				},
+			},
+		},
+		Client: c,
+	}
+
+	// deployment is updating
+	res := ruler.Filter(normalRS, targets, subjects)
+	g.Expect(res.Err).Should(gomega.BeNil())
+	g.Expect(res.Passed.Len()).Should(gomega.BeEquivalentTo(0))
+	g.Expect(len(res.Rejected)).Should(gomega.BeEquivalentTo(2))
+	g.Expect(strings.Contains(res.Rejected["test-pod-a"], "Deployment cache is updating")).Should(gomega.BeTrue())
+	g.Expect(strings.Contains(res.Rejected["test-pod-a"], "CollaSet")).Should(gomega.BeFalse())
+
+	deploy.Status.UpdatedReplicas = 2
+	g.Expect(c.Update(context.TODO(), deploy)).Should(gomega.BeNil())
+	res = ruler.Filter(normalRS, targets, subjects)
+	g.Expect(res.Passed.List()).Should(gomega.Equal(subjects.List()))
+
+	// collaset below min ready
+	cls.Status.ReadyReplicas = 2
+	g.Expect(c.Update(context.TODO(), cls)).Should(gomega.BeNil())
+	res = ruler.Filter(normalRS, targets, subjects)
+	g.Expect(res.Passed.Len()).Should(gomega.BeEquivalentTo(0))
+	g.Expect(strings.Contains(res.Rejected["test-pod-b"], "CollaSet database ready 2/4, below 3")).Should(gomega.BeTrue())
+
+	// collaset without replicas desires no pod, the same as available policy counts
+	cls.Spec.Replicas = nil
+	cls.Status.ReadyReplicas = 0
+	cls.Status.UpdatedReplicas = 0
+	g.Expect(c.Update(context.TODO(), cls)).Should(gomega.BeNil())
+	res = ruler.Filter(normalRS, targets, subjects)
+	g.Expect(res.Passed.List()).Should(gomega.Equal(subjects.List()))
+
+	g.Expect(IsDependentWorkload(ruler.Dependency, kuperatorv1alpha1.DependentKindCollaSet, cls)).Should(gomega.BeTrue())
+	g.Expect(IsDependentWorkload(ruler.Dependency, kuperatorv1alpha1.DependentKindCollaSet, deploy)).Should(gomega.BeFalse())
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+	budgetutils "kusionstack.io/kuperator/pkg/controllers/utils/disruptionbudget"
+)
+
+type DisruptionBudgetRuler struct {
+	Name string
+
+	DisruptionBudget *kuperatorv1alpha1.TransitionRuleDisruptionBudget
+
+	Client client.Client
+}
+
+// Filter passes pods which reserve slots of the shared DisruptionBudget. Reservations are idempotent for the same pod,
+// so pods selected by several PodTransitionRules never consume the budget twice.
+func (r *DisruptionBudgetRuler) Filter(podTransitionRule *appsv1alpha1.PodTransitionRule, targets map[string]*corev1.Pod, subjects sets.String) *FilterResult {
+	passed := sets.NewString()
+	rejected := map[string]string{}
+	if subjects.Len() == 0 {
+		return &FilterResult{Passed: passed, Rejected: rejected}
+	}
+	if r.Client == nil {
+		return rejectAllWithErr(subjects, passed, rejected, "[%s] no client to get DisruptionBudget", r.Name)
+	}
+
+	key := types.NamespacedName{Namespace: r.DisruptionBudget.Namespace, Name: r.DisruptionBudget.Name}
+	if key.Namespace == "" {
+		key.Namespace = podTransitionRule.Namespace
+	}
+	holder := fmt.Sprintf("PodTransitionRule/%s/%s", podTransitionRule.Namespace, podTransitionRule.Name)
+	for _, podName := range subjects.List() {
+		reserved, _, msg, err := budgetutils.Reserve(context.TODO(), r.Client, key, targets[podName], holder)
+		if err != nil {
+			return rejectAllWithErr(subjects, passed, rejected, "[%s] %v", r.Name, err)
+		}
+		if !reserved {
+			reject(subjects, passed, rejected, fmt.Sprintf("[%s] %s", r.Name, msg))
+			break
+		}
+		passed.Insert(podName)
+	}
+	return &FilterResult{Passed: passed, Rejected: rejected}
+}
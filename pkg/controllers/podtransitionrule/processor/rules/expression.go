@@ -0,0 +1,198 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types/ref"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/utils/lru"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+)
+
+const (
+	expressionVarPod      = "pod"
+	expressionVarCollaSet = "collaset"
+	expressionVarNode     = "node"
+
+	// expressionCostLimit bounds the runtime cost of evaluating expression on one pod
+	expressionCostLimit uint64 = 1000000
+	// expressionEvalTimeout interrupts expression evaluating on one pod, checked every
+	// expressionInterruptCheckFrequency iterations in comprehensions
+	expressionEvalTimeout             = 100 * time.Millisecond
+	expressionInterruptCheckFrequency = 100
+
+	expressionCacheSize = 256
+)
+
+// compiledExpressions caches compiled programs by expression, which are safe for concurrent use
+var compiledExpressions = lru.New(expressionCacheSize)
+
+type ExpressionRuler struct {
+	Name string
+
+	Expression *kuperatorv1alpha1.TransitionRuleExpression
+
+	Client client.Client
+}
+
+// Filter passes pods on which the expression evaluates to true
+func (r *ExpressionRuler) Filter(podTransitionRule *appsv1alpha1.PodTransitionRule, targets map[string]*corev1.Pod, subjects sets.String) *FilterResult {
+	passed := sets.NewString()
+	rejected := map[string]string{}
+	if subjects.Len() == 0 {
+		return &FilterResult{Passed: passed, Rejected: rejected}
+	}
+
+	program, err := getCompiledExpression(r.Expression.Expression)
+	if err != nil {
+		return rejectAllWithErr(subjects, passed, rejected, "[%s] fail to compile expression: %v", r.Name, err)
+	}
+
+	collaSets := map[string]map[string]interface{}{}
+	nodes := map[string]map[string]interface{}{}
+	for podName := range subjects {
+		pod := targets[podName]
+		if pod == nil {
+			rejected[podName] = fmt.Sprintf("[%s] pod not found", r.Name)
+			continue
+		}
+		vars, err := r.getVariables(pod, collaSets, nodes)
+		if err != nil {
+			return rejectAllWithErr(subjects, passed, rejected, "[%s] fail to get variables of pod %s: %v", r.Name, podName, err)
+		}
+		val, err := evalExpression(program, vars)
+		if err != nil {
+			rejected[podName] = fmt.Sprintf("[%s] fail to evaluate expression: %v", r.Name, err)
+			continue
+		}
+		if result, ok := val.Value().(bool); !ok {
+			rejected[podName] = fmt.Sprintf("[%s] expression returns %v, not bool", r.Name, val.Value())
+		} else if !result {
+			rejected[podName] = fmt.Sprintf("[%s] expression not satisfied: %s", r.Name, r.Expression.Expression)
+		} else {
+			passed.Insert(podName)
+		}
+	}
+	return &FilterResult{Passed: passed, Rejected: rejected}
+}
+
+// getVariables converts pod, owner CollaSet and node to json objects. CollaSets and nodes are cached by name.
+func (r *ExpressionRuler) getVariables(pod *corev1.Pod, collaSets, nodes map[string]map[string]interface{}) (map[string]interface{}, error) {
+	podObj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	collaSetObj := map[string]interface{}{}
+	if owner := metav1.GetControllerOf(pod); owner != nil && owner.Kind == "CollaSet" {
+		if obj, exist := collaSets[owner.Name]; exist {
+			collaSetObj = obj
+		} else {
+			cls := &appsv1alpha1.CollaSet{}
+			if err := r.Client.Get(context.TODO(), types.NamespacedName{Namespace: pod.Namespace, Name: owner.Name}, cls); err != nil {
+				if !errors.IsNotFound(err) {
+					return nil, err
+				}
+			} else if collaSetObj, err = runtime.DefaultUnstructuredConverter.ToUnstructured(cls); err != nil {
+				return nil, err
+			}
+			collaSets[owner.Name] = collaSetObj
+		}
+	}
+
+	nodeObj := map[string]interface{}{}
+	if pod.Spec.NodeName != "" {
+		if obj, exist := nodes[pod.Spec.NodeName]; exist {
+			nodeObj = obj
+		} else {
+			node := &corev1.Node{}
+			if err := r.Client.Get(context.TODO(), types.NamespacedName{Name: pod.Spec.NodeName}, node); err != nil {
+				if !errors.IsNotFound(err) {
+					return nil, err
+				}
+			} else if nodeObj, err = runtime.DefaultUnstructuredConverter.ToUnstructured(node); err != nil {
+				return nil, err
+			}
+			nodes[pod.Spec.NodeName] = nodeObj
+		}
+	}
+
+	return map[string]interface{}{
+		expressionVarPod:      podObj,
+		expressionVarCollaSet: collaSetObj,
+		expressionVarNode:     nodeObj,
+	}, nil
+}
+
+func evalExpression(program cel.Program, vars map[string]interface{}) (ref.Val, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), expressionEvalTimeout)
+	defer cancel()
+	val, _, err := program.ContextEval(ctx, vars)
+	return val, err
+}
+
+func getCompiledExpression(expression string) (cel.Program, error) {
+	if program, exist := compiledExpressions.Get(expression); exist {
+		return program.(cel.Program), nil
+	}
+	program, err := CompileExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+	compiledExpressions.Add(expression, program)
+	return program, nil
+}
+
+// CompileExpression parses and type checks the CEL expression, which is expected to return bool.
+// The program is limited in runtime cost, and can be interrupted by the context of evaluation.
+func CompileExpression(expression string) (cel.Program, error) {
+	objectType := decls.NewMapType(decls.String, decls.Dyn)
+	env, err := cel.NewEnv(cel.Declarations(
+		decls.NewVar(expressionVarPod, objectType),
+		decls.NewVar(expressionVarCollaSet, objectType),
+		decls.NewVar(expressionVarNode, objectType),
+	))
+	if err != nil {
+		return nil, err
+	}
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if resultType := ast.ResultType(); resultType.GetPrimitive() != exprpb.Type_BOOL && resultType.GetDyn() == nil {
+		return nil, fmt.Errorf("expression should return bool, but returns %v", resultType)
+	}
+	return env.Program(ast,
+		cel.CostLimit(expressionCostLimit),
+		cel.InterruptCheckFrequency(expressionInterruptCheckFrequency),
+	)
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+)
+
+func TestExpression(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	sch := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(sch)).Should(gomega.BeNil())
+	g.Expect(appsv1alpha1.AddToScheme(sch)).Should(gomega.BeNil())
+
+	replicas := int32(3)
+	cls := &appsv1alpha1.CollaSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-cls"},
+		Spec:       appsv1alpha1.CollaSetSpec{Replicas: &replicas},
+	}
+	c := fake.NewClientBuilder().WithScheme(sch).WithObjects(
+		cls,
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a"}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-b"}, Spec: corev1.NodeSpec{Unschedulable: true}},
+	).Build()
+
+	isController := true
+	targets := map[string]*corev1.Pod{}
+	for _, item := range []struct {
+		name         string
+		node         string
+		restartCount int32
+	}{
+		{"test-pod-a", "node-a", 0},
+		{"test-pod-b", "node-a", 5},
+		{"test-pod-c", "node-b", 0},
+	} {
+		pod := (&podTemplate{Name: item.name}).GetPod()
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: "CollaSet", Name: cls.Name, Controller: &isController}}
+		pod.Spec.NodeName = item.node
+		pod.Status.ContainerStatuses = []corev1.ContainerStatus{{Name: "nginx", RestartCount: item.restartCount}}
+		targets[item.name] = pod
+	}
+
+	ruler := &ExpressionRuler{
+		Name: "expression",
+		Expression: &kuperatorv1alpha1.TransitionRuleExpression{
+			Expression: "pod.status.containerStatuses.all(c, c.restartCount < 3) && !has(node.spec.unschedulable) && collaset.spec.replicas > 1",
+		},
+		Client: c,
+	}
+	res := ruler.Filter(normalRS, targets, sets.NewString("test-pod-a", "test-pod-b", "test-pod-c"))
+	g.Expect(res.Err).Should(gomega.BeNil())
+	g.Expect(res.Passed.List()).Should(gomega.Equal([]string{"test-pod-a"}))
+	g.Expect(len(res.Rejected)).Should(gomega.BeEquivalentTo(2))
+	g.Expect(strings.Contains(res.Rejected["test-pod-b"], "expression not satisfied")).Should(gomega.BeTrue())
+
+	_, err := CompileExpression("pod.metadata.name + 'x'")
+	g.Expect(err).Should(gomega.HaveOccurred())
+	_, err = CompileExpression("pod.metadata.labels['app'] == 'test-app'")
+	g.Expect(err).Should(gomega.BeNil())
+
+	// compiled program is cached by expression
+	_, cached := compiledExpressions.Get(ruler.Expression.Expression)
+	g.Expect(cached).Should(gomega.BeTrue())
+
+	// expensive expression is stopped by cost limit
+	items := make([]string, 100)
+	for i := range items {
+		items[i] = fmt.Sprint(i)
+	}
+	list := "[" + strings.Join(items, ",") + "]"
+	ruler.Expression = &kuperatorv1alpha1.TransitionRuleExpression{
+		Expression: fmt.Sprintf("%s.all(x, %s.all(y, %s.all(z, x + y + z >= 0)))", list, list, list),
+	}
+	res = ruler.Filter(normalRS, targets, sets.NewString("test-pod-a"))
+	g.Expect(res.Passed.Len()).Should(gomega.BeEquivalentTo(0))
+	g.Expect(res.Rejected["test-pod-a"]).Should(gomega.ContainSubstring("cost limit exceeded"))
+}
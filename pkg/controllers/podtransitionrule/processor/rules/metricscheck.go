@@ -0,0 +1,234 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+	utilshttp "kusionstack.io/kuperator/pkg/utils/http"
+)
+
+type MetricsCheckRuler struct {
+	Name string
+
+	MetricsCheck *kuperatorv1alpha1.TransitionRuleMetricsCheck
+
+	// cache query results in one reconciling, since pods usually share the same query, like pods in one shard
+	cache map[string]*metricsQueryResult
+}
+
+type metricsQueryResult struct {
+	values []float64
+	err    error
+}
+
+// promResponse is the response of Prometheus HTTP API /api/v1/query
+type promResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+type promSample struct {
+	Metric map[string]string `json:"metric"`
+	Value  []interface{}     `json:"value"`
+}
+
+func (r *MetricsCheckRuler) Filter(podTransitionRule *appsv1alpha1.PodTransitionRule, targets map[string]*corev1.Pod, subjects sets.String) *FilterResult {
+	passed := sets.NewString()
+	rejected := map[string]string{}
+	threshold, err := strconv.ParseFloat(r.MetricsCheck.Threshold, 64)
+	if err != nil {
+		return rejectAllWithErr(subjects, passed, rejected, "[%s] fail to parse threshold %s: %v", r.Name, r.MetricsCheck.Threshold, err)
+	}
+	tmpl, err := template.New(r.Name).Option("missingkey=error").Parse(r.MetricsCheck.Query)
+	if err != nil {
+		return rejectAllWithErr(subjects, passed, rejected, "[%s] fail to parse query %s: %v", r.Name, r.MetricsCheck.Query, err)
+	}
+	if r.cache == nil {
+		r.cache = map[string]*metricsQueryResult{}
+	}
+
+	var errs []string
+	for podName := range subjects {
+		query, err := r.renderQuery(tmpl, targets[podName])
+		if err != nil {
+			rejected[podName] = fmt.Sprintf("[%s] fail to render query: %v", r.Name, err)
+			errs = append(errs, rejected[podName])
+			continue
+		}
+
+		result, exist := r.cache[query]
+		if !exist {
+			values, err := r.query(query)
+			result = &metricsQueryResult{values: values, err: err}
+			r.cache[query] = result
+		}
+		if result.err != nil {
+			rejected[podName] = fmt.Sprintf("[%s] fail to query metrics %s: %v", r.Name, query, result.err)
+			errs = append(errs, rejected[podName])
+			continue
+		}
+
+		if len(result.values) == 0 {
+			if r.MetricsCheck.NoDataPolicy == kuperatorv1alpha1.MetricsCheckNoDataPass {
+				passed.Insert(podName)
+			} else {
+				rejected[podName] = fmt.Sprintf("[%s] blocked by metrics check, no data returned by query %s", r.Name, query)
+			}
+			continue
+		}
+
+		matched := true
+		for _, value := range result.values {
+			if ok, err := compareMetricsValue(value, r.MetricsCheck.Operator, threshold); err != nil {
+				return rejectAllWithErr(subjects, passed, rejected, "[%s] %v", r.Name, err)
+			} else if !ok {
+				rejected[podName] = fmt.Sprintf("[%s] blocked by metrics check, query %s returns %v, expected %s %s", r.Name, query, value, r.MetricsCheck.Operator, r.MetricsCheck.Threshold)
+				matched = false
+				break
+			}
+		}
+		if matched {
+			passed.Insert(podName)
+		}
+	}
+
+	if len(errs) > 0 {
+		return &FilterResult{Passed: passed, Rejected: rejected, Err: fmt.Errorf("%s", strings.Join(errs, "; "))}
+	}
+	return &FilterResult{Passed: passed, Rejected: rejected}
+}
+
+func (r *MetricsCheckRuler) renderQuery(tmpl *template.Template, pod *corev1.Pod) (string, error) {
+	parameters := map[string]string{}
+	for i := range r.MetricsCheck.Parameters {
+		parameter := &r.MetricsCheck.Parameters[i]
+		if len(parameter.Value) != 0 {
+			parameters[parameter.Key] = parameter.Value
+			continue
+		}
+		if parameter.ValueFrom == nil || parameter.ValueFrom.FieldRef == nil {
+			return "", fmt.Errorf("unexpected empty parameter %s", parameter.Key)
+		}
+		value, err := ExtractValueFromPod(pod, parameter.Key, parameter.ValueFrom.FieldRef.FieldPath)
+		if err != nil {
+			return "", err
+		}
+		if value == "null" {
+			value = ""
+		}
+		parameters[parameter.Key] = value
+	}
+
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, parameters); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// query returns the values of samples in query result, which is expected to be a vector or scalar
+func (r *MetricsCheckRuler) query(query string) ([]float64, error) {
+	queryUrl := strings.TrimSuffix(r.MetricsCheck.Address, "/") + "/api/v1/query?query=" + url.QueryEscape(query)
+	resp, err := utilshttp.DoHttpAndHttpsRequestWithCa(http.MethodGet, queryUrl, nil, nil, r.MetricsCheck.CABundle)
+	if err != nil {
+		return nil, err
+	}
+	promResp := &promResponse{}
+	if err := utilshttp.ParseResponse(resp, promResp); err != nil {
+		return nil, err
+	}
+	if promResp.Status != "success" {
+		return nil, fmt.Errorf("query failed with %s: %s", promResp.ErrorType, promResp.Error)
+	}
+
+	switch promResp.Data.ResultType {
+	case "vector":
+		var samples []promSample
+		if err := json.Unmarshal(promResp.Data.Result, &samples); err != nil {
+			return nil, fmt.Errorf("fail to parse vector result: %s", err)
+		}
+		values := make([]float64, 0, len(samples))
+		for _, sample := range samples {
+			value, err := parseSampleValue(sample.Value)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	case "scalar":
+		var sample []interface{}
+		if err := json.Unmarshal(promResp.Data.Result, &sample); err != nil {
+			return nil, fmt.Errorf("fail to parse scalar result: %s", err)
+		}
+		value, err := parseSampleValue(sample)
+		if err != nil {
+			return nil, err
+		}
+		return []float64{value}, nil
+	default:
+		return nil, fmt.Errorf("unsupported result type %s, expected vector or scalar", promResp.Data.ResultType)
+	}
+}
+
+// parseSampleValue parses sample value in the format of [<unix_time>, "<value>"]
+func parseSampleValue(sample []interface{}) (float64, error) {
+	if len(sample) != 2 {
+		return 0, fmt.Errorf("unexpected sample value %v", sample)
+	}
+	str, ok := sample[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected sample value %v", sample)
+	}
+	return strconv.ParseFloat(str, 64)
+}
+
+func compareMetricsValue(value float64, operator kuperatorv1alpha1.MetricsCheckOperator, threshold float64) (bool, error) {
+	switch operator {
+	case kuperatorv1alpha1.MetricsCheckOperatorLessThan:
+		return value < threshold, nil
+	case kuperatorv1alpha1.MetricsCheckOperatorLessThanEqual:
+		return value <= threshold, nil
+	case kuperatorv1alpha1.MetricsCheckOperatorGreaterThan:
+		return value > threshold, nil
+	case kuperatorv1alpha1.MetricsCheckOperatorGreaterThanEqual:
+		return value >= threshold, nil
+	case kuperatorv1alpha1.MetricsCheckOperatorEqual:
+		return value == threshold, nil
+	case kuperatorv1alpha1.MetricsCheckOperatorNotEqual:
+		return value != threshold, nil
+	}
+	return false, fmt.Errorf("unsupported operator %s", operator)
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+)
+
+func TestMetricsCheck(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	queries := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("query")
+		queries[query]++
+		switch query {
+		case `error_rate{context="test-context"}`:
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"0.005"]}]}}`)
+		case `error_rate{context="other-context"}`:
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"0.02"]}]}}`)
+		default:
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+		}
+	}))
+	defer server.Close()
+
+	ruler := &MetricsCheckRuler{
+		Name: "metrics",
+		MetricsCheck: &kuperatorv1alpha1.TransitionRuleMetricsCheck{
+			Address: server.URL,
+			Query:   `error_rate{context="{{ .context }}"}`,
+			Parameters: []appsv1alpha1.Parameter{
+				{
+					Key: "context",
+					ValueFrom: &appsv1alpha1.ParameterSource{
+						FieldRef: &corev1.ObjectFieldSelector{
+							FieldPath: "metadata.annotations['test.io/context']",
+						},
+					},
+				},
+			},
+			Operator:  kuperatorv1alpha1.MetricsCheckOperatorLessThan,
+			Threshold: "0.01",
+		},
+	}
+
+	targets := map[string]*corev1.Pod{
+		"test-pod-a": (&podTemplate{Name: "test-pod-a"}).GetPod(),
+		"test-pod-b": (&podTemplate{Name: "test-pod-b"}).GetPod(),
+		"test-pod-c": (&podTemplate{Name: "test-pod-c"}).GetPod(),
+		"test-pod-d": (&podTemplate{Name: "test-pod-d"}).GetPod(),
+	}
+	targets["test-pod-c"].Annotations["test.io/context"] = "other-context"
+	targets["test-pod-d"].Annotations["test.io/context"] = "no-data"
+
+	res := ruler.Filter(normalRS, targets, sets.NewString("test-pod-a", "test-pod-b", "test-pod-c", "test-pod-d"))
+	g.Expect(res.Err).Should(gomega.BeNil())
+	g.Expect(res.Passed.List()).Should(gomega.Equal([]string{"test-pod-a", "test-pod-b"}))
+	g.Expect(len(res.Rejected)).Should(gomega.BeEquivalentTo(2))
+	// pods sharing the same query only query once
+	g.Expect(queries[`error_rate{context="test-context"}`]).Should(gomega.BeEquivalentTo(1))
+
+	ruler.MetricsCheck.NoDataPolicy = kuperatorv1alpha1.MetricsCheckNoDataPass
+	res = ruler.Filter(normalRS, targets, sets.NewString("test-pod-d"))
+	g.Expect(res.Passed.List()).Should(gomega.Equal([]string{"test-pod-d"}))
+}
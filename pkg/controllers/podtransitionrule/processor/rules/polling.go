@@ -44,7 +44,8 @@ var (
 
 type PollingManagerInterface interface {
 	Delete(id string)
-	Add(id, url, caBundle, resourceKey string, timeout, interval time.Duration)
+	Add(id, url, caBundle, resourceKey string, timeout, interval time.Duration, credential CredentialFunc)
+	Resume(id, url, caBundle, resourceKey string, interval time.Duration, credential CredentialFunc, state *PollTaskState)
 	GetResult(id string) *PollResult
 	Start(ctx context.Context)
 	AddListener(chan<- event.GenericEvent)
@@ -149,32 +150,47 @@ func (r *pollingRunner) addAfter(id string, d time.Duration) {
 	})
 }
 
-func (r *pollingRunner) Add(id, url, caBundle, resourceKey string, timeout, interval time.Duration) {
+func (r *pollingRunner) Add(id, url, caBundle, resourceKey string, timeout, interval time.Duration, credential CredentialFunc) {
+	r.add(id, url, caBundle, resourceKey, interval, credential, &PollTaskState{Deadline: time.Now().Add(timeout)}, "Waiting for first query...")
+}
+
+// Resume rebuilds task from persisted state after restart, so that the task still times out at the persisted deadline
+func (r *pollingRunner) Resume(id, url, caBundle, resourceKey string, interval time.Duration, credential CredentialFunc, state *PollTaskState) {
+	r.add(id, url, caBundle, resourceKey, interval, credential, state, "Resumed, waiting for next query...")
+}
+
+func (r *pollingRunner) add(id, url, caBundle, resourceKey string, interval time.Duration, credential CredentialFunc, state *PollTaskState, msg string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	tm := time.Now()
 	t := &task{
 		id:           id,
 		url:          url,
 		caBundle:     caBundle,
+		credential:   credential,
 		resourceKey:  resourceKey,
-		timeoutTime:  tm.Add(timeout),
-		deadlineTime: tm.Add(timeout + (TaskDeadLineSeconds-1)*time.Second),
+		timeoutTime:  state.Deadline,
+		deadlineTime: state.Deadline.Add((TaskDeadLineSeconds - 1) * time.Second),
 		interval:     interval,
 		result: &PollResult{
-			Approved:    sets.NewString(),
-			LastMessage: "Waiting for first query...",
+			Deadline:    state.Deadline,
+			Count:       state.Count,
+			Approved:    sets.NewString(state.Approved...),
+			LastMessage: msg,
 		},
 	}
 	r.tasks[id] = t
 	r.addAfter(id, interval)
-	r.addAfter(id, timeout+TaskDeadLineSeconds*time.Second)
+	r.addAfter(id, time.Until(t.timeoutTime)+TaskDeadLineSeconds*time.Second)
 }
 
 func (r *pollingRunner) GetResult(id string) *PollResult {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	return r.tasks[id].getResult()
+	t, ok := r.tasks[id]
+	if !ok || t == nil {
+		return nil
+	}
+	return t.getResult()
 }
 
 func (r *pollingRunner) Delete(id string) {
@@ -195,6 +211,7 @@ type task struct {
 	id          string
 	url         string
 	caBundle    string
+	credential  CredentialFunc
 	resourceKey string
 
 	timeoutTime  time.Time
@@ -241,7 +258,14 @@ func (t *task) do() bool {
 }
 
 func (t *task) query() (*appsv1alpha1.PollResponse, error) {
-	httpResp, err := utilshttp.DoHttpAndHttpsRequestWithCa(http.MethodGet, t.url, nil, nil, t.caBundle)
+	var credential *utilshttp.Credential
+	if t.credential != nil {
+		var err error
+		if credential, err = t.credential(); err != nil {
+			return nil, err
+		}
+	}
+	httpResp, err := utilshttp.DoHttpAndHttpsRequestWithCredential(context.TODO(), http.MethodGet, t.url, nil, nil, t.caBundle, credential)
 	if err != nil {
 		return nil, err
 	}
@@ -263,7 +287,15 @@ func (t *task) getResult() *PollResult {
 	return t.result
 }
 
+// PollTaskState is the progress of polling task persisted by controller
+type PollTaskState struct {
+	Deadline time.Time
+	Count    int
+	Approved []string
+}
+
 type PollResult struct {
+	Deadline      time.Time
 	Count         int
 	Stopped       bool
 	ApproveAll    bool
@@ -0,0 +1,142 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+	"kusionstack.io/kuperator/pkg/controllers/podtransitionrule/utils"
+)
+
+type RateLimitRuler struct {
+	Name string
+
+	RateLimit *kuperatorv1alpha1.TransitionRuleRateLimit
+
+	// now is for test
+	now func() time.Time
+}
+
+// Filter approves at most limit pods in the sliding period. Approvals are recorded as tasks in rule state,
+// since RuleState only persists WebhookStatus, so that the budget survives controller restarts.
+func (r *RateLimitRuler) Filter(podTransitionRule *appsv1alpha1.PodTransitionRule, targets map[string]*corev1.Pod, subjects sets.String) *FilterResult {
+	passed := sets.NewString()
+	rejected := map[string]string{}
+	now := time.Now()
+	if r.now != nil {
+		now = r.now()
+	}
+	period := r.RateLimit.Period.Duration
+	limit := int(r.RateLimit.Limit)
+
+	approvals := r.recentApprovals(podTransitionRule, now)
+	used := 0
+	for _, approval := range approvals {
+		used += len(approval.Approved)
+	}
+
+	var newApproved []string
+	for _, podName := range subjects.List() {
+		// approved pods do not consume budget again
+		if utils.IsPodPassRule(podName, podTransitionRule, r.Name) {
+			passed.Insert(podName)
+			continue
+		}
+		if used < limit {
+			used++
+			passed.Insert(podName)
+			newApproved = append(newApproved, podName)
+		}
+	}
+	if len(newApproved) > 0 {
+		approvals = append(approvals, appsv1alpha1.TaskInfo{
+			TaskId:    NewTrace(),
+			BeginTime: &metav1.Time{Time: now},
+			Approved:  newApproved,
+		})
+	}
+
+	ruleState := &appsv1alpha1.RuleState{
+		Name: r.Name,
+		WebhookStatus: &appsv1alpha1.WebhookStatus{
+			History: approvals,
+		},
+	}
+	if passed.Len() == subjects.Len() {
+		return &FilterResult{Passed: passed, Rejected: rejected, RuleState: ruleState}
+	}
+
+	reject(subjects, passed, rejected, fmt.Sprintf("[%s] blocked by rate limit policy: %d pods approved in the last %s, limit %d", r.Name, used, period, limit))
+	if len(approvals) == 0 {
+		return &FilterResult{Passed: passed, Rejected: rejected, RuleState: ruleState}
+	}
+	// budget frees up when the earliest approval slides out of the period
+	sort.Slice(approvals, func(i, j int) bool {
+		return approvals[i].BeginTime.Before(approvals[j].BeginTime)
+	})
+	interval := approvals[0].BeginTime.Add(period).Sub(now)
+	return &FilterResult{Passed: passed, Rejected: rejected, Interval: &interval, RuleState: ruleState}
+}
+
+// KeepRuleState keeps approvals in the sliding period, even if there is no pod to filter
+func (r *RateLimitRuler) KeepRuleState(podTransitionRule *appsv1alpha1.PodTransitionRule) *appsv1alpha1.RuleState {
+	now := time.Now()
+	if r.now != nil {
+		now = r.now()
+	}
+	approvals := r.recentApprovals(podTransitionRule, now)
+	if len(approvals) == 0 {
+		return nil
+	}
+	return &appsv1alpha1.RuleState{
+		Name: r.Name,
+		WebhookStatus: &appsv1alpha1.WebhookStatus{
+			History: approvals,
+		},
+	}
+}
+
+func (r *RateLimitRuler) recentApprovals(podTransitionRule *appsv1alpha1.PodTransitionRule, now time.Time) []appsv1alpha1.TaskInfo {
+	var approvals []appsv1alpha1.TaskInfo
+	state := getRuleState(podTransitionRule, r.Name)
+	if state.WebhookStatus == nil {
+		return approvals
+	}
+	for _, approval := range state.WebhookStatus.History {
+		if approval.BeginTime != nil && now.Sub(approval.BeginTime.Time) < r.RateLimit.Period.Duration {
+			approvals = append(approvals, approval)
+		}
+	}
+	return approvals
+}
+
+func getRuleState(podTransitionRule *appsv1alpha1.PodTransitionRule, name string) *appsv1alpha1.RuleState {
+	for i, state := range podTransitionRule.Status.RuleStates {
+		if state.Name == name {
+			return podTransitionRule.Status.RuleStates[i].DeepCopy()
+		}
+	}
+	return &appsv1alpha1.RuleState{Name: name}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+)
+
+func TestRateLimit(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	rs := normalRS.DeepCopy()
+	targets := map[string]*corev1.Pod{
+		"test-pod-a": (&podTemplate{Name: "test-pod-a"}).GetPod(),
+		"test-pod-b": (&podTemplate{Name: "test-pod-b"}).GetPod(),
+		"test-pod-c": (&podTemplate{Name: "test-pod-c"}).GetPod(),
+	}
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	ruler := &RateLimitRuler{
+		Name: "rate",
+		RateLimit: &kuperatorv1alpha1.TransitionRuleRateLimit{
+			Limit:  2,
+			Period: metav1.Duration{Duration: 5 * time.Minute},
+		},
+		now: func() time.Time { return now },
+	}
+
+	res := ruler.Filter(rs, targets, sets.NewString("test-pod-a", "test-pod-b", "test-pod-c"))
+	g.Expect(res.Passed.List()).Should(gomega.Equal([]string{"test-pod-a", "test-pod-b"}))
+	g.Expect(len(res.Rejected)).Should(gomega.BeEquivalentTo(1))
+	g.Expect(*res.Interval).Should(gomega.Equal(5 * time.Minute))
+
+	// approvals are recorded in status, and approved pods do not consume budget again
+	rs.Status.RuleStates = []*appsv1alpha1.RuleState{res.RuleState}
+	rs.Status.Details = []*appsv1alpha1.PodTransitionDetail{
+		{Name: "test-pod-a", PassedRules: []string{"rate"}},
+		{Name: "test-pod-b", PassedRules: []string{"rate"}},
+	}
+	now = now.Add(time.Minute)
+	res = ruler.Filter(rs, targets, sets.NewString("test-pod-a", "test-pod-c"))
+	g.Expect(res.Passed.List()).Should(gomega.Equal([]string{"test-pod-a"}))
+	g.Expect(*res.Interval).Should(gomega.Equal(4 * time.Minute))
+
+	// budget frees up after the period
+	rs.Status.RuleStates = []*appsv1alpha1.RuleState{res.RuleState}
+	now = now.Add(4 * time.Minute)
+	g.Expect(ruler.KeepRuleState(rs)).Should(gomega.BeNil())
+	res = ruler.Filter(rs, targets, sets.NewString("test-pod-c"))
+	g.Expect(res.Passed.List()).Should(gomega.Equal([]string{"test-pod-c"}))
+}
@@ -0,0 +1,397 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+	"kusionstack.io/kuperator/pkg/controllers/podtransitionrule/utils"
+)
+
+const (
+	blackoutDateLayout = "2006-01-02"
+	windowTimeLayout   = "15:04"
+
+	// maxCronWindowDuration limits how far to look back for the opening of a cron-style window
+	maxCronWindowDuration = 7 * 24 * time.Hour
+	// searchWindowLimit limits how far to look forward for the next opening window
+	searchWindowLimit = 366 * 24 * time.Hour
+)
+
+var weekdays = map[string]time.Weekday{
+	"Sun": time.Sunday,
+	"Mon": time.Monday,
+	"Tue": time.Tuesday,
+	"Wed": time.Wednesday,
+	"Thu": time.Thursday,
+	"Fri": time.Friday,
+	"Sat": time.Saturday,
+}
+
+type TimeWindowRuler struct {
+	Name string
+
+	TimeWindow *kuperatorv1alpha1.TransitionRuleTimeWindow
+
+	// now is for test
+	now func() time.Time
+}
+
+// Filter passes pods inside the time windows, and rejects pods outside with interval until the next window opens
+func (r *TimeWindowRuler) Filter(podTransitionRule *appsv1alpha1.PodTransitionRule, targets map[string]*corev1.Pod, subjects sets.String) *FilterResult {
+	passed := sets.NewString()
+	rejected := map[string]string{}
+	schedule, err := parseTimeWindow(r.TimeWindow)
+	if err != nil {
+		return rejectAllWithErr(subjects, passed, rejected, "[%s] invalid time window: %v", r.Name, err)
+	}
+
+	now := time.Now()
+	if r.now != nil {
+		now = r.now()
+	}
+	now = now.In(schedule.location)
+
+	// pods approved in window keep approved until they finish transition
+	for podName := range subjects {
+		if utils.IsPodPassRule(podName, podTransitionRule, r.Name) {
+			passed.Insert(podName)
+		}
+	}
+	if schedule.isOpen(now) {
+		return &FilterResult{Passed: sets.NewString(subjects.List()...), Rejected: rejected}
+	}
+
+	next, found := schedule.nextOpen(now)
+	if !found {
+		reject(subjects, passed, rejected, fmt.Sprintf("[%s] blocked by time window, no window opens within %s", r.Name, searchWindowLimit))
+		return &FilterResult{Passed: passed, Rejected: rejected}
+	}
+	interval := next.Sub(now)
+	reject(subjects, passed, rejected, fmt.Sprintf("[%s] blocked by time window, next window opens at %s", r.Name, next.Format(time.RFC3339)))
+	return &FilterResult{Passed: passed, Rejected: rejected, Interval: &interval}
+}
+
+type timeWindowSchedule struct {
+	location  *time.Location
+	windows   []window
+	blackouts sets.String
+}
+
+type window interface {
+	// contains returns true if t is inside the window
+	contains(t time.Time) bool
+	// nextStart returns the first time after t when the window opens
+	nextStart(t time.Time) (time.Time, bool)
+}
+
+// ValidateTimeWindow checks whether the time windows are valid.
+func ValidateTimeWindow(tw *kuperatorv1alpha1.TransitionRuleTimeWindow) error {
+	_, err := parseTimeWindow(tw)
+	return err
+}
+
+func parseTimeWindow(tw *kuperatorv1alpha1.TransitionRuleTimeWindow) (*timeWindowSchedule, error) {
+	schedule := &timeWindowSchedule{
+		location:  time.UTC,
+		blackouts: sets.NewString(),
+	}
+	if tw.TimeZone != "" {
+		loc, err := time.LoadLocation(tw.TimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone %s: %s", tw.TimeZone, err)
+		}
+		schedule.location = loc
+	}
+
+	if len(tw.Windows) == 0 {
+		return nil, fmt.Errorf("at least one window is required")
+	}
+	for i := range tw.Windows {
+		w, err := parseWindow(&tw.Windows[i], schedule.location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid window %d: %s", i, err)
+		}
+		schedule.windows = append(schedule.windows, w)
+	}
+
+	for _, date := range tw.BlackoutDates {
+		if _, err := time.ParseInLocation(blackoutDateLayout, date, schedule.location); err != nil {
+			return nil, fmt.Errorf("invalid blackout date %s, expected format %s", date, blackoutDateLayout)
+		}
+		schedule.blackouts.Insert(date)
+	}
+	return schedule, nil
+}
+
+func (s *timeWindowSchedule) isOpen(t time.Time) bool {
+	if s.blackouts.Has(t.Format(blackoutDateLayout)) {
+		return false
+	}
+	for _, w := range s.windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextOpen returns the first time after t when any window is open, skipping blackout dates
+func (s *timeWindowSchedule) nextOpen(t time.Time) (time.Time, bool) {
+	limit := t.Add(searchWindowLimit)
+	cur := t
+	for cur.Before(limit) {
+		var candidate time.Time
+		for _, w := range s.windows {
+			if start, ok := w.nextStart(cur); ok && (candidate.IsZero() || start.Before(candidate)) {
+				candidate = start
+			}
+		}
+		// window may be already open when blackout date ends
+		if s.blackouts.Has(cur.Format(blackoutDateLayout)) {
+			dayEnd := startOfDay(cur).AddDate(0, 0, 1)
+			if candidate.IsZero() || dayEnd.Before(candidate) {
+				candidate = dayEnd
+			}
+		}
+		if candidate.IsZero() {
+			return time.Time{}, false
+		}
+		if s.isOpen(candidate) {
+			return candidate, true
+		}
+		cur = candidate
+	}
+	return time.Time{}, false
+}
+
+func parseWindow(tw *kuperatorv1alpha1.TimeWindow, loc *time.Location) (window, error) {
+	if tw.Cron != "" {
+		if tw.Start != "" || tw.End != "" || len(tw.Weekdays) > 0 {
+			return nil, fmt.Errorf("cron can not be used together with weekdays, start or end")
+		}
+		if tw.Duration == nil || tw.Duration.Duration <= 0 || tw.Duration.Duration > maxCronWindowDuration {
+			return nil, fmt.Errorf("duration of cron window should be positive and no more than %s", maxCronWindowDuration)
+		}
+		schedule, err := parseCron(tw.Cron)
+		if err != nil {
+			return nil, err
+		}
+		return &cronWindow{schedule: schedule, duration: tw.Duration.Duration}, nil
+	}
+
+	w := &weekdayWindow{location: loc, weekdays: map[time.Weekday]bool{}}
+	for _, day := range tw.Weekdays {
+		weekday, ok := weekdays[day]
+		if !ok {
+			return nil, fmt.Errorf("invalid weekday %s, expected one of Sun, Mon, Tue, Wed, Thu, Fri and Sat", day)
+		}
+		w.weekdays[weekday] = true
+	}
+	var err error
+	if w.start, err = parseWindowTime(tw.Start); err != nil {
+		return nil, fmt.Errorf("invalid start: %s", err)
+	}
+	if w.end, err = parseWindowTime(tw.End); err != nil {
+		return nil, fmt.Errorf("invalid end: %s", err)
+	}
+	return w, nil
+}
+
+// parseWindowTime returns the offset from midnight
+func parseWindowTime(value string) (time.Duration, error) {
+	t, err := time.Parse(windowTimeLayout, value)
+	if err != nil {
+		return 0, fmt.Errorf("%s is not in the format of %s", value, windowTimeLayout)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// weekdayWindow opens from start to end on each of weekdays, crossing midnight if end is not after start
+type weekdayWindow struct {
+	location *time.Location
+	weekdays map[time.Weekday]bool
+	start    time.Duration
+	end      time.Duration
+}
+
+func (w *weekdayWindow) onDay(day time.Weekday) bool {
+	return len(w.weekdays) == 0 || w.weekdays[day]
+}
+
+func (w *weekdayWindow) at(day time.Time, offset time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, w.location)
+}
+
+func (w *weekdayWindow) contains(t time.Time) bool {
+	today := startOfDay(t)
+	if w.start < w.end {
+		return w.onDay(t.Weekday()) && !t.Before(w.at(today, w.start)) && t.Before(w.at(today, w.end))
+	}
+	// the window crossing midnight opens on the previous day
+	if w.onDay(t.Weekday()) && !t.Before(w.at(today, w.start)) {
+		return true
+	}
+	yesterday := today.AddDate(0, 0, -1)
+	return w.onDay(yesterday.Weekday()) && t.Before(w.at(today, w.end))
+}
+
+func (w *weekdayWindow) nextStart(t time.Time) (time.Time, bool) {
+	today := startOfDay(t)
+	for i := 0; i <= 7; i++ {
+		day := today.AddDate(0, 0, i)
+		start := w.at(day, w.start)
+		if start.After(t) && w.onDay(day.Weekday()) {
+			return start, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// cronWindow opens at each time matching cron schedule, and lasts for duration
+type cronWindow struct {
+	schedule *cronSchedule
+	duration time.Duration
+}
+
+func (w *cronWindow) contains(t time.Time) bool {
+	minute := t.Truncate(time.Minute)
+	for fire := minute; t.Sub(fire) < w.duration; fire = fire.Add(-time.Minute) {
+		if w.schedule.matches(fire) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *cronWindow) nextStart(t time.Time) (time.Time, bool) {
+	limit := t.Add(searchWindowLimit)
+	for fire := t.Truncate(time.Minute).Add(time.Minute); fire.Before(limit); {
+		if !w.schedule.matchesDay(fire) {
+			fire = startOfDay(fire).AddDate(0, 0, 1)
+			continue
+		}
+		if w.schedule.matches(fire) {
+			return fire, true
+		}
+		fire = fire.Add(time.Minute)
+	}
+	return time.Time{}, false
+}
+
+// cronSchedule is a standard 5-field cron expression: minute, hour, day of month, month and day of week
+type cronSchedule struct {
+	minutes, hours, doms, months, dows sets.Int
+	// cron matches day if either day of month or day of week matches, when both of them are restricted
+	domRestricted, dowRestricted bool
+}
+
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron %q, expected 5 fields", expr)
+	}
+	schedule := &cronSchedule{}
+	var err error
+	if schedule.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("invalid minute of cron %q: %s", expr, err)
+	}
+	if schedule.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("invalid hour of cron %q: %s", expr, err)
+	}
+	if schedule.doms, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("invalid day of month of cron %q: %s", expr, err)
+	}
+	if schedule.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("invalid month of cron %q: %s", expr, err)
+	}
+	if schedule.dows, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("invalid day of week of cron %q: %s", expr, err)
+	}
+	// both 0 and 7 are Sunday
+	if schedule.dows.Has(7) {
+		schedule.dows.Insert(0)
+	}
+	schedule.domRestricted = fields[2] != "*"
+	schedule.dowRestricted = fields[4] != "*"
+	return schedule, nil
+}
+
+// parseCronField parses items like "*", "*/5", "1-5", "1-10/2" and "1,3,5"
+func parseCronField(field string, min, max int) (sets.Int, error) {
+	values := sets.NewInt()
+	for _, item := range strings.Split(field, ",") {
+		step := 1
+		if parts := strings.SplitN(item, "/", 2); len(parts) == 2 {
+			var err error
+			if step, err = strconv.Atoi(parts[1]); err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step %q", item)
+			}
+			item = parts[0]
+		}
+
+		start, end := min, max
+		if item != "*" {
+			bounds := strings.SplitN(item, "-", 2)
+			var err error
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value %q", item)
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid value %q", item)
+				}
+			}
+		}
+		if start < min || end > max || start > end {
+			return nil, fmt.Errorf("value %q out of range [%d, %d]", item, min, max)
+		}
+		for i := start; i <= end; i += step {
+			values.Insert(i)
+		}
+	}
+	return values, nil
+}
+
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	if !s.months.Has(int(t.Month())) {
+		return false
+	}
+	domMatched := s.doms.Has(t.Day())
+	dowMatched := s.dows.Has(int(t.Weekday()))
+	if s.domRestricted && s.dowRestricted {
+		return domMatched || dowMatched
+	}
+	return domMatched && dowMatched
+}
+
+func (s *cronSchedule) matches(t time.Time) bool {
+	return s.matchesDay(t) && s.hours.Has(t.Hour()) && s.minutes.Has(t.Minute())
+}
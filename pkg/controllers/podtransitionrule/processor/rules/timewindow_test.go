@@ -0,0 +1,107 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+)
+
+func TestTimeWindowWeekday(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	g.Expect(err).Should(gomega.BeNil())
+
+	targets := map[string]*corev1.Pod{
+		"test-pod-a": (&podTemplate{Name: "test-pod-a"}).GetPod(),
+	}
+	subjects := sets.NewString("test-pod-a")
+	// 2024-03-01 is Friday
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, loc)
+	ruler := &TimeWindowRuler{
+		Name: "window",
+		TimeWindow: &kuperatorv1alpha1.TransitionRuleTimeWindow{
+			TimeZone: "Asia/Shanghai",
+			Windows: []kuperatorv1alpha1.TimeWindow{
+				{
+					Weekdays: []string{"Mon", "Tue", "Wed", "Thu", "Fri"},
+					Start:    "22:00",
+					End:      "02:00",
+				},
+			},
+			BlackoutDates: []string{"2024-03-04"},
+		},
+		now: func() time.Time { return now },
+	}
+
+	res := ruler.Filter(normalRS, targets, subjects)
+	g.Expect(res.Passed.Len()).Should(gomega.BeEquivalentTo(0))
+	g.Expect(res.Interval).ShouldNot(gomega.BeNil())
+	g.Expect(*res.Interval).Should(gomega.Equal(10 * time.Hour))
+
+	// window crossing midnight opens on Saturday morning
+	now = time.Date(2024, 3, 2, 1, 0, 0, 0, loc)
+	res = ruler.Filter(normalRS, targets, subjects)
+	g.Expect(res.Passed.Len()).Should(gomega.BeEquivalentTo(1))
+
+	// Monday is blackout date, so the next window opens when Monday ends
+	now = time.Date(2024, 3, 2, 3, 0, 0, 0, loc)
+	res = ruler.Filter(normalRS, targets, subjects)
+	g.Expect(res.Passed.Len()).Should(gomega.BeEquivalentTo(0))
+	g.Expect(now.Add(*res.Interval).Equal(time.Date(2024, 3, 5, 0, 0, 0, 0, loc))).Should(gomega.BeTrue())
+}
+
+func TestTimeWindowCron(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	targets := map[string]*corev1.Pod{
+		"test-pod-a": (&podTemplate{Name: "test-pod-a"}).GetPod(),
+	}
+	subjects := sets.NewString("test-pod-a")
+	now := time.Date(2024, 3, 1, 3, 30, 0, 0, time.UTC)
+	ruler := &TimeWindowRuler{
+		Name: "window",
+		TimeWindow: &kuperatorv1alpha1.TransitionRuleTimeWindow{
+			Windows: []kuperatorv1alpha1.TimeWindow{
+				{
+					Cron:     "0 2 * * 1-5",
+					Duration: &metav1.Duration{Duration: 2 * time.Hour},
+				},
+			},
+		},
+		now: func() time.Time { return now },
+	}
+
+	res := ruler.Filter(normalRS, targets, subjects)
+	g.Expect(res.Passed.Len()).Should(gomega.BeEquivalentTo(1))
+
+	// the next window opens on Monday
+	now = time.Date(2024, 3, 1, 4, 0, 0, 0, time.UTC)
+	res = ruler.Filter(normalRS, targets, subjects)
+	g.Expect(res.Passed.Len()).Should(gomega.BeEquivalentTo(0))
+	g.Expect(now.Add(*res.Interval).Equal(time.Date(2024, 3, 4, 2, 0, 0, 0, time.UTC))).Should(gomega.BeTrue())
+
+	g.Expect(ValidateTimeWindow(&kuperatorv1alpha1.TransitionRuleTimeWindow{
+		Windows: []kuperatorv1alpha1.TimeWindow{{Cron: "0 25 * * *", Duration: &metav1.Duration{Duration: time.Hour}}},
+	})).ShouldNot(gomega.BeNil())
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+)
+
+// unscheduledDomain groups pods not scheduled or on nodes without topology label
+const unscheduledDomain = "<none>"
+
+type TopologyAvailableRuler struct {
+	Name string
+
+	TopologyAvailable *kuperatorv1alpha1.TransitionRuleTopologyAvailable
+
+	Client client.Client
+}
+
+// Filter evaluates available policy in each topology domain, so that one domain is not emptied by a global budget
+func (r *TopologyAvailableRuler) Filter(podTransitionRule *appsv1alpha1.PodTransitionRule, targets map[string]*corev1.Pod, subjects sets.String) *FilterResult {
+	passed := sets.NewString()
+	rejected := map[string]string{}
+
+	domainTargets := map[string]map[string]*corev1.Pod{}
+	domainSubjects := map[string]sets.String{}
+	domainOwners := map[string]map[types.UID]struct{}{}
+	nodeDomains := map[string]string{}
+	for podName, pod := range targets {
+		domain, err := r.getDomain(pod, nodeDomains)
+		if err != nil {
+			return rejectAllWithErr(subjects, passed, rejected, "[%s] fail to get topology domain of pod %s: %v", r.Name, podName, err)
+		}
+		if _, exist := domainTargets[domain]; !exist {
+			domainTargets[domain] = map[string]*corev1.Pod{}
+			domainSubjects[domain] = sets.NewString()
+			domainOwners[domain] = map[types.UID]struct{}{}
+		}
+		domainTargets[domain][podName] = pod
+		if controllerRef := metav1.GetControllerOf(pod); controllerRef != nil {
+			domainOwners[domain][controllerRef.UID] = struct{}{}
+		}
+		if subjects.Has(podName) {
+			domainSubjects[domain].Insert(podName)
+		}
+	}
+
+	ruler := &AvailableRuler{
+		Name:                r.Name,
+		MaxUnavailableValue: r.TopologyAvailable.MaxUnavailableValue,
+		MinAvailableValue:   r.TopologyAvailable.MinAvailableValue,
+		Client:              r.Client,
+	}
+	// uncreated replicas may belong to any domain of their owner, so they are conservatively counted as unavailable
+	// in every domain with pods of the owner
+	ownerUncreatedReplicas, err := ruler.getUncreatedReplicas(podTransitionRule.Namespace, targets)
+	if err != nil {
+		return rejectAllWithErr(subjects, passed, rejected, "[%s] fail to get uncreated replicas, error: %v", r.Name, err)
+	}
+	var interval *time.Duration
+	var errs []string
+	for _, domain := range sets.StringKeySet(domainTargets).List() {
+		if domainSubjects[domain].Len() == 0 {
+			continue
+		}
+		domainUncreatedReplicas := 0
+		for uid := range domainOwners[domain] {
+			domainUncreatedReplicas += ownerUncreatedReplicas[uid]
+		}
+		result := ruler.filter(podTransitionRule, domainTargets[domain], domainSubjects[domain], domainUncreatedReplicas)
+		passed.Insert(result.Passed.List()...)
+		for podName, reason := range result.Rejected {
+			rejected[podName] = fmt.Sprintf("[topology domain %s=%s] %s", r.TopologyAvailable.TopologyKey, domain, reason)
+		}
+		if result.Interval != nil && (interval == nil || *result.Interval < *interval) {
+			interval = result.Interval
+		}
+		if result.Err != nil {
+			errs = append(errs, fmt.Sprintf("topology domain %s=%s: %v", r.TopologyAvailable.TopologyKey, domain, result.Err))
+		}
+	}
+
+	res := &FilterResult{Passed: passed, Rejected: rejected, Interval: interval}
+	if len(errs) > 0 {
+		res.Err = fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return res
+}
+
+func (r *TopologyAvailableRuler) getDomain(pod *corev1.Pod, nodeDomains map[string]string) (string, error) {
+	if pod.Spec.NodeName == "" {
+		return unscheduledDomain, nil
+	}
+	if domain, exist := nodeDomains[pod.Spec.NodeName]; exist {
+		return domain, nil
+	}
+
+	domain := unscheduledDomain
+	node := &corev1.Node{}
+	if err := r.Client.Get(context.TODO(), types.NamespacedName{Name: pod.Spec.NodeName}, node); err != nil {
+		if !errors.IsNotFound(err) {
+			return "", err
+		}
+	} else if value, exist := node.Labels[r.TopologyAvailable.TopologyKey]; exist {
+		domain = value
+	}
+	nodeDomains[pod.Spec.NodeName] = domain
+	return domain, nil
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+)
+
+func TestTopologyAvailable(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	zoneKey := "topology.kubernetes.io/zone"
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a", Labels: map[string]string{zoneKey: "zone-a"}}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-b", Labels: map[string]string{zoneKey: "zone-b"}}},
+	).Build()
+
+	targets := map[string]*corev1.Pod{}
+	for _, item := range []struct{ name, node string }{
+		{"test-pod-a1", "node-a"},
+		{"test-pod-a2", "node-a"},
+		{"test-pod-b1", "node-b"},
+		{"test-pod-b2", "node-b"},
+	} {
+		pod := (&podTemplate{Name: item.name}).GetPod()
+		pod.Spec.NodeName = item.node
+		targets[item.name] = pod
+	}
+
+	maxUnavailable := intstr.FromInt(1)
+	ruler := &TopologyAvailableRuler{
+		Name: "zone",
+		TopologyAvailable: &kuperatorv1alpha1.TransitionRuleTopologyAvailable{
+			TopologyKey:         zoneKey,
+			MaxUnavailableValue: &maxUnavailable,
+		},
+		Client: c,
+	}
+
+	// one pod is approved in each zone
+	res := ruler.Filter(normalRS, targets, sets.NewString("test-pod-a1", "test-pod-a2", "test-pod-b1", "test-pod-b2"))
+	g.Expect(res.Err).Should(gomega.BeNil())
+	g.Expect(res.Passed.Len()).Should(gomega.BeEquivalentTo(2))
+	g.Expect(len(res.Rejected)).Should(gomega.BeEquivalentTo(2))
+	zones := sets.NewString()
+	for podName, reason := range res.Rejected {
+		zone := targets[podName].Spec.NodeName[len("node-"):]
+		g.Expect(strings.Contains(reason, zoneKey+"=zone-"+zone)).Should(gomega.BeTrue())
+		zones.Insert(zone)
+	}
+	g.Expect(zones.List()).Should(gomega.Equal([]string{"a", "b"}))
+}
+
+func TestTopologyAvailableUncreatedReplicas(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	zoneKey := "topology.kubernetes.io/zone"
+	replicas := int32(4)
+	rs := &appsv1.ReplicaSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "test-rs", UID: "test-rs-uid"},
+		Spec:       appsv1.ReplicaSetSpec{Replicas: &replicas},
+	}
+	objs := []runtime.Object{
+		rs,
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-a", Labels: map[string]string{zoneKey: "zone-a"}}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-b", Labels: map[string]string{zoneKey: "zone-b"}}},
+	}
+	isController := true
+	newPod := func(name, node string) *corev1.Pod {
+		pod := (&podTemplate{Name: name}).GetPod()
+		pod.Spec.NodeName = node
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: rs.Name, UID: rs.UID, Controller: &isController}}
+		return pod
+	}
+	// test-pod-b2 in zone-b is missing
+	targets := map[string]*corev1.Pod{}
+	for _, item := range []struct{ name, node string }{
+		{"test-pod-a1", "node-a"},
+		{"test-pod-a2", "node-a"},
+		{"test-pod-b1", "node-b"},
+	} {
+		pod := newPod(item.name, item.node)
+		targets[item.name] = pod
+		objs = append(objs, pod)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithRuntimeObjects(objs...).Build()
+
+	maxUnavailable := intstr.FromInt(1)
+	ruler := &TopologyAvailableRuler{
+		Name: "zone",
+		TopologyAvailable: &kuperatorv1alpha1.TransitionRuleTopologyAvailable{
+			TopologyKey:         zoneKey,
+			MaxUnavailableValue: &maxUnavailable,
+		},
+		Client: c,
+	}
+
+	// the missing replica may belong to any zone, so it uses up budget of every zone, and zone-b is not emptied
+	res := ruler.Filter(normalRS, targets, sets.NewString("test-pod-a1", "test-pod-a2", "test-pod-b1"))
+	g.Expect(res.Err).Should(gomega.BeNil())
+	g.Expect(res.Passed.Len()).Should(gomega.BeEquivalentTo(0))
+	g.Expect(len(res.Rejected)).Should(gomega.BeEquivalentTo(3))
+	for _, reason := range res.Rejected {
+		g.Expect(reason).Should(gomega.ContainSubstring("[uncreated replicas]=1"))
+	}
+
+	// one pod is approved in each zone after the missing replica is created
+	recreated := newPod("test-pod-b2", "node-b")
+	targets[recreated.Name] = recreated
+	g.Expect(c.Create(context.TODO(), recreated)).Should(gomega.BeNil())
+	res = ruler.Filter(normalRS, targets, sets.NewString("test-pod-a1", "test-pod-a2", "test-pod-b1", "test-pod-b2"))
+	g.Expect(res.Err).Should(gomega.BeNil())
+	g.Expect(res.Passed.Len()).Should(gomega.BeEquivalentTo(2))
+	g.Expect(len(res.Rejected)).Should(gomega.BeEquivalentTo(2))
+	for _, reason := range res.Rejected {
+		g.Expect(reason).ShouldNot(gomega.ContainSubstring("uncreated replicas"))
+	}
+}
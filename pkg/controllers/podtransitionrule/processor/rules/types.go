@@ -22,15 +22,22 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 )
 
 type Ruler interface {
 	Filter(podTransitionRule *appsv1alpha1.PodTransitionRule, targets map[string]*corev1.Pod, subjects sets.String) *FilterResult
 }
 
+// RuleStateKeeper is implemented by rulers whose state should be kept even if there is no pod to filter
+type RuleStateKeeper interface {
+	KeepRuleState(podTransitionRule *appsv1alpha1.PodTransitionRule) *appsv1alpha1.RuleState
+}
+
 type FilterResult struct {
 	Passed   sets.String
 	Rejected map[string]string
@@ -38,9 +45,11 @@ type FilterResult struct {
 	Err      error
 
 	RuleState *appsv1alpha1.RuleState
+	// WebhookProgress is the progress of webhook rule to persist in annotation of PodTransitionRule
+	WebhookProgress *kuperatorv1alpha1.TransitionRuleWebhookProgress
 }
 
-func GetRuler(rule *appsv1alpha1.TransitionRule, client client.Client) Ruler {
+func GetRuler(podTransitionRule *appsv1alpha1.PodTransitionRule, rule *appsv1alpha1.TransitionRule, client client.Client, apiReader client.Reader) Ruler {
 
 	if rule.AvailablePolicy != nil {
 		return &AvailableRuler{
@@ -57,11 +66,108 @@ func GetRuler(rule *appsv1alpha1.TransitionRule, client client.Client) Ruler {
 		}
 	}
 	if rule.Webhook != nil {
-		return &WebhookRuler{Name: rule.Name}
+		if _, err := kuperatorv1alpha1.GetTransitionRuleWebhookRetries(podTransitionRule); err != nil {
+			klog.Errorf("fail to get webhook retries of PodTransitionRule %s/%s: %v", podTransitionRule.Namespace, podTransitionRule.Name, err)
+			return &InvalidRuler{Name: rule.Name, Err: err}
+		}
+		return &WebhookRuler{Name: rule.Name, APIReader: apiReader}
+	}
+	return getExtensionRuler(podTransitionRule, rule, client)
+}
+
+// getExtensionRuler returns the ruler of rule defined in annotation, for rules with empty definition.
+// Rules whose extension is invalid reject all pods, instead of being skipped.
+func getExtensionRuler(podTransitionRule *appsv1alpha1.PodTransitionRule, rule *appsv1alpha1.TransitionRule, client client.Client) Ruler {
+	extensions, err := kuperatorv1alpha1.GetTransitionRuleExtensions(podTransitionRule)
+	if err != nil {
+		klog.Errorf("fail to get rule extensions of PodTransitionRule %s/%s: %v", podTransitionRule.Namespace, podTransitionRule.Name, err)
+		return &InvalidRuler{Name: rule.Name, Err: err}
+	}
+	extension, exist := extensions[rule.Name]
+	if !exist || extension == nil {
+		return nil
+	}
+	if count := CountExtensionRules(extension); count != 1 {
+		return &InvalidRuler{Name: rule.Name, Err: fmt.Errorf("rule extension should define exactly one rule, got %d", count)}
+	}
+	if extension.MetricsCheck != nil {
+		return &MetricsCheckRuler{
+			Name:         rule.Name,
+			MetricsCheck: extension.MetricsCheck,
+		}
+	}
+	if extension.TimeWindow != nil {
+		return &TimeWindowRuler{
+			Name:       rule.Name,
+			TimeWindow: extension.TimeWindow,
+		}
+	}
+	if extension.RateLimit != nil {
+		return &RateLimitRuler{
+			Name:      rule.Name,
+			RateLimit: extension.RateLimit,
+		}
+	}
+	if extension.TopologyAvailable != nil {
+		return &TopologyAvailableRuler{
+			Name:              rule.Name,
+			TopologyAvailable: extension.TopologyAvailable,
+			Client:            client,
+		}
+	}
+	if extension.Dependency != nil {
+		return &DependencyRuler{
+			Name:       rule.Name,
+			Dependency: extension.Dependency,
+			Client:     client,
+		}
+	}
+	if extension.Expression != nil {
+		return &ExpressionRuler{
+			Name:       rule.Name,
+			Expression: extension.Expression,
+			Client:     client,
+		}
+	}
+	if extension.DisruptionBudget != nil {
+		return &DisruptionBudgetRuler{
+			Name:             rule.Name,
+			DisruptionBudget: extension.DisruptionBudget,
+			Client:           client,
+		}
 	}
 	return nil
 }
 
+// CountExtensionRules returns the number of rules defined in extension, which is expected to be exactly one.
+func CountExtensionRules(extension *kuperatorv1alpha1.TransitionRuleExtension) int {
+	count := 0
+	for _, defined := range []bool{
+		extension.MetricsCheck != nil,
+		extension.TimeWindow != nil,
+		extension.RateLimit != nil,
+		extension.TopologyAvailable != nil,
+		extension.Dependency != nil,
+		extension.Expression != nil,
+		extension.DisruptionBudget != nil,
+	} {
+		if defined {
+			count++
+		}
+	}
+	return count
+}
+
+// InvalidRuler rejects all pods with the error of rule definition, so that an invalid rule never passes pods.
+type InvalidRuler struct {
+	Name string
+	Err  error
+}
+
+func (r *InvalidRuler) Filter(podTransitionRule *appsv1alpha1.PodTransitionRule, targets map[string]*corev1.Pod, subjects sets.String) *FilterResult {
+	return rejectAllWithErr(subjects, sets.NewString(), map[string]string{}, "invalid rule %s: %v", r.Name, r.Err)
+}
+
 func rejectAllWithErr(subjects, passed sets.String, rejects map[string]string, format string, a ...any) *FilterResult {
 	reject(subjects, passed, rejects, fmt.Sprintf(format, a...))
 	return &FilterResult{Passed: passed, Rejected: rejects, Err: fmt.Errorf(format, a...)}
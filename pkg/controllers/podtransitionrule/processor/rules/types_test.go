@@ -0,0 +1,58 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"testing"
+
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+)
+
+func TestInvalidExtensionRuler(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	targets := map[string]*corev1.Pod{
+		"test-pod-a": (&podTemplate{Name: "test-pod-a"}).GetPod(),
+		"test-pod-b": (&podTemplate{Name: "test-pod-b"}).GetPod(),
+	}
+	rule := &appsv1alpha1.TransitionRule{Name: "extension"}
+
+	for _, extensions := range []string{
+		// annotation can not be parsed
+		`{"extension": {"rateLimit": {"limit": "one"}}}`,
+		// more than one rule defined
+		`{"extension": {"rateLimit": {"limit": 1, "period": "1m"}, "disruptionBudget": {"name": "foo"}}}`,
+	} {
+		rs := normalRS.DeepCopy()
+		rs.Annotations = map[string]string{kuperatorv1alpha1.PodTransitionRuleExtensionsAnnoKey: extensions}
+		ruler := GetRuler(rs, rule, nil, nil)
+		g.Expect(ruler).ShouldNot(gomega.BeNil())
+		res := ruler.Filter(rs, targets, sets.NewString("test-pod-a", "test-pod-b"))
+		g.Expect(res.Passed.Len()).Should(gomega.BeEquivalentTo(0))
+		g.Expect(len(res.Rejected)).Should(gomega.BeEquivalentTo(2))
+		g.Expect(res.Err).Should(gomega.HaveOccurred())
+	}
+
+	rs := normalRS.DeepCopy()
+	rs.Annotations = map[string]string{kuperatorv1alpha1.PodTransitionRuleExtensionsAnnoKey: `{"extension": {"rateLimit": {"limit": 1, "period": "1m"}}}`}
+	_, ok := GetRuler(rs, rule, nil, nil).(*RateLimitRuler)
+	g.Expect(ok).Should(gomega.BeTrue())
+}
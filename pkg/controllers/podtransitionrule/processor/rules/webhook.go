@@ -17,6 +17,7 @@ limitations under the License.
 package rules
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"time"
@@ -25,8 +26,10 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 	controllerutils "kusionstack.io/kuperator/pkg/controllers/podtransitionrule/utils"
 	"kusionstack.io/kuperator/pkg/utils"
 	utilshttp "kusionstack.io/kuperator/pkg/utils/http"
@@ -34,6 +37,9 @@ import (
 
 type WebhookRuler struct {
 	Name string
+
+	// APIReader reads Secrets for webhook authentication from the apiserver, so that Secrets are never cached
+	APIReader client.Reader
 }
 
 func (r *WebhookRuler) Filter(
@@ -41,7 +47,13 @@ func (r *WebhookRuler) Filter(
 	targets map[string]*corev1.Pod,
 	subjects sets.String,
 ) *FilterResult {
-	return GetWebhook(podTransitionRule, r.Name)[0].Do(targets, subjects)
+	webhook := GetWebhook(podTransitionRule, r.Name)[0]
+	credential, err := getCredentialFunc(r.APIReader, podTransitionRule, r.Name)
+	if err != nil {
+		return rejectAllWithErr(subjects, sets.NewString(), map[string]string{}, "[%s] fail to get webhook authentication: %v", r.Name, err)
+	}
+	webhook.Credential = credential
+	return webhook.Do(targets, subjects)
 }
 
 const (
@@ -77,7 +89,9 @@ func GetWebhook(pt *appsv1alpha1.PodTransitionRule, names ...string) (webs []*We
 			RuleName: rule.Name,
 			Key:      pt.Namespace + "/" + pt.Name + "/" + rule.Name,
 			Webhook:  web,
+			Retry:    getWebhookRetry(pt, rule.Name),
 			State:    ruleState,
+			progress: getWebhookProgress(pt, rule.Name),
 			Approved: func(po string) bool {
 				return controllerutils.IsPodPassRule(po, pt, rule.Name)
 			},
@@ -92,16 +106,28 @@ type Webhook struct {
 	Stage    *string
 
 	Webhook *appsv1alpha1.TransitionRuleWebhook
+	Retry   *kuperatorv1alpha1.TransitionRuleWebhookRetry
 	State   *appsv1alpha1.RuleState
 
 	Approved func(string) bool
 
+	// Credential authenticates webhook and polling requests if not nil
+	Credential CredentialFunc
+
 	retryInterval *time.Duration
 	taskInfo      map[string]*appsv1alpha1.TaskInfo
+	progress      *kuperatorv1alpha1.TransitionRuleWebhookProgress
+	failure       *kuperatorv1alpha1.TransitionRuleWebhookFailure
+	polls         map[string]*kuperatorv1alpha1.TransitionRuleWebhookPoll
 }
 
-func (w *Webhook) Do(targets map[string]*corev1.Pod, subjects sets.String) *FilterResult {
+func (w *Webhook) Do(targets map[string]*corev1.Pod, subjects sets.String) (result *FilterResult) {
 	w.taskInfo = map[string]*appsv1alpha1.TaskInfo{}
+	w.failure = nil
+	if w.progress != nil {
+		w.failure = w.progress.Failure
+	}
+	w.polls = map[string]*kuperatorv1alpha1.TransitionRuleWebhookPoll{}
 	effectiveSubjects := sets.NewString(subjects.List()...)
 	checked := sets.NewString()
 	rejectedPods := map[string]string{}
@@ -120,6 +146,9 @@ func (w *Webhook) Do(targets map[string]*corev1.Pod, subjects sets.String) *Filt
 		newWebhookState.TaskStates = w.convTaskInfo(w.taskInfo)
 		newWebhookState.History = w.convTaskInfo(historyTaskInfo)
 		w.State.WebhookStatus = newWebhookState
+		if result != nil {
+			result.WebhookProgress = &kuperatorv1alpha1.TransitionRuleWebhookProgress{Failure: w.failure, Polls: w.polls}
+		}
 	}()
 	allTracingPods := sets.NewString()
 	nowTime := time.Now()
@@ -144,20 +173,32 @@ func (w *Webhook) Do(targets map[string]*corev1.Pod, subjects sets.String) *Filt
 		// get latest polling result
 		pollingResult := PollingManager.GetResult(taskId)
 
-		// restart case
+		// restart case, resume polling from the persisted task state
 		if pollingResult == nil {
 			pollUrl, _ := w.getPollingUrl(taskId)
-			PollingManager.Add(
+			pollState := w.pollTaskState(&state)
+			if nowTime.After(pollState.Deadline) {
+				// timeout before resumed, move in history, and request again
+				historyTaskInfo[taskId] = state.DeepCopy()
+				allTracingPods.Delete(currentPods.List()...)
+				klog.Infof("polling task %s of %s timeout before resumed, approved pods %v", taskId, w.Key, state.Approved)
+				continue
+			}
+			PollingManager.Resume(
 				taskId,
 				pollUrl,
 				w.Webhook.ClientConfig.Poll.CABundle,
 				w.Key,
-				time.Duration(*w.Webhook.ClientConfig.Poll.TimeoutSeconds)*time.Second,
 				time.Duration(*w.Webhook.ClientConfig.Poll.IntervalSeconds)*time.Second,
+				w.Credential,
+				pollState,
 			)
+			w.recordPoll(taskId, PollingManager.GetResult(taskId))
+			w.taskInfo[taskId] = state.DeepCopy()
 			rejectMsg := fmt.Sprintf(
-				"Task %s polling result not found, try polling again, %s",
+				"Task %s polling result not found, resume polling after %d times, %s",
 				w.Key,
+				pollState.Count,
 				taskId,
 			)
 			for po := range currentPods {
@@ -195,6 +236,7 @@ func (w *Webhook) Do(targets map[string]*corev1.Pod, subjects sets.String) *Filt
 			)
 		} else {
 			w.recordTaskInfo(&state, pollingResult.LastMessage, pollingResult.LastQueryTime, pollingResult.Approved.List())
+			w.recordPoll(taskId, pollingResult)
 			klog.Infof("polling task is running, current %d times, approved pods %v, %s, %s", pollingResult.Count, pollingResult.Approved.List(), pollingResult.Info, pollingResult.LastMessage)
 			rejectMsg = fmt.Sprintf(
 				"Not approved by webhook %s, polling task %s is running %s %s",
@@ -228,9 +270,52 @@ func (w *Webhook) Do(targets map[string]*corev1.Pod, subjects sets.String) *Filt
 		}
 	}
 
+	// No request in backoff after failures
+	if w.failure != nil && nowTime.Before(w.failure.RetryTime.Time) {
+		w.updateInterval(w.failure.RetryTime.Sub(nowTime))
+		msg := fmt.Sprintf(
+			"Webhook %s backing off after %d consecutive failures, last error: %s",
+			w.Key,
+			w.failure.Count,
+			w.failure.LastError,
+		)
+		if w.ignoreFailure() {
+			klog.Warningf("%s, ignore failures and pass pods %v", msg, effectiveSubjects.List())
+			checked.Insert(effectiveSubjects.List()...)
+		} else {
+			for eft := range effectiveSubjects {
+				rejectedPods[eft] = msg
+			}
+		}
+		return &FilterResult{
+			Passed:    checked,
+			Rejected:  rejectedPods,
+			Interval:  w.retryInterval,
+			RuleState: &appsv1alpha1.RuleState{Name: w.RuleName, WebhookStatus: newWebhookState},
+		}
+	}
+
 	// First request
 	selfTraceId, res, err := w.query(effectiveSubjects, targets)
 	if err != nil {
+		w.updateInterval(w.recordFailure(nowTime, err))
+		if w.ignoreFailure() {
+			klog.Warningf(
+				"fail to request podtransitionrule webhook %s %d consecutive times, ignore failures and pass pods %v, traceId: %s, err: %v",
+				w.Key,
+				w.failure.Count,
+				effectiveSubjects.List(),
+				selfTraceId,
+				err,
+			)
+			checked.Insert(effectiveSubjects.List()...)
+			return &FilterResult{
+				Passed:    checked,
+				Rejected:  rejectedPods,
+				Interval:  w.retryInterval,
+				RuleState: &appsv1alpha1.RuleState{Name: w.RuleName, WebhookStatus: newWebhookState},
+			}
+		}
 		for eft := range effectiveSubjects {
 			rejectedPods[eft] = fmt.Sprintf(
 				"Fail to do webhook request %s, %v, traceId %s",
@@ -249,10 +334,12 @@ func (w *Webhook) Do(targets map[string]*corev1.Pod, subjects sets.String) *Filt
 		return &FilterResult{
 			Passed:    checked,
 			Rejected:  rejectedPods,
+			Interval:  w.retryInterval,
 			Err:       err,
 			RuleState: &appsv1alpha1.RuleState{Name: w.RuleName, WebhookStatus: newWebhookState},
 		}
 	}
+	w.failure = nil
 	taskId := getTaskId(res)
 	klog.Infof(
 		"request podtransitionrule webhook %s, pods: %v, taskId: %s, traceId: %s, resp: %s",
@@ -319,8 +406,10 @@ func (w *Webhook) Do(targets map[string]*corev1.Pod, subjects sets.String) *Filt
 			w.Key,
 			time.Duration(*w.Webhook.ClientConfig.Poll.TimeoutSeconds)*time.Second,
 			time.Duration(*w.Webhook.ClientConfig.Poll.IntervalSeconds)*time.Second,
+			w.Credential,
 		)
 		klog.Infof("%s, polling task %s initialized.", w.Key, taskId)
+		w.recordPoll(taskId, PollingManager.GetResult(taskId))
 		w.newTaskInfo(taskId, res.Message, processing, approved)
 		checked.Insert(approved...)
 		for _, po := range processing {
@@ -418,7 +507,16 @@ func (w *Webhook) query(podSet sets.String, targets map[string]*corev1.Pod) (str
 }
 
 func (w *Webhook) doHttp(req *appsv1alpha1.WebhookRequest) (*appsv1alpha1.WebhookResponse, error) {
-	httpResp, err := utilshttp.DoHttpAndHttpsRequestWithCa(http.MethodPost, w.Webhook.ClientConfig.URL, *req, nil, w.Webhook.ClientConfig.CABundle)
+	var credential *utilshttp.Credential
+	if w.Credential != nil {
+		var err error
+		if credential, err = w.Credential(); err != nil {
+			return nil, err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), w.timeout())
+	defer cancel()
+	httpResp, err := utilshttp.DoHttpAndHttpsRequestWithCredential(ctx, http.MethodPost, w.Webhook.ClientConfig.URL, *req, nil, w.Webhook.ClientConfig.CABundle, credential)
 	if err != nil {
 		return nil, err
 	}
@@ -429,6 +527,35 @@ func (w *Webhook) doHttp(req *appsv1alpha1.WebhookRequest) (*appsv1alpha1.Webhoo
 	return resp, nil
 }
 
+// recordPoll keeps progress of running polling task to persist, since TaskInfo has no field for it
+func (w *Webhook) recordPoll(taskId string, result *PollResult) {
+	if result == nil {
+		return
+	}
+	w.polls[taskId] = &kuperatorv1alpha1.TransitionRuleWebhookPoll{
+		Count:    int32(result.Count),
+		Deadline: metav1.NewTime(result.Deadline),
+	}
+}
+
+// pollTaskState returns the persisted progress of polling task to resume. Deadline is counted from the begin time
+// of task if progress is not persisted.
+func (w *Webhook) pollTaskState(state *appsv1alpha1.TaskInfo) *PollTaskState {
+	pollState := &PollTaskState{Approved: state.Approved}
+	if w.progress != nil && w.progress.Polls[state.TaskId] != nil {
+		poll := w.progress.Polls[state.TaskId]
+		pollState.Count = int(poll.Count)
+		pollState.Deadline = poll.Deadline.Time
+		return pollState
+	}
+	beginTime := time.Now()
+	if state.BeginTime != nil {
+		beginTime = state.BeginTime.Time
+	}
+	pollState.Deadline = beginTime.Add(time.Duration(*w.Webhook.ClientConfig.Poll.TimeoutSeconds) * time.Second)
+	return pollState
+}
+
 func shouldPoll(resp *appsv1alpha1.WebhookResponse) bool {
 	return resp.Async || resp.Poll
 }
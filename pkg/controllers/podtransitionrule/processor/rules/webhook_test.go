@@ -28,6 +28,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 	"kusionstack.io/kuperator/pkg/utils"
 )
 
@@ -411,3 +412,72 @@ func printJson(obj any) {
 	byt, _ := json.MarshalIndent(obj, "", "  ")
 	fmt.Printf("%s\n", string(byt))
 }
+
+func TestWebhookPollResume(t *testing.T) {
+	targets := map[string]*corev1.Pod{
+		"test-pod-a": (&podTemplate{Name: "test-pod-a", Ip: "1.1.1.58"}).GetPod(),
+		"test-pod-b": (&podTemplate{Name: "test-pod-b", Ip: "1.1.1.59"}).GetPod(),
+	}
+	subjects := sets.NewString("test-pod-a", "test-pod-b")
+	g := gomega.NewGomegaWithT(t)
+	pollRS := poRS.DeepCopy()
+	beginTime := metav1.NewTime(time.Now().Add(-20 * time.Second))
+	deadline := metav1.NewTime(time.Now().Add(40 * time.Second))
+	pollRS.Annotations = map[string]string{
+		kuperatorv1alpha1.PodTransitionRuleWebhookProgressAnnoKey: utils.DumpJSON(map[string]*kuperatorv1alpha1.TransitionRuleWebhookProgress{
+			"test-webhook": {Polls: map[string]*kuperatorv1alpha1.TransitionRuleWebhookPoll{
+				"resume-task": {Count: 3, Deadline: deadline},
+			}},
+		}),
+	}
+	state := &appsv1alpha1.RuleState{
+		Name: "test-webhook",
+		WebhookStatus: &appsv1alpha1.WebhookStatus{
+			TaskStates: []appsv1alpha1.TaskInfo{
+				{
+					TaskId:     "resume-task",
+					BeginTime:  &beginTime,
+					LastTime:   &beginTime,
+					Message:    "processing",
+					Approved:   []string{"test-pod-a"},
+					Processing: []string{"test-pod-b"},
+				},
+			},
+		},
+	}
+	pollRS.Status.RuleStates = []*appsv1alpha1.RuleState{state}
+	defer PollingManager.Delete("resume-task")
+
+	// polling task is rebuilt from persisted state after restart
+	res := GetWebhook(pollRS)[0].Do(targets, subjects)
+	fmt.Printf("res: %s", utils.DumpJSON(res))
+	g.Expect(res.Passed.List()).Should(gomega.Equal([]string{"test-pod-a"}))
+	g.Expect(res.Rejected["test-pod-b"]).Should(gomega.ContainSubstring("resume polling after 3 times"))
+	g.Expect(len(res.RuleState.WebhookStatus.TaskStates)).Should(gomega.BeEquivalentTo(1))
+	g.Expect(res.RuleState.WebhookStatus.TaskStates[0].BeginTime.Time.Equal(beginTime.Time)).Should(gomega.BeTrue())
+	g.Expect(res.RuleState.WebhookStatus.TaskStates[0].Message).Should(gomega.Equal("processing"))
+	g.Expect(res.WebhookProgress.Polls["resume-task"].Count).Should(gomega.BeEquivalentTo(3))
+	g.Expect(res.WebhookProgress.Polls["resume-task"].Deadline.Time.Equal(deadline.Time)).Should(gomega.BeTrue())
+
+	result := PollingManager.GetResult("resume-task")
+	g.Expect(result).ShouldNot(gomega.BeNil())
+	g.Expect(result.Count).Should(gomega.BeEquivalentTo(3))
+	g.Expect(result.Approved.List()).Should(gomega.Equal([]string{"test-pod-a"}))
+	PollingManager.Delete("resume-task")
+
+	// polling task timed out before resumed is moved in history
+	expired := metav1.NewTime(time.Now().Add(-2 * time.Minute))
+	state.WebhookStatus.TaskStates[0].BeginTime = &expired
+	state.WebhookStatus.TaskStates[0].LastTime = &expired
+	delete(pollRS.Annotations, kuperatorv1alpha1.PodTransitionRuleWebhookProgressAnnoKey)
+	res = GetWebhook(pollRS)[0].Do(targets, subjects)
+	fmt.Printf("res: %s", utils.DumpJSON(res))
+	g.Expect(PollingManager.GetResult("resume-task")).Should(gomega.BeNil())
+	var inHistory bool
+	for _, info := range res.RuleState.WebhookStatus.History {
+		if info.TaskId == "resume-task" {
+			inHistory = true
+		}
+	}
+	g.Expect(inHistory).Should(gomega.BeTrue())
+}
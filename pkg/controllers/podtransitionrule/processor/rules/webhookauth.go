@@ -0,0 +1,93 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+	utilshttp "kusionstack.io/kuperator/pkg/utils/http"
+)
+
+// CredentialFunc reads the latest credential, so that rotated Secret takes effect on the next request
+type CredentialFunc func() (*utilshttp.Credential, error)
+
+// getCredentialFunc returns nil if no authentication configured for the webhook rule
+func getCredentialFunc(c client.Reader, pt *appsv1alpha1.PodTransitionRule, ruleName string) (CredentialFunc, error) {
+	auths, err := kuperatorv1alpha1.GetTransitionRuleWebhookAuths(pt)
+	if err != nil {
+		return nil, err
+	}
+	auth, exist := auths[ruleName]
+	if !exist || auth == nil {
+		return nil, nil
+	}
+	if c == nil {
+		return nil, fmt.Errorf("no reader to get secret %s", auth.SecretName)
+	}
+	namespace := pt.Namespace
+	return func() (*utilshttp.Credential, error) {
+		return GetWebhookCredential(c, namespace, auth)
+	}, nil
+}
+
+// GetWebhookCredential reads credential from the Secret referred by auth
+func GetWebhookCredential(c client.Reader, namespace string, auth *kuperatorv1alpha1.TransitionRuleWebhookAuth) (*utilshttp.Credential, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(context.TODO(), types.NamespacedName{Namespace: namespace, Name: auth.SecretName}, secret); err != nil {
+		return nil, fmt.Errorf("fail to get secret %s/%s: %v", namespace, auth.SecretName, err)
+	}
+	getData := func(key string) ([]byte, error) {
+		if len(secret.Data[key]) == 0 {
+			return nil, fmt.Errorf("key %s not found in secret %s/%s", key, namespace, auth.SecretName)
+		}
+		return secret.Data[key], nil
+	}
+
+	switch auth.Type {
+	case kuperatorv1alpha1.WebhookAuthBearerToken:
+		token, err := getData(kuperatorv1alpha1.WebhookAuthTokenKey)
+		if err != nil {
+			return nil, err
+		}
+		return &utilshttp.Credential{Token: strings.TrimSpace(string(token))}, nil
+	case kuperatorv1alpha1.WebhookAuthClientCertificate:
+		cert, err := getData(corev1.TLSCertKey)
+		if err != nil {
+			return nil, err
+		}
+		key, err := getData(corev1.TLSPrivateKeyKey)
+		if err != nil {
+			return nil, err
+		}
+		return &utilshttp.Credential{ClientCert: cert, ClientKey: key}, nil
+	case kuperatorv1alpha1.WebhookAuthHMAC:
+		signingKey, err := getData(kuperatorv1alpha1.WebhookAuthSigningKey)
+		if err != nil {
+			return nil, err
+		}
+		return &utilshttp.Credential{SigningKey: signingKey}, nil
+	}
+	return nil, fmt.Errorf("unsupported webhook auth type %s", auth.Type)
+}
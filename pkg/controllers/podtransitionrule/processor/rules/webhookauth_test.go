@@ -0,0 +1,83 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+)
+
+func handleHttpWithBearerToken(resp http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Authorization") != "Bearer test-token" {
+		http.Error(resp, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	handleHttpAlwaysSuccess(resp, req)
+}
+
+func TestWebhookBearerToken(t *testing.T) {
+	stop, finish := RunHttpServer(handleHttpWithBearerToken, "8897")
+	defer func() {
+		stop <- struct{}{}
+		<-finish
+	}()
+	g := gomega.NewGomegaWithT(t)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "webhook-token"},
+		Data:       map[string][]byte{kuperatorv1alpha1.WebhookAuthTokenKey: []byte("test-token\n")},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(secret).Build()
+
+	rs := normalRS.DeepCopy()
+	rs.Spec.Rules[0].Webhook.ClientConfig.URL = "http://127.0.0.1:8897"
+	rs.Annotations = map[string]string{
+		kuperatorv1alpha1.PodTransitionRuleWebhookAuthAnnoKey: `{"test-webhook": {"type": "BearerToken", "secretName": "webhook-token"}}`,
+	}
+	targets := map[string]*corev1.Pod{
+		"test-pod-a": (&podTemplate{Name: "test-pod-a", Ip: "1.1.1.58"}).GetPod(),
+		"test-pod-b": (&podTemplate{Name: "test-pod-b", Ip: "1.1.1.59"}).GetPod(),
+	}
+	subjects := sets.NewString("test-pod-a", "test-pod-b")
+	ruler := &WebhookRuler{Name: "test-webhook", APIReader: c}
+
+	res := ruler.Filter(rs, targets, subjects)
+	g.Expect(res.Err).Should(gomega.BeNil())
+	g.Expect(res.Passed.Len()).Should(gomega.BeEquivalentTo(2))
+
+	// rotated token is read on the next request
+	secret.Data[kuperatorv1alpha1.WebhookAuthTokenKey] = []byte("rotated-token")
+	g.Expect(c.Update(context.TODO(), secret)).Should(gomega.BeNil())
+	res = ruler.Filter(rs, targets, subjects)
+	g.Expect(res.Err).ShouldNot(gomega.BeNil())
+	g.Expect(res.Passed.Len()).Should(gomega.BeEquivalentTo(0))
+
+	_, err := GetWebhookCredential(c, "default", &kuperatorv1alpha1.TransitionRuleWebhookAuth{
+		Type:       kuperatorv1alpha1.WebhookAuthHMAC,
+		SecretName: "webhook-token",
+	})
+	g.Expect(err).ShouldNot(gomega.BeNil())
+}
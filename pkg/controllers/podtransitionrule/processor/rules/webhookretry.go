@@ -0,0 +1,104 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+)
+
+const (
+	defaultWebhookTimeout = 30 * time.Second
+	defaultInitialBackoff = 5 * time.Second
+	defaultMaxBackoff     = 5 * time.Minute
+	backoffJitterFactor   = 0.2
+)
+
+// recordFailure increases consecutive failures, and returns the backoff before next request
+func (w *Webhook) recordFailure(now time.Time, err error) time.Duration {
+	if w.failure == nil {
+		w.failure = &kuperatorv1alpha1.TransitionRuleWebhookFailure{}
+	}
+	w.failure.Count++
+	w.failure.LastFailureTime = metav1.NewTime(now)
+	w.failure.LastError = err.Error()
+	backoff := w.backoff(int(w.failure.Count))
+	w.failure.RetryTime = metav1.NewTime(now.Add(backoff))
+	return backoff
+}
+
+// backoff doubles from initial backoff for each consecutive failure, with jitter
+func (w *Webhook) backoff(count int) time.Duration {
+	initial, max := defaultInitialBackoff, defaultMaxBackoff
+	if w.Retry != nil && w.Retry.InitialBackoffSeconds > 0 {
+		initial = time.Duration(w.Retry.InitialBackoffSeconds) * time.Second
+	}
+	if w.Retry != nil && w.Retry.MaxBackoffSeconds > 0 {
+		max = time.Duration(w.Retry.MaxBackoffSeconds) * time.Second
+	}
+	backoff := initial
+	for i := 1; i < count && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return wait.Jitter(backoff, backoffJitterFactor)
+}
+
+// ignoreFailure returns true if failurePolicy is Ignore and consecutive failures reach the threshold
+func (w *Webhook) ignoreFailure() bool {
+	return w.failure != nil && w.Retry != nil && w.Retry.FailureThreshold > 0 &&
+		w.Webhook.FailurePolicy != nil && *w.Webhook.FailurePolicy == appsv1alpha1.Ignore &&
+		w.failure.Count >= w.Retry.FailureThreshold
+}
+
+func (w *Webhook) timeout() time.Duration {
+	if w.Retry != nil && w.Retry.TimeoutSeconds > 0 {
+		return time.Duration(w.Retry.TimeoutSeconds) * time.Second
+	}
+	return defaultWebhookTimeout
+}
+
+// getWebhookRetry returns failure handling of webhook rule. Invalid annotation is surfaced by GetRuler, which rejects
+// all pods of the rule, so it is ignored here.
+func getWebhookRetry(pt *appsv1alpha1.PodTransitionRule, ruleName string) *kuperatorv1alpha1.TransitionRuleWebhookRetry {
+	retries, err := kuperatorv1alpha1.GetTransitionRuleWebhookRetries(pt)
+	if err != nil {
+		return nil
+	}
+	return retries[ruleName]
+}
+
+// getWebhookProgress returns consecutive failures and polling tasks of webhook rule persisted by controller
+func getWebhookProgress(pt *appsv1alpha1.PodTransitionRule, ruleName string) *kuperatorv1alpha1.TransitionRuleWebhookProgress {
+	progresses, err := kuperatorv1alpha1.GetTransitionRuleWebhookProgresses(pt)
+	if err != nil {
+		klog.Errorf("fail to get webhook progress of PodTransitionRule %s/%s, ignore it: %v", pt.Namespace, pt.Name, err)
+		return &kuperatorv1alpha1.TransitionRuleWebhookProgress{}
+	}
+	if progress := progresses[ruleName]; progress != nil {
+		return progress
+	}
+	return &kuperatorv1alpha1.TransitionRuleWebhookProgress{}
+}
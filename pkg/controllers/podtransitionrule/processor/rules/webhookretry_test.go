@@ -0,0 +1,108 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rules
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+	"kusionstack.io/kuperator/pkg/utils"
+)
+
+func handleHttpInternalError(resp http.ResponseWriter, req *http.Request) {
+	http.Error(resp, "internal error", http.StatusInternalServerError)
+}
+
+// setWebhookProgress persists progress of webhook rule in annotation, as controller does
+func setWebhookProgress(rs *appsv1alpha1.PodTransitionRule, ruleName string, progress *kuperatorv1alpha1.TransitionRuleWebhookProgress) {
+	rs.Annotations[kuperatorv1alpha1.PodTransitionRuleWebhookProgressAnnoKey] = utils.DumpJSON(map[string]*kuperatorv1alpha1.TransitionRuleWebhookProgress{ruleName: progress})
+}
+
+func TestWebhookFailureIgnore(t *testing.T) {
+	stop, finish := RunHttpServer(handleHttpInternalError, "8896")
+	defer func() {
+		stop <- struct{}{}
+		<-finish
+	}()
+	g := gomega.NewGomegaWithT(t)
+	ignore := appsv1alpha1.Ignore
+	rs := normalRS.DeepCopy()
+	rs.Spec.Rules[0].Webhook.ClientConfig.URL = "http://127.0.0.1:8896"
+	rs.Spec.Rules[0].Webhook.FailurePolicy = &ignore
+	rs.Annotations = map[string]string{
+		kuperatorv1alpha1.PodTransitionRuleWebhookRetryAnnoKey: `{"test-webhook": {"failureThreshold": 2, "initialBackoffSeconds": 60}}`,
+	}
+	targets := map[string]*corev1.Pod{
+		"test-pod-a": (&podTemplate{Name: "test-pod-a", Ip: "1.1.1.58"}).GetPod(),
+	}
+	subjects := sets.NewString("test-pod-a")
+
+	// first failure is rejected and backed off
+	res := GetWebhook(rs)[0].Do(targets, subjects)
+	g.Expect(res.Passed.Len()).Should(gomega.BeEquivalentTo(0))
+	g.Expect(*res.Interval >= 60*time.Second && *res.Interval <= 72*time.Second).Should(gomega.BeTrue())
+	g.Expect(res.WebhookProgress.Failure.Count).Should(gomega.BeEquivalentTo(1))
+	g.Expect(res.WebhookProgress.Failure.LastError).Should(gomega.ContainSubstring("internal error"))
+	for _, info := range res.RuleState.WebhookStatus.History {
+		g.Expect(info.TaskId).ShouldNot(gomega.Equal("consecutive-failures"))
+	}
+
+	// no request during backoff
+	rs.Status.RuleStates = []*appsv1alpha1.RuleState{res.RuleState}
+	setWebhookProgress(rs, "test-webhook", res.WebhookProgress)
+	res = GetWebhook(rs)[0].Do(targets, subjects)
+	g.Expect(res.Passed.Len()).Should(gomega.BeEquivalentTo(0))
+	g.Expect(strings.Contains(res.Rejected["test-pod-a"], "backing off after 1 consecutive failures")).Should(gomega.BeTrue())
+	g.Expect(res.WebhookProgress.Failure.Count).Should(gomega.BeEquivalentTo(1))
+
+	// failure is ignored after threshold
+	res.WebhookProgress.Failure.RetryTime = metav1.NewTime(time.Now().Add(-time.Second))
+	rs.Status.RuleStates = []*appsv1alpha1.RuleState{res.RuleState}
+	setWebhookProgress(rs, "test-webhook", res.WebhookProgress)
+	res = GetWebhook(rs)[0].Do(targets, subjects)
+	g.Expect(res.Passed.List()).Should(gomega.Equal([]string{"test-pod-a"}))
+	g.Expect(*res.Interval >= 120*time.Second).Should(gomega.BeTrue())
+	g.Expect(res.WebhookProgress.Failure.Count).Should(gomega.BeEquivalentTo(2))
+}
+
+func TestInvalidWebhookRetry(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	rs := normalRS.DeepCopy()
+	rs.Annotations = map[string]string{
+		kuperatorv1alpha1.PodTransitionRuleWebhookRetryAnnoKey: `{"test-webhook": {"failureThreshold": "2"}}`,
+	}
+	targets := map[string]*corev1.Pod{
+		"test-pod-a": (&podTemplate{Name: "test-pod-a", Ip: "1.1.1.59"}).GetPod(),
+	}
+
+	// invalid retry rejects all pods, instead of falling back to defaults silently
+	ruler := GetRuler(rs, &rs.Spec.Rules[0], nil, nil)
+	_, ok := ruler.(*InvalidRuler)
+	g.Expect(ok).Should(gomega.BeTrue())
+	res := ruler.Filter(rs, targets, sets.NewString("test-pod-a"))
+	g.Expect(res.Err).ShouldNot(gomega.BeNil())
+	g.Expect(res.Rejected["test-pod-a"]).Should(gomega.ContainSubstring(kuperatorv1alpha1.PodTransitionRuleWebhookRetryAnnoKey))
+}
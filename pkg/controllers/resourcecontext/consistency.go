@@ -0,0 +1,382 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourcecontext
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	"kusionstack.io/kuperator/pkg/controllers/collaset/podcontext"
+	"kusionstack.io/kuperator/pkg/controllers/collaset/podcontrol"
+	"kusionstack.io/kuperator/pkg/controllers/collaset/synccontrol"
+	collasetutils "kusionstack.io/kuperator/pkg/controllers/collaset/utils"
+	"kusionstack.io/kuperator/pkg/controllers/utils/expectations"
+	rcutils "kusionstack.io/kuperator/pkg/controllers/utils/resourcecontext"
+)
+
+const (
+	// ConsistencyCheckInterval is the period to check ResourceContext consistency
+	ConsistencyCheckInterval = 5 * time.Minute
+
+	// ConditionsAnnoKey records conditions of ResourceContext in json, since it has no status
+	ConditionsAnnoKey = "resourcecontext.kusionstack.io/conditions"
+	// AutoRepairAnnoKey indicates whether to repair inconsistency found in ResourceContext
+	AutoRepairAnnoKey = "resourcecontext.kusionstack.io/auto-repair"
+
+	// ConsistentCondition is true if ResourceContext matches the pods of its owners
+	ConsistentCondition = "Consistent"
+)
+
+// inconsistency found for one owner of ResourceContext
+type inconsistency struct {
+	owner string
+	// IDs whose owner CollaSet no longer exists
+	orphanedOwner bool
+	// IDs not held by any pod, when owner has enough pods
+	orphanedIDs []int
+	// IDs labeled on more than one pod, mapping to pods except the oldest one
+	duplicatedIDs map[int][]*corev1.Pod
+	// pods whose instance ID is not recorded in ResourceContext
+	missingIDs map[int]*corev1.Pod
+	// IDs recording a revision no longer existing, while their pods are on an existing one
+	staleRevisionIDs []int
+
+	cls  *appsv1alpha1.CollaSet
+	pods map[int]*corev1.Pod
+}
+
+func (i *inconsistency) empty() bool {
+	return !i.orphanedOwner && len(i.orphanedIDs) == 0 && len(i.duplicatedIDs) == 0 &&
+		len(i.missingIDs) == 0 && len(i.staleRevisionIDs) == 0
+}
+
+func (i *inconsistency) String() string {
+	var msgs []string
+	if i.orphanedOwner {
+		msgs = append(msgs, "owner not found")
+	}
+	if len(i.orphanedIDs) > 0 {
+		msgs = append(msgs, fmt.Sprintf("orphaned IDs %v", i.orphanedIDs))
+	}
+	if len(i.duplicatedIDs) > 0 {
+		msgs = append(msgs, fmt.Sprintf("duplicated IDs %v", sets.IntKeySet(i.duplicatedIDs).List()))
+	}
+	if len(i.missingIDs) > 0 {
+		msgs = append(msgs, fmt.Sprintf("IDs missing in context %v", sets.IntKeySet(i.missingIDs).List()))
+	}
+	if len(i.staleRevisionIDs) > 0 {
+		msgs = append(msgs, fmt.Sprintf("IDs with stale revision %v", i.staleRevisionIDs))
+	}
+	return fmt.Sprintf("owner %s: %s", i.owner, strings.Join(msgs, ", "))
+}
+
+// checkConsistency checks whether each ContextDetail matches a live pod, and each pod has a valid context.
+// Inconsistency is reported as condition and events, and repaired if AutoRepairAnnoKey is "true".
+func (r *ResourceContextReconciler) checkConsistency(ctx context.Context, instance *appsv1alpha1.ResourceContext) error {
+	owners := sets.NewString()
+	for _, detail := range instance.Spec.Contexts {
+		if owner, exist := detail.Data[rcutils.OwnerContextKey]; exist {
+			owners.Insert(owner)
+		}
+	}
+
+	var inconsistencies []*inconsistency
+	for _, owner := range owners.List() {
+		// owners leasing IDs through library are in the format of <kind>/<name>
+		if strings.Contains(owner, "/") {
+			continue
+		}
+		result, err := r.checkCollaSetOwner(ctx, instance, owner)
+		if err != nil {
+			return err
+		}
+		if result != nil && !result.empty() {
+			inconsistencies = append(inconsistencies, result)
+		}
+	}
+
+	var msgs []string
+	for _, result := range inconsistencies {
+		msgs = append(msgs, result.String())
+		r.Recorder.Eventf(instance, corev1.EventTypeWarning, "InconsistentContext", "%s", result.String())
+		if result.cls != nil {
+			r.Recorder.Eventf(result.cls, corev1.EventTypeWarning, "InconsistentContext", "ResourceContext %s: %s", instance.Name, result.String())
+		}
+	}
+
+	if len(inconsistencies) > 0 && instance.Annotations[AutoRepairAnnoKey] == "true" {
+		if err := r.repair(ctx, instance, inconsistencies); err != nil {
+			r.Recorder.Eventf(instance, corev1.EventTypeWarning, "RepairFailed", "fail to repair ResourceContext: %s", err)
+			return err
+		}
+		r.Recorder.Eventf(instance, corev1.EventTypeNormal, "Repaired", "repaired inconsistency: %s", strings.Join(msgs, "; "))
+		return nil
+	}
+
+	cond := metav1.Condition{
+		Type:    ConsistentCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Consistent",
+		Message: "",
+	}
+	if len(inconsistencies) > 0 {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = "Inconsistent"
+		cond.Message = strings.Join(msgs, "; ")
+	}
+	return r.updateCondition(ctx, instance, cond)
+}
+
+// isDeletedCollaSetOwner returns true if owner not found holds IDs as CollaSet does, i.e. with revision recorded.
+// IDs written by other controllers without revision are not taken as CollaSet ones, so that they are never released by repair.
+func isDeletedCollaSetOwner(instance *appsv1alpha1.ResourceContext, owner string) bool {
+	for _, detail := range rcutils.OwnedIDs(instance, owner) {
+		if _, exist := detail.Data[podcontext.RevisionContextDataKey]; exist {
+			return true
+		}
+	}
+	return false
+}
+
+// checkCollaSetOwner checks IDs held by owner, and returns nil if owner is not a CollaSet. Owner is identified
+// by looking up the CollaSet with the same name.
+func (r *ResourceContextReconciler) checkCollaSetOwner(ctx context.Context, instance *appsv1alpha1.ResourceContext, owner string) (*inconsistency, error) {
+	result := &inconsistency{
+		owner:         owner,
+		duplicatedIDs: map[int][]*corev1.Pod{},
+		missingIDs:    map[int]*corev1.Pod{},
+		pods:          map[int]*corev1.Pod{},
+	}
+
+	cls := &appsv1alpha1.CollaSet{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Namespace: instance.Namespace, Name: owner}, cls); err != nil {
+		if errors.IsNotFound(err) {
+			if !isDeletedCollaSetOwner(instance, owner) {
+				return nil, nil
+			}
+			result.orphanedOwner = true
+			return result, nil
+		}
+		return nil, err
+	}
+	// CollaSet reclaims its IDs itself when deleting, and the context may not be used by it anymore
+	if cls.DeletionTimestamp != nil || getContextName(cls) != instance.Name {
+		return result, nil
+	}
+	result.cls = cls
+
+	pods, err := podcontrol.NewRealPodControl(r.Client, r.Scheme).GetFilteredPods(cls.Spec.Selector, cls)
+	if err != nil {
+		return nil, err
+	}
+	revisions, err := r.getRevisionNames(ctx, cls)
+	if err != nil {
+		return nil, err
+	}
+
+	ownedIDs := rcutils.OwnedIDs(instance, owner)
+	// sort pods by creation time to keep the oldest pod for duplicated IDs
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].CreationTimestamp.Before(&pods[j].CreationTimestamp)
+	})
+	activePods := map[int]*corev1.Pod{}
+	for _, pod := range pods {
+		id, err := collasetutils.GetPodInstanceID(pod)
+		if err != nil || id < 0 {
+			continue
+		}
+		if _, exist := result.pods[id]; !exist {
+			result.pods[id] = pod
+		}
+		// terminating pod may share ID with the one recreated for it
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		if _, exist := activePods[id]; exist {
+			result.duplicatedIDs[id] = append(result.duplicatedIDs[id], pod)
+			continue
+		}
+		activePods[id] = pod
+		result.pods[id] = pod
+		if _, exist := ownedIDs[id]; !exist {
+			result.missingIDs[id] = pod
+		}
+	}
+
+	// IDs without pods are expected while scaling out or replacing, only check them when owner is stable with enough pods
+	replicas := 0
+	if cls.Spec.Replicas != nil {
+		replicas = int(*cls.Spec.Replicas)
+	}
+	stable := cls.Status.ObservedGeneration == cls.Generation && len(activePods) >= replicas
+	for _, id := range sets.IntKeySet(ownedIDs).List() {
+		detail := ownedIDs[id]
+		_, replacing := detail.Get(synccontrol.ReplaceNewPodIDContextDataKey)
+		if !replacing {
+			_, replacing = detail.Get(synccontrol.ReplaceOriginPodIDContextDataKey)
+		}
+		if _, exist := result.pods[id]; !exist && stable && !replacing && !detail.Contains(synccontrol.ScaleInContextDataKey, "true") {
+			result.orphanedIDs = append(result.orphanedIDs, id)
+		}
+		// revisions may be pruned by history limit, so only IDs whose pods are on an existing revision are corrected
+		pod, exist := activePods[id]
+		if !exist || !revisions.Has(pod.Labels[appsv1.ControllerRevisionHashLabelKey]) {
+			continue
+		}
+		if revision := detail.Data[podcontext.RevisionContextDataKey]; revision != "" && !revisions.Has(revision) {
+			result.staleRevisionIDs = append(result.staleRevisionIDs, id)
+		}
+	}
+	return result, nil
+}
+
+func (r *ResourceContextReconciler) getRevisionNames(ctx context.Context, cls *appsv1alpha1.CollaSet) (sets.String, error) {
+	selector, err := metav1.LabelSelectorAsSelector(cls.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	revisionList := &appsv1.ControllerRevisionList{}
+	if err := r.Client.List(ctx, revisionList, &client.ListOptions{Namespace: cls.Namespace, LabelSelector: selector}); err != nil {
+		return nil, err
+	}
+
+	names := sets.NewString()
+	for i := range revisionList.Items {
+		if metav1.IsControlledBy(&revisionList.Items[i], cls) {
+			names.Insert(revisionList.Items[i].Name)
+		}
+	}
+	return names, nil
+}
+
+// repair fixes ResourceContext as the following:
+// 1. remove IDs of owners not found and IDs not held by any pod;
+// 2. record IDs of pods missing in ResourceContext, if the ID is not held by other owners;
+// 3. correct stale revisions with the revision of pod;
+// 4. delete the newer pods sharing the same ID through PodOpsLifecycle.
+func (r *ResourceContextReconciler) repair(ctx context.Context, instance *appsv1alpha1.ResourceContext, inconsistencies []*inconsistency) error {
+	for _, result := range inconsistencies {
+		for _, pods := range result.duplicatedIDs {
+			for _, pod := range pods {
+				if _, exist := pod.Labels[appsv1alpha1.PodDeletionIndicationLabelKey]; exist {
+					continue
+				}
+				patch := client.RawPatch(types.StrategicMergePatchType, []byte(fmt.Sprintf(`{"metadata":{"labels":{"%s":"%d"}}}`, appsv1alpha1.PodDeletionIndicationLabelKey, time.Now().UnixNano())))
+				if err := r.Client.Patch(ctx, pod, patch); err != nil {
+					return fmt.Errorf("fail to delete pod %s/%s with duplicated ID: %s", pod.Namespace, pod.Name, err)
+				}
+			}
+		}
+	}
+
+	heldIDs := map[int]string{}
+	for _, detail := range instance.Spec.Contexts {
+		heldIDs[detail.ID] = detail.Data[rcutils.OwnerContextKey]
+	}
+	for _, result := range inconsistencies {
+		ownedIDs := rcutils.OwnedIDs(instance, result.owner)
+		if result.orphanedOwner {
+			ownedIDs = nil
+		}
+		for _, id := range result.orphanedIDs {
+			delete(ownedIDs, id)
+		}
+		for id, pod := range result.missingIDs {
+			if _, held := heldIDs[id]; held {
+				continue
+			}
+			ownedIDs[id] = &appsv1alpha1.ContextDetail{
+				ID: id,
+				Data: map[string]string{
+					rcutils.OwnerContextKey:           result.owner,
+					podcontext.RevisionContextDataKey: pod.Labels[appsv1.ControllerRevisionHashLabelKey],
+				},
+			}
+		}
+		for _, id := range result.staleRevisionIDs {
+			if detail, exist := ownedIDs[id]; exist {
+				detail.Put(podcontext.RevisionContextDataKey, result.pods[id].Labels[appsv1.ControllerRevisionHashLabelKey])
+			}
+		}
+		if err := rcutils.SetOwnedIDs(instance, result.owner, ownedIDs); err != nil {
+			return err
+		}
+	}
+
+	setCondition(instance, metav1.Condition{
+		Type:   ConsistentCondition,
+		Status: metav1.ConditionTrue,
+		Reason: "Repaired",
+	})
+	// empty ResourceContext is deleted in next reconciling
+	if err := r.Client.Update(ctx, instance); err != nil {
+		return err
+	}
+	return activeExpectations.ExpectUpdate(instance, expectations.ResourceContext, instance.Name, instance.ResourceVersion)
+}
+
+func (r *ResourceContextReconciler) updateCondition(ctx context.Context, instance *appsv1alpha1.ResourceContext, cond metav1.Condition) error {
+	if !setCondition(instance, cond) {
+		return nil
+	}
+	if err := r.Client.Update(ctx, instance); err != nil {
+		return err
+	}
+	return activeExpectations.ExpectUpdate(instance, expectations.ResourceContext, instance.Name, instance.ResourceVersion)
+}
+
+// setCondition records condition in annotation, and returns false if nothing changes
+func setCondition(instance *appsv1alpha1.ResourceContext, cond metav1.Condition) bool {
+	var conditions []metav1.Condition
+	if value := instance.Annotations[ConditionsAnnoKey]; value != "" {
+		// overwrite malformed conditions
+		_ = json.Unmarshal([]byte(value), &conditions)
+	}
+	existing := meta.FindStatusCondition(conditions, cond.Type)
+	if existing != nil && existing.Status == cond.Status && existing.Reason == cond.Reason && existing.Message == cond.Message {
+		return false
+	}
+
+	meta.SetStatusCondition(&conditions, cond)
+	bytes, _ := json.Marshal(conditions)
+	if instance.Annotations == nil {
+		instance.Annotations = map[string]string{}
+	}
+	instance.Annotations[ConditionsAnnoKey] = string(bytes)
+	return true
+}
+
+func getContextName(cls *appsv1alpha1.CollaSet) string {
+	if cls.Spec.ScaleStrategy.Context != "" {
+		return cls.Spec.ScaleStrategy.Context
+	}
+	return cls.Name
+}
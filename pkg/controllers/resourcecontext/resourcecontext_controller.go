@@ -28,6 +28,8 @@ import (
 
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
 	"kusionstack.io/kuperator/pkg/controllers/utils/expectations"
+	"kusionstack.io/kuperator/pkg/features"
+	"kusionstack.io/kuperator/pkg/utils/feature"
 	"kusionstack.io/kuperator/pkg/utils/mixin"
 )
 
@@ -82,8 +84,13 @@ func AddToMgr(mgr ctrl.Manager, r reconcile.Reconciler) error {
 // +kubebuilder:rbac:groups=apps.kusionstack.io,resources=resourcecontexts,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps.kusionstack.io,resources=resourcecontexts/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=apps.kusionstack.io,resources=resourcecontexts/finalizers,verbs=update
+// +kubebuilder:rbac:groups=apps.kusionstack.io,resources=collasets,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=controllerrevisions,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;update;patch
 
 // Reconcile aims to reclaim ResourceContext which is not in used which means the ResourceContext contains no Context.
+// It also checks periodically whether ResourceContext is consistent with pods of its owners, if feature gate is enabled.
 func (r *ResourceContextReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := r.Logger.WithValues("resourceContext", req.String())
 	instance := &appsv1alpha1.ResourceContext{}
@@ -116,6 +123,15 @@ func (r *ResourceContextReconciler) Reconcile(ctx context.Context, req ctrl.Requ
 			logger.Error(err, "failed to expect deletion after ResourceContext is deleted")
 			return ctrl.Result{}, err
 		}
+		return ctrl.Result{}, nil
+	}
+
+	if feature.DefaultFeatureGate.Enabled(features.ResourceContextConsistencyCheck) {
+		if err := r.checkConsistency(ctx, instance); err != nil {
+			logger.Error(err, "failed to check consistency of ResourceContext")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: ConsistencyCheckInterval}, nil
 	}
 
 	return ctrl.Result{}, nil
@@ -47,6 +47,7 @@ import (
 	"kusionstack.io/kuperator/pkg/controllers/poddeletion"
 	"kusionstack.io/kuperator/pkg/controllers/utils/poddecoration/strategy"
 	"kusionstack.io/kuperator/pkg/utils/inject"
+	"kusionstack.io/kuperator/pkg/utils/mixin"
 )
 
 var (
@@ -228,6 +229,134 @@ var _ = Describe("ResourceContext controller", func() {
 			return c.Get(context.TODO(), types.NamespacedName{Namespace: cs.Namespace, Name: cs.Name}, resourceContext)
 		}, 5*time.Second, 1*time.Second).ShouldNot(BeNil())
 	})
+
+	It("resource context consistency check", func() {
+		testcase := "test-rc-consistency"
+		Expect(createNamespace(c, testcase)).Should(BeNil())
+
+		// IDs held by a CollaSet not existing, and IDs held by other controllers
+		resourceContext := &appsv1alpha1.ResourceContext{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testcase,
+				Name:      "foo",
+			},
+			Spec: appsv1alpha1.ResourceContextSpec{
+				Contexts: []appsv1alpha1.ContextDetail{
+					{ID: 0, Data: map[string]string{"Owner": "foo", "Revision": "foo-1"}},
+					{ID: 1, Data: map[string]string{"Owner": "foo", "Revision": "foo-1"}},
+					{ID: 2, Data: map[string]string{"Owner": "Job/bar"}},
+					{ID: 3, Data: map[string]string{"Owner": "shard-controller"}},
+				},
+			},
+		}
+		Expect(c.Create(context.TODO(), resourceContext)).Should(BeNil())
+
+		r := &ResourceContextReconciler{ReconcilerMixin: mixin.NewReconcilerMixin(controllerName, mgr)}
+		Eventually(func() error {
+			if err := c.Get(context.TODO(), types.NamespacedName{Namespace: testcase, Name: "foo"}, resourceContext); err != nil {
+				return err
+			}
+			return r.checkConsistency(context.TODO(), resourceContext)
+		}, 5*time.Second, 1*time.Second).Should(BeNil())
+
+		Eventually(func() bool {
+			Expect(c.Get(context.TODO(), types.NamespacedName{Namespace: testcase, Name: "foo"}, resourceContext)).Should(BeNil())
+			return strings.Contains(resourceContext.Annotations[ConditionsAnnoKey], `"status":"False"`)
+		}, 5*time.Second, 1*time.Second).Should(BeTrue())
+		Expect(len(resourceContext.Spec.Contexts)).Should(BeEquivalentTo(4))
+		Expect(resourceContext.Annotations[ConditionsAnnoKey]).ShouldNot(ContainSubstring("shard-controller"))
+
+		// repair removes the orphaned IDs, and keeps IDs leased through library or held by other controllers
+		resourceContext.Annotations[AutoRepairAnnoKey] = "true"
+		Expect(c.Update(context.TODO(), resourceContext)).Should(BeNil())
+		Eventually(func() error {
+			if err := c.Get(context.TODO(), types.NamespacedName{Namespace: testcase, Name: "foo"}, resourceContext); err != nil {
+				return err
+			}
+			return r.checkConsistency(context.TODO(), resourceContext)
+		}, 5*time.Second, 1*time.Second).Should(BeNil())
+
+		Eventually(func() bool {
+			Expect(c.Get(context.TODO(), types.NamespacedName{Namespace: testcase, Name: "foo"}, resourceContext)).Should(BeNil())
+			return len(resourceContext.Spec.Contexts) == 2 && resourceContext.Spec.Contexts[0].ID == 2 &&
+				resourceContext.Spec.Contexts[1].ID == 3
+		}, 5*time.Second, 1*time.Second).Should(BeTrue())
+	})
+
+	It("resource context consistency check of CollaSet", func() {
+		testcase := "test-rc-consistency-collaset"
+		Expect(createNamespace(c, testcase)).Should(BeNil())
+
+		cs := &appsv1alpha1.CollaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testcase,
+				Name:      "foo",
+			},
+			Spec: appsv1alpha1.CollaSetSpec{
+				Replicas: int32Pointer(1),
+				Selector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{
+						"app": "foo",
+					},
+				},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{
+						Labels: map[string]string{
+							"app": "foo",
+						},
+					},
+					Spec: corev1.PodSpec{
+						Containers: []corev1.Container{
+							{
+								Name:  "foo",
+								Image: "nginx:v1",
+							},
+						},
+					},
+				},
+			},
+		}
+		Expect(c.Create(context.TODO(), cs)).Should(BeNil())
+
+		podList := &corev1.PodList{}
+		Eventually(func() bool {
+			Expect(c.List(context.TODO(), podList, client.InNamespace(cs.Namespace))).Should(BeNil())
+			return len(podList.Items) == 1
+		}, 5*time.Second, 1*time.Second).Should(BeTrue())
+		pod := podList.Items[0]
+		id, err := collasetutils.GetPodInstanceID(&pod)
+		Expect(err).Should(BeNil())
+
+		// CollaSet owner is identified even if no revision is recorded, and revision pruned by history limit
+		// is corrected only if the pod is on an existing revision
+		resourceContext := &appsv1alpha1.ResourceContext{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testcase,
+				Name:      "foo",
+			},
+			Spec: appsv1alpha1.ResourceContextSpec{
+				Contexts: []appsv1alpha1.ContextDetail{
+					{ID: id, Data: map[string]string{"Owner": "foo", "Revision": "foo-pruned"}},
+					{ID: id + 1, Data: map[string]string{"Owner": "foo", "Revision": "foo-pruned", "ScaleIn": "true"}},
+					{ID: id + 2, Data: map[string]string{"Owner": "foo", "ScaleIn": "true"}},
+				},
+			},
+		}
+		r := &ResourceContextReconciler{ReconcilerMixin: mixin.NewReconcilerMixin(controllerName, mgr)}
+		result, err := r.checkCollaSetOwner(context.TODO(), resourceContext, "foo")
+		Expect(err).Should(BeNil())
+		Expect(result).ShouldNot(BeNil())
+		Expect(result.orphanedOwner).Should(BeFalse())
+		Expect(result.staleRevisionIDs).Should(BeEquivalentTo([]int{id}))
+
+		// owners not found without revision are not taken as CollaSets
+		resourceContext.Spec.Contexts = []appsv1alpha1.ContextDetail{
+			{ID: 0, Data: map[string]string{"Owner": "shard-controller"}},
+		}
+		result, err = r.checkCollaSetOwner(context.TODO(), resourceContext, "shard-controller")
+		Expect(err).Should(BeNil())
+		Expect(result).Should(BeNil())
+	})
 })
 
 func expectedStatusReplicas(c client.Client, cls *appsv1alpha1.CollaSet, scheduledReplicas, readyReplicas, availableReplicas, replicas, updatedReplicas, operatingReplicas,
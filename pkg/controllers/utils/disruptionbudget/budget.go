@@ -0,0 +1,237 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package disruptionbudget
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+	"kusionstack.io/kuperator/pkg/utils/inject"
+)
+
+// HolderPodOpsLifecycle is the holder of slots reserved by PodOpsLifecycle controller
+const HolderPodOpsLifecycle = "PodOpsLifecycle"
+
+// PodKey is the key of pod in reservations of DisruptionBudget
+func PodKey(pod *corev1.Pod) string {
+	return fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
+}
+
+// GetMatchedBudgets returns DisruptionBudgets selecting the pod.
+// Only budgets in the namespace of pod and budgets selecting namespaces are listed, by index of the namespaces they select.
+// No budget is returned if DisruptionBudget is not installed.
+func GetMatchedBudgets(ctx context.Context, c client.Client, pod *corev1.Pod) ([]*kuperatorv1alpha1.DisruptionBudget, error) {
+	namespacedList := &kuperatorv1alpha1.DisruptionBudgetList{}
+	if err := c.List(ctx, namespacedList, client.InNamespace(pod.Namespace),
+		client.MatchingFields{inject.FieldIndexDisruptionBudgetNamespace: pod.Namespace}); err != nil {
+		if meta.IsNoMatchError(err) || runtime.IsNotRegisteredError(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("fail to list DisruptionBudgets in namespace %s: %s", pod.Namespace, err)
+	}
+	crossNamespaceList := &kuperatorv1alpha1.DisruptionBudgetList{}
+	if err := c.List(ctx, crossNamespaceList,
+		client.MatchingFields{inject.FieldIndexDisruptionBudgetNamespace: inject.AllNamespacesIndexValue}); err != nil {
+		return nil, fmt.Errorf("fail to list DisruptionBudgets selecting namespaces: %s", err)
+	}
+
+	var namespaceLabels map[string]string
+	for i := range crossNamespaceList.Items {
+		if crossNamespaceList.Items[i].Spec.NamespaceSelector != nil {
+			namespace := &corev1.Namespace{}
+			if err := c.Get(ctx, types.NamespacedName{Name: pod.Namespace}, namespace); err != nil {
+				return nil, fmt.Errorf("fail to get namespace %s: %s", pod.Namespace, err)
+			}
+			namespaceLabels = namespace.Labels
+			break
+		}
+	}
+
+	var budgets []*kuperatorv1alpha1.DisruptionBudget
+	visited := sets.NewString()
+	for _, items := range [][]kuperatorv1alpha1.DisruptionBudget{namespacedList.Items, crossNamespaceList.Items} {
+		for i := range items {
+			budget := &items[i]
+			key := fmt.Sprintf("%s/%s", budget.Namespace, budget.Name)
+			if visited.Has(key) {
+				continue
+			}
+			visited.Insert(key)
+			matched, err := MatchPod(budget, pod, namespaceLabels)
+			if err != nil {
+				return nil, err
+			}
+			if matched {
+				budgets = append(budgets, budget)
+			}
+		}
+	}
+	return budgets, nil
+}
+
+// MatchNamespace returns true if the budget selects pods in the namespace
+func MatchNamespace(budget *kuperatorv1alpha1.DisruptionBudget, namespace string, namespaceLabels map[string]string) (bool, error) {
+	if budget.Spec.NamespaceSelector == nil {
+		return budget.Namespace == namespace, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(budget.Spec.NamespaceSelector)
+	if err != nil {
+		return false, fmt.Errorf("invalid namespaceSelector of DisruptionBudget %s/%s: %s", budget.Namespace, budget.Name, err)
+	}
+	return selector.Matches(labels.Set(namespaceLabels)), nil
+}
+
+// MatchPod returns true if the budget selects the pod, with labels of the namespace of pod
+func MatchPod(budget *kuperatorv1alpha1.DisruptionBudget, pod *corev1.Pod, namespaceLabels map[string]string) (bool, error) {
+	if matched, err := MatchNamespace(budget, pod.Namespace, namespaceLabels); err != nil || !matched {
+		return false, err
+	}
+	if budget.Spec.Selector == nil {
+		return false, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(budget.Spec.Selector)
+	if err != nil {
+		return false, fmt.Errorf("invalid selector of DisruptionBudget %s/%s: %s", budget.Namespace, budget.Name, err)
+	}
+	return selector.Matches(labels.Set(pod.Labels)), nil
+}
+
+// MaxUnavailable returns the max unavailable scaled by total pods of budget,
+// which is total pods minus min available if MinAvailable is set instead of MaxUnavailable.
+func MaxUnavailable(budget *kuperatorv1alpha1.DisruptionBudget) (int, error) {
+	total := int(budget.Status.TotalPods)
+	if budget.Spec.MaxUnavailable != nil {
+		return intstr.GetScaledValueFromIntOrPercent(budget.Spec.MaxUnavailable, total, true)
+	}
+	if budget.Spec.MinAvailable != nil {
+		minAvailable, err := intstr.GetScaledValueFromIntOrPercent(budget.Spec.MinAvailable, total, true)
+		if err != nil {
+			return 0, err
+		}
+		if minAvailable > total {
+			return 0, nil
+		}
+		return total - minAvailable, nil
+	}
+	return 0, nil
+}
+
+// DisruptionsAllowed returns the number of pods which can be reserved currently
+func DisruptionsAllowed(budget *kuperatorv1alpha1.DisruptionBudget) (int, error) {
+	maxUnavailable, err := MaxUnavailable(budget)
+	if err != nil {
+		return 0, err
+	}
+	allowed := maxUnavailable - int(budget.Status.UnavailablePods) - len(budget.Status.Reservations)
+	if allowed < 0 {
+		allowed = 0
+	}
+	return allowed, nil
+}
+
+// IsReserved returns true if a slot of budget is reserved by the pod
+func IsReserved(budget *kuperatorv1alpha1.DisruptionBudget, podKey string) bool {
+	for _, reservation := range budget.Status.Reservations {
+		if reservation.Pod == podKey {
+			return true
+		}
+	}
+	return false
+}
+
+// Reserve reserves a slot of budget for the pod, which is idempotent for the same pod no matter the holder.
+// The reservation is updated to status with optimistic concurrency, and retried on conflict,
+// so that concurrent reservations never exceed the budget. created is true only if the slot is reserved by this call
+// rather than held by the pod before, so that callers rolling back release only the slots they reserved.
+func Reserve(ctx context.Context, c client.Client, key types.NamespacedName, pod *corev1.Pod, holder string) (reserved, created bool, msg string, err error) {
+	podKey := PodKey(pod)
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		budget := &kuperatorv1alpha1.DisruptionBudget{}
+		if err := c.Get(ctx, key, budget); err != nil {
+			return err
+		}
+		if IsReserved(budget, podKey) {
+			reserved, created = true, false
+			return nil
+		}
+		allowed, err := DisruptionsAllowed(budget)
+		if err != nil {
+			return err
+		}
+		if allowed <= 0 {
+			reserved, created = false, false
+			msg = fmt.Sprintf("no disruption allowed by DisruptionBudget %s: [total]=%d, [unavailable]=%d, [reserved]=%d",
+				key, budget.Status.TotalPods, budget.Status.UnavailablePods, len(budget.Status.Reservations))
+			return nil
+		}
+		budget.Status.Reservations = append(budget.Status.Reservations, kuperatorv1alpha1.DisruptionReservation{
+			Pod:         podKey,
+			Holder:      holder,
+			ReserveTime: metav1.Now(),
+		})
+		budget.Status.DisruptionsAllowed = int32(allowed - 1)
+		if err := c.Status().Update(ctx, budget); err != nil {
+			return err
+		}
+		reserved, created = true, true
+		return nil
+	})
+	if err != nil {
+		return false, false, "", fmt.Errorf("fail to reserve DisruptionBudget %s for pod %s: %s", key, podKey, err)
+	}
+	return reserved, created, msg, nil
+}
+
+// Release releases the slot of budget reserved by the pod
+func Release(ctx context.Context, c client.Client, key types.NamespacedName, podKey string) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		budget := &kuperatorv1alpha1.DisruptionBudget{}
+		if err := c.Get(ctx, key, budget); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if !IsReserved(budget, podKey) {
+			return nil
+		}
+		var reservations []kuperatorv1alpha1.DisruptionReservation
+		for _, reservation := range budget.Status.Reservations {
+			if reservation.Pod != podKey {
+				reservations = append(reservations, reservation)
+			}
+		}
+		budget.Status.Reservations = reservations
+		if allowed, err := DisruptionsAllowed(budget); err == nil {
+			budget.Status.DisruptionsAllowed = int32(allowed)
+		}
+		return c.Status().Update(ctx, budget)
+	})
+	if err != nil {
+		return fmt.Errorf("fail to release DisruptionBudget %s for pod %s: %s", key, podKey, err)
+	}
+	return nil
+}
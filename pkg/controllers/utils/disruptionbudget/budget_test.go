@@ -0,0 +1,125 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package disruptionbudget
+
+import (
+	"context"
+	"testing"
+
+	"github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+)
+
+func newPod(namespace, name string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels:    map[string]string{"app": "middleware"},
+		},
+	}
+}
+
+func TestReserve(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	sch := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(sch)).Should(gomega.BeNil())
+	g.Expect(kuperatorv1alpha1.AddToScheme(sch)).Should(gomega.BeNil())
+
+	maxUnavailable := intstr.FromString("50%")
+	budget := &kuperatorv1alpha1.DisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "middleware"},
+		Spec: kuperatorv1alpha1.DisruptionBudgetSpec{
+			Selector:          &metav1.LabelSelector{MatchLabels: map[string]string{"app": "middleware"}},
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "middleware"}},
+			MaxUnavailable:    &maxUnavailable,
+		},
+		Status: kuperatorv1alpha1.DisruptionBudgetStatus{TotalPods: 4, UnavailablePods: 1},
+	}
+	c := fake.NewClientBuilder().WithScheme(sch).WithObjects(
+		budget,
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"team": "middleware"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b"}},
+	).Build()
+	key := types.NamespacedName{Namespace: "default", Name: "middleware"}
+
+	// budget is selected across namespaces
+	budgets, err := GetMatchedBudgets(context.TODO(), c, newPod("team-a", "pod-a"))
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(len(budgets)).Should(gomega.Equal(1))
+	budgets, err = GetMatchedBudgets(context.TODO(), c, newPod("team-b", "pod-a"))
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(len(budgets)).Should(gomega.Equal(0))
+
+	// 2 max unavailable, 1 unavailable, so only 1 pod can be reserved
+	reserved, created, _, err := Reserve(context.TODO(), c, key, newPod("team-a", "pod-a"), "PodTransitionRule/team-a/rule")
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(reserved).Should(gomega.BeTrue())
+	g.Expect(created).Should(gomega.BeTrue())
+	// slot held before is not created again
+	reserved, created, _, err = Reserve(context.TODO(), c, key, newPod("team-a", "pod-a"), HolderPodOpsLifecycle)
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(reserved).Should(gomega.BeTrue())
+	g.Expect(created).Should(gomega.BeFalse())
+	reserved, created, msg, err := Reserve(context.TODO(), c, key, newPod("team-a", "pod-b"), HolderPodOpsLifecycle)
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(reserved).Should(gomega.BeFalse())
+	g.Expect(created).Should(gomega.BeFalse())
+	g.Expect(msg).Should(gomega.ContainSubstring("no disruption allowed"))
+
+	// slot is reusable after released
+	g.Expect(Release(context.TODO(), c, key, "team-a/pod-a")).Should(gomega.BeNil())
+	reserved, created, _, err = Reserve(context.TODO(), c, key, newPod("team-a", "pod-b"), HolderPodOpsLifecycle)
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(reserved).Should(gomega.BeTrue())
+	g.Expect(created).Should(gomega.BeTrue())
+
+	g.Expect(c.Get(context.TODO(), key, budget)).Should(gomega.BeNil())
+	g.Expect(len(budget.Status.Reservations)).Should(gomega.Equal(1))
+	g.Expect(budget.Status.Reservations[0].Pod).Should(gomega.Equal("team-a/pod-b"))
+	g.Expect(budget.Status.DisruptionsAllowed).Should(gomega.BeEquivalentTo(0))
+}
+
+func TestMaxUnavailable(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	budget := &kuperatorv1alpha1.DisruptionBudget{
+		Status: kuperatorv1alpha1.DisruptionBudgetStatus{TotalPods: 4, UnavailablePods: 1},
+	}
+
+	// min available is converted to max unavailable by total pods
+	for value, expected := range map[string]int{"3": 1, "75%": 1, "60%": 1, "5": 0} {
+		minAvailable := intstr.Parse(value)
+		budget.Spec.MinAvailable = &minAvailable
+		maxUnavailable, err := MaxUnavailable(budget)
+		g.Expect(err).Should(gomega.BeNil())
+		g.Expect(maxUnavailable).Should(gomega.Equal(expected), value)
+	}
+
+	minAvailable := intstr.FromInt(2)
+	budget.Spec.MinAvailable = &minAvailable
+	allowed, err := DisruptionsAllowed(budget)
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(allowed).Should(gomega.Equal(1))
+}
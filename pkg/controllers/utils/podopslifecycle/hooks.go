@@ -0,0 +1,36 @@
+/*
+ Copyright 2024 The KusionStack Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package podopslifecycle
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+)
+
+// deleteLifecycleHookStatus removes the progress of hooks of the lifecycle of adapter from the pod
+func deleteLifecycleHookStatus(adapter LifecycleAdapter, obj client.Object) bool {
+	annotations := obj.GetAnnotations()
+	key := fmt.Sprintf("%s/%s", kuperatorv1alpha1.PodOpsLifecycleHookStatusAnnoPrefix, adapter.GetID())
+	if _, ok := annotations[key]; !ok {
+		return false
+	}
+	delete(annotations, key)
+	return true
+}
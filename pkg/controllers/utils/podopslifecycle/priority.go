@@ -0,0 +1,121 @@
+/*
+ Copyright 2024 The KusionStack Authors.
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package podopslifecycle
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"kusionstack.io/kube-api/apps/v1alpha1"
+)
+
+var (
+	prioritiesLock sync.RWMutex
+	// operationTypePriorities are priorities of OperationTypes. The priority of types not set is 0.
+	operationTypePriorities = map[OperationType]int32{}
+)
+
+// SetOperationTypePriority sets the priority of OperationType. When beginning a lifecycle, the lifecycles of lower
+// priority still preparing are canceled, and it waits if any lifecycle of higher priority is on the pod.
+func SetOperationTypePriority(operationType OperationType, priority int32) {
+	prioritiesLock.Lock()
+	defer prioritiesLock.Unlock()
+	operationTypePriorities[operationType] = priority
+}
+
+// SetOperationTypePriorities parses priorities in the format of json map from OperationType to priority,
+// like {"delete": 100, "update": 10}
+func SetOperationTypePriorities(value string) error {
+	if value == "" {
+		return nil
+	}
+	priorities := map[OperationType]int32{}
+	if err := json.Unmarshal([]byte(value), &priorities); err != nil {
+		return fmt.Errorf("fail to parse OperationType priorities: %s", err)
+	}
+	for operationType, priority := range priorities {
+		SetOperationTypePriority(operationType, priority)
+	}
+	return nil
+}
+
+// GetOperationTypePriority returns the priority of OperationType
+func GetOperationTypePriority(operationType OperationType) int32 {
+	prioritiesLock.RLock()
+	defer prioritiesLock.RUnlock()
+	return operationTypePriorities[operationType]
+}
+
+// lifecycleOnObject is a lifecycle on the pod other than the one of adapter
+type lifecycleOnObject struct {
+	id            string
+	operationType OperationType
+	preparing     bool
+}
+
+// otherLifecycles returns the lifecycles not finished on the pod, except the one of adapter
+func otherLifecycles(adapter LifecycleAdapter, obj client.Object) []lifecycleOnObject {
+	var lifecycles []lifecycleOnObject
+	labels := obj.GetLabels()
+	for k, v := range labels {
+		var id string
+		if strings.HasPrefix(k, v1alpha1.PodOperationTypeLabelPrefix+"/") {
+			id = strings.TrimPrefix(k, v1alpha1.PodOperationTypeLabelPrefix+"/")
+		} else if strings.HasPrefix(k, v1alpha1.PodDoneOperationTypeLabelPrefix+"/") {
+			id = strings.TrimPrefix(k, v1alpha1.PodDoneOperationTypeLabelPrefix+"/")
+		}
+		if id == "" || id == adapter.GetID() {
+			continue
+		}
+		if _, undo := labels[fmt.Sprintf("%s/%s", v1alpha1.PodUndoOperationTypeLabelPrefix, id)]; undo {
+			continue
+		}
+		_, operate := labels[fmt.Sprintf("%s/%s", v1alpha1.PodOperateLabelPrefix, id)]
+		_, operated := labels[fmt.Sprintf("%s/%s", v1alpha1.PodOperatedLabelPrefix, id)]
+		lifecycles = append(lifecycles, lifecycleOnObject{
+			id:            id,
+			operationType: OperationType(v),
+			preparing:     !operate && !operated,
+		})
+	}
+	return lifecycles
+}
+
+// preemptLifecycles cancels the lifecycles of lower priority which are still preparing, or returns wait
+// if the lifecycle of adapter should wait for ones of higher priority. The owners of canceled lifecycles
+// watching the pod are requeued by the pod update, and wait until the lifecycle of adapter is finished.
+func preemptLifecycles(adapter LifecycleAdapter, obj client.Object) (preempted []string, wait bool) {
+	priority := GetOperationTypePriority(adapter.GetType())
+	others := otherLifecycles(adapter, obj)
+	for _, other := range others {
+		if GetOperationTypePriority(other.operationType) > priority {
+			return nil, true
+		}
+	}
+
+	for _, other := range others {
+		if other.preparing && GetOperationTypePriority(other.operationType) < priority {
+			obj.GetLabels()[fmt.Sprintf("%s/%s", v1alpha1.PodUndoOperationTypeLabelPrefix, other.id)] = string(other.operationType)
+			preempted = append(preempted, other.id)
+		}
+	}
+	return preempted, false
+}
@@ -38,7 +38,18 @@ func IsDuringOps(adapter LifecycleAdapter, obj client.Object) bool {
 	return hasID && hasType
 }
 
-// Begin is used for an CRD Operator to begin a lifecycle
+// IsPodOperating returns true if any lifecycle is operating on the obj, no matter which adapter begins it
+func IsPodOperating(obj client.Object) bool {
+	for key := range obj.GetLabels() {
+		if strings.HasPrefix(key, v1alpha1.PodOperatingLabelPrefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Begin is used for an CRD Operator to begin a lifecycle.
+// It returns false without error if any lifecycle of higher OperationType priority is on the pod.
 func Begin(c client.Client, adapter LifecycleAdapter, obj client.Object, updateFunc ...UpdateFunc) (updated bool, err error) {
 	if obj.GetLabels() == nil {
 		obj.SetLabels(map[string]string{})
@@ -62,9 +73,20 @@ func Begin(c client.Client, adapter LifecycleAdapter, obj client.Object, updateF
 			return
 		}
 
+		// wait for lifecycles of higher priority, and cancel ones of lower priority still preparing
+		preempted, wait := preemptLifecycles(adapter, obj)
+		if wait {
+			return false, nil
+		}
+		if len(preempted) > 0 {
+			needUpdate = true
+		}
+
 		if !hasID {
 			needUpdate = true
 			setOperatingID(adapter, obj)
+			// drop progress of hooks left by a former lifecycle with the same ID
+			deleteLifecycleHookStatus(adapter, obj)
 		}
 		if !hasType {
 			needUpdate = true
@@ -126,6 +148,9 @@ func Finish(c client.Client, adapter LifecycleAdapter, obj client.Object, update
 		needUpdate = true
 		deleteOperatingID(adapter, obj)
 	}
+	if deleteLifecycleHookStatus(adapter, obj) {
+		needUpdate = true
+	}
 
 	updated, err = DefaultUpdateAll(obj, append(updateFunc, adapter.WhenFinish)...)
 	if err != nil {
@@ -139,6 +164,16 @@ func Finish(c client.Client, adapter LifecycleAdapter, obj client.Object, update
 	return false, err
 }
 
+// SetUndo sets the undo label of the lifecycle on obj, so that the lifecycle is cancelled and its labels are cleaned up
+func SetUndo(obj client.Object, id string, operationType OperationType) {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+		obj.SetLabels(labels)
+	}
+	labels[fmt.Sprintf("%s/%s", v1alpha1.PodUndoOperationTypeLabelPrefix, id)] = string(operationType)
+}
+
 func checkOperatingID(adapter LifecycleAdapter, obj client.Object) (val string, ok bool) {
 	labelID := fmt.Sprintf("%s/%s", v1alpha1.PodOperatingLabelPrefix, adapter.GetID())
 	_, ok = obj.GetLabels()[labelID]
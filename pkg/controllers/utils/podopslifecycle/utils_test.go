@@ -31,6 +31,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 
 	"kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 )
 
 const (
@@ -119,15 +120,111 @@ func TestLifecycle(t *testing.T) {
 		g.Expect(err).Should(gomega.BeNil())
 		g.Expect(started).Should(gomega.BeTrue())
 		g.Expect(IsDuringOps(a, pod)).Should(gomega.BeTrue())
+		g.Expect(IsPodOperating(pod)).Should(gomega.BeTrue())
 
 		finished, err := Finish(c, a, pod)
 		g.Expect(err).Should(gomega.BeNil())
 		g.Expect(finished).Should(gomega.BeTrue())
 		g.Expect(pod.Labels[mockLabelKey]).Should(gomega.BeEquivalentTo(""))
 		g.Expect(IsDuringOps(a, pod)).Should(gomega.BeFalse())
+		g.Expect(IsPodOperating(pod)).Should(gomega.BeFalse())
 	}
 }
 
+func TestLifecyclePriority(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	g := gomega.NewGomegaWithT(t)
+
+	allowTypes = true
+	defer func() {
+		allowTypes = false
+	}()
+	g.Expect(SetOperationTypePriorities(`{"type-drain": 100, "type-update": 10}`)).Should(gomega.BeNil())
+	defer func() {
+		SetOperationTypePriority("type-drain", 0)
+		SetOperationTypePriority("type-update", 0)
+	}()
+
+	update := &mockAdapter{id: "id-update", operationType: "type-update"}
+	drain := &mockAdapter{id: "id-drain", operationType: "type-drain"}
+	other := &mockAdapter{id: "id-other", operationType: "type-other"}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testNamespace,
+			Name:      "pod-priority",
+			Labels:    map[string]string{},
+		},
+	}
+	g.Expect(c.Create(context.TODO(), pod)).Should(gomega.BeNil())
+
+	// lifecycle of higher priority preempts the one still preparing
+	started, err := Begin(c, update, pod)
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(started).Should(gomega.BeTrue())
+	started, err = Begin(c, drain, pod)
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(started).Should(gomega.BeTrue())
+	g.Expect(pod.Labels[fmt.Sprintf("%s/%s", v1alpha1.PodUndoOperationTypeLabelPrefix, update.GetID())]).Should(gomega.BeEquivalentTo(update.GetType()))
+	g.Expect(IsDuringOps(drain, pod)).Should(gomega.BeTrue())
+
+	// lifecycles of lower priority wait
+	delete(pod.Labels, fmt.Sprintf("%s/%s", v1alpha1.PodUndoOperationTypeLabelPrefix, update.GetID()))
+	delete(pod.Labels, fmt.Sprintf("%s/%s", v1alpha1.PodOperatingLabelPrefix, update.GetID()))
+	delete(pod.Labels, fmt.Sprintf("%s/%s", v1alpha1.PodOperationTypeLabelPrefix, update.GetID()))
+	for _, adapter := range []*mockAdapter{update, other} {
+		started, err = Begin(c, adapter, pod)
+		g.Expect(err).Should(gomega.BeNil())
+		g.Expect(started).Should(gomega.BeFalse())
+		g.Expect(IsDuringOps(adapter, pod)).Should(gomega.BeFalse())
+	}
+
+	// lifecycle of lower priority is not preempted after it starts to operate
+	_, err = Finish(c, drain, pod)
+	g.Expect(err).Should(gomega.BeNil())
+	pod.Labels = map[string]string{}
+	_, err = Begin(c, update, pod)
+	g.Expect(err).Should(gomega.BeNil())
+	setOperate(update, pod)
+	started, err = Begin(c, drain, pod)
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(started).Should(gomega.BeTrue())
+	g.Expect(pod.Labels).ShouldNot(gomega.HaveKey(fmt.Sprintf("%s/%s", v1alpha1.PodUndoOperationTypeLabelPrefix, update.GetID())))
+}
+
+func TestLifecycleHookStatus(t *testing.T) {
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	g := gomega.NewGomegaWithT(t)
+
+	a := &mockAdapter{id: "id-hook", operationType: "type-1"}
+	statusKey := fmt.Sprintf("%s/%s", kuperatorv1alpha1.PodOpsLifecycleHookStatusAnnoPrefix, a.GetID())
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: testNamespace,
+			Name:      "pod-hook",
+			Labels:    map[string]string{},
+			Annotations: map[string]string{
+				// left by a former lifecycle with the same ID
+				statusKey: `[{"name":"deregister","stage":"Preparing","phase":"Succeeded"}]`,
+			},
+		},
+	}
+	g.Expect(c.Create(context.TODO(), pod)).Should(gomega.BeNil())
+
+	// progress of former lifecycle is dropped
+	started, err := Begin(c, a, pod)
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(started).Should(gomega.BeTrue())
+	g.Expect(pod.Annotations).ShouldNot(gomega.HaveKey(statusKey))
+
+	// progress is removed when lifecycle is finished
+	pod.Annotations[statusKey] = `[{"name":"deregister","stage":"Preparing","phase":"Succeeded"}]`
+	finished, err := Finish(c, a, pod)
+	g.Expect(err).Should(gomega.BeNil())
+	g.Expect(finished).Should(gomega.BeTrue())
+	g.Expect(pod.Annotations).ShouldNot(gomega.HaveKey(statusKey))
+}
+
 type mockAdapter struct {
 	id            string
 	operationType OperationType
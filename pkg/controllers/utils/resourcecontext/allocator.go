@@ -0,0 +1,349 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourcecontext
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+)
+
+const (
+	// OwnerContextKey is the data key of ContextDetail recording which owner holds the ID
+	OwnerContextKey = "Owner"
+
+	// OwnerQuotasAnnoKey is annotated on ResourceContext to limit the number of IDs each owner can hold,
+	// in the format of json map from owner to quota, like {"foo": 10}.
+	OwnerQuotasAnnoKey = "resourcecontext.kusionstack.io/owner-quotas"
+)
+
+// AllocateOptions controls how new IDs are allocated to an owner.
+type AllocateOptions struct {
+	// Quota limits the number of IDs the owner can hold, 0 means unlimited.
+	// The smaller one takes effect if quota is also annotated on ResourceContext.
+	Quota int
+	// Contiguous requires IDs allocated in one call to be a contiguous range.
+	Contiguous bool
+	// NewData returns the initial data of a newly allocated ID, besides owner.
+	NewData func(id int) map[string]string
+}
+
+// QuotaExceededError is returned if the owner requires more IDs than its quota.
+type QuotaExceededError struct {
+	Owner    string
+	Quota    int
+	Required int
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("owner %s requires %d IDs, exceeding its quota %d", e.Owner, e.Required, e.Quota)
+}
+
+func IsQuotaExceeded(err error) bool {
+	_, ok := err.(*QuotaExceededError)
+	return ok
+}
+
+// OwnedIDs returns the IDs held by owner in ResourceContext.
+func OwnedIDs(rc *appsv1alpha1.ResourceContext, owner string) map[int]*appsv1alpha1.ContextDetail {
+	ownedIDs := map[int]*appsv1alpha1.ContextDetail{}
+	for i := range rc.Spec.Contexts {
+		detail := &rc.Spec.Contexts[i]
+		if detail.Contains(OwnerContextKey, owner) {
+			ownedIDs[detail.ID] = detail
+		}
+	}
+	return ownedIDs
+}
+
+// AllocateIDs makes owner hold at least replicas IDs in ResourceContext, and returns all the IDs held by owner.
+// New IDs are appended to rc.Spec.Contexts, which is supposed to be persisted by caller.
+func AllocateIDs(rc *appsv1alpha1.ResourceContext, owner string, replicas int, opts *AllocateOptions) (map[int]*appsv1alpha1.ContextDetail, error) {
+	if opts == nil {
+		opts = &AllocateOptions{}
+	}
+
+	// store all the IDs crossing multiple owners
+	existingIDs := map[int]*appsv1alpha1.ContextDetail{}
+	// only store the IDs belonging to this owner
+	ownedIDs := map[int]*appsv1alpha1.ContextDetail{}
+	for i := range rc.Spec.Contexts {
+		detail := &rc.Spec.Contexts[i]
+		if detail.Contains(OwnerContextKey, owner) {
+			ownedIDs[detail.ID] = detail
+		}
+		existingIDs[detail.ID] = detail
+	}
+
+	// if owner has enough ID, return
+	if len(ownedIDs) >= replicas {
+		return ownedIDs, nil
+	}
+
+	quota, err := getOwnerQuota(rc, owner, opts)
+	if err != nil {
+		return nil, err
+	}
+	if quota > 0 && replicas > quota {
+		return nil, &QuotaExceededError{Owner: owner, Quota: quota, Required: replicas}
+	}
+
+	policy, err := parseAllocationPolicy(rc)
+	if err != nil {
+		return nil, err
+	}
+	unavailable := func(id int) bool {
+		_, exist := existingIDs[id]
+		return exist || !policy.allowed(id, owner)
+	}
+
+	var newIDs []int
+	if opts.Contiguous {
+		newIDs = findContiguousIDs(unavailable, policy, replicas-len(ownedIDs))
+	} else {
+		newIDs = findIDs(unavailable, policy, owner, replicas-len(ownedIDs))
+	}
+
+	for _, id := range newIDs {
+		data := map[string]string{}
+		if opts.NewData != nil {
+			for k, v := range opts.NewData(id) {
+				data[k] = v
+			}
+		}
+		data[OwnerContextKey] = owner
+		rc.Spec.Contexts = append(rc.Spec.Contexts, appsv1alpha1.ContextDetail{ID: id, Data: data})
+	}
+
+	// keep context detail in order by ID
+	sort.Sort(ContextDetailsByOrder(rc.Spec.Contexts))
+	return OwnedIDs(rc, owner), nil
+}
+
+// SetOwnedIDs replaces the IDs held by owner in ResourceContext with ownedIDs.
+// IDs no longer held by owner are recorded as released if required by reuse policy.
+// Invalid allocation policy does not block owners from releasing IDs, and released IDs are not recorded under it.
+func SetOwnedIDs(rc *appsv1alpha1.ResourceContext, owner string, ownedIDs map[int]*appsv1alpha1.ContextDetail) error {
+	policy, err := parseAllocationPolicy(rc)
+	if err != nil {
+		klog.Warningf("invalid allocation policy of ResourceContext %s/%s, released IDs of %s are not recorded: %s", rc.Namespace, rc.Name, owner, err)
+	}
+
+	// store all IDs crossing all owners
+	existingIDs := map[int]*appsv1alpha1.ContextDetail{}
+	var releasedIDs []int
+	for i := range rc.Spec.Contexts {
+		detail := rc.Spec.Contexts[i]
+		if detail.Contains(OwnerContextKey, owner) {
+			if _, exist := ownedIDs[detail.ID]; !exist {
+				releasedIDs = append(releasedIDs, detail.ID)
+			}
+			continue
+		}
+		existingIDs[detail.ID] = &detail
+	}
+
+	for _, contextDetail := range ownedIDs {
+		existingIDs[contextDetail.ID] = contextDetail
+	}
+
+	rc.Spec.Contexts = make([]appsv1alpha1.ContextDetail, 0, len(existingIDs))
+	for _, contextDetail := range existingIDs {
+		rc.Spec.Contexts = append(rc.Spec.Contexts, *contextDetail)
+	}
+
+	// keep context detail in order by ID
+	sort.Sort(ContextDetailsByOrder(rc.Spec.Contexts))
+	if policy != nil {
+		policy.recordReleased(rc, releasedIDs)
+	}
+	return nil
+}
+
+// ValidateLeaseOwner checks the owner leasing IDs through Lease is in the format of <kind>/<name>,
+// which tells it from CollaSets holding IDs by their names.
+func ValidateLeaseOwner(owner string) error {
+	parts := strings.Split(owner, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("owner %q should be in the format of <kind>/<name>", owner)
+	}
+	return nil
+}
+
+// Lease makes owner hold at least replicas IDs in the ResourceContext identified by key,
+// creating the ResourceContext if not found. It is for controllers which do not manage ResourceContext by themselves,
+// and owner should be in the format of <kind>/<name>.
+func Lease(ctx context.Context, c client.Client, key types.NamespacedName, owner string, replicas int, opts *AllocateOptions) (map[int]*appsv1alpha1.ContextDetail, error) {
+	if err := ValidateLeaseOwner(owner); err != nil {
+		return nil, err
+	}
+
+	var ownedIDs map[int]*appsv1alpha1.ContextDetail
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		rc := &appsv1alpha1.ResourceContext{}
+		notFound := false
+		if err := c.Get(ctx, key, rc); err != nil {
+			if !errors.IsNotFound(err) {
+				return fmt.Errorf("fail to find ResourceContext %s for owner %s: %s", key, owner, err)
+			}
+			notFound = true
+			rc.Namespace = key.Namespace
+			rc.Name = key.Name
+		}
+
+		existingCount := len(rc.Spec.Contexts)
+		var err error
+		if ownedIDs, err = AllocateIDs(rc, owner, replicas, opts); err != nil {
+			return err
+		}
+		if len(rc.Spec.Contexts) == existingCount {
+			return nil
+		}
+
+		if notFound {
+			return c.Create(ctx, rc)
+		}
+		return c.Update(ctx, rc)
+	})
+	return ownedIDs, err
+}
+
+// Release returns IDs held by owner back to the ResourceContext identified by key.
+// ResourceContext is deleted if no IDs are left in it, unless it is annotated with allocation policy.
+func Release(ctx context.Context, c client.Client, key types.NamespacedName, owner string, ids ...int) error {
+	if err := ValidateLeaseOwner(owner); err != nil {
+		return err
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		rc := &appsv1alpha1.ResourceContext{}
+		if err := c.Get(ctx, key, rc); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+
+		ownedIDs := OwnedIDs(rc, owner)
+		for _, id := range ids {
+			delete(ownedIDs, id)
+		}
+		if err := SetOwnedIDs(rc, owner, ownedIDs); err != nil {
+			return err
+		}
+
+		if IsDeletable(rc) {
+			return client.IgnoreNotFound(c.Delete(ctx, rc))
+		}
+		return c.Update(ctx, rc)
+	})
+}
+
+func getOwnerQuota(rc *appsv1alpha1.ResourceContext, owner string, opts *AllocateOptions) (int, error) {
+	quota := opts.Quota
+	if rc.Annotations == nil || rc.Annotations[OwnerQuotasAnnoKey] == "" {
+		return quota, nil
+	}
+
+	quotas := map[string]int{}
+	if err := json.Unmarshal([]byte(rc.Annotations[OwnerQuotasAnnoKey]), &quotas); err != nil {
+		return 0, fmt.Errorf("fail to parse annotation %s of ResourceContext %s/%s: %s", OwnerQuotasAnnoKey, rc.Namespace, rc.Name, err)
+	}
+	if annoQuota, exist := quotas[owner]; exist && (quota == 0 || annoQuota < quota) {
+		quota = annoQuota
+	}
+	return quota, nil
+}
+
+// findIDs prefers IDs reserved for owner, and then the lowest ones following reuse policy
+func findIDs(unavailable func(int) bool, policy *allocationPolicy, owner string, count int) []int {
+	var ids []int
+	var reservedIDs []int
+	for id, reservedOwner := range policy.reserved {
+		if reservedOwner == owner && !unavailable(id) {
+			reservedIDs = append(reservedIDs, id)
+		}
+	}
+	sort.Ints(reservedIDs)
+	for _, id := range reservedIDs {
+		if len(ids) == count {
+			return ids
+		}
+		ids = append(ids, id)
+	}
+
+	chosen := sets.NewInt(ids...)
+	released := sets.NewInt(policy.released...)
+	for candidateID := 0; len(ids) < count; candidateID++ {
+		if unavailable(candidateID) || chosen.Has(candidateID) {
+			continue
+		}
+		// released IDs are at the end of the queue, they are not reused until evicted from history
+		if policy.reusePolicy == ReleasedLastIDReusePolicy && released.Has(candidateID) {
+			continue
+		}
+		ids = append(ids, candidateID)
+	}
+	return ids
+}
+
+func findContiguousIDs(unavailable func(int) bool, policy *allocationPolicy, count int) []int {
+	released := sets.NewInt(policy.released...)
+	blocked := func(id int) bool {
+		return unavailable(id) || (policy.reusePolicy == ReleasedLastIDReusePolicy && released.Has(id))
+	}
+
+	start := 0
+	for {
+		end := start
+		for end < start+count {
+			if blocked(end) {
+				break
+			}
+			end++
+		}
+		if end == start+count {
+			break
+		}
+		// the range is broken by an unavailable ID, search from the next one
+		start = end + 1
+	}
+
+	ids := make([]int, 0, count)
+	for id := start; id < start+count; id++ {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+type ContextDetailsByOrder []appsv1alpha1.ContextDetail
+
+func (s ContextDetailsByOrder) Len() int      { return len(s) }
+func (s ContextDetailsByOrder) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+
+func (s ContextDetailsByOrder) Less(i, j int) bool {
+	l, r := s[i], s[j]
+	return l.ID < r.ID
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourcecontext
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+)
+
+func newResourceContext(owners map[int]string) *appsv1alpha1.ResourceContext {
+	rc := &appsv1alpha1.ResourceContext{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "foo",
+		},
+	}
+	for id, owner := range owners {
+		rc.Spec.Contexts = append(rc.Spec.Contexts, appsv1alpha1.ContextDetail{
+			ID:   id,
+			Data: map[string]string{OwnerContextKey: owner},
+		})
+	}
+	return rc
+}
+
+func assertIDs(t *testing.T, ownedIDs map[int]*appsv1alpha1.ContextDetail, ids ...int) {
+	if len(ownedIDs) != len(ids) {
+		t.Fatalf("expected %d IDs, got %d", len(ids), len(ownedIDs))
+	}
+	for _, id := range ids {
+		if _, exist := ownedIDs[id]; !exist {
+			t.Fatalf("expected ID %d allocated, got %v", id, ownedIDs)
+		}
+	}
+}
+
+func TestAllocateIDs(t *testing.T) {
+	rc := newResourceContext(map[int]string{1: "bar", 3: "bar"})
+
+	ownedIDs, err := AllocateIDs(rc, "foo", 3, &AllocateOptions{
+		NewData: func(id int) map[string]string {
+			return map[string]string{"key": "value"}
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	assertIDs(t, ownedIDs, 0, 2, 4)
+	if !ownedIDs[2].Contains("key", "value") || !ownedIDs[2].Contains(OwnerContextKey, "foo") {
+		t.Fatalf("unexpected data of new ID: %v", ownedIDs[2].Data)
+	}
+	for i := 1; i < len(rc.Spec.Contexts); i++ {
+		if rc.Spec.Contexts[i-1].ID > rc.Spec.Contexts[i].ID {
+			t.Fatalf("contexts are not in order by ID")
+		}
+	}
+
+	// contiguous range skips the gaps among other owners' IDs
+	rc = newResourceContext(map[int]string{1: "bar", 4: "bar"})
+	ownedIDs, err = AllocateIDs(rc, "foo", 3, &AllocateOptions{Contiguous: true})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	assertIDs(t, ownedIDs, 5, 6, 7)
+
+	// quota from options and annotation, the smaller one takes effect
+	rc = newResourceContext(nil)
+	rc.Annotations = map[string]string{OwnerQuotasAnnoKey: `{"foo": 2}`}
+	if _, err = AllocateIDs(rc, "foo", 3, &AllocateOptions{Quota: 5}); !IsQuotaExceeded(err) {
+		t.Fatalf("expected quota exceeded, got %v", err)
+	}
+	if len(rc.Spec.Contexts) != 0 {
+		t.Fatalf("expected no ID allocated when quota exceeded")
+	}
+	ownedIDs, err = AllocateIDs(rc, "bar", 3, &AllocateOptions{Quota: 5})
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	assertIDs(t, ownedIDs, 0, 1, 2)
+}
+
+func TestSetOwnedIDs(t *testing.T) {
+	rc := newResourceContext(map[int]string{0: "foo", 1: "bar", 2: "foo"})
+	ownedIDs := OwnedIDs(rc, "foo")
+	delete(ownedIDs, 0)
+	if err := SetOwnedIDs(rc, "foo", ownedIDs); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+
+	if len(rc.Spec.Contexts) != 2 || rc.Spec.Contexts[0].ID != 1 || rc.Spec.Contexts[1].ID != 2 {
+		t.Fatalf("unexpected contexts %v", rc.Spec.Contexts)
+	}
+}
+
+func TestLeaseAndRelease(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := appsv1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatalf("fail to add scheme: %s", err)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	key := types.NamespacedName{Namespace: "default", Name: "shards"}
+
+	// owner not in the format of <kind>/<name> is taken as CollaSet, and can not lease IDs
+	for _, owner := range []string{"foo", "Deployment/", "apps/Deployment/foo"} {
+		if _, err := Lease(context.TODO(), c, key, owner, 1, nil); err == nil {
+			t.Fatalf("expected err for owner %s", owner)
+		}
+	}
+
+	ownedIDs, err := Lease(context.TODO(), c, key, "Deployment/foo", 2, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	assertIDs(t, ownedIDs, 0, 1)
+
+	ownedIDs, err = Lease(context.TODO(), c, key, "Job/bar", 2, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	assertIDs(t, ownedIDs, 2, 3)
+
+	if err := Release(context.TODO(), c, key, "Deployment/foo", 0, 1); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	rc := &appsv1alpha1.ResourceContext{}
+	if err := c.Get(context.TODO(), key, rc); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	assertIDs(t, OwnedIDs(rc, "Deployment/foo"))
+
+	if err := Release(context.TODO(), c, key, "Job/bar", 2, 3); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if err := c.Get(context.TODO(), key, rc); err == nil {
+		t.Fatalf("expected ResourceContext deleted after all IDs released")
+	}
+
+	// ResourceContext with allocation policy is kept after all IDs released
+	rc = newResourceContext(nil)
+	rc.Name = "policy"
+	rc.Annotations = map[string]string{IDReusePolicyAnnoKey: string(ReleasedLastIDReusePolicy)}
+	if err := c.Create(context.TODO(), rc); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	key = types.NamespacedName{Namespace: rc.Namespace, Name: rc.Name}
+	if _, err := Lease(context.TODO(), c, key, "Deployment/foo", 1, nil); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if err := Release(context.TODO(), c, key, "Deployment/foo", 0); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if err := c.Get(context.TODO(), key, rc); err != nil {
+		t.Fatalf("expected ResourceContext with policy kept, got %s", err)
+	}
+	if len(rc.Spec.Contexts) != 0 || rc.Annotations[ReleasedIDsAnnoKey] != "0" {
+		t.Fatalf("expected no IDs held and ID 0 recorded as released, got %v, %v", rc.Spec.Contexts, rc.Annotations)
+	}
+}
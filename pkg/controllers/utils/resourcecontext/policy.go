@@ -0,0 +1,289 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourcecontext
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+)
+
+const (
+	// ReservedIDsAnnoKey is annotated on ResourceContext to reserve IDs for owners,
+	// in the format of json map from owner to ID ranges, like {"foo": "0-9,20"}.
+	// Reserved IDs are only allocated to their owner, and are preferred by it.
+	ReservedIDsAnnoKey = "resourcecontext.kusionstack.io/reserved-ids"
+	// BlacklistedIDsAnnoKey is annotated on ResourceContext with ID ranges never allocated, like "5,7-8".
+	BlacklistedIDsAnnoKey = "resourcecontext.kusionstack.io/blacklisted-ids"
+
+	// IDReusePolicyAnnoKey is annotated on ResourceContext to decide how released IDs are reused.
+	IDReusePolicyAnnoKey = "resourcecontext.kusionstack.io/id-reuse-policy"
+	// ReleasedIDsAnnoKey records the latest released IDs from the earliest to the latest, like "3,1,2".
+	// It is maintained by allocator under ReleasedLastIDReusePolicy.
+	ReleasedIDsAnnoKey = "resourcecontext.kusionstack.io/released-ids"
+	// ReleasedIDHistoryLimitAnnoKey limits the number of IDs recorded in ReleasedIDsAnnoKey.
+	ReleasedIDHistoryLimitAnnoKey = "resourcecontext.kusionstack.io/released-id-history-limit"
+
+	DefaultReleasedIDHistoryLimit = 10
+)
+
+type IDReusePolicy string
+
+const (
+	// LowestFirstIDReusePolicy always allocates the lowest free ID. It is the default policy.
+	LowestFirstIDReusePolicy IDReusePolicy = "LowestFirst"
+	// ReleasedLastIDReusePolicy puts released IDs at the end of the queue, so that a just-released ID
+	// is not reused until it is evicted from the released history.
+	ReleasedLastIDReusePolicy IDReusePolicy = "ReleasedLast"
+)
+
+// allocationPolicy is parsed from ResourceContext annotations
+type allocationPolicy struct {
+	// reserved maps ID to the owner it is reserved for
+	reserved    map[int]string
+	blacklisted sets.Int
+
+	reusePolicy  IDReusePolicy
+	released     []int
+	historyLimit int
+}
+
+func parseAllocationPolicy(rc *appsv1alpha1.ResourceContext) (*allocationPolicy, error) {
+	policy := &allocationPolicy{
+		reserved:     map[int]string{},
+		blacklisted:  sets.NewInt(),
+		reusePolicy:  LowestFirstIDReusePolicy,
+		historyLimit: DefaultReleasedIDHistoryLimit,
+	}
+	annos := rc.Annotations
+	if annos == nil {
+		return policy, nil
+	}
+
+	if value := annos[ReservedIDsAnnoKey]; value != "" {
+		reservations := map[string]string{}
+		if err := json.Unmarshal([]byte(value), &reservations); err != nil {
+			return nil, fmt.Errorf("fail to parse annotation %s: %s", ReservedIDsAnnoKey, err)
+		}
+		for owner, ranges := range reservations {
+			ids, err := ParseIDRanges(ranges)
+			if err != nil {
+				return nil, fmt.Errorf("fail to parse annotation %s: %s", ReservedIDsAnnoKey, err)
+			}
+			for _, id := range ids.List() {
+				if reservedOwner, exist := policy.reserved[id]; exist && reservedOwner != owner {
+					return nil, fmt.Errorf("ID %d is reserved for both %s and %s", id, reservedOwner, owner)
+				}
+				policy.reserved[id] = owner
+			}
+		}
+	}
+
+	if value := annos[BlacklistedIDsAnnoKey]; value != "" {
+		ids, err := ParseIDRanges(value)
+		if err != nil {
+			return nil, fmt.Errorf("fail to parse annotation %s: %s", BlacklistedIDsAnnoKey, err)
+		}
+		policy.blacklisted = ids
+	}
+
+	if value := annos[IDReusePolicyAnnoKey]; value != "" {
+		switch IDReusePolicy(value) {
+		case LowestFirstIDReusePolicy, ReleasedLastIDReusePolicy:
+			policy.reusePolicy = IDReusePolicy(value)
+		default:
+			return nil, fmt.Errorf("unsupported %s %s", IDReusePolicyAnnoKey, value)
+		}
+	}
+
+	if value := annos[ReleasedIDHistoryLimitAnnoKey]; value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid annotation %s %s", ReleasedIDHistoryLimitAnnoKey, value)
+		}
+		policy.historyLimit = limit
+	}
+
+	if value := annos[ReleasedIDsAnnoKey]; value != "" {
+		for _, item := range strings.Split(value, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(item))
+			if err != nil {
+				return nil, fmt.Errorf("fail to parse annotation %s: %s", ReleasedIDsAnnoKey, err)
+			}
+			policy.released = append(policy.released, id)
+		}
+	}
+	return policy, nil
+}
+
+// policyAnnoKeys are annotations configuring or recording the allocation of ResourceContext
+var policyAnnoKeys = []string{
+	OwnerQuotasAnnoKey,
+	ReservedIDsAnnoKey,
+	BlacklistedIDsAnnoKey,
+	IDReusePolicyAnnoKey,
+	ReleasedIDsAnnoKey,
+	ReleasedIDHistoryLimitAnnoKey,
+}
+
+// HasAllocationPolicy returns true if ResourceContext is annotated with allocation policy or released ID history.
+func HasAllocationPolicy(rc *appsv1alpha1.ResourceContext) bool {
+	for _, key := range policyAnnoKeys {
+		if _, exist := rc.Annotations[key]; exist {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDeletable returns true if ResourceContext holds no IDs, and has no allocation policy to keep.
+func IsDeletable(rc *appsv1alpha1.ResourceContext) bool {
+	return len(rc.Spec.Contexts) == 0 && !HasAllocationPolicy(rc)
+}
+
+// allowed returns false if ID is blacklisted or reserved for other owners
+func (p *allocationPolicy) allowed(id int, owner string) bool {
+	if p.blacklisted.Has(id) {
+		return false
+	}
+	reservedOwner, exist := p.reserved[id]
+	return !exist || reservedOwner == owner
+}
+
+// recordReleased appends released IDs to history, and evicts the earliest ones beyond limit
+func (p *allocationPolicy) recordReleased(rc *appsv1alpha1.ResourceContext, ids []int) {
+	if p.reusePolicy != ReleasedLastIDReusePolicy || len(ids) == 0 {
+		return
+	}
+
+	released := make([]int, 0, len(p.released)+len(ids))
+	newReleased := sets.NewInt(ids...)
+	for _, id := range p.released {
+		if !newReleased.Has(id) {
+			released = append(released, id)
+		}
+	}
+	released = append(released, ids...)
+	if len(released) > p.historyLimit {
+		released = released[len(released)-p.historyLimit:]
+	}
+	p.released = released
+
+	items := make([]string, len(released))
+	for i, id := range released {
+		items[i] = strconv.Itoa(id)
+	}
+	if rc.Annotations == nil {
+		rc.Annotations = map[string]string{}
+	}
+	rc.Annotations[ReleasedIDsAnnoKey] = strings.Join(items, ",")
+}
+
+// ParseIDRanges parses ID ranges like "0-9,20" into a set of IDs.
+func ParseIDRanges(value string) (sets.Int, error) {
+	ids := sets.NewInt()
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		bounds := strings.SplitN(item, "-", 2)
+		start, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid ID range %q", item)
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil {
+				return nil, fmt.Errorf("invalid ID range %q", item)
+			}
+		}
+		if start < 0 || end < start {
+			return nil, fmt.Errorf("invalid ID range %q", item)
+		}
+		for id := start; id <= end; id++ {
+			ids.Insert(id)
+		}
+	}
+	return ids, nil
+}
+
+// ValidateResourceContext checks the allocation policy of ResourceContext, and makes sure IDs newly
+// assigned to owners are neither blacklisted nor reserved for other owners, and owners in the format
+// of <kind>/<name> are well-formed. Invalid policy kept from oldRc does not block the update, so that
+// controllers can still release IDs, and it is returned as warnings instead.
+func ValidateResourceContext(rc, oldRc *appsv1alpha1.ResourceContext) (warnings []string, err error) {
+	policy, err := parseAllocationPolicy(rc)
+	if err != nil {
+		if oldRc == nil || policyChanged(rc, oldRc) {
+			return nil, err
+		}
+		warnings = append(warnings, fmt.Sprintf("invalid allocation policy is kept: %s", err))
+	}
+
+	oldOwners := map[int]string{}
+	if oldRc != nil {
+		for _, detail := range oldRc.Spec.Contexts {
+			oldOwners[detail.ID] = detail.Data[OwnerContextKey]
+		}
+	}
+
+	var errs []string
+	for _, detail := range rc.Spec.Contexts {
+		owner := detail.Data[OwnerContextKey]
+		// IDs assigned before policy changed are kept
+		if oldOwner, exist := oldOwners[detail.ID]; exist && oldOwner == owner {
+			continue
+		}
+		if strings.Contains(owner, "/") {
+			if err := ValidateLeaseOwner(owner); err != nil {
+				errs = append(errs, fmt.Sprintf("ID %d: %s", detail.ID, err))
+				continue
+			}
+		}
+		if policy == nil {
+			continue
+		}
+		if policy.blacklisted.Has(detail.ID) {
+			errs = append(errs, fmt.Sprintf("ID %d is blacklisted", detail.ID))
+		} else if !policy.allowed(detail.ID, owner) {
+			errs = append(errs, fmt.Sprintf("ID %d is reserved for %s, not %s", detail.ID, policy.reserved[detail.ID], owner))
+		}
+	}
+	if len(errs) > 0 {
+		return warnings, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return warnings, nil
+}
+
+// policyChanged returns true if any annotation of allocation policy is changed
+func policyChanged(rc, oldRc *appsv1alpha1.ResourceContext) bool {
+	for _, key := range policyAnnoKeys {
+		value, exist := rc.Annotations[key]
+		oldValue, oldExist := oldRc.Annotations[key]
+		if exist != oldExist || value != oldValue {
+			return true
+		}
+	}
+	return false
+}
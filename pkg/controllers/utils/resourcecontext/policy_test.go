@@ -0,0 +1,162 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourcecontext
+
+import (
+	"testing"
+)
+
+func TestParseIDRanges(t *testing.T) {
+	ids, err := ParseIDRanges("0-2, 5,7-7")
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if ids.Len() != 5 || !ids.HasAll(0, 1, 2, 5, 7) {
+		t.Fatalf("unexpected ids %v", ids.List())
+	}
+
+	for _, invalid := range []string{"a", "3-1", "-1", "1-b"} {
+		if _, err := ParseIDRanges(invalid); err == nil {
+			t.Fatalf("expected err for %q", invalid)
+		}
+	}
+}
+
+func TestAllocateWithReservationAndBlacklist(t *testing.T) {
+	rc := newResourceContext(nil)
+	rc.Annotations = map[string]string{
+		ReservedIDsAnnoKey:    `{"bar": "0-1", "foo": "5"}`,
+		BlacklistedIDsAnnoKey: "2-3",
+	}
+
+	// reserved IDs are preferred by its owner, and others are skipped
+	ownedIDs, err := AllocateIDs(rc, "foo", 3, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	assertIDs(t, ownedIDs, 4, 5, 6)
+
+	ownedIDs, err = AllocateIDs(rc, "bar", 3, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	assertIDs(t, ownedIDs, 0, 1, 7)
+}
+
+func TestReleasedLastReusePolicy(t *testing.T) {
+	rc := newResourceContext(nil)
+	rc.Annotations = map[string]string{
+		IDReusePolicyAnnoKey:          string(ReleasedLastIDReusePolicy),
+		ReleasedIDHistoryLimitAnnoKey: "2",
+	}
+
+	ownedIDs, err := AllocateIDs(rc, "foo", 4, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	assertIDs(t, ownedIDs, 0, 1, 2, 3)
+
+	delete(ownedIDs, 1)
+	if err := SetOwnedIDs(rc, "foo", ownedIDs); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if rc.Annotations[ReleasedIDsAnnoKey] != "1" {
+		t.Fatalf("unexpected released IDs %s", rc.Annotations[ReleasedIDsAnnoKey])
+	}
+
+	// just released ID is not reused
+	ownedIDs, err = AllocateIDs(rc, "foo", 4, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	assertIDs(t, ownedIDs, 0, 2, 3, 4)
+
+	// ID 1 is evicted from history after two more IDs released
+	delete(ownedIDs, 2)
+	delete(ownedIDs, 3)
+	if err := SetOwnedIDs(rc, "foo", ownedIDs); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if rc.Annotations[ReleasedIDsAnnoKey] != "2,3" {
+		t.Fatalf("unexpected released IDs %s", rc.Annotations[ReleasedIDsAnnoKey])
+	}
+	ownedIDs, err = AllocateIDs(rc, "foo", 3, nil)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	assertIDs(t, ownedIDs, 0, 1, 4)
+}
+
+func TestValidateResourceContext(t *testing.T) {
+	old := newResourceContext(map[int]string{2: "foo"})
+	rc := newResourceContext(map[int]string{0: "foo", 2: "foo"})
+	rc.Annotations = map[string]string{
+		ReservedIDsAnnoKey:    `{"bar": "0"}`,
+		BlacklistedIDsAnnoKey: "2",
+	}
+	// ID 2 is held before blacklisted, and ID 0 is reserved for bar
+	if _, err := ValidateResourceContext(rc, old); err == nil {
+		t.Fatalf("expected err for ID reserved for other owner")
+	}
+
+	rc = newResourceContext(map[int]string{2: "foo"})
+	rc.Annotations = map[string]string{BlacklistedIDsAnnoKey: "2"}
+	if _, err := ValidateResourceContext(rc, old); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if _, err := ValidateResourceContext(rc, nil); err == nil {
+		t.Fatalf("expected err for blacklisted ID")
+	}
+
+	rc.Annotations = map[string]string{IDReusePolicyAnnoKey: "Random"}
+	if _, err := ValidateResourceContext(rc, nil); err == nil {
+		t.Fatalf("expected err for unsupported reuse policy")
+	}
+
+	rc = newResourceContext(map[int]string{0: "Deployment/foo", 1: "foo"})
+	if _, err := ValidateResourceContext(rc, nil); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	rc = newResourceContext(map[int]string{0: "apps/Deployment/foo"})
+	if _, err := ValidateResourceContext(rc, nil); err == nil {
+		t.Fatalf("expected err for malformed owner")
+	}
+
+	// invalid policy kept from old one does not block releasing IDs, and is warned
+	old = newResourceContext(map[int]string{0: "foo", 1: "foo"})
+	old.Annotations = map[string]string{IDReusePolicyAnnoKey: "Random"}
+	rc = old.DeepCopy()
+	ownedIDs := OwnedIDs(rc, "foo")
+	delete(ownedIDs, 1)
+	if err := SetOwnedIDs(rc, "foo", ownedIDs); err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(rc.Spec.Contexts) != 1 {
+		t.Fatalf("expected ID 1 released, got %v", rc.Spec.Contexts)
+	}
+	warnings, err := ValidateResourceContext(rc, old)
+	if err != nil {
+		t.Fatalf("unexpected err: %s", err)
+	}
+	if len(warnings) != 1 {
+		t.Fatalf("expected warning for invalid policy, got %v", warnings)
+	}
+	rc.Annotations = map[string]string{IDReusePolicyAnnoKey: "Oldest"}
+	if _, err := ValidateResourceContext(rc, old); err == nil {
+		t.Fatalf("expected err for changing to invalid policy")
+	}
+}
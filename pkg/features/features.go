@@ -30,12 +30,16 @@ const (
 	GraceDeleteWebhook featuregate.Feature = "GraceDeleteWebhook"
 	// ReclaimPodToDelete enables reclaim of collaset.spec.scaleStrategy.podToDelete
 	ReclaimPodToDelete featuregate.Feature = "ReclaimPodToDelete"
+	// ResourceContextConsistencyCheck enables periodic consistency check between ResourceContext and pods
+	ResourceContextConsistencyCheck featuregate.Feature = "ResourceContextConsistencyCheck"
 )
 
 var defaultFeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
 	AlibabaCloudSlb:    {Default: false, PreRelease: featuregate.Alpha},
 	GraceDeleteWebhook: {Default: false, PreRelease: featuregate.Alpha},
 	ReclaimPodToDelete: {Default: true, PreRelease: featuregate.Alpha},
+
+	ResourceContextConsistencyCheck: {Default: false, PreRelease: featuregate.Alpha},
 }
 
 func init() {
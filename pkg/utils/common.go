@@ -22,6 +22,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 )
 
 // DumpJSON returns the JSON encoding
@@ -38,6 +39,18 @@ func ControlledByKusionStack(obj client.Object) bool {
 	return ok && v == "true"
 }
 
+// OpsLifecycleEnabled returns true if the pod is managed by PodOpsLifecycle, either controlled by KusionStack
+// or opted in by label from native workloads.
+func OpsLifecycleEnabled(obj client.Object) bool {
+	if ControlledByKusionStack(obj) {
+		return true
+	}
+	if obj == nil || obj.GetLabels() == nil {
+		return false
+	}
+	return obj.GetLabels()[kuperatorv1alpha1.PodOpsLifecycleEnabledLabelKey] == "true"
+}
+
 func ControlByKusionStack(obj client.Object) {
 	if obj.GetLabels() == nil {
 		obj.SetLabels(map[string]string{})
@@ -18,19 +18,41 @@ package http
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"sync"
 	"time"
+
+	"k8s.io/utils/lru"
 )
 
 const timeout = time.Second * 30
 
+const (
+	SignatureHeader          = "X-Kuperator-Signature"
+	SignatureTimestampHeader = "X-Kuperator-Timestamp"
+)
+
+// Credential authenticates requests to server. Only one of bearer token, client certificate and signing key is used.
+type Credential struct {
+	Token string
+
+	ClientCert []byte
+	ClientKey  []byte
+
+	SigningKey []byte
+}
+
 func ParseResponse(resp *http.Response, data interface{}) error {
 	if resp == nil {
 		return fmt.Errorf("response cannot be nil")
@@ -69,18 +91,87 @@ func DoHttpAndHttpsRequestWithCa(method, url string, body interface{}, header ma
 	return c.Do(req)
 }
 
-func DoHttpAndHttpsRequestWithToken(method, url string, body interface{}, header map[string]string, token string) (*http.Response, error) {
+/*
+DoHttpAndHttpsRequestWithToken authenticates the request by bearer token. Ca with base64
+*/
+func DoHttpAndHttpsRequestWithToken(method, url string, body interface{}, header map[string]string, ca, token string) (*http.Response, error) {
+	return DoHttpAndHttpsRequestWithCredential(context.TODO(), method, url, body, header, ca, &Credential{Token: token})
+}
+
+/*
+DoHttpAndHttpsRequestWithKey authenticates the request by client certificate and key in PEM. Ca with base64
+*/
+func DoHttpAndHttpsRequestWithKey(method, url string, body interface{}, header map[string]string, ca string, cert, key []byte) (*http.Response, error) {
+	return DoHttpAndHttpsRequestWithCredential(context.TODO(), method, url, body, header, ca, &Credential{ClientCert: cert, ClientKey: key})
+}
+
+/*
+DoHttpAndHttpsRequestWithSignature signs the request by HMAC-SHA256 of "{timestamp}.{body}" with signingKey.
+The timestamp and hex signature are set in SignatureTimestampHeader and SignatureHeader. Ca with base64
+*/
+func DoHttpAndHttpsRequestWithSignature(method, url string, body interface{}, header map[string]string, ca string, signingKey []byte) (*http.Response, error) {
+	return DoHttpAndHttpsRequestWithCredential(context.TODO(), method, url, body, header, ca, &Credential{SigningKey: signingKey})
+}
+
+/*
+DoHttpAndHttpsRequestWithCredential authenticates the request by credential, or only verifies server by ca if credential is nil.
+The request is cancelled with ctx.
+*/
+func DoHttpAndHttpsRequestWithCredential(ctx context.Context, method, url string, body interface{}, header map[string]string, ca string, credential *Credential) (*http.Response, error) {
 	req, err := buildReq(method, url, body, header)
 	if err != nil {
 		return nil, err
 	}
-	c, err := DefaultClient.GetClientWithKey(token)
+	req = req.WithContext(ctx)
+
+	var c *http.Client
+	switch {
+	case credential == nil:
+		c, err = DefaultClient.GetClientWithCa(ca)
+	case credential.Token != "":
+		req.Header.Set("Authorization", "Bearer "+credential.Token)
+		c, err = DefaultClient.GetClientWithCa(ca)
+	case len(credential.ClientCert) > 0:
+		c, err = DefaultClient.GetClientWithKey(ca, credential.ClientCert, credential.ClientKey)
+	case len(credential.SigningKey) > 0:
+		if err = signReq(req, credential.SigningKey); err != nil {
+			return nil, err
+		}
+		c, err = DefaultClient.GetClientWithCa(ca)
+	default:
+		return nil, fmt.Errorf("empty credential")
+	}
 	if err != nil {
 		return nil, err
 	}
 	return c.Do(req)
 }
 
+func signReq(req *http.Request, signingKey []byte) error {
+	var payload []byte
+	if req.GetBody != nil {
+		reader, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		if payload, err = io.ReadAll(reader); err != nil {
+			return err
+		}
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(SignatureTimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, "sha256="+Sign(signingKey, timestamp, payload))
+	return nil
+}
+
+// Sign returns hex HMAC-SHA256 of "{timestamp}.{payload}"
+func Sign(signingKey []byte, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, signingKey)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 func buildReq(method, url string, body interface{}, header map[string]string) (*http.Request, error) {
 	buf := &bytes.Buffer{}
 	if body != nil {
@@ -102,16 +193,21 @@ func buildReq(method, url string, body interface{}, header map[string]string) (*
 
 var DefaultClient = newSharedClient()
 
+// maxKeyClients bounds the clients cached by client certificate, so that clients of rotated certificates are evicted
+const maxKeyClients = 128
+
 func newSharedClient() *clientSet {
 	return &clientSet{
 		caClientSet: map[string]*http.Client{},
-		tkClientSet: map[string]*http.Client{},
+		tkClientSet: lru.NewWithEvictionFunc(maxKeyClients, func(_ lru.Key, value interface{}) {
+			value.(*http.Client).CloseIdleConnections()
+		}),
 	}
 }
 
 type clientSet struct {
 	caClientSet map[string]*http.Client
-	tkClientSet map[string]*http.Client
+	tkClientSet *lru.Cache
 	mu          sync.RWMutex
 }
 
@@ -120,28 +216,34 @@ func (s *clientSet) GetClientWithCa(ca string) (c *http.Client, err error) {
 	c, ok := s.caClientSet[ca]
 	s.mu.RUnlock()
 	if !ok {
-		return s.newClient(&ca, nil)
+		return s.newClient(&ca, nil, nil)
 	}
 	return c, nil
 }
 
-func (s *clientSet) GetClientWithKey(key string) (c *http.Client, err error) {
-	s.mu.RLock()
-	c, ok := s.tkClientSet[key]
-	s.mu.RUnlock()
-	if !ok {
-		return s.newClient(nil, &key)
+func (s *clientSet) GetClientWithKey(ca string, cert, key []byte) (c *http.Client, err error) {
+	h := sha256.New()
+	h.Write([]byte(ca))
+	h.Write(cert)
+	h.Write(key)
+	clientKey := hex.EncodeToString(h.Sum(nil))
+	if value, ok := s.tkClientSet.Get(clientKey); ok {
+		return value.(*http.Client), nil
 	}
-	return c, nil
+	certificate, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return nil, err
+	}
+	return s.newClient(&ca, &clientKey, &certificate)
 }
 
 /*
  *  newClient.
  *	Case 1: Different ca use different client.
- *  Case 2: Nil ca use default client which ClientCAs is systemPool
- *  Case 3: Different token use different client and ClientCAs is systemPool
+ *  Case 2: Nil ca use default client which RootCAs is systemPool
+ *  Case 3: Different ca and client certificate use different client, which is cached by key in a bounded LRU
  */
-func (s *clientSet) newClient(ca *string, key *string) (c *http.Client, err error) {
+func (s *clientSet) newClient(ca *string, key *string, certificate *tls.Certificate) (c *http.Client, err error) {
 	var pool *x509.CertPool
 	if ca != nil && *ca != "" && *ca != "Cg==" {
 		pool = x509.NewCertPool()
@@ -153,16 +255,21 @@ func (s *clientSet) newClient(ca *string, key *string) (c *http.Client, err erro
 	}
 	t := &http.Transport{
 		TLSClientConfig: &tls.Config{
-			ClientCAs: pool,
+			RootCAs: pool,
 		},
 	}
+	if certificate != nil {
+		t.TLSClientConfig.Certificates = []tls.Certificate{*certificate}
+	}
 	c = &http.Client{Transport: t, Timeout: timeout}
+	if key != nil {
+		s.tkClientSet.Add(*key, c)
+		return c, nil
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if ca != nil {
 		s.caClientSet[*ca] = c
-	} else if key != nil {
-		s.tkClientSet[*key] = c
 	}
-	return c, err
+	return c, nil
 }
@@ -21,19 +21,27 @@ import (
 
 	appv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apiruntime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 )
 
 const (
 	FieldIndexOwnerRefUID            = "ownerRefUID"
 	FieldIndexPodTransitionRule      = "podTransitionRuleIndex"
 	FieldIndexPodDecorationCollaSets = "podDecorationCollaSets"
+	FieldIndexPodNodeName            = "podNodeName"
+
+	FieldIndexDisruptionBudgetNamespace = "disruptionBudgetNamespace"
+	// AllNamespacesIndexValue is the FieldIndexDisruptionBudgetNamespace value of budgets selecting namespaces by labels
+	AllNamespacesIndexValue = "*"
 )
 
 func NewCacheWithFieldIndex(config *rest.Config, opts cache.Options) (cache.Cache, error) {
@@ -61,6 +69,18 @@ func NewCacheWithFieldIndex(config *rest.Config, opts cache.Options) (cache.Cach
 			return []string{string(ownerRef.UID)}
 		}))
 
+	runtime.Must(c.IndexField(
+		context.TODO(),
+		&corev1.Pod{},
+		FieldIndexPodNodeName,
+		func(pod client.Object) []string {
+			nodeName := pod.(*corev1.Pod).Spec.NodeName
+			if nodeName == "" {
+				return nil
+			}
+			return []string{nodeName}
+		}))
+
 	runtime.Must(c.IndexField(
 		context.TODO(),
 		&corev1.PersistentVolumeClaim{},
@@ -104,5 +124,20 @@ func NewCacheWithFieldIndex(config *rest.Config, opts cache.Options) (cache.Cach
 			return
 		}))
 
+	// DisruptionBudget is optional, and indexed only if it is registered and installed
+	if err := c.IndexField(
+		context.TODO(),
+		&kuperatorv1alpha1.DisruptionBudget{},
+		FieldIndexDisruptionBudgetNamespace,
+		func(obj client.Object) []string {
+			budget := obj.(*kuperatorv1alpha1.DisruptionBudget)
+			if budget.Spec.NamespaceSelector != nil {
+				return []string{AllNamespacesIndexValue}
+			}
+			return []string{budget.Namespace}
+		}); err != nil && !apiruntime.IsNotRegisteredError(err) && !meta.IsNoMatchError(err) {
+		return c, err
+	}
+
 	return c, nil
 }
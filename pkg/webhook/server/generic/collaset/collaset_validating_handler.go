@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"k8s.io/kubernetes/pkg/apis/core"
 
@@ -96,10 +97,68 @@ func (h *ValidatingHandler) validate(cls, oldCls *appsv1alpha1.CollaSet) error {
 	allErrs = append(allErrs, h.validateSelector(cls, fSpec)...)
 	allErrs = append(allErrs, h.validateScaleStrategy(cls, oldCls, fSpec)...)
 	allErrs = append(allErrs, h.validateUpdateStrategy(cls, fSpec)...)
+	allErrs = append(allErrs, h.validateNamingPolicy(cls)...)
+	allErrs = append(allErrs, h.validatePvcSnapshotCleanup(cls)...)
+	allErrs = append(allErrs, utils.ValidateLifecycleHooks(cls)...)
 
 	return allErrs.ToAggregate()
 }
 
+func (h *ValidatingHandler) validateNamingPolicy(cls *appsv1alpha1.CollaSet) field.ErrorList {
+	var allErrs field.ErrorList
+	policy, exist := cls.Annotations[kuperatorv1alpha1.CollaSetNamingPolicyAnnoKey]
+	if !exist {
+		return allErrs
+	}
+
+	switch policy {
+	case kuperatorv1alpha1.RandomNamingPolicy:
+	case kuperatorv1alpha1.InstanceIDNamingPolicy:
+		// new pod of replace update runs alongside the origin one, and can not take the name of it
+		if cls.Spec.UpdateStrategy.PodUpdatePolicy == appsv1alpha1.CollaSetReplacePodUpdateStrategyType {
+			allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "updateStrategy", "podUpdatePolicy"),
+				fmt.Sprintf("%s is not supported with naming policy %s", appsv1alpha1.CollaSetReplacePodUpdateStrategyType, kuperatorv1alpha1.InstanceIDNamingPolicy)))
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(field.NewPath("metadata", "annotations").Key(kuperatorv1alpha1.CollaSetNamingPolicyAnnoKey),
+			policy, []string{kuperatorv1alpha1.RandomNamingPolicy, kuperatorv1alpha1.InstanceIDNamingPolicy}))
+	}
+	return allErrs
+}
+
+func (h *ValidatingHandler) validatePvcSnapshotCleanup(cls *appsv1alpha1.CollaSet) field.ErrorList {
+	var allErrs field.ErrorList
+	fAnnotations := field.NewPath("metadata", "annotations")
+
+	if policy, exist := cls.Annotations[kuperatorv1alpha1.CollaSetPvcSnapshotCleanupPolicyAnnoKey]; exist {
+		fPolicy := fAnnotations.Key(kuperatorv1alpha1.CollaSetPvcSnapshotCleanupPolicyAnnoKey)
+		switch policy {
+		case kuperatorv1alpha1.RetainPvcSnapshotCleanupPolicy,
+			kuperatorv1alpha1.DeleteAfterRestorePvcSnapshotCleanupPolicy:
+		case kuperatorv1alpha1.DeleteWithCollaSetPvcSnapshotCleanupPolicy:
+			// snapshots taken on CollaSet deletion would be garbage collected along with it
+			if retention := cls.Spec.ScaleStrategy.PersistentVolumeClaimRetentionPolicy; retention != nil &&
+				retention.WhenDeleted == kuperatorv1alpha1.SnapshotPersistentVolumeClaimRetentionPolicyType {
+				allErrs = append(allErrs, field.Forbidden(fPolicy, fmt.Sprintf("%s is not supported with whenDeleted retention policy %s",
+					policy, kuperatorv1alpha1.SnapshotPersistentVolumeClaimRetentionPolicyType)))
+			}
+		default:
+			allErrs = append(allErrs, field.NotSupported(fPolicy, policy, []string{
+				kuperatorv1alpha1.RetainPvcSnapshotCleanupPolicy,
+				kuperatorv1alpha1.DeleteAfterRestorePvcSnapshotCleanupPolicy,
+				kuperatorv1alpha1.DeleteWithCollaSetPvcSnapshotCleanupPolicy}))
+		}
+	}
+
+	if value, exist := cls.Annotations[kuperatorv1alpha1.CollaSetPvcSnapshotHistoryLimitAnnoKey]; exist {
+		if limit, err := strconv.Atoi(value); err != nil || limit <= 0 {
+			allErrs = append(allErrs, field.Invalid(fAnnotations.Key(kuperatorv1alpha1.CollaSetPvcSnapshotHistoryLimitAnnoKey),
+				value, "pvc snapshot history limit should be a positive integer"))
+		}
+	}
+	return allErrs
+}
+
 func (h *ValidatingHandler) validateScaleStrategy(cls, oldCls *appsv1alpha1.CollaSet, fSpec *field.Path) field.ErrorList {
 	var allErrs field.ErrorList
 
@@ -112,6 +171,28 @@ func (h *ValidatingHandler) validateScaleStrategy(cls, oldCls *appsv1alpha1.Coll
 		allErrs = append(allErrs, field.Forbidden(fSpec.Child("scaleStrategy", "context"), "scaleStrategy.context is not allowed to be changed"))
 	}
 
+	if policy := cls.Spec.ScaleStrategy.PersistentVolumeClaimRetentionPolicy; policy != nil {
+		fPolicy := fSpec.Child("scaleStrategy", "persistentVolumeClaimRetentionPolicy")
+		allErrs = append(allErrs, validatePvcRetentionPolicyType(policy.WhenScaled, fPolicy.Child("whenScaled"))...)
+		allErrs = append(allErrs, validatePvcRetentionPolicyType(policy.WhenDeleted, fPolicy.Child("whenDeleted"))...)
+	}
+
+	return allErrs
+}
+
+func validatePvcRetentionPolicyType(policyType appsv1alpha1.PersistentVolumeClaimRetentionPolicyType, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	switch policyType {
+	case "",
+		appsv1alpha1.RetainPersistentVolumeClaimRetentionPolicyType,
+		appsv1alpha1.DeletePersistentVolumeClaimRetentionPolicyType,
+		kuperatorv1alpha1.SnapshotPersistentVolumeClaimRetentionPolicyType:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fldPath, policyType, []string{
+			string(appsv1alpha1.RetainPersistentVolumeClaimRetentionPolicyType),
+			string(appsv1alpha1.DeletePersistentVolumeClaimRetentionPolicyType),
+			string(kuperatorv1alpha1.SnapshotPersistentVolumeClaimRetentionPolicyType)}))
+	}
 	return allErrs
 }
 
@@ -82,6 +82,45 @@ func TestValidatingCollaSet(t *testing.T) {
 				},
 			},
 		},
+		{
+			cls: &appsv1alpha1.CollaSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+					Annotations: map[string]string{
+						operatingv1alpha1.CollaSetPvcSnapshotCleanupPolicyAnnoKey: operatingv1alpha1.DeleteAfterRestorePvcSnapshotCleanupPolicy,
+						operatingv1alpha1.CollaSetPvcSnapshotHistoryLimitAnnoKey:  "3",
+					},
+				},
+				Spec: appsv1alpha1.CollaSetSpec{
+					Selector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"app": "foo",
+						},
+					},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: map[string]string{
+								"app": "foo",
+							},
+						},
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{
+									Name:  "foo",
+									Image: "image:v1",
+								},
+							},
+						},
+					},
+					ScaleStrategy: appsv1alpha1.ScaleStrategy{
+						PersistentVolumeClaimRetentionPolicy: &appsv1alpha1.PersistentVolumeClaimRetentionPolicy{
+							WhenScaled:  operatingv1alpha1.SnapshotPersistentVolumeClaimRetentionPolicyType,
+							WhenDeleted: operatingv1alpha1.SnapshotPersistentVolumeClaimRetentionPolicyType,
+						},
+					},
+				},
+			},
+		},
 	}
 
 	validatingHandler := NewValidatingHandler()
@@ -412,6 +451,215 @@ func TestValidatingCollaSet(t *testing.T) {
 				},
 			},
 		},
+		"invalid-naming-policy": {
+			messageKeyWords: "Unsupported value",
+			cls: &appsv1alpha1.CollaSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+					Annotations: map[string]string{
+						operatingv1alpha1.CollaSetNamingPolicyAnnoKey: "Ordinal",
+					},
+				},
+				Spec: appsv1alpha1.CollaSetSpec{
+					Selector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"app": "foo",
+						},
+					},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: map[string]string{
+								"app": "foo",
+							},
+						},
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{
+									Name:  "foo",
+									Image: "image:v1",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"replace-update-with-instance-id-naming-policy": {
+			messageKeyWords: "not supported with naming policy InstanceID",
+			cls: &appsv1alpha1.CollaSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+					Annotations: map[string]string{
+						operatingv1alpha1.CollaSetNamingPolicyAnnoKey: operatingv1alpha1.InstanceIDNamingPolicy,
+					},
+				},
+				Spec: appsv1alpha1.CollaSetSpec{
+					Selector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"app": "foo",
+						},
+					},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: map[string]string{
+								"app": "foo",
+							},
+						},
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{
+									Name:  "foo",
+									Image: "image:v1",
+								},
+							},
+						},
+					},
+					UpdateStrategy: appsv1alpha1.UpdateStrategy{
+						PodUpdatePolicy: appsv1alpha1.CollaSetReplacePodUpdateStrategyType,
+					},
+				},
+			},
+		},
+		"invalid-pvc-retention-policy": {
+			messageKeyWords: "whenDeleted: Unsupported value",
+			cls: &appsv1alpha1.CollaSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: appsv1alpha1.CollaSetSpec{
+					Selector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"app": "foo",
+						},
+					},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: map[string]string{
+								"app": "foo",
+							},
+						},
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{
+									Name:  "foo",
+									Image: "image:v1",
+								},
+							},
+						},
+					},
+					ScaleStrategy: appsv1alpha1.ScaleStrategy{
+						PersistentVolumeClaimRetentionPolicy: &appsv1alpha1.PersistentVolumeClaimRetentionPolicy{
+							WhenScaled:  operatingv1alpha1.SnapshotPersistentVolumeClaimRetentionPolicyType,
+							WhenDeleted: "Backup",
+						},
+					},
+				},
+			},
+		},
+		"invalid-pvc-snapshot-cleanup-policy": {
+			messageKeyWords: "Unsupported value",
+			cls: &appsv1alpha1.CollaSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+					Annotations: map[string]string{
+						operatingv1alpha1.CollaSetPvcSnapshotCleanupPolicyAnnoKey: "Delete",
+					},
+				},
+				Spec: appsv1alpha1.CollaSetSpec{
+					Selector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"app": "foo",
+						},
+					},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: map[string]string{
+								"app": "foo",
+							},
+						},
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{
+									Name:  "foo",
+									Image: "image:v1",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"pvc-snapshot-deleted-with-collaset-taken-on-deletion": {
+			messageKeyWords: "not supported with whenDeleted retention policy Snapshot",
+			cls: &appsv1alpha1.CollaSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+					Annotations: map[string]string{
+						operatingv1alpha1.CollaSetPvcSnapshotCleanupPolicyAnnoKey: operatingv1alpha1.DeleteWithCollaSetPvcSnapshotCleanupPolicy,
+					},
+				},
+				Spec: appsv1alpha1.CollaSetSpec{
+					Selector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"app": "foo",
+						},
+					},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: map[string]string{
+								"app": "foo",
+							},
+						},
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{
+									Name:  "foo",
+									Image: "image:v1",
+								},
+							},
+						},
+					},
+					ScaleStrategy: appsv1alpha1.ScaleStrategy{
+						PersistentVolumeClaimRetentionPolicy: &appsv1alpha1.PersistentVolumeClaimRetentionPolicy{
+							WhenDeleted: operatingv1alpha1.SnapshotPersistentVolumeClaimRetentionPolicyType,
+						},
+					},
+				},
+			},
+		},
+		"invalid-pvc-snapshot-history-limit": {
+			messageKeyWords: "pvc snapshot history limit should be a positive integer",
+			cls: &appsv1alpha1.CollaSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+					Annotations: map[string]string{
+						operatingv1alpha1.CollaSetPvcSnapshotHistoryLimitAnnoKey: "0",
+					},
+				},
+				Spec: appsv1alpha1.CollaSetSpec{
+					Selector: &metav1.LabelSelector{
+						MatchLabels: map[string]string{
+							"app": "foo",
+						},
+					},
+					Template: corev1.PodTemplateSpec{
+						ObjectMeta: metav1.ObjectMeta{
+							Labels: map[string]string{
+								"app": "foo",
+							},
+						},
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{
+									Name:  "foo",
+									Image: "image:v1",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 
 	for key, tc := range failureCases {
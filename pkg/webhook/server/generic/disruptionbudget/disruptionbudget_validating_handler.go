@@ -0,0 +1,101 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package disruptionbudget
+
+import (
+	"context"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+	"kusionstack.io/kuperator/pkg/utils/mixin"
+)
+
+var _ inject.Client = &ValidatingHandler{}
+var _ admission.DecoderInjector = &ValidatingHandler{}
+
+type ValidatingHandler struct {
+	*mixin.WebhookHandlerMixin
+}
+
+func NewValidatingHandler() *ValidatingHandler {
+	return &ValidatingHandler{
+		WebhookHandlerMixin: mixin.NewWebhookHandlerMixin(),
+	}
+}
+
+func (h *ValidatingHandler) Handle(ctx context.Context, req admission.Request) (resp admission.Response) {
+	if req.Operation == admissionv1.Delete {
+		return admission.ValidationResponse(true, "")
+	}
+
+	budget := &kuperatorv1alpha1.DisruptionBudget{}
+	if err := h.Decoder.Decode(req, budget); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	if errList := ValidateDisruptionBudgetSpec(&budget.Spec, field.NewPath("spec")); len(errList) > 0 {
+		return admission.Errored(http.StatusUnprocessableEntity, errList.ToAggregate())
+	}
+	return admission.ValidationResponse(true, "")
+}
+
+// ValidateDisruptionBudgetSpec requires selector, and exactly one of maxUnavailable and minAvailable
+func ValidateDisruptionBudgetSpec(spec *kuperatorv1alpha1.DisruptionBudgetSpec, fldPath *field.Path) field.ErrorList {
+	var errList field.ErrorList
+	if spec.Selector == nil {
+		errList = append(errList, field.Required(fldPath.Child("selector"), "selector is required"))
+	} else {
+		errList = append(errList, metav1validation.ValidateLabelSelector(spec.Selector, fldPath.Child("selector"))...)
+	}
+	if spec.NamespaceSelector != nil {
+		errList = append(errList, metav1validation.ValidateLabelSelector(spec.NamespaceSelector, fldPath.Child("namespaceSelector"))...)
+	}
+
+	switch {
+	case spec.MaxUnavailable == nil && spec.MinAvailable == nil:
+		errList = append(errList, field.Required(fldPath, "one of maxUnavailable and minAvailable is required"))
+	case spec.MaxUnavailable != nil && spec.MinAvailable != nil:
+		errList = append(errList, field.Forbidden(fldPath.Child("minAvailable"), "maxUnavailable and minAvailable cannot be both set"))
+	case spec.MaxUnavailable != nil:
+		errList = append(errList, validateIntOrPercent(spec.MaxUnavailable, fldPath.Child("maxUnavailable"))...)
+	default:
+		errList = append(errList, validateIntOrPercent(spec.MinAvailable, fldPath.Child("minAvailable"))...)
+	}
+	return errList
+}
+
+// validateIntOrPercent requires a non-negative integer, or a percentage between 0% and 100%
+func validateIntOrPercent(value *intstr.IntOrString, fldPath *field.Path) field.ErrorList {
+	scaled, err := intstr.GetScaledValueFromIntOrPercent(value, 100, true)
+	if err != nil {
+		return field.ErrorList{field.Invalid(fldPath, value.String(), err.Error())}
+	}
+	if scaled < 0 {
+		return field.ErrorList{field.Invalid(fldPath, value.String(), "must be non-negative")}
+	}
+	if value.Type == intstr.String && scaled > 100 {
+		return field.ErrorList{field.Invalid(fldPath, value.String(), "must not be greater than 100%")}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package disruptionbudget
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+)
+
+func newDisruptionBudget(maxUnavailable, minAvailable *intstr.IntOrString) *kuperatorv1alpha1.DisruptionBudget {
+	return &kuperatorv1alpha1.DisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo"},
+		Spec: kuperatorv1alpha1.DisruptionBudgetSpec{
+			Selector:       &metav1.LabelSelector{MatchLabels: map[string]string{"app": "foo"}},
+			MaxUnavailable: maxUnavailable,
+			MinAvailable:   minAvailable,
+		},
+	}
+}
+
+func TestValidatingDisruptionBudget(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, kuperatorv1alpha1.AddToScheme(scheme))
+	decoder, err := admission.NewDecoder(scheme)
+	assert.Nil(t, err)
+	h := NewValidatingHandler()
+	assert.Nil(t, h.InjectDecoder(decoder))
+
+	handle := func(operation admissionv1.Operation, budget *kuperatorv1alpha1.DisruptionBudget) admission.Response {
+		req := admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: operation,
+				Namespace: budget.Namespace,
+				Name:      budget.Name,
+			},
+		}
+		raw, err := json.Marshal(budget)
+		assert.Nil(t, err)
+		req.Object.Raw = raw
+		return h.Handle(context.TODO(), req)
+	}
+
+	one := intstr.FromInt(1)
+	half := intstr.FromString("50%")
+	for _, budget := range []*kuperatorv1alpha1.DisruptionBudget{
+		newDisruptionBudget(&one, nil),
+		newDisruptionBudget(&half, nil),
+		newDisruptionBudget(nil, &one),
+		newDisruptionBudget(nil, &half),
+	} {
+		assert.True(t, handle(admissionv1.Create, budget).Allowed)
+		assert.True(t, handle(admissionv1.Update, budget).Allowed)
+	}
+
+	negative := intstr.FromInt(-1)
+	overflow := intstr.FromString("150%")
+	invalid := intstr.FromString("foo")
+	noSelector := newDisruptionBudget(&one, nil)
+	noSelector.Spec.Selector = nil
+	for name, budget := range map[string]*kuperatorv1alpha1.DisruptionBudget{
+		"neither":     newDisruptionBudget(nil, nil),
+		"both":        newDisruptionBudget(&one, &one),
+		"negative":    newDisruptionBudget(&negative, nil),
+		"overflow":    newDisruptionBudget(nil, &overflow),
+		"invalid":     newDisruptionBudget(&invalid, nil),
+		"no selector": noSelector,
+	} {
+		resp := handle(admissionv1.Create, budget)
+		assert.False(t, resp.Allowed, name)
+		assert.Equal(t, int32(http.StatusUnprocessableEntity), resp.Result.Code, name)
+	}
+
+	// deletion is always allowed
+	assert.True(t, handle(admissionv1.Delete, &kuperatorv1alpha1.DisruptionBudget{}).Allowed)
+}
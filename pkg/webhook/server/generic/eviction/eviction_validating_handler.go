@@ -0,0 +1,104 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eviction
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"kusionstack.io/kuperator/pkg/controllers/poddeletion"
+	"kusionstack.io/kuperator/pkg/controllers/utils/podopslifecycle"
+	"kusionstack.io/kuperator/pkg/utils/mixin"
+	"kusionstack.io/kuperator/pkg/webhook/server/generic/pod/gracedelete"
+)
+
+var _ inject.Client = &ValidatingHandler{}
+var _ admission.DecoderInjector = &ValidatingHandler{}
+
+// evictionRetryAfterSeconds is the retry hint returned to eviction clients, like kubectl drain,
+// while the delete lifecycle of pod is in progress
+var evictionRetryAfterSeconds int32 = 10
+
+// ValidatingHandler intercepts evictions of pods managed by PodOpsLifecycle. It begins the delete lifecycle
+// of the pod, and rejects the eviction with 429 until the lifecycle allows the pod to be deleted.
+type ValidatingHandler struct {
+	*mixin.WebhookHandlerMixin
+}
+
+func NewValidatingHandler() *ValidatingHandler {
+	return &ValidatingHandler{
+		WebhookHandlerMixin: mixin.NewWebhookHandlerMixin(),
+	}
+}
+
+func (h *ValidatingHandler) Handle(ctx context.Context, req admission.Request) (resp admission.Response) {
+	if req.Operation != admissionv1.Create {
+		return admission.Allowed("")
+	}
+
+	pod := &corev1.Pod{}
+	if err := h.Client.Get(ctx, types.NamespacedName{Namespace: req.Namespace, Name: req.Name}, pod); err != nil {
+		if errors.IsNotFound(err) {
+			return admission.Allowed("")
+		}
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	if pod.DeletionTimestamp != nil || !gracedelete.ShouldGraceDelete(pod) {
+		return admission.Allowed("")
+	}
+
+	// if pod is allowed to delete
+	if _, allowed := podopslifecycle.AllowOps(poddeletion.OpsLifecycleAdapter, 0, pod); allowed {
+		return admission.Allowed("")
+	}
+
+	if req.DryRun == nil || !*req.DryRun {
+		if err := gracedelete.BeginDeleteLifecycle(ctx, h.Client, pod); err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+	}
+
+	return tooManyRequests(fmt.Sprintf("pod eviction is deferred until the deletion process managed by PodOpsLifecycle allows, retry after %d seconds", evictionRetryAfterSeconds))
+}
+
+// tooManyRequests rejects the eviction with 429, which eviction clients take as retryable, like PodDisruptionBudget does.
+func tooManyRequests(msg string) admission.Response {
+	return admission.Response{
+		AdmissionResponse: admissionv1.AdmissionResponse{
+			Allowed: false,
+			Result: &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Code:    http.StatusTooManyRequests,
+				Reason:  metav1.StatusReasonTooManyRequests,
+				Message: msg,
+				Details: &metav1.StatusDetails{
+					RetryAfterSeconds: evictionRetryAfterSeconds,
+				},
+			},
+		},
+	}
+}
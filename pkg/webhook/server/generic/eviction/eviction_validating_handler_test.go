@@ -0,0 +1,113 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eviction
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/kubectl/pkg/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+)
+
+func TestEviction(t *testing.T) {
+	readinessGates := []corev1.PodReadinessGate{{ConditionType: appsv1alpha1.ReadinessGatePodServiceReady}}
+	managedPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "managed",
+			Labels: map[string]string{
+				kuperatorv1alpha1.PodOpsLifecycleEnabledLabelKey: "true",
+			},
+		},
+		Spec: corev1.PodSpec{ReadinessGates: readinessGates},
+	}
+	allowedPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "allowed",
+			Labels: map[string]string{
+				kuperatorv1alpha1.PodOpsLifecycleEnabledLabelKey:           "true",
+				"operating.podopslifecycle.kusionstack.io/pod-delete":      "1704865098763959176",
+				"operation-type.podopslifecycle.kusionstack.io/pod-delete": "delete",
+				"operate.podopslifecycle.kusionstack.io/pod-delete":        "1704865098763959176",
+			},
+		},
+		Spec: corev1.PodSpec{ReadinessGates: readinessGates},
+	}
+	unmanagedPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "unmanaged",
+		},
+		Spec: corev1.PodSpec{ReadinessGates: readinessGates},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(managedPod, allowedPod, unmanagedPod).Build()
+	h := NewValidatingHandler()
+	assert.Nil(t, h.InjectClient(c))
+
+	evict := func(name string, dryRun bool) admission.Response {
+		return h.Handle(context.Background(), admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Kind:        metav1.GroupVersionKind{Group: "policy", Version: "v1", Kind: "Eviction"},
+				SubResource: "eviction",
+				Namespace:   "default",
+				Name:        name,
+				Operation:   admissionv1.Create,
+				DryRun:      &dryRun,
+			},
+		})
+	}
+	hasDeletionLabel := func(name string) bool {
+		pod := &corev1.Pod{}
+		assert.Nil(t, c.Get(context.Background(), types.NamespacedName{Namespace: "default", Name: name}, pod))
+		_, exist := pod.Labels[appsv1alpha1.PodDeletionIndicationLabelKey]
+		return exist
+	}
+
+	// pods not managed by PodOpsLifecycle, or not existing, are evicted directly
+	assert.True(t, evict("unmanaged", false).Allowed)
+	assert.False(t, hasDeletionLabel("unmanaged"))
+	assert.True(t, evict("not-found", false).Allowed)
+
+	// dry-run eviction is rejected without beginning the delete lifecycle
+	resp := evict("managed", true)
+	assert.False(t, resp.Allowed)
+	assert.False(t, hasDeletionLabel("managed"))
+
+	// eviction begins the delete lifecycle, and is rejected with retry hint
+	resp = evict("managed", false)
+	assert.False(t, resp.Allowed)
+	assert.Equal(t, int32(http.StatusTooManyRequests), resp.Result.Code)
+	assert.Equal(t, metav1.StatusReasonTooManyRequests, resp.Result.Reason)
+	assert.Equal(t, evictionRetryAfterSeconds, resp.Result.Details.RetryAfterSeconds)
+	assert.True(t, hasDeletionLabel("managed"))
+
+	// eviction is allowed after the delete lifecycle allows
+	assert.True(t, evict("allowed", false).Allowed)
+}
@@ -20,9 +20,12 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	"kusionstack.io/kuperator/pkg/webhook/server/generic/collaset"
+	"kusionstack.io/kuperator/pkg/webhook/server/generic/disruptionbudget"
+	"kusionstack.io/kuperator/pkg/webhook/server/generic/eviction"
 	"kusionstack.io/kuperator/pkg/webhook/server/generic/operationjob"
 	"kusionstack.io/kuperator/pkg/webhook/server/generic/persistentvolumeclaim"
 	"kusionstack.io/kuperator/pkg/webhook/server/generic/poddecoration"
+	"kusionstack.io/kuperator/pkg/webhook/server/generic/resourcecontext"
 
 	webhookdmission "kusionstack.io/kuperator/pkg/webhook/admission"
 	"kusionstack.io/kuperator/pkg/webhook/server/generic/pod"
@@ -45,6 +48,8 @@ func init() {
 	MutatingTypeHandlerMap["Pod"] = podMutatingHandler
 	MutatingTypeHandlerMap["Pod/status"] = podMutatingHandler
 	ValidatingTypeHandlerMap["Pod"] = pod.NewValidatingHandler()
+	// evictions are requested as Eviction objects on pods/eviction subresource
+	ValidatingTypeHandlerMap["Eviction/eviction"] = eviction.NewValidatingHandler()
 
 	MutatingTypeHandlerMap["PodTransitionRule"] = podtransitionrule.NewMutatingHandler()
 	ValidatingTypeHandlerMap["PodTransitionRule"] = podtransitionrule.NewValidatingHandler()
@@ -60,4 +65,8 @@ func init() {
 
 	MutatingTypeHandlerMap["OperationJob"] = operationjob.NewMutatingHandler()
 	ValidatingTypeHandlerMap["OperationJob"] = operationjob.NewValidatingHandler()
+
+	ValidatingTypeHandlerMap["ResourceContext"] = resourcecontext.NewValidatingHandler()
+
+	ValidatingTypeHandlerMap["DisruptionBudget"] = disruptionbudget.NewValidatingHandler()
 }
@@ -31,6 +31,7 @@ import (
 
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
 	"kusionstack.io/kuperator/pkg/utils/mixin"
+	"kusionstack.io/kuperator/pkg/webhook/server/generic/utils"
 )
 
 var _ inject.Client = &ValidatingHandler{}
@@ -69,6 +70,7 @@ func (h *ValidatingHandler) Handle(ctx context.Context, req admission.Request) (
 	allErrors = append(allErrors, h.validatePartition(&obj, &old, fldPath)...)
 	allErrors = append(allErrors, h.validateTTLAndActiveDeadline(&obj, fldPath)...)
 	allErrors = append(allErrors, h.validateOpsTarget(&obj, &old, fldPath.Child("targets"))...)
+	allErrors = append(allErrors, utils.ValidateLifecycleHooks(&obj)...)
 	if len(allErrors) > 0 {
 		return admission.Errored(http.StatusBadRequest, allErrors.ToAggregate())
 	}
@@ -53,35 +53,60 @@ func (gd *GraceDelete) Name() string {
 }
 
 func (gd *GraceDelete) Validating(ctx context.Context, c client.Client, oldPod, newPod *corev1.Pod, operation admissionv1.Operation) error {
-	// GraceDeleteWebhook FeatureGate defaults to false
-	// Add '--feature-gates=GraceDeleteWebhook=true' to container args, to enable gracedelete webhook
-	if !feature.DefaultFeatureGate.Enabled(features.GraceDeleteWebhook) || operation != admissionv1.Delete || !utils.ControlledByKusionStack(oldPod) {
+	if operation != admissionv1.Delete || !ShouldGraceDelete(oldPod) {
 		return nil
 	}
 
-	// if has no service-ready ReadinessGate, skip gracedelete
-	hasReadinessGate := false
-	if oldPod.Spec.ReadinessGates != nil {
-		for _, readinessGate := range oldPod.Spec.ReadinessGates {
-			if readinessGate.ConditionType == v1alpha1.ReadinessGatePodServiceReady {
-				hasReadinessGate = true
-				break
-			}
+	// if pod is allowed to delete
+	if _, allowed := podopslifecycle.AllowOps(poddeletion.OpsLifecycleAdapter, 0, oldPod); allowed {
+		return nil
+	}
+
+	if err := BeginDeleteLifecycle(ctx, c, oldPod); err != nil {
+		return err
+	}
+
+	var finalizers []string
+	for _, f := range oldPod.Finalizers {
+		if strings.HasPrefix(f, v1alpha1.PodOperationProtectionFinalizerPrefix) {
+			finalizers = append(finalizers, f)
 		}
 	}
-	if !hasReadinessGate {
-		return nil
+
+	if len(finalizers) == 0 {
+		return fmt.Errorf("pod deletion process is underway and being managed by PodOpsLifecycle")
 	}
 
-	// if pod is allowed to delete
-	if _, allowed := podopslifecycle.AllowOps(poddeletion.OpsLifecycleAdapter, 0, oldPod); allowed {
-		return nil
+	return fmt.Errorf("pod deletion process is underway and being managed by PodOpsLifecycle with finalizers: %v", finalizers)
+}
+
+// ShouldGraceDelete returns true if the deletion of pod should be deferred until its delete lifecycle completes.
+func ShouldGraceDelete(pod *corev1.Pod) bool {
+	if !utils.OpsLifecycleEnabled(pod) {
+		return false
+	}
+	// GraceDeleteWebhook FeatureGate defaults to false
+	// Add '--feature-gates=GraceDeleteWebhook=true' to container args, to enable gracedelete webhook.
+	// Pods of native workloads opted in PodOpsLifecycle by label are always handled.
+	if !feature.DefaultFeatureGate.Enabled(features.GraceDeleteWebhook) && utils.ControlledByKusionStack(pod) {
+		return false
+	}
+
+	// if has no service-ready ReadinessGate, skip gracedelete
+	for _, readinessGate := range pod.Spec.ReadinessGates {
+		if readinessGate.ConditionType == v1alpha1.ReadinessGatePodServiceReady {
+			return true
+		}
 	}
+	return false
+}
 
-	// label pod to trigger poddeletion_controller reconcile
-	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+// BeginDeleteLifecycle labels pod to trigger poddeletion_controller reconcile, which begins the delete lifecycle
+// and deletes the pod after the lifecycle allows.
+func BeginDeleteLifecycle(ctx context.Context, c client.Client, pod *corev1.Pod) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
 		newPod := &corev1.Pod{}
-		err := c.Get(ctx, types.NamespacedName{Namespace: oldPod.Namespace, Name: oldPod.Name}, newPod)
+		err := c.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}, newPod)
 		if err != nil {
 			return err
 		}
@@ -108,23 +133,6 @@ func (gd *GraceDelete) Validating(ctx context.Context, c client.Client, oldPod,
 
 		return c.Update(ctx, newPod)
 	})
-
-	if err != nil {
-		return err
-	}
-
-	var finalizers []string
-	for _, f := range oldPod.Finalizers {
-		if strings.HasPrefix(f, v1alpha1.PodOperationProtectionFinalizerPrefix) {
-			finalizers = append(finalizers, f)
-		}
-	}
-
-	if len(finalizers) == 0 {
-		return fmt.Errorf("pod deletion process is underway and being managed by PodOpsLifecycle")
-	}
-
-	return fmt.Errorf("pod deletion process is underway and being managed by PodOpsLifecycle with finalizers: %v", finalizers)
 }
 
 func (gd *GraceDelete) Mutating(ctx context.Context, c client.Client, oldPod, newPod *corev1.Pod, operation admissionv1.Operation) error {
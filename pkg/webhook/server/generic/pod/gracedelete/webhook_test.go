@@ -27,6 +27,7 @@ import (
 	"kusionstack.io/kube-api/apps/v1alpha1"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 	"kusionstack.io/kuperator/pkg/utils/feature"
 
 	admissionv1 "k8s.io/api/admission/v1"
@@ -175,3 +176,49 @@ func TestGraceDelete(t *testing.T) {
 		}
 	}
 }
+
+func TestGraceDeleteOptedInPod(t *testing.T) {
+	runtime.Must(feature.DefaultMutableFeatureGate.Set("GraceDeleteWebhook=false"))
+	defer func() {
+		runtime.Must(feature.DefaultMutableFeatureGate.Set("GraceDeleteWebhook=true"))
+	}()
+
+	nativePod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "native",
+			Labels: map[string]string{
+				kuperatorv1alpha1.PodOpsLifecycleEnabledLabelKey: "true",
+			},
+		},
+		Spec: corev1.PodSpec{
+			ReadinessGates: []corev1.PodReadinessGate{{ConditionType: v1alpha1.ReadinessGatePodServiceReady}},
+		},
+	}
+	kusionStackPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "kusionstack",
+			Labels: map[string]string{
+				v1alpha1.ControlledByKusionStackLabelKey: "true",
+			},
+		},
+		Spec: corev1.PodSpec{
+			ReadinessGates: []corev1.PodReadinessGate{{ConditionType: v1alpha1.ReadinessGatePodServiceReady}},
+		},
+	}
+	client := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(nativePod, kusionStackPod).Build()
+	gd := New()
+
+	// deletion of pod opted in PodOpsLifecycle is handled regardless of feature gate
+	err := gd.Validating(context.Background(), client, nativePod, nil, admissionv1.Delete)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "pod deletion process is underway")
+	pod := &corev1.Pod{}
+	assert.Nil(t, client.Get(context.Background(), types.NamespacedName{Namespace: nativePod.Namespace, Name: nativePod.Name}, pod))
+	_, exist := pod.Labels[appsv1alpha1.PodDeletionIndicationLabelKey]
+	assert.True(t, exist)
+
+	// deletion of pod controlled by KusionStack is handled only with feature gate
+	assert.Nil(t, gd.Validating(context.Background(), client, kusionStackPod, nil, admissionv1.Delete))
+}
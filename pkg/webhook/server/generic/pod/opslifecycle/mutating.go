@@ -33,7 +33,7 @@ import (
 )
 
 func (lc *OpsLifecycle) Mutating(ctx context.Context, c client.Client, oldPod, newPod *corev1.Pod, operation admissionv1.Operation) error {
-	if !utils.ControlledByKusionStack(newPod) {
+	if !utils.OpsLifecycleEnabled(newPod) {
 		return nil
 	}
 
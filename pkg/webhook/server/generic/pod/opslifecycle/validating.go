@@ -32,7 +32,7 @@ import (
 )
 
 func (lc *OpsLifecycle) Validating(ctx context.Context, c client.Client, oldPod, newPod *corev1.Pod, operation admissionv1.Operation) (err error) {
-	if operation == admissionv1.Delete || !utils.ControlledByKusionStack(newPod) {
+	if operation == admissionv1.Delete || !utils.OpsLifecycleEnabled(newPod) {
 		return nil
 	}
 
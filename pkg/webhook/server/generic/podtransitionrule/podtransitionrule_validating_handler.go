@@ -25,15 +25,26 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"reflect"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+	"kusionstack.io/kuperator/pkg/controllers/podtransitionrule/processor/rules"
 	commonutils "kusionstack.io/kuperator/pkg/utils"
 	"kusionstack.io/kuperator/pkg/utils/mixin"
 )
@@ -71,9 +82,81 @@ func (h *ValidatingHandler) Handle(ctx context.Context, req admission.Request) (
 		logger.Error(err, "illegal PodTransitionRule")
 		return admission.Denied(err.Error())
 	}
+	cycle, err := h.findDependencyCycle(ctx, rs)
+	if err != nil {
+		logger.Error(err, "failed to find dependency cycle")
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if len(cycle) > 0 {
+		logger.Info("PodTransitionRules depend on each other", "cycle", cycle)
+		return admission.Denied(fmt.Sprintf("dependency cycle of PodTransitionRules: %s", strings.Join(cycle, " -> ")))
+	}
 	return admission.Allowed("")
 }
 
+// findDependencyCycle returns the PodTransitionRules depending on each other from rs, directly or indirectly,
+// which block pods of each other forever while their pods are operating.
+func (h *ValidatingHandler) findDependencyCycle(ctx context.Context, rs *appsv1alpha1.PodTransitionRule) ([]string, error) {
+	list := &appsv1alpha1.PodTransitionRuleList{}
+	if err := h.Client.List(ctx, list, client.InNamespace(rs.Namespace)); err != nil {
+		return nil, err
+	}
+	ruleSets := map[string]*appsv1alpha1.PodTransitionRule{rs.Name: rs}
+	for i := range list.Items {
+		if list.Items[i].Name != rs.Name {
+			ruleSets[list.Items[i].Name] = &list.Items[i]
+		}
+	}
+	names := sets.StringKeySet(ruleSets).List()
+
+	path := []string{rs.Name}
+	visited := sets.NewString(rs.Name)
+	var visit func(name string) bool
+	visit = func(name string) bool {
+		for _, dependent := range dependentPodTransitionRules(ruleSets[name], ruleSets, names) {
+			if dependent == rs.Name {
+				path = append(path, dependent)
+				return true
+			}
+			if visited.Has(dependent) {
+				continue
+			}
+			visited.Insert(dependent)
+			path = append(path, dependent)
+			if visit(dependent) {
+				return true
+			}
+			path = path[:len(path)-1]
+		}
+		return false
+	}
+	if visit(rs.Name) {
+		return path, nil
+	}
+	return nil, nil
+}
+
+// dependentPodTransitionRules returns names of other PodTransitionRules that rs depends on
+func dependentPodTransitionRules(rs *appsv1alpha1.PodTransitionRule, ruleSets map[string]*appsv1alpha1.PodTransitionRule, names []string) []string {
+	extensions, err := kuperatorv1alpha1.GetTransitionRuleExtensions(rs)
+	if err != nil {
+		return nil
+	}
+	var dependents []string
+	for _, name := range names {
+		if name == rs.Name {
+			continue
+		}
+		for _, extension := range extensions {
+			if extension.Dependency != nil && rules.IsDependentWorkload(extension.Dependency, kuperatorv1alpha1.DependentKindPodTransitionRule, ruleSets[name]) {
+				dependents = append(dependents, name)
+				break
+			}
+		}
+	}
+	return dependents
+}
+
 func (h *ValidatingHandler) validate(rs *appsv1alpha1.PodTransitionRule) error {
 	var errList field.ErrorList
 	fSpec := field.NewPath("spec")
@@ -98,9 +181,264 @@ func (h *ValidatingHandler) validate(rs *appsv1alpha1.PodTransitionRule) error {
 			errList = append(errList, field.Invalid(fRule.Child(rule.Name), nil, "minAvailableValue and maxUnavailableValue must have at least one configured"))
 		}
 	}
+	errList = append(errList, validateRuleExtensions(rs)...)
+	errList = append(errList, validateWebhookAuths(rs)...)
+	errList = append(errList, validateWebhookRetries(rs)...)
+	errList = append(errList, validateAuditedRules(rs)...)
+	errList = append(errList, validateStageTimeout(rs)...)
 	return errList.ToAggregate()
 }
 
+func validateStageTimeout(rs *appsv1alpha1.PodTransitionRule) field.ErrorList {
+	var errList field.ErrorList
+	fAnno := field.NewPath("metadata", "annotations").Key(kuperatorv1alpha1.PodTransitionRuleStageTimeoutAnnoKey)
+	timeout, err := kuperatorv1alpha1.GetTransitionRuleStageTimeout(rs)
+	if err == nil {
+		err = kuperatorv1alpha1.ValidateStageTimeout(timeout)
+	}
+	if err != nil {
+		errList = append(errList, field.Invalid(fAnno, rs.Annotations[kuperatorv1alpha1.PodTransitionRuleStageTimeoutAnnoKey], err.Error()))
+	}
+	return errList
+}
+
+func validateAuditedRules(rs *appsv1alpha1.PodTransitionRule) field.ErrorList {
+	var errList field.ErrorList
+	fAnno := field.NewPath("metadata", "annotations").Key(kuperatorv1alpha1.PodTransitionRuleAuditAnnoKey)
+	ruleNames := sets.NewString()
+	for _, rule := range rs.Spec.Rules {
+		ruleNames.Insert(rule.Name)
+	}
+	for _, name := range kuperatorv1alpha1.GetAuditedTransitionRules(rs) {
+		if name != kuperatorv1alpha1.AuditAllTransitionRules && !ruleNames.Has(name) {
+			errList = append(errList, field.Invalid(fAnno, name, "no rule found with the same name in spec.rules"))
+		}
+	}
+	return errList
+}
+
+func validateWebhookRetries(rs *appsv1alpha1.PodTransitionRule) field.ErrorList {
+	var errList field.ErrorList
+	fAnno := field.NewPath("metadata", "annotations").Key(kuperatorv1alpha1.PodTransitionRuleWebhookRetryAnnoKey)
+	retries, err := kuperatorv1alpha1.GetTransitionRuleWebhookRetries(rs)
+	if err != nil {
+		return append(errList, field.Invalid(fAnno, rs.Annotations[kuperatorv1alpha1.PodTransitionRuleWebhookRetryAnnoKey], err.Error()))
+	}
+
+	webhookRules := sets.NewString()
+	for _, rule := range rs.Spec.Rules {
+		if rule.Webhook != nil {
+			webhookRules.Insert(rule.Name)
+		}
+	}
+	for name, retry := range retries {
+		fRetry := fAnno.Child(name)
+		if !webhookRules.Has(name) {
+			errList = append(errList, field.Invalid(fRetry, name, "no webhook rule found with the same name in spec.rules"))
+			continue
+		}
+		if retry == nil {
+			continue
+		}
+		for key, value := range map[string]int32{
+			"failureThreshold":      retry.FailureThreshold,
+			"timeoutSeconds":        retry.TimeoutSeconds,
+			"initialBackoffSeconds": retry.InitialBackoffSeconds,
+			"maxBackoffSeconds":     retry.MaxBackoffSeconds,
+		} {
+			if value < 0 {
+				errList = append(errList, field.Invalid(fRetry.Child(key), value, "should not be negative"))
+			}
+		}
+		if retry.InitialBackoffSeconds > 0 && retry.MaxBackoffSeconds > 0 && retry.InitialBackoffSeconds > retry.MaxBackoffSeconds {
+			errList = append(errList, field.Invalid(fRetry.Child("maxBackoffSeconds"), retry.MaxBackoffSeconds, "should not be less than initialBackoffSeconds"))
+		}
+	}
+	return errList
+}
+
+func validateWebhookAuths(rs *appsv1alpha1.PodTransitionRule) field.ErrorList {
+	var errList field.ErrorList
+	fAnno := field.NewPath("metadata", "annotations").Key(kuperatorv1alpha1.PodTransitionRuleWebhookAuthAnnoKey)
+	auths, err := kuperatorv1alpha1.GetTransitionRuleWebhookAuths(rs)
+	if err != nil {
+		return append(errList, field.Invalid(fAnno, rs.Annotations[kuperatorv1alpha1.PodTransitionRuleWebhookAuthAnnoKey], err.Error()))
+	}
+
+	webhookRules := sets.NewString()
+	for _, rule := range rs.Spec.Rules {
+		if rule.Webhook != nil {
+			webhookRules.Insert(rule.Name)
+		}
+	}
+	for name, auth := range auths {
+		fAuth := fAnno.Child(name)
+		if !webhookRules.Has(name) {
+			errList = append(errList, field.Invalid(fAuth, name, "no webhook rule found with the same name in spec.rules"))
+			continue
+		}
+		if auth == nil {
+			errList = append(errList, field.Required(fAuth, "webhook auth is empty"))
+			continue
+		}
+		switch auth.Type {
+		case kuperatorv1alpha1.WebhookAuthBearerToken, kuperatorv1alpha1.WebhookAuthClientCertificate, kuperatorv1alpha1.WebhookAuthHMAC:
+		default:
+			errList = append(errList, field.NotSupported(fAuth.Child("type"), auth.Type, []string{
+				string(kuperatorv1alpha1.WebhookAuthBearerToken), string(kuperatorv1alpha1.WebhookAuthClientCertificate), string(kuperatorv1alpha1.WebhookAuthHMAC),
+			}))
+		}
+		if auth.SecretName == "" {
+			errList = append(errList, field.Required(fAuth.Child("secretName"), "secretName is required"))
+		}
+	}
+	return errList
+}
+
+func validateRuleExtensions(rs *appsv1alpha1.PodTransitionRule) field.ErrorList {
+	var errList field.ErrorList
+	fAnno := field.NewPath("metadata", "annotations").Key(kuperatorv1alpha1.PodTransitionRuleExtensionsAnnoKey)
+	extensions, err := kuperatorv1alpha1.GetTransitionRuleExtensions(rs)
+	if err != nil {
+		return append(errList, field.Invalid(fAnno, rs.Annotations[kuperatorv1alpha1.PodTransitionRuleExtensionsAnnoKey], err.Error()))
+	}
+
+	ruleDefs := map[string]*appsv1alpha1.TransitionRuleDefinition{}
+	for i := range rs.Spec.Rules {
+		ruleDefs[rs.Spec.Rules[i].Name] = &rs.Spec.Rules[i].TransitionRuleDefinition
+	}
+	for name, extension := range extensions {
+		fExt := fAnno.Child(name)
+		ruleDef, exist := ruleDefs[name]
+		if !exist {
+			errList = append(errList, field.Invalid(fExt, name, "no rule found with the same name in spec.rules"))
+			continue
+		}
+		if !reflect.DeepEqual(*ruleDef, appsv1alpha1.TransitionRuleDefinition{}) {
+			errList = append(errList, field.Invalid(fExt, name, "rule extension requires empty definition in spec.rules"))
+			continue
+		}
+		if extension == nil || reflect.DeepEqual(*extension, kuperatorv1alpha1.TransitionRuleExtension{}) {
+			errList = append(errList, field.Required(fExt, "rule extension is empty"))
+			continue
+		}
+		if count := rules.CountExtensionRules(extension); count != 1 {
+			errList = append(errList, field.Invalid(fExt, name, fmt.Sprintf("rule extension should define exactly one rule, got %d", count)))
+			continue
+		}
+		if extension.MetricsCheck != nil {
+			errList = append(errList, ValidateMetricsCheck(extension.MetricsCheck, fExt.Child("metricsCheck"))...)
+		}
+		if extension.TimeWindow != nil {
+			if err := rules.ValidateTimeWindow(extension.TimeWindow); err != nil {
+				errList = append(errList, field.Invalid(fExt.Child("timeWindow"), extension.TimeWindow, err.Error()))
+			}
+		}
+		if extension.RateLimit != nil {
+			if extension.RateLimit.Limit <= 0 {
+				errList = append(errList, field.Invalid(fExt.Child("rateLimit", "limit"), extension.RateLimit.Limit, "limit should be positive"))
+			}
+			if extension.RateLimit.Period.Duration <= 0 {
+				errList = append(errList, field.Invalid(fExt.Child("rateLimit", "period"), extension.RateLimit.Period, "period should be positive"))
+			}
+		}
+		if topology := extension.TopologyAvailable; topology != nil {
+			if errs := validation.IsQualifiedName(topology.TopologyKey); len(errs) > 0 {
+				errList = append(errList, field.Invalid(fExt.Child("topologyAvailable", "topologyKey"), topology.TopologyKey, strings.Join(errs, "; ")))
+			}
+			if topology.MaxUnavailableValue == nil && topology.MinAvailableValue == nil {
+				errList = append(errList, field.Invalid(fExt.Child("topologyAvailable"), nil, "minAvailableValue and maxUnavailableValue must have at least one configured"))
+			}
+		}
+		if extension.Dependency != nil {
+			errList = append(errList, ValidateDependency(rs, extension.Dependency, fExt.Child("dependency"))...)
+		}
+		if extension.Expression != nil {
+			if _, err := rules.CompileExpression(extension.Expression.Expression); err != nil {
+				errList = append(errList, field.Invalid(fExt.Child("expression", "expression"), extension.Expression.Expression, err.Error()))
+			}
+		}
+		if extension.DisruptionBudget != nil && extension.DisruptionBudget.Name == "" {
+			errList = append(errList, field.Required(fExt.Child("disruptionBudget", "name"), "name of DisruptionBudget is required"))
+		}
+	}
+	return errList
+}
+
+func ValidateDependency(rs *appsv1alpha1.PodTransitionRule, dependency *kuperatorv1alpha1.TransitionRuleDependency, f *field.Path) field.ErrorList {
+	var errList field.ErrorList
+	if len(dependency.Workloads) == 0 {
+		return append(errList, field.Required(f.Child("workloads"), "at least one dependent workload is required"))
+	}
+	for i, workload := range dependency.Workloads {
+		fWorkload := f.Child("workloads").Index(i)
+		switch workload.Kind {
+		case kuperatorv1alpha1.DependentKindCollaSet, kuperatorv1alpha1.DependentKindDeployment:
+		case kuperatorv1alpha1.DependentKindPodTransitionRule:
+			if workload.Name == rs.Name {
+				errList = append(errList, field.Invalid(fWorkload.Child("name"), workload.Name, "PodTransitionRule cannot depend on itself"))
+			}
+		default:
+			errList = append(errList, field.NotSupported(fWorkload.Child("kind"), workload.Kind, []string{
+				kuperatorv1alpha1.DependentKindCollaSet, kuperatorv1alpha1.DependentKindDeployment, kuperatorv1alpha1.DependentKindPodTransitionRule,
+			}))
+		}
+		if (workload.Name == "") == (workload.Selector == nil) {
+			errList = append(errList, field.Invalid(fWorkload, workload.Name, "exactly one of name and selector should be configured"))
+		} else if workload.Selector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(workload.Selector)
+			if err != nil {
+				errList = append(errList, field.Invalid(fWorkload.Child("selector"), workload.Selector, err.Error()))
+			} else if workload.Kind == kuperatorv1alpha1.DependentKindPodTransitionRule && selector.Matches(labels.Set(rs.Labels)) {
+				errList = append(errList, field.Invalid(fWorkload.Child("selector"), workload.Selector, "PodTransitionRule cannot depend on itself"))
+			}
+		}
+		if workload.MinReadyValue != nil {
+			if _, err := intstr.GetScaledValueFromIntOrPercent(workload.MinReadyValue, 100, true); err != nil {
+				errList = append(errList, field.Invalid(fWorkload.Child("minReadyValue"), workload.MinReadyValue.String(), err.Error()))
+			}
+		}
+	}
+	return errList
+}
+
+func ValidateMetricsCheck(metricsCheck *kuperatorv1alpha1.TransitionRuleMetricsCheck, f *field.Path) field.ErrorList {
+	var errList field.ErrorList
+	if u, err := url.Parse(metricsCheck.Address); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		errList = append(errList, field.Invalid(f.Child("address"), metricsCheck.Address, "invalid http or https url"))
+	}
+	if err := CheckCaBundle(metricsCheck.CABundle); err != nil {
+		errList = append(errList, field.Invalid(f.Child("caBundle"), metricsCheck.CABundle, err.Error()))
+	}
+	if metricsCheck.Query == "" {
+		errList = append(errList, field.Required(f.Child("query"), "query is required"))
+	} else if _, err := template.New("query").Parse(metricsCheck.Query); err != nil {
+		errList = append(errList, field.Invalid(f.Child("query"), metricsCheck.Query, err.Error()))
+	}
+	for i, parameter := range metricsCheck.Parameters {
+		if parameter.Key == "" || (parameter.Value == "" && (parameter.ValueFrom == nil || parameter.ValueFrom.FieldRef == nil)) {
+			errList = append(errList, field.Invalid(f.Child("parameters").Index(i), parameter.Key, "parameter requires key and value or valueFrom.fieldRef"))
+		}
+	}
+	switch metricsCheck.Operator {
+	case kuperatorv1alpha1.MetricsCheckOperatorLessThan, kuperatorv1alpha1.MetricsCheckOperatorLessThanEqual,
+		kuperatorv1alpha1.MetricsCheckOperatorGreaterThan, kuperatorv1alpha1.MetricsCheckOperatorGreaterThanEqual,
+		kuperatorv1alpha1.MetricsCheckOperatorEqual, kuperatorv1alpha1.MetricsCheckOperatorNotEqual:
+	default:
+		errList = append(errList, field.NotSupported(f.Child("operator"), metricsCheck.Operator, []string{"<", "<=", ">", ">=", "==", "!="}))
+	}
+	if _, err := strconv.ParseFloat(metricsCheck.Threshold, 64); err != nil {
+		errList = append(errList, field.Invalid(f.Child("threshold"), metricsCheck.Threshold, err.Error()))
+	}
+	switch metricsCheck.NoDataPolicy {
+	case "", kuperatorv1alpha1.MetricsCheckNoDataReject, kuperatorv1alpha1.MetricsCheckNoDataPass:
+	default:
+		errList = append(errList, field.NotSupported(f.Child("noDataPolicy"), metricsCheck.NoDataPolicy,
+			[]string{string(kuperatorv1alpha1.MetricsCheckNoDataReject), string(kuperatorv1alpha1.MetricsCheckNoDataPass)}))
+	}
+	return errList
+}
+
 func ValidateWebhook(webhook *appsv1alpha1.TransitionRuleWebhook, f *field.Path) *field.Error {
 
 	if err := CheckServerReachable(webhook.ClientConfig.URL); err != nil {
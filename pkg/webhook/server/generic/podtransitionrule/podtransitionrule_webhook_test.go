@@ -17,15 +17,19 @@
 package podtransitionrule
 
 import (
+	"context"
 	"testing"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
 )
 
 var _ = Describe("PodTransitionRule Validating", func() {
@@ -166,6 +170,167 @@ var _ = Describe("PodTransitionRule Validating", func() {
 		}
 		Expect(NewValidatingHandler().validate(rs)).Should(BeNil())
 	})
+	It("Validate MetricsCheck", func() {
+		rs.Spec = appsv1alpha1.PodTransitionRuleSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"test": "test"},
+			},
+			Rules: []appsv1alpha1.TransitionRule{
+				{
+					Name: "metrics",
+				},
+			},
+		}
+		rs.Annotations = map[string]string{
+			kuperatorv1alpha1.PodTransitionRuleExtensionsAnnoKey: `{"metrics": {"metricsCheck": {"address": "http://prometheus:9090", "query": "error_rate{shard=\"{{ .shard }}\"}", "operator": "~", "threshold": "0.01"}}}`,
+		}
+		Expect(NewValidatingHandler().validate(rs)).Should(HaveOccurred())
+		rs.Annotations = map[string]string{
+			kuperatorv1alpha1.PodTransitionRuleExtensionsAnnoKey: `{"metrics": {"metricsCheck": {"address": "http://prometheus:9090", "query": "error_rate{shard=\"{{ .shard }}\"}", "operator": "<", "threshold": "0.01"}}}`,
+		}
+		Expect(NewValidatingHandler().validate(rs)).Should(BeNil())
+		rs.Annotations = nil
+	})
+	It("Validate Expression", func() {
+		rs.Spec = appsv1alpha1.PodTransitionRuleSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"test": "test"},
+			},
+			Rules: []appsv1alpha1.TransitionRule{
+				{
+					Name: "expression",
+				},
+			},
+		}
+		rs.Annotations = map[string]string{
+			kuperatorv1alpha1.PodTransitionRuleExtensionsAnnoKey: `{"expression": {"expression": {"expression": "pod.status.containerStatuses.size() + 1"}}}`,
+		}
+		Expect(NewValidatingHandler().validate(rs)).Should(HaveOccurred())
+		rs.Annotations = map[string]string{
+			kuperatorv1alpha1.PodTransitionRuleExtensionsAnnoKey: `{"expression": {"expression": {"expression": "pod.status.containerStatuses.all(c, c.restartCount < 3) && !has(node.spec.unschedulable)"}}}`,
+		}
+		Expect(NewValidatingHandler().validate(rs)).Should(BeNil())
+		rs.Annotations = nil
+	})
+	It("Validate Rule Extension", func() {
+		rs.Spec = appsv1alpha1.PodTransitionRuleSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"test": "test"},
+			},
+			Rules: []appsv1alpha1.TransitionRule{
+				{
+					Name: "extension",
+				},
+			},
+		}
+		rs.Annotations = map[string]string{
+			kuperatorv1alpha1.PodTransitionRuleExtensionsAnnoKey: `{"extension": {"rateLimit": {"limit": 1, "period": "1m"}, "disruptionBudget": {"name": "foo"}}}`,
+		}
+		Expect(NewValidatingHandler().validate(rs)).Should(HaveOccurred())
+		rs.Annotations = map[string]string{
+			kuperatorv1alpha1.PodTransitionRuleExtensionsAnnoKey: `{"extension": {}}`,
+		}
+		Expect(NewValidatingHandler().validate(rs)).Should(HaveOccurred())
+		rs.Annotations = map[string]string{
+			kuperatorv1alpha1.PodTransitionRuleExtensionsAnnoKey: `{"extension": {"rateLimit": {"limit": 1, "period": "1m"}}}`,
+		}
+		Expect(NewValidatingHandler().validate(rs)).Should(BeNil())
+		rs.Annotations = nil
+	})
+	It("Validate Audit", func() {
+		rs.Spec = appsv1alpha1.PodTransitionRuleSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"test": "test"},
+			},
+			Rules: []appsv1alpha1.TransitionRule{
+				{
+					Name: "expression",
+				},
+			},
+		}
+		rs.Annotations = map[string]string{
+			kuperatorv1alpha1.PodTransitionRuleAuditAnnoKey: "expression, not-found",
+		}
+		Expect(NewValidatingHandler().validate(rs)).Should(HaveOccurred())
+		rs.Annotations = map[string]string{
+			kuperatorv1alpha1.PodTransitionRuleAuditAnnoKey: "expression",
+		}
+		Expect(NewValidatingHandler().validate(rs)).Should(BeNil())
+		rs.Annotations = map[string]string{
+			kuperatorv1alpha1.PodTransitionRuleAuditAnnoKey: kuperatorv1alpha1.AuditAllTransitionRules,
+		}
+		Expect(NewValidatingHandler().validate(rs)).Should(BeNil())
+		rs.Annotations = nil
+	})
+	It("Validate Stage Timeout", func() {
+		rs.Spec = appsv1alpha1.PodTransitionRuleSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"test": "test"},
+			},
+		}
+		rs.Annotations = map[string]string{
+			kuperatorv1alpha1.PodTransitionRuleStageTimeoutAnnoKey: `{"preparing": "30m", "action": "Skip"}`,
+		}
+		Expect(NewValidatingHandler().validate(rs)).Should(HaveOccurred())
+		rs.Annotations = map[string]string{
+			kuperatorv1alpha1.PodTransitionRuleStageTimeoutAnnoKey: `{"preparing": "-30m"}`,
+		}
+		Expect(NewValidatingHandler().validate(rs)).Should(HaveOccurred())
+		rs.Annotations = map[string]string{
+			kuperatorv1alpha1.PodTransitionRuleStageTimeoutAnnoKey: `{"preparing": "30m", "completing": "1h", "action": "ForcePass"}`,
+		}
+		Expect(NewValidatingHandler().validate(rs)).Should(BeNil())
+		rs.Annotations = nil
+	})
+	It("Validate Dependency", func() {
+		rs.Name = "a"
+		rs.Labels = map[string]string{"tier": "a"}
+		rs.Spec = appsv1alpha1.PodTransitionRuleSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"test": "test"},
+			},
+			Rules: []appsv1alpha1.TransitionRule{
+				{
+					Name: "dependency",
+				},
+			},
+		}
+		rs.Annotations = map[string]string{
+			kuperatorv1alpha1.PodTransitionRuleExtensionsAnnoKey: `{"dependency": {"dependency": {"workloads": [{"kind": "PodTransitionRule", "selector": {"matchLabels": {"tier": "a"}}}]}}}`,
+		}
+		Expect(NewValidatingHandler().validate(rs)).Should(HaveOccurred())
+		rs.Annotations = map[string]string{
+			kuperatorv1alpha1.PodTransitionRuleExtensionsAnnoKey: `{"dependency": {"dependency": {"workloads": [{"kind": "PodTransitionRule", "selector": {"matchLabels": {"tier": "b"}}}]}}}`,
+		}
+		Expect(NewValidatingHandler().validate(rs)).Should(BeNil())
+
+		// b depends on a by name, while a depends on b by selector
+		b := &appsv1alpha1.PodTransitionRule{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   "b",
+				Labels: map[string]string{"tier": "b"},
+				Annotations: map[string]string{
+					kuperatorv1alpha1.PodTransitionRuleExtensionsAnnoKey: `{"dependency": {"dependency": {"workloads": [{"kind": "PodTransitionRule", "name": "a"}]}}}`,
+				},
+			},
+		}
+		sch := runtime.NewScheme()
+		Expect(appsv1alpha1.AddToScheme(sch)).Should(BeNil())
+		h := NewValidatingHandler()
+		h.Client = fake.NewClientBuilder().WithScheme(sch).WithObjects(b).Build()
+		cycle, err := h.findDependencyCycle(context.TODO(), rs)
+		Expect(err).Should(BeNil())
+		Expect(cycle).Should(Equal([]string{"a", "b", "a"}))
+
+		b.Annotations = nil
+		Expect(h.Client.Update(context.TODO(), b)).Should(BeNil())
+		cycle, err = h.findDependencyCycle(context.TODO(), rs)
+		Expect(err).Should(BeNil())
+		Expect(cycle).Should(BeEmpty())
+		rs.Name = ""
+		rs.Labels = nil
+		rs.Annotations = nil
+	})
 	It("Mutating PodTransitionRule", func() {
 		rs.Spec = appsv1alpha1.PodTransitionRuleSpec{
 			Selector: &metav1.LabelSelector{
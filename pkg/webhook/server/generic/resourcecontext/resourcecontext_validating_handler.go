@@ -0,0 +1,70 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourcecontext
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	"sigs.k8s.io/controller-runtime/pkg/runtime/inject"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+
+	"kusionstack.io/kuperator/pkg/controllers/utils/resourcecontext"
+	"kusionstack.io/kuperator/pkg/utils/mixin"
+)
+
+var _ inject.Client = &ValidatingHandler{}
+var _ admission.DecoderInjector = &ValidatingHandler{}
+
+type ValidatingHandler struct {
+	*mixin.WebhookHandlerMixin
+}
+
+func NewValidatingHandler() *ValidatingHandler {
+	return &ValidatingHandler{
+		WebhookHandlerMixin: mixin.NewWebhookHandlerMixin(),
+	}
+}
+
+func (h *ValidatingHandler) Handle(ctx context.Context, req admission.Request) (resp admission.Response) {
+	if req.Operation == admissionv1.Delete {
+		return admission.Allowed("")
+	}
+
+	rc := &appsv1alpha1.ResourceContext{}
+	if err := h.Decoder.Decode(req, rc); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	var oldRc *appsv1alpha1.ResourceContext
+	if req.Operation == admissionv1.Update {
+		oldRc = &appsv1alpha1.ResourceContext{}
+		if err := h.Decoder.DecodeRaw(req.OldObject, oldRc); err != nil {
+			return admission.Errored(http.StatusBadRequest, fmt.Errorf("failed to unmarshal old object: %s", err))
+		}
+	}
+
+	warnings, err := resourcecontext.ValidateResourceContext(rc, oldRc)
+	if err != nil {
+		return admission.Errored(http.StatusUnprocessableEntity, err).WithWarnings(warnings...)
+	}
+	return admission.Allowed("").WithWarnings(warnings...)
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2024 The KusionStack Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourcecontext
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	appsv1alpha1 "kusionstack.io/kube-api/apps/v1alpha1"
+
+	"kusionstack.io/kuperator/pkg/controllers/utils/resourcecontext"
+)
+
+func newResourceContext(annotations map[string]string, owners map[int]string) *appsv1alpha1.ResourceContext {
+	rc := &appsv1alpha1.ResourceContext{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "default",
+			Name:        "foo",
+			Annotations: annotations,
+		},
+	}
+	for id, owner := range owners {
+		rc.Spec.Contexts = append(rc.Spec.Contexts, appsv1alpha1.ContextDetail{
+			ID:   id,
+			Data: map[string]string{resourcecontext.OwnerContextKey: owner},
+		})
+	}
+	return rc
+}
+
+func TestValidatingResourceContext(t *testing.T) {
+	scheme := runtime.NewScheme()
+	assert.Nil(t, appsv1alpha1.AddToScheme(scheme))
+	decoder, err := admission.NewDecoder(scheme)
+	assert.Nil(t, err)
+	h := NewValidatingHandler()
+	assert.Nil(t, h.InjectDecoder(decoder))
+
+	handle := func(operation admissionv1.Operation, rc, oldRc *appsv1alpha1.ResourceContext) admission.Response {
+		req := admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: operation,
+				Namespace: rc.Namespace,
+				Name:      rc.Name,
+			},
+		}
+		raw, err := json.Marshal(rc)
+		assert.Nil(t, err)
+		req.Object.Raw = raw
+		if oldRc != nil {
+			raw, err := json.Marshal(oldRc)
+			assert.Nil(t, err)
+			req.OldObject.Raw = raw
+		}
+		return h.Handle(context.TODO(), req)
+	}
+
+	// policy without IDs is allowed, so that ResourceContext can be created ahead of owners
+	rc := newResourceContext(map[string]string{
+		resourcecontext.ReservedIDsAnnoKey:    `{"foo": "0-4"}`,
+		resourcecontext.BlacklistedIDsAnnoKey: "5",
+		resourcecontext.IDReusePolicyAnnoKey:  string(resourcecontext.ReleasedLastIDReusePolicy),
+	}, nil)
+	assert.True(t, handle(admissionv1.Create, rc, nil).Allowed)
+
+	// invalid policy annotations are rejected
+	for key, value := range map[string]string{
+		resourcecontext.ReservedIDsAnnoKey:            `{"foo": "0-4", "bar": "4"}`,
+		resourcecontext.BlacklistedIDsAnnoKey:         "5-3",
+		resourcecontext.IDReusePolicyAnnoKey:          "Random",
+		resourcecontext.ReleasedIDHistoryLimitAnnoKey: "-1",
+	} {
+		resp := handle(admissionv1.Create, newResourceContext(map[string]string{key: value}, nil), nil)
+		assert.False(t, resp.Allowed, "annotation %s=%s", key, value)
+		assert.Equal(t, int32(http.StatusUnprocessableEntity), resp.Result.Code)
+	}
+
+	// IDs newly assigned must follow the policy
+	old := newResourceContext(rc.Annotations, map[int]string{0: "foo"})
+	resp := handle(admissionv1.Update, newResourceContext(rc.Annotations, map[int]string{0: "foo", 1: "bar"}), old)
+	assert.False(t, resp.Allowed)
+	resp = handle(admissionv1.Update, newResourceContext(rc.Annotations, map[int]string{0: "foo", 5: "bar"}), old)
+	assert.False(t, resp.Allowed)
+	resp = handle(admissionv1.Update, newResourceContext(rc.Annotations, map[int]string{0: "foo", 6: "bar"}), old)
+	assert.True(t, resp.Allowed)
+
+	// IDs held before blacklisted are kept
+	blacklisted := newResourceContext(map[string]string{resourcecontext.BlacklistedIDsAnnoKey: "0"}, map[int]string{0: "foo"})
+	assert.True(t, handle(admissionv1.Update, blacklisted, old).Allowed)
+
+	// IDs leased through library are held by owners in the format of <kind>/<name>
+	resp = handle(admissionv1.Update, newResourceContext(rc.Annotations, map[int]string{0: "foo", 6: "Job/bar"}), old)
+	assert.True(t, resp.Allowed)
+	resp = handle(admissionv1.Update, newResourceContext(rc.Annotations, map[int]string{0: "foo", 6: "batch/Job/bar"}), old)
+	assert.False(t, resp.Allowed)
+
+	// controllers can still update ResourceContext with invalid policy, which is reported as warning
+	invalid := map[string]string{resourcecontext.IDReusePolicyAnnoKey: "Random"}
+	resp = handle(admissionv1.Update, newResourceContext(invalid, nil), newResourceContext(invalid, map[int]string{0: "foo"}))
+	assert.True(t, resp.Allowed)
+	assert.Equal(t, 1, len(resp.Warnings))
+	resp = handle(admissionv1.Update, newResourceContext(invalid, map[int]string{0: "foo"}), newResourceContext(nil, map[int]string{0: "foo"}))
+	assert.False(t, resp.Allowed)
+
+	// deletion is always allowed
+	assert.True(t, handle(admissionv1.Delete, &appsv1alpha1.ResourceContext{}, nil).Allowed)
+}
@@ -16,7 +16,13 @@
 
 package utils
 
-import corevalidation "k8s.io/kubernetes/pkg/apis/core/validation"
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	corevalidation "k8s.io/kubernetes/pkg/apis/core/validation"
+
+	kuperatorv1alpha1 "kusionstack.io/kuperator/apis/apps/v1alpha1"
+)
 
 var (
 	PodValidationOptions = corevalidation.PodValidationOptions{
@@ -27,3 +33,20 @@ var (
 		AllowExpandedDNSConfig:          true,
 	}
 )
+
+// ValidateLifecycleHooks validates PodOpsLifecycle hooks annotated on CollaSet or OperationJob
+func ValidateLifecycleHooks(obj metav1.Object) field.ErrorList {
+	value, ok := obj.GetAnnotations()[kuperatorv1alpha1.PodOpsLifecycleHooksAnnoKey]
+	if !ok {
+		return nil
+	}
+	fldPath := field.NewPath("metadata", "annotations").Key(kuperatorv1alpha1.PodOpsLifecycleHooksAnnoKey)
+	hooks, err := kuperatorv1alpha1.ParseLifecycleHooks(value)
+	if err == nil {
+		err = kuperatorv1alpha1.ValidateLifecycleHooks(hooks)
+	}
+	if err != nil {
+		return field.ErrorList{field.Invalid(fldPath, value, err.Error())}
+	}
+	return nil
+}